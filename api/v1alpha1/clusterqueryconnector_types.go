@@ -25,6 +25,10 @@ import (
 // +kubebuilder:resource:scope=Cluster
 // +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"ResourceSynced\")].status",description=""
 // +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type==\"State\")].reason",description=""
+// +kubebuilder:printcolumn:name="Distribution",type="string",JSONPath=".status.distribution",description=""
+// +kubebuilder:printcolumn:name="Version",type="string",JSONPath=".status.version",description=""
+// +kubebuilder:printcolumn:name="Reachable",type="string",JSONPath=".status.conditions[?(@.type==\"Reachable\")].status",description=""
+// +kubebuilder:printcolumn:name="Health",type="string",JSONPath=".status.health",description=""
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description=""
 
 // ClusterQueryConnector is the Schema for the clusterqueryconnectors API.
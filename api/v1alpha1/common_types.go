@@ -7,3 +7,29 @@ type SecretRef struct {
 	KeyUsername string `json:"keyUsername"`
 	KeyPassword string `json:"keyPassword"`
 }
+
+// SecretKeyRef points to a single key of a Secret. When Namespace is empty,
+// the namespace of the resource holding the reference is used.
+type SecretKeyRef struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Key       string `json:"key"`
+}
+
+// CABundleRef points to a PEM bundle of CA certificates stored in a Secret or
+// a ConfigMap. The certificates are trusted in addition to the ones of the
+// system. When Namespace is empty, the namespace of the resource holding the
+// reference is used.
+type CABundleRef struct {
+	// Kind of the object holding the bundle.
+	// +kubebuilder:validation:Enum=Secret;ConfigMap
+	// +kubebuilder:default=Secret
+	Kind string `json:"kind,omitempty"`
+
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+
+	// Key of the bundle in the object.
+	// +kubebuilder:default="ca.crt"
+	Key string `json:"key,omitempty"`
+}
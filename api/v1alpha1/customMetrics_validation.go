@@ -24,8 +24,12 @@ var promIdentifierRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
 // `searchrule_<Name>` resolves to one of these is rejected to avoid
 // shadowing the legacy series.
 var reservedMetricNames = map[string]struct{}{
-	"searchrule_value": {},
-	"searchrule_state": {},
+	"searchrule_value":               {},
+	"searchrule_state":               {},
+	"searchrule_baseline_value":      {},
+	"searchrule_change":              {},
+	"searchrule_anomaly_lower_bound": {},
+	"searchrule_anomaly_upper_bound": {},
 }
 
 // reservedLabelNames are the labels the operator emits implicitly on every
@@ -36,6 +40,12 @@ var reservedLabelNames = map[string]struct{}{
 	"rule":                 {},
 }
 
+// IsValidLabelName tells whether name is a valid Prometheus label name, as
+// required from the labels extracted from buckets.
+func IsValidLabelName(name string) bool {
+	return promIdentifierRe.MatchString(name)
+}
+
 // ValidateCustomMetricName returns nil iff name is a valid suffix for a
 // `searchrule_<name>` Prometheus metric and does not collide with the
 // operator's reserved gauges. Lives in the API package so any consumer
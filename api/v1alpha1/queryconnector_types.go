@@ -39,25 +39,231 @@ type CertificatesSecretRef struct {
 	KeyKey    string `json:"keyKey"`
 }
 
+// SigV4SecretRef points to the Secret holding the AWS credentials used to
+// sign the requests. KeySessionToken is only needed for temporary credentials.
+type SigV4SecretRef struct {
+	Name               string `json:"name"`
+	Namespace          string `json:"namespace,omitempty"`
+	KeyAccessKeyID     string `json:"keyAccessKeyID"`
+	KeySecretAccessKey string `json:"keySecretAccessKey"`
+	KeySessionToken    string `json:"keySessionToken,omitempty"`
+}
+
+// SigV4Auth signs every request with AWS Signature Version 4, as required by
+// Amazon OpenSearch Service domains and OpenSearch Serverless collections.
+type SigV4Auth struct {
+	// Region of the domain or collection, e.g. `eu-west-1`.
+	Region string `json:"region"`
+
+	// Service is the signing name: `es` for managed domains, `aoss` for
+	// OpenSearch Serverless. Defaults to `es`.
+	// +kubebuilder:validation:Enum=es;aoss
+	Service string `json:"service,omitempty"`
+
+	SecretRef SigV4SecretRef `json:"secretRef"`
+}
+
+// QueryConnectorAuth selects how requests to the connector are authenticated.
+// Exactly one mode must be set.
+// +kubebuilder:validation:MinProperties=1
+// +kubebuilder:validation:MaxProperties=1
+type QueryConnectorAuth struct {
+	// Basic sends the username and password of the Secret as HTTP basic auth.
+	Basic *QueryConnectorCredentials `json:"basic,omitempty"`
+
+	// APIKey sends the key as `Authorization: ApiKey <key>`. For Elasticsearch
+	// the key is the base64 encoded `id:api_key` returned on its creation.
+	APIKey *SecretKeyRef `json:"apiKey,omitempty"`
+
+	// Bearer sends the token as `Authorization: Bearer <token>`.
+	Bearer *SecretKeyRef `json:"bearer,omitempty"`
+
+	// SigV4 signs the requests with AWS credentials.
+	SigV4 *SigV4Auth `json:"sigv4,omitempty"`
+}
+
+// LoadBalancing configures how requests are spread across the endpoints of a
+// QueryConnector and when a failing endpoint stops receiving them.
+type LoadBalancing struct {
+	// Strategy picks the endpoint of each request. `failover` always uses the
+	// first healthy endpoint in order; `roundRobin` rotates across all of them.
+	// +kubebuilder:validation:Enum=failover;roundRobin
+	// +kubebuilder:default=failover
+	Strategy string `json:"strategy,omitempty"`
+
+	// MaxFailures is the number of consecutive failed requests after which an
+	// endpoint is ejected.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=3
+	MaxFailures int32 `json:"maxFailures,omitempty"`
+
+	// EjectionTime is how long an ejected endpoint is skipped before it is
+	// tried again.
+	// +kubebuilder:default="30s"
+	EjectionTime string `json:"ejectionTime,omitempty"`
+
+	// Sniff discovers the HTTP address of every node of the cluster through
+	// `_nodes/http` and adds them to the endpoints. Only for Elasticsearch
+	// compatible clusters reachable directly, not behind a load balancer.
+	Sniff bool `json:"sniff,omitempty"`
+
+	// SniffInterval is how often the nodes are discovered again.
+	// +kubebuilder:default="5m"
+	SniffInterval string `json:"sniffInterval,omitempty"`
+}
+
+// QueryLimits bounds the queries sent to the connector by all the SearchRules
+// using it. Queries over the limits wait for their turn up to MaxQueueTime.
+type QueryLimits struct {
+	// MaxConcurrentQueries is the number of queries running at the same time.
+	// +kubebuilder:validation:Minimum=1
+	MaxConcurrentQueries int32 `json:"maxConcurrentQueries,omitempty"`
+
+	// QueriesPerSecond is the sustained rate of queries.
+	// +kubebuilder:validation:Minimum=1
+	QueriesPerSecond int32 `json:"queriesPerSecond,omitempty"`
+
+	// Burst is the number of queries allowed at once over QueriesPerSecond.
+	// Defaults to QueriesPerSecond.
+	// +kubebuilder:validation:Minimum=1
+	Burst int32 `json:"burst,omitempty"`
+
+	// MaxQueueTime is how long a query waits for its turn before it is
+	// rejected and the SearchRule reports it as Throttled.
+	// +kubebuilder:default="10s"
+	MaxQueueTime string `json:"maxQueueTime,omitempty"`
+}
+
+// QueryBatching coalesces the Elasticsearch queries of the SearchRules using
+// the connector into `_msearch` requests. When a rule is evaluated, the rules
+// due within Window are evaluated in the same request.
+type QueryBatching struct {
+	// Window is how early a rule may be evaluated to join the batch of
+	// another one.
+	// +kubebuilder:default="5s"
+	Window string `json:"window,omitempty"`
+
+	// MaxSize is the maximum number of queries of a `_msearch` request.
+	// +kubebuilder:validation:Minimum=2
+	// +kubebuilder:default=50
+	MaxSize int32 `json:"maxSize,omitempty"`
+}
+
+// RequestPolicy bounds how long a query may take and how failed queries are
+// retried. Set on a QueryConnector it applies to all the SearchRules using it,
+// and a SearchRule can override any of its fields.
+type RequestPolicy struct {
+	// Timeout of each attempt of a query. Elasticsearch compatible clusters
+	// are also given it as the `timeout` of the search, so they stop it too.
+	// Defaults to 60s.
+	Timeout string `json:"timeout,omitempty"`
+
+	// Retries is the number of times a query is sent again when the
+	// connection is reset or the cluster answers 429, 502, 503 or 504.
+	// Defaults to 0.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=10
+	Retries *int32 `json:"retries,omitempty"`
+
+	// Backoff is the wait between attempts.
+	Backoff *RequestBackoff `json:"backoff,omitempty"`
+}
+
+// RequestBackoff is an exponential backoff with jitter: the wait before each
+// retry doubles from InitialInterval up to MaxInterval, and a random part of
+// it is dropped so the retries of many SearchRules do not happen at once.
+type RequestBackoff struct {
+	// InitialInterval is the wait before the first retry. Defaults to 500ms.
+	InitialInterval string `json:"initialInterval,omitempty"`
+
+	// MaxInterval caps the wait between retries. Defaults to 10s.
+	MaxInterval string `json:"maxInterval,omitempty"`
+}
+
 // QueryConnectorSpec defines the desired state of QueryConnector.
 type QueryConnectorSpec struct {
+	// Type is the query engine behind URL. When empty or `auto`, the operator
+	// probes the root endpoint of an Elasticsearch compatible cluster and uses
+	// the detected distribution to shape the requests of the SearchRules.
+	// `loki`, `prometheus` and `clickhouse` select the other query backends;
+	// SearchRules using them must define the matching query block.
+	// +kubebuilder:validation:Enum=auto;elasticsearch;opensearch;loki;prometheus;clickhouse
+	Type string `json:"type,omitempty"`
+
 	URL           string                     `json:"url"`
 	Headers       map[string]string          `json:"headers,omitempty"`
 	TlsSkipVerify bool                       `json:"tlsSkipVerify,omitempty"`
 	Credentials   QueryConnectorCredentials  `json:"credentials,omitempty"`
 	SyncInterval  string                     `json:"syncInterval,omitempty"`
 	Certificates  QueryConnectorCertificates `json:"certificates,omitempty"`
+
+	// URLs are more endpoints of the same cluster. Requests are sent to URL
+	// and URLs as configured in LoadBalancing.
+	URLs []string `json:"urls,omitempty"`
+
+	// LoadBalancing configures how requests are spread across the endpoints.
+	LoadBalancing *LoadBalancing `json:"loadBalancing,omitempty"`
+
+	// Limits bounds the queries SearchRules send to the connector.
+	Limits *QueryLimits `json:"limits,omitempty"`
+
+	// Batching coalesces the queries of the SearchRules into `_msearch`
+	// requests. Only for Elasticsearch compatible clusters.
+	Batching *QueryBatching `json:"batching,omitempty"`
+
+	// RequestPolicy sets the timeout and retries of the queries.
+	RequestPolicy *RequestPolicy `json:"requestPolicy,omitempty"`
+
+	// ProxyURL is the HTTP proxy the requests go through, e.g.
+	// `http://proxy.internal:3128`. Without it the connector is reached directly.
+	ProxyURL string `json:"proxyURL,omitempty"`
+
+	// NoProxy lists the hosts reached without the proxy, as the NO_PROXY
+	// environment variable does: hostnames, domains such as `.svc`, IPs and
+	// CIDRs, optionally with a port.
+	NoProxy []string `json:"noProxy,omitempty"`
+
+	// CABundle is the CA the cluster certificates are signed by, when it is
+	// not one of the system. Unlike Certificates, it needs no client
+	// certificate.
+	CABundle *CABundleRef `json:"caBundle,omitempty"`
+
+	// Auth selects the authentication mode of the requests. It replaces
+	// Credentials, which is kept for basic auth, so only one of both can be set.
+	Auth *QueryConnectorAuth `json:"auth,omitempty"`
 }
 
 // QueryConnectorStatus defines the observed state of QueryConnector.
 type QueryConnectorStatus struct {
 	Conditions []metav1.Condition `json:"conditions"`
+
+	// Distribution is the search engine flavor reported by the root endpoint
+	// on the last probe: `elasticsearch` or `opensearch`.
+	Distribution string `json:"distribution,omitempty"`
+
+	// Version is the version number reported by the root endpoint on the
+	// last probe.
+	Version string `json:"version,omitempty"`
+
+	// ClusterName is the name of the cluster reported on the last probe.
+	ClusterName string `json:"clusterName,omitempty"`
+
+	// Health is the color reported by `_cluster/health` on the last probe:
+	// `green`, `yellow` or `red`. Empty when it could not be read.
+	Health string `json:"health,omitempty"`
+
+	// LatencyMilliseconds is the round trip of the last probe.
+	LatencyMilliseconds int64 `json:"latencyMilliseconds,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"ResourceSynced\")].status",description=""
 // +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type==\"State\")].reason",description=""
+// +kubebuilder:printcolumn:name="Distribution",type="string",JSONPath=".status.distribution",description=""
+// +kubebuilder:printcolumn:name="Version",type="string",JSONPath=".status.version",description=""
+// +kubebuilder:printcolumn:name="Reachable",type="string",JSONPath=".status.conditions[?(@.type==\"Reachable\")].status",description=""
+// +kubebuilder:printcolumn:name="Health",type="string",JSONPath=".status.health",description=""
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description=""
 
 // QueryConnector is the Schema for the queryconnectors API.
@@ -33,6 +33,17 @@ type Webhook struct {
 	TlsSkipVerify bool                   `json:"tlsSkipVerify,omitempty"`
 	Validator     string                 `json:"validator,omitempty"`
 	Credentials   RulerActionCredentials `json:"credentials,omitempty"`
+
+	// ProxyURL is the HTTP proxy the webhook is called through.
+	ProxyURL string `json:"proxyURL,omitempty"`
+
+	// NoProxy lists the hosts reached without the proxy, with the syntax of
+	// the NO_PROXY environment variable.
+	NoProxy []string `json:"noProxy,omitempty"`
+
+	// CABundle is the CA the certificate of the webhook is signed by, when it
+	// is not one of the system.
+	CABundle *CABundleRef `json:"caBundle,omitempty"`
 }
 
 // RulerActionSpec defines the desired state of RulerAction.
@@ -23,19 +23,246 @@ import (
 
 // Elasticsearch TODO
 type Elasticsearch struct {
-	Index string `json:"index"`
+	Index string `json:"index,omitempty"`
 
 	ConditionField string `json:"conditionField"`
 
 	QueryJSON string                `json:"queryJSON,omitempty"`
 	Query     *apiextensionsv1.JSON `json:"query,omitempty"`
+
+	// SQL is a SQL statement sent to the SQL endpoint of the cluster instead
+	// of a Query DSL search. The endpoint depends on the distribution of the
+	// QueryConnector (`_sql` on Elasticsearch, `_plugins/_sql` on OpenSearch).
+	SQL string `json:"sql,omitempty"`
+
+	// PPL is a Piped Processing Language query sent to `_plugins/_ppl`.
+	// Only available on OpenSearch clusters.
+	PPL string `json:"ppl,omitempty"`
+}
+
+// Loki defines a LogQL query executed as an instant query against the
+// `/loki/api/v1/query` endpoint of a QueryConnector of type `loki`. The
+// query must return a number, so it is usually a metric query such as
+// `sum(count_over_time({app="api"} |= "error" [5m]))`.
+type Loki struct {
+	Query string `json:"query"`
+
+	// ConditionField is a gjson path in the response used as the value of
+	// the rule. Defaults to `data.result.0.value.1`, the value of the first
+	// sample of the resulting vector.
+	ConditionField string `json:"conditionField,omitempty"`
+}
+
+// Prometheus defines a PromQL instant query executed against the
+// `/api/v1/query` endpoint of a QueryConnector of type `prometheus`.
+type Prometheus struct {
+	Query string `json:"query"`
+
+	// ConditionField is a gjson path in the response used as the value of
+	// the rule. Defaults to `data.result.0.value.1`, the value of the first
+	// sample of the resulting vector.
+	ConditionField string `json:"conditionField,omitempty"`
+}
+
+// ClickHouse defines a SQL query executed through the HTTP interface of a
+// QueryConnector of type `clickhouse`. Results are requested in the JSON
+// format, so every row is an object keyed by column name under `data`.
+type ClickHouse struct {
+	Query string `json:"query"`
+
+	// Database the query runs in. Defaults to the database of the user.
+	Database string `json:"database,omitempty"`
+
+	// ConditionField is a gjson path in the response used as the value of
+	// the rule, e.g. `data.0.errors`. Defaults to the first column of the
+	// first row.
+	ConditionField string `json:"conditionField,omitempty"`
 }
 
 // Condition TODO
 type Condition struct {
-	Operator  string `json:"operator"`
-	Threshold string `json:"threshold"`
+	Operator  string `json:"operator,omitempty"`
+	Threshold string `json:"threshold,omitempty"`
 	For       string `json:"for"`
+
+	// LowerThreshold and UpperThreshold are the bounds of the `between` and
+	// `outside` operators, both included in the range.
+	LowerThreshold string `json:"lowerThreshold,omitempty"`
+	UpperThreshold string `json:"upperThreshold,omitempty"`
+
+	// ResolveThreshold replaces Threshold once the rule is firing, so it only
+	// resolves after crossing it, e.g. fires over 100 but resolves under 80.
+	// Values hovering around the threshold do not flap the alert this way.
+	ResolveThreshold string `json:"resolveThreshold,omitempty"`
+
+	// All, Any and Not replace operator and threshold with a tree of
+	// conditions, so several fields of the same response can be checked,
+	// e.g. an error count over 100 AND an error ratio over 5%. Only one of
+	// operator, all, any, not and expression can be set.
+	All []ConditionNode `json:"all,omitempty"`
+	Any []ConditionNode `json:"any,omitempty"`
+	Not *ConditionNode  `json:"not,omitempty"`
+
+	// Expression is a CEL expression returning a bool, evaluated with the
+	// parsed response of the query as `response` and the value of the rule
+	// as `value`, e.g.
+	// `response.aggregations.errors.doc_count / response.hits.total.value > 0.05`.
+	Expression string `json:"expression,omitempty"`
+
+	// Severities are levels ordered from the least to the most severe, each
+	// one with its own thresholds and `for` compared with the operator of the
+	// condition. The rule fires at the most severe level matched during its
+	// `for`, and notifies every change of level.
+	// +kubebuilder:validation:MaxItems=10
+	Severities []SeverityLevel `json:"severities,omitempty"`
+
+	// Buckets evaluates the condition on every bucket of an aggregation
+	// instead of once for the rule, e.g. the error rate of each service of a
+	// `terms` aggregation. Every bucket keeps its own state and fires and
+	// resolves its own alert, labeled with the fields of the bucket.
+	Buckets *ConditionBuckets `json:"buckets,omitempty"`
+
+	// Comparison compares the value of the query with the one of a baseline
+	// window, e.g. the same hour last week, and evaluates the condition on
+	// the change between them instead of on the value.
+	Comparison *Comparison `json:"comparison,omitempty"`
+
+	// Anomaly replaces operator and threshold with bounds learned from the
+	// past values of the rule, so it fires on values unusual for the rule
+	// rather than over a fixed threshold.
+	Anomaly *AnomalyDetection `json:"anomaly,omitempty"`
+}
+
+// AnomalyDetection fires a condition when the value of the rule deviates
+// from the mean of its past values by more than Sigmas standard deviations.
+// The history is kept in memory by the operator, one sample per evaluation.
+type AnomalyDetection struct {
+	// Method computes the mean and the standard deviation: `zscore` over
+	// the last Samples values, or `ewma` as exponentially weighted moving
+	// averages, giving the recent values more weight.
+	// +kubebuilder:validation:Enum=zscore;ewma
+	// +kubebuilder:default=zscore
+	Method string `json:"method,omitempty"`
+
+	// Sigmas is how many standard deviations away from the mean a value is
+	// anomalous. Defaults to 3.
+	Sigmas string `json:"sigmas,omitempty"`
+
+	// Direction of the deviations firing the condition: `above` the upper
+	// bound, `below` the lower one, or `both`.
+	// +kubebuilder:validation:Enum=both;above;below
+	// +kubebuilder:default=both
+	Direction string `json:"direction,omitempty"`
+
+	// Samples is the number of past values of the `zscore` method.
+	// +kubebuilder:validation:Minimum=2
+	// +kubebuilder:validation:Maximum=10000
+	// +kubebuilder:default=60
+	Samples int32 `json:"samples,omitempty"`
+
+	// Alpha is the weight of the last value in the averages of the `ewma`
+	// method, between 0 and 1. Defaults to 0.1.
+	Alpha string `json:"alpha,omitempty"`
+
+	// WarmUp is the number of values to learn from before the condition
+	// can fire. Defaults to Samples.
+	// +kubebuilder:validation:Minimum=2
+	WarmUp int32 `json:"warmUp,omitempty"`
+}
+
+// Comparison runs the query of a rule twice on every evaluation: for the
+// current window and for a baseline window shifted back by Offset. The
+// queries of Elasticsearch, OpenSearch and ClickHouse must bound their time
+// range with the templated `{{ .from }}` and `{{ .to }}` of the window, while
+// Prometheus and Loki queries are evaluated at the end of the window.
+type Comparison struct {
+	// Offset shifts the baseline window back from the current one, e.g.
+	// `168h` for the same time last week.
+	Offset string `json:"offset"`
+
+	// Window is the length of the windows. Defaults to the checkInterval.
+	Window string `json:"window,omitempty"`
+
+	// Change is what the condition compares: the `absolute` difference
+	// between the current and the baseline values, its `percent` of the
+	// baseline, or the `ratio` of the current value to the baseline.
+	// +kubebuilder:validation:Enum=absolute;percent;ratio
+	// +kubebuilder:default=percent
+	Change string `json:"change,omitempty"`
+}
+
+// ConditionBuckets points a Condition at an array of buckets, like the
+// aggregation_map of a CustomMetric. The operator and thresholds compare
+// the Value of each bucket, and the leaves with a field and the CEL
+// expressions read the bucket instead of the whole response.
+type ConditionBuckets struct {
+	// AggregationMap is a gjson path to an array of buckets, evaluated
+	// against the aggregations of the response like the aggregation_map of
+	// customMetrics, e.g. `by_service.buckets`.
+	// +kubebuilder:validation:MinLength=1
+	AggregationMap string `json:"aggregation_map"`
+
+	// Labels are extracted from each bucket. They identify the bucket and
+	// are attached to its alert. Defaults to the `key` of the bucket as the
+	// `key` label.
+	Labels []MetricLabel `json:"labels,omitempty"`
+
+	// Value is the gjson path inside a bucket compared by the condition.
+	// Defaults to `doc_count`.
+	Value string `json:"value,omitempty"`
+}
+
+// SeverityLevel is a level of a Condition with several severities.
+type SeverityLevel struct {
+	// Name of the severity, e.g. warning or critical. It is the `severity`
+	// label of the alerts sent to Alertmanager and of the generated
+	// PrometheusRule.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	Threshold        string `json:"threshold,omitempty"`
+	LowerThreshold   string `json:"lowerThreshold,omitempty"`
+	UpperThreshold   string `json:"upperThreshold,omitempty"`
+	ResolveThreshold string `json:"resolveThreshold,omitempty"`
+
+	// For defaults to the `for` of the condition.
+	For string `json:"for,omitempty"`
+}
+
+// ConditionNode is a node of a compound condition. A leaf compares the
+// value at Field with Operator and Threshold; any other node combines its
+// children with All, Any or Not. Nodes below the first level are not
+// validated by the CRD schema, as it can not describe recursive types, but
+// by the controller, which reports them in the status of the SearchRule.
+type ConditionNode struct {
+	// Name identifies the leaf in the `conditions` exposed to the action
+	// templates. Defaults to Field.
+	Name string `json:"name,omitempty"`
+
+	// Field is a gjson path in the response compared by the leaf. Defaults
+	// to the value of the rule, read from its conditionField.
+	Field string `json:"field,omitempty"`
+
+	Operator  string `json:"operator,omitempty"`
+	Threshold string `json:"threshold,omitempty"`
+
+	// LowerThreshold, UpperThreshold and ResolveThreshold work as in the
+	// Condition, for the leaf.
+	LowerThreshold   string `json:"lowerThreshold,omitempty"`
+	UpperThreshold   string `json:"upperThreshold,omitempty"`
+	ResolveThreshold string `json:"resolveThreshold,omitempty"`
+
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
+	All []ConditionNode `json:"all,omitempty"`
+
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Any []ConditionNode `json:"any,omitempty"`
+
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Not *ConditionNode `json:"not,omitempty"`
 }
 
 // ActionRef TODO
@@ -131,15 +358,76 @@ type PrometheusRuleSpec struct {
 	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
+// EvaluationSchedule evaluates a rule at the times of a cron expression
+// instead of every checkInterval.
+type EvaluationSchedule struct {
+	// Cron is a cron expression with the five standard fields, minute, hour,
+	// day of month, month and day of week, e.g. `5 6 * * *` for every day at
+	// 06:05. The macros `@hourly`, `@daily`, `@weekly`, `@monthly` and
+	// `@yearly` are accepted too.
+	// +kubebuilder:validation:MinLength=1
+	Cron string `json:"cron"`
+
+	// Timezone of the expression, as an IANA name like `Europe/Madrid`.
+	// Defaults to UTC.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// Weekday is a day of the week of an ActiveWindow.
+// +kubebuilder:validation:Enum=Mon;Tue;Wed;Thu;Fri;Sat;Sun
+type Weekday string
+
+// ActiveWindow is a period of the week in which a rule is evaluated.
+type ActiveWindow struct {
+	// Days of the week of the window. Defaults to every day.
+	Days []Weekday `json:"days,omitempty"`
+
+	// Start and End are the times of the day the window starts and ends at,
+	// as `HH:MM`. End can be `24:00`, and a window with an End before its
+	// Start ends the day after, e.g. from `22:00` to `06:00`.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start"`
+	// +kubebuilder:validation:Pattern=`^(([01][0-9]|2[0-3]):[0-5][0-9]|24:00)$`
+	End string `json:"end"`
+
+	// Timezone of the window, as an IANA name like `Europe/Madrid`.
+	// Defaults to UTC.
+	Timezone string `json:"timezone,omitempty"`
+}
+
 // SearchRuleSpec defines the desired state of SearchRule.
+// +kubebuilder:validation:XValidation:rule="has(self.checkInterval) || has(self.schedule)",message="checkInterval or schedule must be set"
 type SearchRuleSpec struct {
-	Description       string              `json:"description,omitempty"`
-	QueryConnectorRef QueryConnectorRef   `json:"queryConnectorRef"`
-	CheckInterval     string              `json:"checkInterval"`
-	Elasticsearch     Elasticsearch       `json:"elasticsearch"`
-	Condition         Condition           `json:"condition"`
-	ActionRef         *ActionRef          `json:"actionRef,omitempty"`
-	PrometheusRule    *PrometheusRuleSpec `json:"prometheusRule,omitempty"`
+	Description       string            `json:"description,omitempty"`
+	QueryConnectorRef QueryConnectorRef `json:"queryConnectorRef"`
+
+	// CheckInterval is how often the rule is evaluated, and the window its
+	// query looks back at. With a Schedule, it is only the window, which
+	// defaults to the time between two evaluations of the schedule.
+	CheckInterval string `json:"checkInterval,omitempty"`
+
+	// Schedule evaluates the rule at the times of a cron expression instead
+	// of every checkInterval.
+	Schedule *EvaluationSchedule `json:"schedule,omitempty"`
+
+	// ActiveWindows are the periods in which the rule is evaluated. Outside
+	// of them the rule is not evaluated, and a firing rule is suspended: its
+	// alerts are no longer sent, but it is not resolved, and it fires again
+	// when a window opens if it still matches. Defaults to always active.
+	// +kubebuilder:validation:MaxItems=20
+	ActiveWindows []ActiveWindow `json:"activeWindows,omitempty"`
+
+	Elasticsearch  Elasticsearch       `json:"elasticsearch,omitempty"`
+	Condition      Condition           `json:"condition"`
+	ActionRef      *ActionRef          `json:"actionRef,omitempty"`
+	PrometheusRule *PrometheusRuleSpec `json:"prometheusRule,omitempty"`
+
+	// Loki, Prometheus and ClickHouse hold the query of the rule when the
+	// referenced QueryConnector is of the matching type. Elasticsearch is
+	// used for `elasticsearch` and `opensearch` connectors.
+	Loki       *Loki       `json:"loki,omitempty"`
+	Prometheus *Prometheus `json:"prometheus,omitempty"`
+	ClickHouse *ClickHouse `json:"clickhouse,omitempty"`
 
 	// CustomMetrics declares Prometheus gauges derived from the
 	// Elasticsearch response aggregations. Each entry produces one
@@ -149,11 +437,87 @@ type SearchRuleSpec struct {
 	// to expose the dimension that the bucket grouped by.
 	// +kubebuilder:validation:MaxItems=10
 	CustomMetrics []CustomMetric `json:"customMetrics,omitempty"`
+
+	// RequestPolicy overrides the timeout and retries set in the
+	// QueryConnector for the queries of this rule.
+	RequestPolicy *RequestPolicy `json:"requestPolicy,omitempty"`
+
+	// NoDataState is what a response missing the value to evaluate means
+	// for the rule, e.g. an empty vector or a conditionField not found:
+	// `KeepLast` leaves its state as it is, `Alerting` and `Normal` evaluate
+	// it as matching or not matching the condition, and `NoData` fires a
+	// dedicated DatasourceNoData alert.
+	// +kubebuilder:validation:Enum=KeepLast;Alerting;Normal;NoData
+	// +kubebuilder:default=KeepLast
+	NoDataState string `json:"noDataState,omitempty"`
+
+	// ExecErrorState is what a failed query means for the rule, e.g. an
+	// unreachable backend or a rejected query, like NoDataState. `Error`
+	// fires a dedicated DatasourceError alert.
+	// +kubebuilder:validation:Enum=KeepLast;Alerting;Normal;Error
+	// +kubebuilder:default=KeepLast
+	ExecErrorState string `json:"execErrorState,omitempty"`
+}
+
+// RuleStateStatus is the state machine of a rule, or of a bucket of a rule evaluating its
+// condition per bucket, as of its last evaluation
+type RuleStateStatus struct {
+	// State is the state of the rule: Normal, PendingFiring, Firing, PendingResolving or
+	// Suspended outside of its active windows
+	// +optional
+	State string `json:"state,omitempty"`
+
+	// FiringTime is when the rule started to match, to wait its `for` time before firing
+	// +optional
+	FiringTime *metav1.Time `json:"firingTime,omitempty"`
+
+	// ResolvingTime is when the firing rule stopped matching, to wait its `for` time
+	// before resolving
+	// +optional
+	ResolvingTime *metav1.Time `json:"resolvingTime,omitempty"`
+
+	// Severity is the level the rule fires at, for conditions with several severities
+	// +optional
+	Severity string `json:"severity,omitempty"`
+
+	// SeveritySince holds when every matching level of the condition started to match
+	// +optional
+	SeveritySince map[string]metav1.Time `json:"severitySince,omitempty"`
+}
+
+// BucketStateStatus is the state of a bucket of a rule evaluating its condition per bucket
+type BucketStateStatus struct {
+	// Key identifies the bucket among the others of the rule, from its labels
+	Key string `json:"key"`
+
+	// Labels are the labels of the bucket
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	RuleStateStatus `json:",inline"`
+}
+
+// SearchRuleStateStatus is the state of a rule kept in its status, so the operator resumes it
+// after a restart instead of starting over from the normal state
+type SearchRuleStateStatus struct {
+	RuleStateStatus `json:",inline"`
+
+	// Buckets are the buckets not in normal state, for rules evaluating their condition per bucket
+	// +optional
+	Buckets []BucketStateStatus `json:"buckets,omitempty"`
+
+	// LastEvaluationTime is when the query of the rule was last evaluated
+	// +optional
+	LastEvaluationTime *metav1.Time `json:"lastEvaluationTime,omitempty"`
 }
 
 // SearchRuleStatus defines the observed state of SearchRule.
 type SearchRuleStatus struct {
 	Conditions []metav1.Condition `json:"conditions"`
+
+	// RuleState is the state of the rule as of its last evaluation
+	// +optional
+	RuleState *SearchRuleStateStatus `json:"ruleState,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -0,0 +1,124 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TemplateParameter declares a value the instances of a SearchRuleTemplate
+// pass to it. The values are available to the template as `.values.<name>`.
+type TemplateParameter struct {
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z_][a-zA-Z_0-9]*$`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// Required parameters must be set by every instance. A parameter with a
+	// default is never missing.
+	Required bool `json:"required,omitempty"`
+
+	// Default is the value of the instances not setting the parameter.
+	Default string `json:"default,omitempty"`
+}
+
+// SearchRuleSkeleton is what every SearchRule generated from a template is
+// made of. The strings of the spec, and the values of the labels and the
+// annotations, are Go templates rendered with the values of each instance.
+type SearchRuleSkeleton struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Spec is the spec of the generated SearchRules, validated as a
+	// SearchRule spec once rendered.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Spec *apiextensionsv1.JSON `json:"spec"`
+}
+
+// SearchRuleTemplateInstance is a SearchRule generated from the template, in
+// the namespace of the template.
+type SearchRuleTemplateInstance struct {
+	// Name is the name of the generated SearchRule.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	// +kubebuilder:validation:MaxLength=253
+	Name string `json:"name"`
+
+	// Values are the values of the parameters of the template.
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// SearchRuleTemplateSpec defines the desired state of SearchRuleTemplate.
+type SearchRuleTemplateSpec struct {
+	Parameters []TemplateParameter `json:"parameters,omitempty"`
+	Template   SearchRuleSkeleton  `json:"template"`
+
+	// Instances is the list of SearchRules generated from the template. The
+	// SearchRules of the template missing in it are deleted.
+	Instances []SearchRuleTemplateInstance `json:"instances,omitempty"`
+}
+
+// SearchRuleTemplateInstanceStatus is the state of a SearchRule generated
+// from the template.
+type SearchRuleTemplateInstanceStatus struct {
+	Name string `json:"name"`
+
+	// Revision is the revision of the template the SearchRule was last
+	// rendered from.
+	Revision string `json:"revision,omitempty"`
+
+	// Error tells why the SearchRule could not be rendered or applied, so it
+	// keeps the spec of its last revision.
+	Error string `json:"error,omitempty"`
+}
+
+// SearchRuleTemplateStatus defines the observed state of SearchRuleTemplate.
+type SearchRuleTemplateStatus struct {
+	Conditions []metav1.Condition `json:"conditions"`
+
+	// Revision identifies the parameters and the skeleton of the template.
+	// It changes with them, and every instance is rendered again then.
+	Revision  string                             `json:"revision,omitempty"`
+	Instances []SearchRuleTemplateInstanceStatus `json:"instances,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"ResourceSynced\")].status",description=""
+// +kubebuilder:printcolumn:name="Revision",type="string",JSONPath=".status.revision",description=""
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description=""
+
+// SearchRuleTemplate is the Schema for the searchruletemplates API.
+type SearchRuleTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SearchRuleTemplateSpec   `json:"spec,omitempty"`
+	Status SearchRuleTemplateStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SearchRuleTemplateList contains a list of SearchRuleTemplate.
+type SearchRuleTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SearchRuleTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SearchRuleTemplate{}, &SearchRuleTemplateList{})
+}
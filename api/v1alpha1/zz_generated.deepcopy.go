@@ -55,6 +55,79 @@ func (in *ActionRef) DeepCopy() *ActionRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ActiveWindow) DeepCopyInto(out *ActiveWindow) {
+	*out = *in
+	if in.Days != nil {
+		in, out := &in.Days, &out.Days
+		*out = make([]Weekday, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ActiveWindow.
+func (in *ActiveWindow) DeepCopy() *ActiveWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(ActiveWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AnomalyDetection) DeepCopyInto(out *AnomalyDetection) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AnomalyDetection.
+func (in *AnomalyDetection) DeepCopy() *AnomalyDetection {
+	if in == nil {
+		return nil
+	}
+	out := new(AnomalyDetection)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BucketStateStatus) DeepCopyInto(out *BucketStateStatus) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	in.RuleStateStatus.DeepCopyInto(&out.RuleStateStatus)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BucketStateStatus.
+func (in *BucketStateStatus) DeepCopy() *BucketStateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BucketStateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CABundleRef) DeepCopyInto(out *CABundleRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CABundleRef.
+func (in *CABundleRef) DeepCopy() *CABundleRef {
+	if in == nil {
+		return nil
+	}
+	out := new(CABundleRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CertificatesSecretRef) DeepCopyInto(out *CertificatesSecretRef) {
 	*out = *in
@@ -70,6 +143,21 @@ func (in *CertificatesSecretRef) DeepCopy() *CertificatesSecretRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClickHouse) DeepCopyInto(out *ClickHouse) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClickHouse.
+func (in *ClickHouse) DeepCopy() *ClickHouse {
+	if in == nil {
+		return nil
+	}
+	out := new(ClickHouse)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterQueryConnector) DeepCopyInto(out *ClusterQueryConnector) {
 	*out = *in
@@ -188,9 +276,63 @@ func (in *ClusterRulerActionList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Comparison) DeepCopyInto(out *Comparison) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Comparison.
+func (in *Comparison) DeepCopy() *Comparison {
+	if in == nil {
+		return nil
+	}
+	out := new(Comparison)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Condition) DeepCopyInto(out *Condition) {
 	*out = *in
+	if in.All != nil {
+		in, out := &in.All, &out.All
+		*out = make([]ConditionNode, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Any != nil {
+		in, out := &in.Any, &out.Any
+		*out = make([]ConditionNode, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Not != nil {
+		in, out := &in.Not, &out.Not
+		*out = new(ConditionNode)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Severities != nil {
+		in, out := &in.Severities, &out.Severities
+		*out = make([]SeverityLevel, len(*in))
+		copy(*out, *in)
+	}
+	if in.Buckets != nil {
+		in, out := &in.Buckets, &out.Buckets
+		*out = new(ConditionBuckets)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Comparison != nil {
+		in, out := &in.Comparison, &out.Comparison
+		*out = new(Comparison)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Anomaly != nil {
+		in, out := &in.Anomaly, &out.Anomaly
+		*out = new(AnomalyDetection)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Condition.
@@ -203,6 +345,60 @@ func (in *Condition) DeepCopy() *Condition {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConditionBuckets) DeepCopyInto(out *ConditionBuckets) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make([]MetricLabel, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConditionBuckets.
+func (in *ConditionBuckets) DeepCopy() *ConditionBuckets {
+	if in == nil {
+		return nil
+	}
+	out := new(ConditionBuckets)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConditionNode) DeepCopyInto(out *ConditionNode) {
+	*out = *in
+	if in.All != nil {
+		in, out := &in.All, &out.All
+		*out = make([]ConditionNode, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Any != nil {
+		in, out := &in.Any, &out.Any
+		*out = make([]ConditionNode, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Not != nil {
+		in, out := &in.Not, &out.Not
+		*out = new(ConditionNode)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConditionNode.
+func (in *ConditionNode) DeepCopy() *ConditionNode {
+	if in == nil {
+		return nil
+	}
+	out := new(ConditionNode)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CustomMetric) DeepCopyInto(out *CustomMetric) {
 	*out = *in
@@ -243,6 +439,51 @@ func (in *Elasticsearch) DeepCopy() *Elasticsearch {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EvaluationSchedule) DeepCopyInto(out *EvaluationSchedule) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EvaluationSchedule.
+func (in *EvaluationSchedule) DeepCopy() *EvaluationSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(EvaluationSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LoadBalancing) DeepCopyInto(out *LoadBalancing) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LoadBalancing.
+func (in *LoadBalancing) DeepCopy() *LoadBalancing {
+	if in == nil {
+		return nil
+	}
+	out := new(LoadBalancing)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Loki) DeepCopyInto(out *Loki) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Loki.
+func (in *Loki) DeepCopy() *Loki {
+	if in == nil {
+		return nil
+	}
+	out := new(Loki)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MetricLabel) DeepCopyInto(out *MetricLabel) {
 	*out = *in
@@ -258,6 +499,21 @@ func (in *MetricLabel) DeepCopy() *MetricLabel {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Prometheus) DeepCopyInto(out *Prometheus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Prometheus.
+func (in *Prometheus) DeepCopy() *Prometheus {
+	if in == nil {
+		return nil
+	}
+	out := new(Prometheus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PrometheusRuleSpec) DeepCopyInto(out *PrometheusRuleSpec) {
 	*out = *in
@@ -287,6 +543,21 @@ func (in *PrometheusRuleSpec) DeepCopy() *PrometheusRuleSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QueryBatching) DeepCopyInto(out *QueryBatching) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QueryBatching.
+func (in *QueryBatching) DeepCopy() *QueryBatching {
+	if in == nil {
+		return nil
+	}
+	out := new(QueryBatching)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *QueryConnector) DeepCopyInto(out *QueryConnector) {
 	*out = *in
@@ -314,6 +585,41 @@ func (in *QueryConnector) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QueryConnectorAuth) DeepCopyInto(out *QueryConnectorAuth) {
+	*out = *in
+	if in.Basic != nil {
+		in, out := &in.Basic, &out.Basic
+		*out = new(QueryConnectorCredentials)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.APIKey != nil {
+		in, out := &in.APIKey, &out.APIKey
+		*out = new(SecretKeyRef)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Bearer != nil {
+		in, out := &in.Bearer, &out.Bearer
+		*out = new(SecretKeyRef)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SigV4 != nil {
+		in, out := &in.SigV4, &out.SigV4
+		*out = new(SigV4Auth)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QueryConnectorAuth.
+func (in *QueryConnectorAuth) DeepCopy() *QueryConnectorAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(QueryConnectorAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *QueryConnectorCertificates) DeepCopyInto(out *QueryConnectorCertificates) {
 	*out = *in
@@ -405,6 +711,46 @@ func (in *QueryConnectorSpec) DeepCopyInto(out *QueryConnectorSpec) {
 	}
 	out.Credentials = in.Credentials
 	out.Certificates = in.Certificates
+	if in.URLs != nil {
+		in, out := &in.URLs, &out.URLs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LoadBalancing != nil {
+		in, out := &in.LoadBalancing, &out.LoadBalancing
+		*out = new(LoadBalancing)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Limits != nil {
+		in, out := &in.Limits, &out.Limits
+		*out = new(QueryLimits)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Batching != nil {
+		in, out := &in.Batching, &out.Batching
+		*out = new(QueryBatching)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RequestPolicy != nil {
+		in, out := &in.RequestPolicy, &out.RequestPolicy
+		*out = new(RequestPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NoProxy != nil {
+		in, out := &in.NoProxy, &out.NoProxy
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = new(CABundleRef)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Auth != nil {
+		in, out := &in.Auth, &out.Auth
+		*out = new(QueryConnectorAuth)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QueryConnectorSpec.
@@ -439,6 +785,93 @@ func (in *QueryConnectorStatus) DeepCopy() *QueryConnectorStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QueryLimits) DeepCopyInto(out *QueryLimits) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QueryLimits.
+func (in *QueryLimits) DeepCopy() *QueryLimits {
+	if in == nil {
+		return nil
+	}
+	out := new(QueryLimits)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RequestBackoff) DeepCopyInto(out *RequestBackoff) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RequestBackoff.
+func (in *RequestBackoff) DeepCopy() *RequestBackoff {
+	if in == nil {
+		return nil
+	}
+	out := new(RequestBackoff)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RequestPolicy) DeepCopyInto(out *RequestPolicy) {
+	*out = *in
+	if in.Retries != nil {
+		in, out := &in.Retries, &out.Retries
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Backoff != nil {
+		in, out := &in.Backoff, &out.Backoff
+		*out = new(RequestBackoff)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RequestPolicy.
+func (in *RequestPolicy) DeepCopy() *RequestPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RequestPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RuleStateStatus) DeepCopyInto(out *RuleStateStatus) {
+	*out = *in
+	if in.FiringTime != nil {
+		in, out := &in.FiringTime, &out.FiringTime
+		*out = new(v1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ResolvingTime != nil {
+		in, out := &in.ResolvingTime, &out.ResolvingTime
+		*out = new(v1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SeveritySince != nil {
+		in, out := &in.SeveritySince, &out.SeveritySince
+		*out = make(map[string]v1.Time, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RuleStateStatus.
+func (in *RuleStateStatus) DeepCopy() *RuleStateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RuleStateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RulerAction) DeepCopyInto(out *RulerAction) {
 	*out = *in
@@ -611,12 +1044,58 @@ func (in *SearchRuleList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SearchRuleSkeleton) DeepCopyInto(out *SearchRuleSkeleton) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Spec != nil {
+		in, out := &in.Spec, &out.Spec
+		*out = new(apiextensionsv1.JSON)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SearchRuleSkeleton.
+func (in *SearchRuleSkeleton) DeepCopy() *SearchRuleSkeleton {
+	if in == nil {
+		return nil
+	}
+	out := new(SearchRuleSkeleton)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SearchRuleSpec) DeepCopyInto(out *SearchRuleSpec) {
 	*out = *in
 	out.QueryConnectorRef = in.QueryConnectorRef
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(EvaluationSchedule)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ActiveWindows != nil {
+		in, out := &in.ActiveWindows, &out.ActiveWindows
+		*out = make([]ActiveWindow, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	in.Elasticsearch.DeepCopyInto(&out.Elasticsearch)
-	out.Condition = in.Condition
+	in.Condition.DeepCopyInto(&out.Condition)
 	if in.ActionRef != nil {
 		in, out := &in.ActionRef, &out.ActionRef
 		*out = new(ActionRef)
@@ -627,6 +1106,21 @@ func (in *SearchRuleSpec) DeepCopyInto(out *SearchRuleSpec) {
 		*out = new(PrometheusRuleSpec)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Loki != nil {
+		in, out := &in.Loki, &out.Loki
+		*out = new(Loki)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Prometheus != nil {
+		in, out := &in.Prometheus, &out.Prometheus
+		*out = new(Prometheus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClickHouse != nil {
+		in, out := &in.ClickHouse, &out.ClickHouse
+		*out = new(ClickHouse)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.CustomMetrics != nil {
 		in, out := &in.CustomMetrics, &out.CustomMetrics
 		*out = make([]CustomMetric, len(*in))
@@ -634,6 +1128,11 @@ func (in *SearchRuleSpec) DeepCopyInto(out *SearchRuleSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.RequestPolicy != nil {
+		in, out := &in.RequestPolicy, &out.RequestPolicy
+		*out = new(RequestPolicy)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SearchRuleSpec.
@@ -646,6 +1145,34 @@ func (in *SearchRuleSpec) DeepCopy() *SearchRuleSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SearchRuleStateStatus) DeepCopyInto(out *SearchRuleStateStatus) {
+	*out = *in
+	in.RuleStateStatus.DeepCopyInto(&out.RuleStateStatus)
+	if in.Buckets != nil {
+		in, out := &in.Buckets, &out.Buckets
+		*out = make([]BucketStateStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastEvaluationTime != nil {
+		in, out := &in.LastEvaluationTime, &out.LastEvaluationTime
+		*out = new(v1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SearchRuleStateStatus.
+func (in *SearchRuleStateStatus) DeepCopy() *SearchRuleStateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SearchRuleStateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SearchRuleStatus) DeepCopyInto(out *SearchRuleStatus) {
 	*out = *in
@@ -656,6 +1183,11 @@ func (in *SearchRuleStatus) DeepCopyInto(out *SearchRuleStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.RuleState != nil {
+		in, out := &in.RuleState, &out.RuleState
+		*out = new(SearchRuleStateStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SearchRuleStatus.
@@ -668,6 +1200,172 @@ func (in *SearchRuleStatus) DeepCopy() *SearchRuleStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SearchRuleTemplate) DeepCopyInto(out *SearchRuleTemplate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SearchRuleTemplate.
+func (in *SearchRuleTemplate) DeepCopy() *SearchRuleTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(SearchRuleTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SearchRuleTemplate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SearchRuleTemplateInstance) DeepCopyInto(out *SearchRuleTemplateInstance) {
+	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SearchRuleTemplateInstance.
+func (in *SearchRuleTemplateInstance) DeepCopy() *SearchRuleTemplateInstance {
+	if in == nil {
+		return nil
+	}
+	out := new(SearchRuleTemplateInstance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SearchRuleTemplateInstanceStatus) DeepCopyInto(out *SearchRuleTemplateInstanceStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SearchRuleTemplateInstanceStatus.
+func (in *SearchRuleTemplateInstanceStatus) DeepCopy() *SearchRuleTemplateInstanceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SearchRuleTemplateInstanceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SearchRuleTemplateList) DeepCopyInto(out *SearchRuleTemplateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SearchRuleTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SearchRuleTemplateList.
+func (in *SearchRuleTemplateList) DeepCopy() *SearchRuleTemplateList {
+	if in == nil {
+		return nil
+	}
+	out := new(SearchRuleTemplateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SearchRuleTemplateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SearchRuleTemplateSpec) DeepCopyInto(out *SearchRuleTemplateSpec) {
+	*out = *in
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make([]TemplateParameter, len(*in))
+		copy(*out, *in)
+	}
+	in.Template.DeepCopyInto(&out.Template)
+	if in.Instances != nil {
+		in, out := &in.Instances, &out.Instances
+		*out = make([]SearchRuleTemplateInstance, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SearchRuleTemplateSpec.
+func (in *SearchRuleTemplateSpec) DeepCopy() *SearchRuleTemplateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SearchRuleTemplateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SearchRuleTemplateStatus) DeepCopyInto(out *SearchRuleTemplateStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Instances != nil {
+		in, out := &in.Instances, &out.Instances
+		*out = make([]SearchRuleTemplateInstanceStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SearchRuleTemplateStatus.
+func (in *SearchRuleTemplateStatus) DeepCopy() *SearchRuleTemplateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SearchRuleTemplateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretKeyRef) DeepCopyInto(out *SecretKeyRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretKeyRef.
+func (in *SecretKeyRef) DeepCopy() *SecretKeyRef {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretKeyRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecretRef) DeepCopyInto(out *SecretRef) {
 	*out = *in
@@ -683,6 +1381,67 @@ func (in *SecretRef) DeepCopy() *SecretRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SeverityLevel) DeepCopyInto(out *SeverityLevel) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SeverityLevel.
+func (in *SeverityLevel) DeepCopy() *SeverityLevel {
+	if in == nil {
+		return nil
+	}
+	out := new(SeverityLevel)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SigV4Auth) DeepCopyInto(out *SigV4Auth) {
+	*out = *in
+	out.SecretRef = in.SecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SigV4Auth.
+func (in *SigV4Auth) DeepCopy() *SigV4Auth {
+	if in == nil {
+		return nil
+	}
+	out := new(SigV4Auth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SigV4SecretRef) DeepCopyInto(out *SigV4SecretRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SigV4SecretRef.
+func (in *SigV4SecretRef) DeepCopy() *SigV4SecretRef {
+	if in == nil {
+		return nil
+	}
+	out := new(SigV4SecretRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateParameter) DeepCopyInto(out *TemplateParameter) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateParameter.
+func (in *TemplateParameter) DeepCopy() *TemplateParameter {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateParameter)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Webhook) DeepCopyInto(out *Webhook) {
 	*out = *in
@@ -694,6 +1453,16 @@ func (in *Webhook) DeepCopyInto(out *Webhook) {
 		}
 	}
 	out.Credentials = in.Credentials
+	if in.NoProxy != nil {
+		in, out := &in.NoProxy, &out.NoProxy
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = new(CABundleRef)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Webhook.
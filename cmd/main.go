@@ -20,20 +20,28 @@ import (
 	"context"
 	"crypto/tls"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
+	// Timezones of the schedules and active windows of the SearchRules, on images without them
+	_ "time/tzdata"
 
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
@@ -44,13 +52,18 @@ import (
 	"freepik.com/searchruler/internal/controller/queryconnector"
 	"freepik.com/searchruler/internal/controller/ruleraction"
 	"freepik.com/searchruler/internal/controller/searchrule"
+	"freepik.com/searchruler/internal/controller/searchruletemplate"
 	"freepik.com/searchruler/internal/globals"
 	"freepik.com/searchruler/internal/metrics"
 	"freepik.com/searchruler/internal/pools"
+	"freepik.com/searchruler/internal/sharding"
 	"freepik.com/searchruler/internal/webserver"
 	// +kubebuilder:scaffold:imports
 )
 
+// serviceAccountNamespaceFile holds the namespace the operator runs in
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
@@ -65,6 +78,12 @@ var (
 	AlertsPool = &pools.AlertsStore{
 		Store: make(map[string]*pools.Alert),
 	}
+	ConnectorsPool = &pools.ConnectorsStore{
+		Store: make(map[string]*pools.ConnectorHealth),
+	}
+	QueryResultsPool = &pools.QueryResultsStore{
+		Store: make(map[string]*pools.QueryResult),
+	}
 )
 
 func init() {
@@ -83,6 +102,18 @@ func main() {
 	var webserverAddr string
 	var rulesMetricsAddr string
 	var rulesMetricsRefreshSec int
+	var enableSharding bool
+	var shardingGroup string
+	var shardingNamespace string
+	var shardingIdentity string
+	var shardingAddress string
+	var shardingLeaseDuration time.Duration
+	var evaluationWorkers int
+	var evaluationMaxJitter time.Duration
+	var searchRuleConcurrency int
+	var rulerActionConcurrency int
+	var queryConnectorConcurrency int
+	var searchRuleTemplateConcurrency int
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -100,6 +131,32 @@ func main() {
 		"The address the rules custom metrics will bind to. Leave as 0 to disable the rule metrics server.")
 	flag.IntVar(&rulesMetricsRefreshSec, "rules-metrics-refresh-rate", 10,
 		"The refresh rate in seconds for the rules custom metrics.")
+	flag.BoolVar(&enableSharding, "sharding", false,
+		"Share the evaluation of the SearchRules across the replicas of the operator. "+
+			"Every replica evaluates its shard of the rules, which are handed off when replicas come and go.")
+	flag.StringVar(&shardingGroup, "sharding-group", "searchruler",
+		"The name of the replicas sharing the SearchRules, to tell them from other deployments in the same namespace.")
+	flag.StringVar(&shardingNamespace, "sharding-namespace", "",
+		"The namespace of the Leases of the replicas sharing the SearchRules. Defaults to the namespace of the operator.")
+	flag.StringVar(&shardingIdentity, "sharding-identity", "",
+		"The identity of the replica among the ones sharing the SearchRules. Defaults to the hostname.")
+	flag.StringVar(&shardingAddress, "sharding-advertise-address", "",
+		"The address the other replicas reach the webserver and the rules metrics of this one at, usually the IP of the pod.")
+	flag.DurationVar(&shardingLeaseDuration, "sharding-lease-duration", 15*time.Second,
+		"How long a replica keeps its shard of the SearchRules without renewing its Lease.")
+	flag.IntVar(&evaluationWorkers, "evaluation-workers", 10,
+		"How many SearchRules are evaluated at the same time. Evaluations due while every worker is busy wait for one.")
+	flag.DurationVar(&evaluationMaxJitter, "evaluation-max-jitter", 15*time.Second,
+		"The maximum offset of the evaluations of a SearchRule from the boundaries of its checkInterval, "+
+			"spreading the rules with the same interval. Set to 0 to evaluate them all on the boundaries.")
+	flag.IntVar(&searchRuleConcurrency, "searchrule-max-concurrent-reconciles", 1,
+		"How many SearchRules are reconciled at the same time.")
+	flag.IntVar(&rulerActionConcurrency, "ruleraction-max-concurrent-reconciles", 1,
+		"How many RulerActions and ClusterRulerActions are reconciled at the same time.")
+	flag.IntVar(&queryConnectorConcurrency, "queryconnector-max-concurrent-reconciles", 1,
+		"How many QueryConnectors and ClusterQueryConnectors are reconciled at the same time.")
+	flag.IntVar(&searchRuleTemplateConcurrency, "searchruletemplate-max-concurrent-reconciles", 1,
+		"How many SearchRuleTemplates are reconciled at the same time.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -183,8 +240,14 @@ func main() {
 		Metrics:                metricsServerOptions,
 		WebhookServer:          webhookServer,
 		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "75b1a88b.freepik.com",
+		// Secrets and ConfigMaps are read from the API server when the resources referencing them
+		// are synced, instead of caching every one of the cluster. Their changes are watched with
+		// their metadata only
+		Client: client.Options{
+			Cache: &client.CacheOptions{DisableFor: []client.Object{&corev1.Secret{}, &corev1.ConfigMap{}}},
+		},
+		LeaderElection:   enableLeaderElection,
+		LeaderElectionID: "75b1a88b.freepik.com",
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -202,17 +265,34 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Share the SearchRules across the replicas, each one holding a Lease while it runs. The
+	// peers are the other replicas, for the webserver and the metrics to aggregate their views
+	var shard *sharding.Shard
+	var peers sharding.Peers
+	if enableSharding {
+		shard, err = newShard(cfg, shardingGroup, shardingNamespace, shardingIdentity, shardingAddress, shardingLeaseDuration)
+		if err != nil {
+			setupLog.Error(err, "unable to set up sharding")
+			os.Exit(1)
+		}
+		if err = mgr.Add(shard); err != nil {
+			setupLog.Error(err, "unable to set up sharding")
+			os.Exit(1)
+		}
+		peers = shard
+	}
+
 	if webserverAddr != "0" {
 		// Create webserver for the application
 		go func() {
-			webserver.RunWebserver(context.TODO(), webserverAddr, RulesPool)
+			webserver.RunWebserver(context.TODO(), webserverAddr, RulesPool, peers)
 		}()
 	}
 
 	if rulesMetricsAddr != "0" {
 		// Create rules metrics server
 		go func() {
-			err = metrics.Run(context.TODO(), rulesMetricsAddr, RulesPool, rulesMetricsRefreshSec)
+			err = metrics.Run(context.TODO(), rulesMetricsAddr, RulesPool, ConnectorsPool, rulesMetricsRefreshSec, peers)
 			if err != nil {
 				setupLog.Error(err, "unable to set up metrics server")
 			}
@@ -228,9 +308,11 @@ func main() {
 	}
 
 	if err = (&ruleraction.RulerActionReconciler{
-		Client:     mgr.GetClient(),
-		Scheme:     mgr.GetScheme(),
-		AlertsPool: AlertsPool,
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		AlertsPool:              AlertsPool,
+		Sharded:                 enableSharding,
+		MaxConcurrentReconciles: rulerActionConcurrency,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "RulerAction")
 		os.Exit(1)
@@ -242,20 +324,36 @@ func main() {
 		QueryConnectorCredentialsPool: QueryConnectorCredentialsPool,
 		RulesPool:                     RulesPool,
 		AlertsPool:                    AlertsPool,
+		QueryResultsPool:              QueryResultsPool,
 		PrometheusRuleSupported:       prometheusRuleSupported,
 		MetricsExposed:                metricsExposed,
+		Shard:                         shard,
+		EvaluationWorkers:             evaluationWorkers,
+		EvaluationMaxJitter:           evaluationMaxJitter,
+		MaxConcurrentReconciles:       searchRuleConcurrency,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SearchRule")
 		os.Exit(1)
 	}
 	if err = (&queryconnector.QueryConnectorReconciler{
-		Client:          mgr.GetClient(),
-		Scheme:          mgr.GetScheme(),
-		CredentialsPool: QueryConnectorCredentialsPool,
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		CredentialsPool:         QueryConnectorCredentialsPool,
+		ConnectorsPool:          ConnectorsPool,
+		Sharded:                 enableSharding,
+		MaxConcurrentReconciles: queryConnectorConcurrency,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "QueryConnector")
 		os.Exit(1)
 	}
+	if err = (&searchruletemplate.SearchRuleTemplateReconciler{
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		MaxConcurrentReconciles: searchRuleTemplateConcurrency,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SearchRuleTemplate")
+		os.Exit(1)
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -301,3 +399,41 @@ func isPrometheusRuleCRDInstalled(cfg *rest.Config) bool {
 	}
 	return false
 }
+
+// newShard returns the membership of the replica in the group sharing the SearchRules. The
+// namespace defaults to the one of the service account of the operator, and the identity to the
+// hostname, which is the name of the pod
+func newShard(cfg *rest.Config, group, namespace, identity, address string, leaseDuration time.Duration) (*sharding.Shard, error) {
+
+	if namespace == "" {
+		content, err := os.ReadFile(serviceAccountNamespaceFile)
+		if err != nil {
+			return nil, fmt.Errorf("the namespace of the operator is unknown, set --sharding-namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(content))
+	}
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("the hostname is unknown, set --sharding-identity: %w", err)
+		}
+		identity = hostname
+	}
+	if address == "" {
+		setupLog.Info("WARNING: --sharding-advertise-address is not set; " +
+			"the webserver and the rules metrics can not aggregate the views of the other replicas")
+	}
+
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return sharding.NewShard(sharding.Options{
+		Client:        client,
+		Namespace:     namespace,
+		Group:         group,
+		Identity:      identity,
+		Address:       address,
+		LeaseDuration: leaseDuration,
+	}), nil
+}
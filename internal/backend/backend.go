@@ -0,0 +1,188 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/connector"
+	"freepik.com/searchruler/internal/controller"
+	"freepik.com/searchruler/internal/pools"
+)
+
+var (
+	// ErrConnection is wrapped by the errors of requests that never got a response
+	ErrConnection = errors.New("connection error")
+
+	// ErrQuery is wrapped by the errors of requests rejected by the backend and
+	// responses that can not be evaluated
+	ErrQuery = errors.New("query error")
+
+	// ErrNoData is wrapped by the errors of responses missing the value to evaluate, such as an
+	// empty vector or a conditionField not found. It wraps ErrQuery
+	ErrNoData = fmt.Errorf("%w: no data", ErrQuery)
+
+	// ErrInvalidRule is wrapped by the errors of rules that do not define a query
+	// the backend can run
+	ErrInvalidRule = errors.New("invalid rule")
+)
+
+// Connector gathers everything known about the QueryConnector referenced by a SearchRule.
+// Namespace is empty for ClusterQueryConnectors
+type Connector struct {
+	Namespace   string
+	Name        string
+	Spec        *v1alpha1.QueryConnectorSpec
+	Status      *v1alpha1.QueryConnectorStatus
+	Credentials *pools.Credentials
+}
+
+// Doer sends HTTP requests. *http.Client satisfies it
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Result is what a backend extracts from the response of a query
+type Result struct {
+	// Value is compared against the condition of the rule
+	Value float64
+
+	// Aggregations is exposed to the action templates and to spec.customMetrics.
+	// Nil when the response has nothing to aggregate by
+	Aggregations interface{}
+}
+
+// Backend is a query engine SearchRules can be evaluated against
+type Backend interface {
+	// Name identifies the backend in logs and error messages
+	Name() string
+
+	// Validate checks that the rule defines a query this backend can run
+	Validate(rule *v1alpha1.SearchRule) error
+
+	// BuildRequest creates the request executing the query of the rule
+	BuildRequest(ctx context.Context, conn *Connector, rule *v1alpha1.SearchRule) (*http.Request, error)
+
+	// Execute sends the request and returns the body of a successful response
+	Execute(doer Doer, req *http.Request) ([]byte, error)
+
+	// Extract reads the value of the rule and the aggregations from the response body
+	Extract(rule *v1alpha1.SearchRule, body []byte) (*Result, error)
+}
+
+// BatchItem is the response to one of the queries of a batch
+type BatchItem struct {
+	// Body is the response to the query, as if it was sent alone
+	Body []byte
+
+	// Err wraps ErrQuery when the query failed, leaving the others of the batch untouched
+	Err error
+}
+
+// Batcher is implemented by backends able to run the queries of several rules in one request
+type Batcher interface {
+	// Batchable tells whether the query of the rule can run in a batch
+	Batchable(rule *v1alpha1.SearchRule) bool
+
+	// BuildBatchRequest creates one request running the queries of all the rules
+	BuildBatchRequest(ctx context.Context, conn *Connector, rules []*v1alpha1.SearchRule) (*http.Request, error)
+
+	// SplitBatchResponse returns the response to each query, in the order of the rules
+	SplitBatchResponse(body []byte, size int) ([]BatchItem, error)
+}
+
+// For returns the backend matching the type of the connector
+func For(conn *Connector) (Backend, error) {
+
+	detectedDistribution, detectedVersion := "", ""
+	if conn.Status != nil {
+		detectedDistribution = conn.Status.Distribution
+		detectedVersion = conn.Status.Version
+	}
+
+	flavor := connector.ResolveFlavor(conn.Spec.Type, detectedDistribution)
+	switch flavor {
+	case connector.FlavorElasticsearch, connector.FlavorOpenSearch:
+		return &Elasticsearch{Profile: connector.NewProfile(flavor, detectedVersion)}, nil
+	case connector.FlavorLoki:
+		return &Loki{}, nil
+	case connector.FlavorPrometheus:
+		return &Prometheus{}, nil
+	case connector.FlavorClickHouse:
+		return &ClickHouse{}, nil
+	default:
+		return nil, fmt.Errorf(controller.UnknownBackendErrorMessage, flavor)
+	}
+}
+
+// execute sends the request and reads the whole response. Every backend talks plain HTTP,
+// so this is shared by all of their Execute implementations
+func execute(name string, doer Doer, req *http.Request) ([]byte, error) {
+
+	resp, err := doer.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: "+controller.BackendRequestErrorMessage, ErrConnection, name, req.URL.Redacted(), err)
+	}
+	defer resp.Body.Close()
+
+	// Read response and check if it is ok
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: "+controller.ResponseBodyReadErrorMessage, ErrQuery, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: "+controller.BackendResponseErrorMessage, ErrQuery, name, req.URL.Redacted(), string(body))
+	}
+
+	return body, nil
+}
+
+// FieldValue reads a number from the response of a query, such as the fields compared by the
+// leaves of compound conditions. Both shapes of `hits.total` are accepted, as for conditionField
+func FieldValue(body []byte, field string) (float64, error) {
+
+	value := getConditionValue(body, field)
+	if !value.Exists() {
+		return 0, fmt.Errorf("%w: "+controller.FieldNotFoundMessage, ErrNoData, field, string(body))
+	}
+	return value.Float(), nil
+}
+
+// evaluationTimeKey is the key of the evaluation time in the context of a request
+type evaluationTimeKey struct{}
+
+// WithEvaluationTime returns a context evaluating the queries of the backends taking their time
+// as a parameter, Prometheus and Loki, at t instead of now. Used for the windows the query of a
+// rule is rendered for
+func WithEvaluationTime(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, evaluationTimeKey{}, t)
+}
+
+// evaluationTime returns the time the query must be evaluated at, now by default
+func evaluationTime(ctx context.Context) time.Time {
+	if t, ok := ctx.Value(evaluationTimeKey{}).(time.Time); ok {
+		return t
+	}
+	return time.Now()
+}
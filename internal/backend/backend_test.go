@@ -0,0 +1,342 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/connector"
+	"freepik.com/searchruler/internal/pools"
+)
+
+// capturedRequest is what the fake backend received
+type capturedRequest struct {
+	method, path, query, timeout, body, contentType string
+}
+
+// newFakeBackend answers every request with the given status and payload and records the request
+func newFakeBackend(t *testing.T, status int, payload string) (*httptest.Server, *capturedRequest) {
+	t.Helper()
+	captured := &capturedRequest{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") == "application/x-www-form-urlencoded" {
+			_ = r.ParseForm()
+		}
+		*captured = capturedRequest{
+			method:      r.Method,
+			path:        r.URL.Path,
+			query:       r.URL.Query().Get("query"),
+			timeout:     r.URL.Query().Get("timeout"),
+			body:        string(body),
+			contentType: r.Header.Get("Content-Type"),
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(payload))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, captured
+}
+
+func newRule(modify func(*v1alpha1.SearchRule)) *v1alpha1.SearchRule {
+	rule := &v1alpha1.SearchRule{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}}
+	modify(rule)
+	return rule
+}
+
+// run executes the whole backend cycle against the fake server
+func run(t *testing.T, connectorType string, srvURL string, rule *v1alpha1.SearchRule) (*Result, error) {
+	t.Helper()
+	conn := &Connector{
+		Spec:        &v1alpha1.QueryConnectorSpec{Type: connectorType, URL: srvURL},
+		Status:      &v1alpha1.QueryConnectorStatus{},
+		Credentials: &pools.Credentials{},
+	}
+	b, err := For(conn)
+	if err != nil {
+		t.Fatalf("For: %v", err)
+	}
+	if err = b.Validate(rule); err != nil {
+		return nil, err
+	}
+	req, err := b.BuildRequest(context.Background(), conn, rule)
+	if err != nil {
+		t.Fatalf("BuildRequest: %v", err)
+	}
+	body, err := b.Execute(http.DefaultClient, req)
+	if err != nil {
+		return nil, err
+	}
+	return b.Extract(rule, body)
+}
+
+func TestFor(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		specType, detected string
+		want               string
+		wantErr            bool
+	}{
+		{"", "", connector.FlavorElasticsearch, false},
+		{connector.FlavorAuto, connector.FlavorOpenSearch, connector.FlavorOpenSearch, false},
+		{connector.FlavorLoki, "", connector.FlavorLoki, false},
+		{connector.FlavorPrometheus, "", connector.FlavorPrometheus, false},
+		{connector.FlavorClickHouse, "", connector.FlavorClickHouse, false},
+		{"splunk", "", "", true},
+	}
+	for _, tc := range cases {
+		b, err := For(&Connector{
+			Spec:   &v1alpha1.QueryConnectorSpec{Type: tc.specType},
+			Status: &v1alpha1.QueryConnectorStatus{Distribution: tc.detected},
+		})
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("For(%q) err = %v, wantErr %v", tc.specType, err, tc.wantErr)
+		}
+		if err == nil && b.Name() != tc.want {
+			t.Errorf("For(%q).Name() = %q, want %q", tc.specType, b.Name(), tc.want)
+		}
+	}
+}
+
+func TestElasticsearchBackend(t *testing.T) {
+	t.Parallel()
+	srv, captured := newFakeBackend(t, http.StatusOK,
+		`{"hits":{"total":{"value":3,"relation":"eq"}},"aggregations":{"by_host":{"buckets":[{"key":"a","doc_count":3}]}}}`)
+
+	rule := newRule(func(r *v1alpha1.SearchRule) {
+		r.Spec.Elasticsearch = v1alpha1.Elasticsearch{
+			Index:          "logs",
+			ConditionField: "hits.total",
+			Query:          &apiextensionsv1.JSON{Raw: []byte(`{"size":0}`)},
+		}
+	})
+	got, err := run(t, connector.FlavorElasticsearch, srv.URL, rule)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got.Value != 3 {
+		t.Errorf("Value = %v, want 3", got.Value)
+	}
+	if got.Aggregations == nil {
+		t.Errorf("Aggregations not extracted")
+	}
+	if captured.method != http.MethodPost || captured.path != "/logs/_search" || captured.body != `{"size":0}` ||
+		captured.timeout != "60000ms" {
+		t.Errorf("unexpected request %+v", *captured)
+	}
+}
+
+func TestElasticsearchBackend_Validate(t *testing.T) {
+	t.Parallel()
+	es := &Elasticsearch{Profile: connector.NewProfile(connector.FlavorElasticsearch, "8.15.2")}
+	cases := []struct {
+		name string
+		spec v1alpha1.Elasticsearch
+		ok   bool
+	}{
+		{"no query", v1alpha1.Elasticsearch{Index: "logs"}, false},
+		{"query and sql", v1alpha1.Elasticsearch{Index: "logs", QueryJSON: `{}`, SQL: "SELECT 1"}, false},
+		{"query without index", v1alpha1.Elasticsearch{QueryJSON: `{}`}, false},
+		{"sql without index", v1alpha1.Elasticsearch{SQL: "SELECT COUNT(*) FROM logs"}, true},
+		{"ppl on elasticsearch", v1alpha1.Elasticsearch{PPL: "source=logs | stats count()"}, false},
+		{"query", v1alpha1.Elasticsearch{Index: "logs", QueryJSON: `{}`}, true},
+	}
+	for _, tc := range cases {
+		err := es.Validate(newRule(func(r *v1alpha1.SearchRule) { r.Spec.Elasticsearch = tc.spec }))
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: err = %v, want ok %v", tc.name, err, tc.ok)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("%s: err = %v, want ErrInvalidRule", tc.name, err)
+		}
+	}
+}
+
+func TestLokiBackend(t *testing.T) {
+	t.Parallel()
+	srv, captured := newFakeBackend(t, http.StatusOK,
+		`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"app":"api"},"value":[1700000000,"42"]}]}}`)
+
+	const logql = `sum(count_over_time({app="api"} |= "error" [5m]))`
+	rule := newRule(func(r *v1alpha1.SearchRule) { r.Spec.Loki = &v1alpha1.Loki{Query: logql} })
+	got, err := run(t, connector.FlavorLoki, srv.URL, rule)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got.Value != 42 {
+		t.Errorf("Value = %v, want 42", got.Value)
+	}
+	if captured.method != http.MethodGet || captured.path != "/loki/api/v1/query" || captured.query != logql {
+		t.Errorf("unexpected request %+v", *captured)
+	}
+}
+
+func TestPrometheusBackend(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name    string
+		payload string
+		field   string
+		want    float64
+		wantErr bool
+	}{
+		{
+			name:    "vector",
+			payload: `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"0.25"]}]}}`,
+			want:    0.25,
+		},
+		{
+			name:    "scalar",
+			payload: `{"status":"success","data":{"resultType":"scalar","result":[1700000000,"7"]}}`,
+			want:    7,
+		},
+		{
+			name:    "custom field",
+			payload: `{"status":"success","data":{"resultType":"vector","result":[{"value":[1,"1"]},{"value":[1,"9"]}]}}`,
+			field:   "data.result.1.value.1",
+			want:    9,
+		},
+		{
+			name:    "empty vector",
+			payload: `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+			wantErr: true,
+		},
+		{
+			name:    "failed query",
+			payload: `{"status":"error","errorType":"bad_data","error":"parse error"}`,
+			wantErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			srv, captured := newFakeBackend(t, http.StatusOK, tc.payload)
+			rule := newRule(func(r *v1alpha1.SearchRule) {
+				r.Spec.Prometheus = &v1alpha1.Prometheus{Query: "sum(rate(http_errors_total[5m]))", ConditionField: tc.field}
+			})
+			got, err := run(t, connector.FlavorPrometheus, srv.URL, rule)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if captured.path != "/api/v1/query" || captured.contentType != "application/x-www-form-urlencoded" {
+				t.Errorf("unexpected request %+v", *captured)
+			}
+			if err == nil && got.Value != tc.want {
+				t.Errorf("Value = %v, want %v", got.Value, tc.want)
+			}
+		})
+	}
+}
+
+func TestClickHouseBackend(t *testing.T) {
+	t.Parallel()
+	srv, captured := newFakeBackend(t, http.StatusOK, `{
+		"meta": [{"name": "count()", "type": "UInt64"}, {"name": "service", "type": "String"}],
+		"data": [{"count()": "12", "service": "api"}],
+		"rows": 1
+	}`)
+
+	const sql = "SELECT count(), service FROM logs WHERE level = 'error' GROUP BY service"
+	rule := newRule(func(r *v1alpha1.SearchRule) {
+		r.Spec.ClickHouse = &v1alpha1.ClickHouse{Query: sql, Database: "observability"}
+	})
+	got, err := run(t, connector.FlavorClickHouse, srv.URL, rule)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got.Value != 12 {
+		t.Errorf("Value = %v, want 12", got.Value)
+	}
+	wantAggregations := map[string]interface{}{
+		"data": []interface{}{map[string]interface{}{"count()": "12", "service": "api"}},
+	}
+	if !reflect.DeepEqual(got.Aggregations, wantAggregations) {
+		t.Errorf("Aggregations = %#v, want %#v", got.Aggregations, wantAggregations)
+	}
+	if captured.method != http.MethodPost || captured.body != sql {
+		t.Errorf("unexpected request %+v", *captured)
+	}
+}
+
+func TestBackendErrors(t *testing.T) {
+	t.Parallel()
+
+	// Rejected query
+	srv, _ := newFakeBackend(t, http.StatusBadRequest, `{"error":"parsing_exception"}`)
+	rule := newRule(func(r *v1alpha1.SearchRule) { r.Spec.Loki = &v1alpha1.Loki{Query: "{"} })
+	if _, err := run(t, connector.FlavorLoki, srv.URL, rule); !errors.Is(err, ErrQuery) {
+		t.Errorf("rejected query err = %v, want ErrQuery", err)
+	}
+
+	// Unreachable backend
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	if _, err := run(t, connector.FlavorLoki, closed.URL, rule); !errors.Is(err, ErrConnection) {
+		t.Errorf("unreachable backend err = %v, want ErrConnection", err)
+	}
+
+	// Response without the value to evaluate, still a query error
+	empty, _ := newFakeBackend(t, http.StatusOK, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+	if _, err := run(t, connector.FlavorLoki, empty.URL, rule); !errors.Is(err, ErrNoData) || !errors.Is(err, ErrQuery) {
+		t.Errorf("empty vector err = %v, want ErrNoData", err)
+	}
+
+	// Query block missing for the connector type
+	if _, err := run(t, connector.FlavorClickHouse, srv.URL, rule); !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("missing query err = %v, want ErrInvalidRule", err)
+	}
+}
+
+func TestPrometheusBackend_EvaluationTime(t *testing.T) {
+	t.Parallel()
+	conn := &Connector{
+		Spec:        &v1alpha1.QueryConnectorSpec{Type: connector.FlavorPrometheus, URL: "http://prometheus:9090"},
+		Status:      &v1alpha1.QueryConnectorStatus{},
+		Credentials: &pools.Credentials{},
+	}
+	b, err := For(conn)
+	if err != nil {
+		t.Fatalf("For: %v", err)
+	}
+	rule := newRule(func(r *v1alpha1.SearchRule) {
+		r.Spec.Prometheus = &v1alpha1.Prometheus{Query: "sum(rate(http_errors_total[5m]))"}
+	})
+
+	// Baseline queries are evaluated at the end of their window, in the past
+	at := time.Unix(1700000000, 0)
+	req, err := b.BuildRequest(WithEvaluationTime(context.Background(), at), conn, rule)
+	if err != nil {
+		t.Fatalf("BuildRequest: %v", err)
+	}
+	if err := req.ParseForm(); err != nil {
+		t.Fatalf("ParseForm: %v", err)
+	}
+	if got := req.PostForm.Get("time"); got != "1700000000" {
+		t.Errorf("time = %q, want the evaluation time", got)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tidwall/gjson"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/connector"
+	"freepik.com/searchruler/internal/controller"
+)
+
+const (
+	// ClickHouse HTTP interface endpoint. The query travels in the body
+	clickHouseQueryURL = "%s/?%s"
+
+	// Output format requested to ClickHouse: rows as objects under `data`, columns under `meta`
+	clickHouseFormat = "JSON"
+
+	// Key the rows of the result are exposed under in the aggregations
+	clickHouseAggregationsField = "data"
+)
+
+// ClickHouse runs SQL queries through the ClickHouse HTTP interface
+type ClickHouse struct{}
+
+// Name identifies the backend
+func (c *ClickHouse) Name() string {
+	return connector.FlavorClickHouse
+}
+
+// Validate checks that the rule defines a SQL query
+func (c *ClickHouse) Validate(rule *v1alpha1.SearchRule) error {
+	if rule.Spec.ClickHouse == nil || rule.Spec.ClickHouse.Query == "" {
+		return fmt.Errorf("%w: "+controller.BackendQueryNotDefinedErrorMessage, ErrInvalidRule, c.Name(), rule.Name)
+	}
+	return nil
+}
+
+// BuildRequest creates the request with the SQL query as body
+func (c *ClickHouse) BuildRequest(ctx context.Context, conn *Connector, rule *v1alpha1.SearchRule) (*http.Request, error) {
+
+	params := url.Values{}
+	params.Set("default_format", clickHouseFormat)
+	if rule.Spec.ClickHouse.Database != "" {
+		params.Set("database", rule.Spec.ClickHouse.Database)
+	}
+
+	req, err := connector.NewRequest(ctx, http.MethodPost, fmt.Sprintf(clickHouseQueryURL, conn.Spec.URL, params.Encode()),
+		strings.NewReader(rule.Spec.ClickHouse.Query), conn.Spec, conn.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	return req, nil
+}
+
+// Execute sends the request to ClickHouse
+func (c *ClickHouse) Execute(doer Doer, req *http.Request) ([]byte, error) {
+	return execute(c.Name(), doer, req)
+}
+
+// Extract reads the value of the rule from the rows of the result. The rows are exposed as
+// aggregations under `data`, so spec.customMetrics can emit one sample per row
+func (c *ClickHouse) Extract(rule *v1alpha1.SearchRule, body []byte) (*Result, error) {
+
+	response := gjson.ParseBytes(body)
+
+	// By default the value is the first column of the first row. Column names are
+	// escaped because expressions like `count()` or `t.errors` are valid names
+	conditionField := rule.Spec.ClickHouse.ConditionField
+	if conditionField == "" {
+		column := response.Get("meta.0.name").String()
+		conditionField = "data.0." + gjson.Escape(column)
+	}
+
+	// 64 bits integers are quoted in the JSON output, Float parses them from the string
+	conditionValue := response.Get(conditionField)
+	if !conditionValue.Exists() {
+		return nil, fmt.Errorf("%w: "+controller.ConditionFieldNotFoundMessage, ErrNoData, conditionField, string(body))
+	}
+
+	return &Result{
+		Value: conditionValue.Float(),
+		Aggregations: map[string]interface{}{
+			clickHouseAggregationsField: response.Get("data").Value(),
+		},
+	}, nil
+}
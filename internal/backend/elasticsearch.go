@@ -0,0 +1,258 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/connector"
+	"freepik.com/searchruler/internal/controller"
+)
+
+const (
+	// Elasticsearch aggregation field
+	elasticAggregationsField = "aggregations"
+
+	// Field holding the object form of `hits.total` since Elasticsearch 7
+	elasticTotalHitsValueSuffix = ".value"
+
+	// Field of the total hits of the responses, capped at 10k by default since Elasticsearch 7
+	elasticTotalHitsField = "hits.total"
+
+	// Parameter of `_search` and field of the searches of `_msearch` bounding how long they run
+	searchTimeoutParam = "timeout"
+
+	// Field of the Elasticsearch SQL requests failing the statement once it runs for longer
+	sqlRequestTimeoutField = "request_timeout"
+
+	// Field of the responses of searches stopped by their timeout, with the hits found until then
+	searchTimedOutField = "timed_out"
+)
+
+// Elasticsearch runs Query DSL searches, SQL and PPL queries against Elasticsearch and OpenSearch
+// clusters. Profile shapes the requests for the distribution and version behind the connector
+type Elasticsearch struct {
+	Profile connector.Profile
+}
+
+// Name identifies the backend
+func (e *Elasticsearch) Name() string {
+	return e.Profile.Flavor
+}
+
+// Validate checks that exactly one kind of query is defined in the resource
+func (e *Elasticsearch) Validate(rule *v1alpha1.SearchRule) error {
+
+	definedQueries := 0
+	for _, defined := range []bool{
+		rule.Spec.Elasticsearch.Query != nil,
+		rule.Spec.Elasticsearch.QueryJSON != "",
+		rule.Spec.Elasticsearch.SQL != "",
+		rule.Spec.Elasticsearch.PPL != "",
+	} {
+		if defined {
+			definedQueries++
+		}
+	}
+	if definedQueries == 0 {
+		return fmt.Errorf("%w: "+controller.QueryNotDefinedErrorMessage, ErrInvalidRule, rule.Name)
+	}
+	if definedQueries > 1 {
+		return fmt.Errorf("%w: "+controller.QueryDefinedInBothErrorMessage, ErrInvalidRule, rule.Name)
+	}
+
+	// Query DSL searches run against an index, SQL and PPL name it in the statement
+	if (rule.Spec.Elasticsearch.Query != nil || rule.Spec.Elasticsearch.QueryJSON != "") &&
+		rule.Spec.Elasticsearch.Index == "" {
+		return fmt.Errorf("%w: "+controller.IndexNotDefinedErrorMessage, ErrInvalidRule, rule.Name)
+	}
+
+	if rule.Spec.Elasticsearch.PPL != "" {
+		if _, err := e.Profile.PPLURL(""); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRule, err)
+		}
+	}
+
+	return nil
+}
+
+// BuildRequest selects the query to use, marshals it to JSON and picks the endpoint for it
+// depending on the distribution behind the QueryConnector
+func (e *Elasticsearch) BuildRequest(ctx context.Context, conn *Connector, rule *v1alpha1.SearchRule) (*http.Request, error) {
+
+	var elasticQuery []byte
+	var searchURL string
+
+	// The cluster stops the search when the request times out, instead of running it for nobody.
+	// Query DSL searches take the timeout as a parameter, Elasticsearch SQL in the body
+	settings, err := connector.RequestSettingsFor(conn.Spec, rule.Spec.RequestPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("%w: "+controller.RequestPolicyParseErrorMessage, ErrInvalidRule, err)
+	}
+	timeout := connector.SearchTimeout(settings.Timeout)
+
+	switch {
+	case rule.Spec.Elasticsearch.SQL != "":
+		// The SQL plugin of OpenSearch takes no timeout, so its statements are only bounded
+		// by the request
+		sqlQuery := map[string]string{"query": rule.Spec.Elasticsearch.SQL}
+		if e.Profile.Flavor != connector.FlavorOpenSearch {
+			sqlQuery[sqlRequestTimeoutField] = timeout
+		}
+		elasticQuery, err = json.Marshal(sqlQuery)
+		if err != nil {
+			return nil, fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+		}
+		searchURL = e.Profile.SQLURL(conn.Spec.URL)
+
+	// PPL, which only OpenSearch provides, takes no timeout either
+	case rule.Spec.Elasticsearch.PPL != "":
+		elasticQuery, err = json.Marshal(map[string]string{"query": rule.Spec.Elasticsearch.PPL})
+		if err != nil {
+			return nil, fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+		}
+		searchURL, err = e.Profile.PPLURL(conn.Spec.URL)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		elasticQuery, err = dslQuery(rule)
+		if err != nil {
+			return nil, err
+		}
+
+		// Generate URL for search to elasticsearch
+		searchURL = e.Profile.SearchURL(conn.Spec.URL, rule.Spec.Elasticsearch.Index, elasticQuery, readsTotalHits(rule))
+		separator := "?"
+		if strings.Contains(searchURL, "?") {
+			separator = "&"
+		}
+		searchURL += separator + searchTimeoutParam + "=" + timeout
+	}
+
+	return connector.NewRequest(ctx, http.MethodPost, searchURL, bytes.NewReader(elasticQuery),
+		conn.Spec, conn.Credentials)
+}
+
+// dslQuery returns the Query DSL search of the rule as JSON
+func dslQuery(rule *v1alpha1.SearchRule) ([]byte, error) {
+
+	// If queryJSON is defined in the resource, it is already a JSON, just convert it to bytes
+	if rule.Spec.Elasticsearch.QueryJSON != "" {
+		return []byte(rule.Spec.Elasticsearch.QueryJSON), nil
+	}
+
+	// If query is defined in the resource, just Marshal it
+	elasticQuery, err := json.Marshal(rule.Spec.Elasticsearch.Query)
+	if err != nil {
+		return nil, fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+	}
+	return elasticQuery, nil
+}
+
+// Execute sends the request to the cluster
+func (e *Elasticsearch) Execute(doer Doer, req *http.Request) ([]byte, error) {
+	return execute(e.Name(), doer, req)
+}
+
+// Extract reads the conditionField and, when present, the aggregations of the response,
+// which allows users to use them in the action
+func (e *Elasticsearch) Extract(rule *v1alpha1.SearchRule, body []byte) (*Result, error) {
+
+	if searchTimedOut(gjson.ParseBytes(body)) {
+		return nil, fmt.Errorf("%w: "+controller.SearchTimedOutErrorMessage, ErrQuery)
+	}
+
+	conditionValue := getConditionValue(body, rule.Spec.Elasticsearch.ConditionField)
+	if !conditionValue.Exists() {
+		return nil, fmt.Errorf("%w: "+controller.ConditionFieldNotFoundMessage,
+			ErrNoData, rule.Spec.Elasticsearch.ConditionField, string(body))
+	}
+
+	result := &Result{Value: conditionValue.Float()}
+	if aggregationsResponse := gjson.GetBytes(body, elasticAggregationsField); aggregationsResponse.Exists() {
+		result.Aggregations = aggregationsResponse.Value()
+	}
+
+	return result, nil
+}
+
+// searchTimedOut tells whether the search was stopped by its timeout. The cluster answers it
+// with the hits found until then, so its counts can not be evaluated as the real ones
+func searchTimedOut(response gjson.Result) bool {
+	return response.Get(searchTimedOutField).Bool()
+}
+
+// readsTotalHits tells whether the condition of the rule reads the total hits of the response,
+// from its conditionField, the fields of its leaves or its expression. Only those searches
+// count every hit, as counting past the default cap of the cluster is slower
+func readsTotalHits(rule *v1alpha1.SearchRule) bool {
+
+	readsField := func(field string) bool {
+		return field == elasticTotalHitsField || strings.HasPrefix(field, elasticTotalHitsField+".")
+	}
+	var readsNodes func(nodes []v1alpha1.ConditionNode) bool
+	readsNodes = func(nodes []v1alpha1.ConditionNode) bool {
+		for _, node := range nodes {
+			if readsField(node.Field) || readsNodes(node.All) || readsNodes(node.Any) ||
+				node.Not != nil && readsNodes([]v1alpha1.ConditionNode{*node.Not}) {
+				return true
+			}
+		}
+		return false
+	}
+
+	condition := &rule.Spec.Condition
+	if readsField(rule.Spec.Elasticsearch.ConditionField) || strings.Contains(condition.Expression, elasticTotalHitsField) {
+		return true
+	}
+	return readsNodes(condition.All) || readsNodes(condition.Any) ||
+		condition.Not != nil && readsNodes([]v1alpha1.ConditionNode{*condition.Not})
+}
+
+// getConditionValue extracts the conditionField from the response. `hits.total` is a number
+// before Elasticsearch 7 and an object with the count in `value` since then (and in OpenSearch),
+// so both shapes are accepted whatever form the conditionField was written for
+func getConditionValue(responseBody []byte, conditionField string) gjson.Result {
+
+	conditionValue := gjson.GetBytes(responseBody, conditionField)
+	if conditionValue.IsObject() {
+		if totalValue := conditionValue.Get("value"); totalValue.Exists() {
+			return totalValue
+		}
+	}
+
+	// Field written for the object form but the cluster answers with a plain number
+	if !conditionValue.Exists() && strings.HasSuffix(conditionField, elasticTotalHitsValueSuffix) {
+		parentValue := gjson.GetBytes(responseBody, strings.TrimSuffix(conditionField, elasticTotalHitsValueSuffix))
+		if parentValue.Type == gjson.Number {
+			return parentValue
+		}
+	}
+
+	return conditionValue
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/connector"
+	"freepik.com/searchruler/internal/pools"
+)
+
+func TestGetConditionValue(t *testing.T) {
+	t.Parallel()
+	const (
+		modernTotal = `{"hits":{"total":{"value":12000,"relation":"eq"},"hits":[]}}`
+		legacyTotal = `{"hits":{"total":42,"hits":[]}}`
+	)
+	cases := []struct {
+		name       string
+		response   string
+		field      string
+		want       float64
+		wantExists bool
+	}{
+		{"object form with value path", modernTotal, "hits.total.value", 12000, true},
+		{"object form with total path", modernTotal, "hits.total", 12000, true},
+		{"legacy form with value path", legacyTotal, "hits.total.value", 42, true},
+		{"legacy form with total path", legacyTotal, "hits.total", 42, true},
+		{"missing field", legacyTotal, "aggregations.errors.value", 0, false},
+		{"sql rows", `{"columns":[{"name":"c"}],"rows":[[7]]}`, "rows.0.0", 7, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got := getConditionValue([]byte(tc.response), tc.field)
+			if got.Exists() != tc.wantExists {
+				t.Fatalf("Exists() = %v, want %v", got.Exists(), tc.wantExists)
+			}
+			if got.Float() != tc.want {
+				t.Errorf("Float() = %v, want %v", got.Float(), tc.want)
+			}
+		})
+	}
+}
+
+func TestExtractTimedOut(t *testing.T) {
+	t.Parallel()
+	es := &Elasticsearch{}
+	rule := newRule(func(r *v1alpha1.SearchRule) {
+		r.Spec.Elasticsearch.ConditionField = "hits.total"
+	})
+
+	// The hits counted until the timeout are not the value of the rule
+	_, err := es.Extract(rule, []byte(`{"timed_out":true,"hits":{"total":{"value":3,"relation":"eq"}}}`))
+	if !errors.Is(err, ErrQuery) || errors.Is(err, ErrNoData) {
+		t.Errorf("err = %v, want a query error", err)
+	}
+
+	result, err := es.Extract(rule, []byte(`{"timed_out":false,"hits":{"total":{"value":3,"relation":"eq"}}}`))
+	if err != nil || result.Value != 3 {
+		t.Errorf("value %v, err %v, want 3", result, err)
+	}
+}
+
+func TestBuildRequestSQLTimeout(t *testing.T) {
+	t.Parallel()
+	conn := &Connector{
+		Spec:        &v1alpha1.QueryConnectorSpec{URL: "http://es"},
+		Credentials: &pools.Credentials{},
+	}
+	cases := []struct {
+		name    string
+		profile connector.Profile
+		rule    *v1alpha1.SearchRule
+		want    string
+	}{
+		{
+			name:    "elasticsearch sql",
+			profile: connector.NewProfile(connector.FlavorElasticsearch, "8.15.2"),
+			rule: newRule(func(r *v1alpha1.SearchRule) {
+				r.Spec.Elasticsearch.SQL = "SELECT COUNT(*) FROM logs"
+				r.Spec.RequestPolicy = &v1alpha1.RequestPolicy{Timeout: "30s"}
+			}),
+			want: `{"query":"SELECT COUNT(*) FROM logs","request_timeout":"30000ms"}`,
+		},
+		{
+			name:    "opensearch sql",
+			profile: connector.NewProfile(connector.FlavorOpenSearch, "2.17.1"),
+			rule:    newRule(func(r *v1alpha1.SearchRule) { r.Spec.Elasticsearch.SQL = "SELECT COUNT(*) FROM logs" }),
+			want:    `{"query":"SELECT COUNT(*) FROM logs"}`,
+		},
+		{
+			name:    "opensearch ppl",
+			profile: connector.NewProfile(connector.FlavorOpenSearch, "2.17.1"),
+			rule:    newRule(func(r *v1alpha1.SearchRule) { r.Spec.Elasticsearch.PPL = "source=logs | stats count()" }),
+			want:    `{"query":"source=logs | stats count()"}`,
+		},
+	}
+	for _, tc := range cases {
+		es := &Elasticsearch{Profile: tc.profile}
+		req, err := es.BuildRequest(context.Background(), conn, tc.rule)
+		if err != nil {
+			t.Fatalf("%s: BuildRequest: %v", tc.name, err)
+		}
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			t.Fatalf("%s: read body: %v", tc.name, err)
+		}
+		if string(body) != tc.want {
+			t.Errorf("%s: body = %s, want %s", tc.name, body, tc.want)
+		}
+	}
+}
+
+func TestReadsTotalHits(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name   string
+		modify func(*v1alpha1.SearchRule)
+		want   bool
+	}{
+		{"conditionField", func(r *v1alpha1.SearchRule) { r.Spec.Elasticsearch.ConditionField = "hits.total" }, true},
+		{"conditionField value", func(r *v1alpha1.SearchRule) { r.Spec.Elasticsearch.ConditionField = "hits.total.value" }, true},
+		{"aggregation", func(r *v1alpha1.SearchRule) {
+			r.Spec.Elasticsearch.ConditionField = "aggregations.hits.total.value"
+		}, false},
+		{"leaf of a compound condition", func(r *v1alpha1.SearchRule) {
+			r.Spec.Elasticsearch.ConditionField = "aggregations.p99.value"
+			r.Spec.Condition.All = []v1alpha1.ConditionNode{
+				{Field: "aggregations.p99.value"},
+				{Not: &v1alpha1.ConditionNode{Field: "hits.total.value"}},
+			}
+		}, true},
+		{"expression", func(r *v1alpha1.SearchRule) {
+			r.Spec.Condition.Expression = "response.aggregations.errors.doc_count / response.hits.total.value > 0.05"
+		}, true},
+	}
+	for _, tc := range cases {
+		if got := readsTotalHits(newRule(tc.modify)); got != tc.want {
+			t.Errorf("%s: readsTotalHits = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/connector"
+	"freepik.com/searchruler/internal/controller"
+)
+
+const (
+	// Loki HTTP API endpoint for instant queries
+	lokiQueryURL = "%s/loki/api/v1/query?%s"
+)
+
+// Loki runs LogQL instant queries against the Loki HTTP API
+type Loki struct{}
+
+// Name identifies the backend
+func (l *Loki) Name() string {
+	return connector.FlavorLoki
+}
+
+// Validate checks that the rule defines a LogQL query
+func (l *Loki) Validate(rule *v1alpha1.SearchRule) error {
+	if rule.Spec.Loki == nil || rule.Spec.Loki.Query == "" {
+		return fmt.Errorf("%w: "+controller.BackendQueryNotDefinedErrorMessage, ErrInvalidRule, l.Name(), rule.Name)
+	}
+	return nil
+}
+
+// BuildRequest creates an instant query evaluated at the evaluation time of the context, now by
+// default
+func (l *Loki) BuildRequest(ctx context.Context, conn *Connector, rule *v1alpha1.SearchRule) (*http.Request, error) {
+
+	params := url.Values{}
+	params.Set("query", rule.Spec.Loki.Query)
+	params.Set("time", strconv.FormatInt(evaluationTime(ctx).UnixNano(), 10))
+
+	return connector.NewRequest(ctx, http.MethodGet, fmt.Sprintf(lokiQueryURL, conn.Spec.URL, params.Encode()),
+		nil, conn.Spec, conn.Credentials)
+}
+
+// Execute sends the request to Loki
+func (l *Loki) Execute(doer Doer, req *http.Request) ([]byte, error) {
+	return execute(l.Name(), doer, req)
+}
+
+// Extract reads the value of the rule from the query result, which has the same shape
+// as the one of Prometheus
+func (l *Loki) Extract(rule *v1alpha1.SearchRule, body []byte) (*Result, error) {
+	return extractQueryResult(body, rule.Spec.Loki.ConditionField)
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/connector"
+	"freepik.com/searchruler/internal/controller"
+)
+
+const (
+	// Content type of `_msearch` requests: a header and a query per line
+	multiSearchContentType = "application/x-ndjson"
+)
+
+// Batchable tells whether the query of the rule can run in a `_msearch`. Only Query DSL
+// searches can, SQL and PPL have their own endpoints. Queries compared with a baseline run
+// alone. Templated queries are rendered for the evaluation of their own rule, so they never
+// join the batch of another one, but they can lead their own once rendered
+func (e *Elasticsearch) Batchable(rule *v1alpha1.SearchRule) bool {
+	if rule.Spec.Elasticsearch.Query == nil && rule.Spec.Elasticsearch.QueryJSON == "" {
+		return false
+	}
+	if rule.Spec.Elasticsearch.Query != nil && bytes.Contains(rule.Spec.Elasticsearch.Query.Raw, []byte("{{")) {
+		return false
+	}
+	return rule.Spec.Elasticsearch.Index != "" && rule.Spec.Condition.Comparison == nil &&
+		!strings.Contains(rule.Spec.Elasticsearch.QueryJSON, "{{") && !strings.Contains(rule.Spec.Elasticsearch.Index, "{{")
+}
+
+// BuildBatchRequest creates a `_msearch` request with the searches of the rules, in order
+func (e *Elasticsearch) BuildBatchRequest(ctx context.Context, conn *Connector, rules []*v1alpha1.SearchRule) (*http.Request, error) {
+
+	// The batch is sent with the timeout of the rule being evaluated, the first one
+	settings, err := connector.RequestSettingsFor(conn.Spec, rules[0].Spec.RequestPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("%w: "+controller.RequestPolicyParseErrorMessage, ErrInvalidRule, err)
+	}
+	timeout := connector.SearchTimeout(settings.Timeout)
+
+	body := &bytes.Buffer{}
+	for _, rule := range rules {
+		header, err := json.Marshal(map[string]string{"index": rule.Spec.Elasticsearch.Index})
+		if err != nil {
+			return nil, fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+		}
+
+		elasticQuery, err := dslQuery(rule)
+		if err != nil {
+			return nil, err
+		}
+		line, err := e.Profile.MultiSearchBody(elasticQuery, readsTotalHits(rule))
+		if err != nil {
+			return nil, fmt.Errorf("%w: "+controller.BatchQueryErrorMessage, ErrInvalidRule, rule.Namespace, rule.Name, err)
+		}
+
+		body.Write(header)
+		body.WriteByte('\n')
+		body.Write(withField(line, searchTimeoutParam, timeout))
+		body.WriteByte('\n')
+	}
+
+	req, err := connector.NewRequest(ctx, http.MethodPost, e.Profile.MultiSearchURL(conn.Spec.URL),
+		bytes.NewReader(body.Bytes()), conn.Spec, conn.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", multiSearchContentType)
+	return req, nil
+}
+
+// SplitBatchResponse returns the response to each search of a `_msearch`, in the order of the request
+func (e *Elasticsearch) SplitBatchResponse(body []byte, size int) ([]BatchItem, error) {
+
+	responses := gjson.GetBytes(body, "responses").Array()
+	if len(responses) != size {
+		return nil, fmt.Errorf("%w: "+controller.BatchResponseSizeErrorMessage, ErrQuery, len(responses), size)
+	}
+
+	items := make([]BatchItem, 0, size)
+	for _, response := range responses {
+		if searchError := response.Get("error"); searchError.Exists() {
+			items = append(items, BatchItem{
+				Err: fmt.Errorf("%w: "+controller.BackendResponseStatusErrorMessage, ErrQuery, searchError.Raw),
+			})
+			continue
+		}
+		if searchTimedOut(response) {
+			items = append(items, BatchItem{
+				Err: fmt.Errorf("%w: "+controller.SearchTimedOutErrorMessage, ErrQuery),
+			})
+			continue
+		}
+		items = append(items, BatchItem{Body: []byte(response.Raw)})
+	}
+
+	return items, nil
+}
+
+// withField adds the string field to the JSON object in the line, unless the query already
+// sets it. Only the top-level keys are looked at, as a field of the same name may be nested
+// anywhere in the query
+func withField(line []byte, name, value string) []byte {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(line, &fields); err != nil || !bytes.HasPrefix(line, []byte("{")) {
+		return line
+	}
+	if _, set := fields[name]; set {
+		return line
+	}
+
+	field, err := json.Marshal(map[string]string{name: value})
+	if err != nil {
+		return line
+	}
+	fielded := field[:len(field)-1]
+	if len(fields) > 0 {
+		fielded = append(fielded, ',')
+	}
+	return append(fielded, line[1:]...)
+}
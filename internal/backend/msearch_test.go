@@ -0,0 +1,155 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/connector"
+	"freepik.com/searchruler/internal/pools"
+)
+
+func TestMultiSearch(t *testing.T) {
+	t.Parallel()
+	srv, captured := newFakeBackend(t, http.StatusOK, `{"responses": [
+		{"hits": {"total": {"value": 12, "relation": "eq"}}, "status": 200},
+		{"error": {"type": "index_not_found_exception", "reason": "no such index [audit]"}, "status": 404},
+		{"timed_out": true, "hits": {"total": {"value": 3, "relation": "eq"}}, "status": 200}
+	]}`)
+
+	es := &Elasticsearch{Profile: connector.NewProfile(connector.FlavorElasticsearch, "8.15.2")}
+	conn := &Connector{
+		Spec:        &v1alpha1.QueryConnectorSpec{URL: srv.URL},
+		Credentials: &pools.Credentials{},
+	}
+	rules := []*v1alpha1.SearchRule{
+		newRule(func(r *v1alpha1.SearchRule) {
+			r.Spec.Elasticsearch.Index = "logs-*"
+			r.Spec.Elasticsearch.QueryJSON = `{ "size": 0, "query": {"match_all": {}} }`
+			r.Spec.Elasticsearch.ConditionField = "hits.total.value"
+			r.Spec.RequestPolicy = &v1alpha1.RequestPolicy{Timeout: "30s"}
+		}),
+		newRule(func(r *v1alpha1.SearchRule) {
+			r.Spec.Elasticsearch.Index = "audit"
+			r.Spec.Elasticsearch.ConditionField = "hits.total"
+			r.Spec.Elasticsearch.Query = &apiextensionsv1.JSON{Raw: []byte(`{"size":0,"track_total_hits":1000,"timeout":"5s"}`)}
+		}),
+		newRule(func(r *v1alpha1.SearchRule) {
+			r.Spec.Elasticsearch.Index = "slow"
+			r.Spec.Elasticsearch.QueryJSON = `{}`
+		}),
+	}
+
+	req, err := es.BuildBatchRequest(context.Background(), conn, rules)
+	if err != nil {
+		t.Fatalf("BuildBatchRequest: %v", err)
+	}
+	body, err := es.Execute(http.DefaultClient, req)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	wantBody := `{"index":"logs-*"}
+{"timeout":"30000ms","track_total_hits":true,"size":0,"query":{"match_all":{}}}
+{"index":"audit"}
+{"size":0,"track_total_hits":1000,"timeout":"5s"}
+{"index":"slow"}
+{"timeout":"30000ms"}
+`
+	if captured.path != "/_msearch" || captured.contentType != "application/x-ndjson" || captured.body != wantBody {
+		t.Errorf("got %s %s with body\n%s", captured.path, captured.contentType, captured.body)
+	}
+
+	items, err := es.SplitBatchResponse(body, len(rules))
+	if err != nil {
+		t.Fatalf("SplitBatchResponse: %v", err)
+	}
+	if items[0].Err != nil {
+		t.Fatalf("first item failed: %v", items[0].Err)
+	}
+	result, err := es.Extract(newRule(func(r *v1alpha1.SearchRule) {
+		r.Spec.Elasticsearch.ConditionField = "hits.total"
+	}), items[0].Body)
+	if err != nil || result.Value != 12 {
+		t.Errorf("first item: value %v, err %v", result, err)
+	}
+	if !errors.Is(items[1].Err, ErrQuery) {
+		t.Errorf("second item err = %v, want ErrQuery", items[1].Err)
+	}
+	// Searches stopped by their timeout only counted part of the hits
+	if !errors.Is(items[2].Err, ErrQuery) {
+		t.Errorf("timed out item err = %v, want ErrQuery", items[2].Err)
+	}
+
+	if _, err = es.SplitBatchResponse(body, 2); !errors.Is(err, ErrQuery) {
+		t.Errorf("size mismatch err = %v, want ErrQuery", err)
+	}
+}
+
+func TestBatchable(t *testing.T) {
+	t.Parallel()
+	es := &Elasticsearch{Profile: connector.NewProfile(connector.FlavorOpenSearch, "2.17.1")}
+	cases := []struct {
+		name string
+		rule *v1alpha1.SearchRule
+		want bool
+	}{
+		{"query dsl", newRule(func(r *v1alpha1.SearchRule) {
+			r.Spec.Elasticsearch.Index = "logs"
+			r.Spec.Elasticsearch.QueryJSON = `{}`
+		}), true},
+		{"sql", newRule(func(r *v1alpha1.SearchRule) { r.Spec.Elasticsearch.SQL = "SELECT 1" }), false},
+		{"templated query", newRule(func(r *v1alpha1.SearchRule) {
+			r.Spec.Elasticsearch.Index = "logs"
+			r.Spec.Elasticsearch.QueryJSON = `{"query":{"range":{"@timestamp":{"gte":"{{ .from }}"}}}}`
+		}), false},
+		{"templated index", newRule(func(r *v1alpha1.SearchRule) {
+			r.Spec.Elasticsearch.Index = `logs-{{ now | date "2006.01.02" }}`
+			r.Spec.Elasticsearch.QueryJSON = `{}`
+		}), false},
+		{"loki", newRule(func(r *v1alpha1.SearchRule) { r.Spec.Loki = &v1alpha1.Loki{Query: "up"} }), false},
+	}
+	for _, tc := range cases {
+		if got := es.Batchable(tc.rule); got != tc.want {
+			t.Errorf("%s: Batchable = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestWithField(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name, line, want string
+	}{
+		{"empty query", `{}`, `{"timeout":"5000ms"}`},
+		{"query", `{"size":0}`, `{"timeout":"5000ms","size":0}`},
+		{"set by the query", `{"size":0,"timeout":"1s"}`, `{"size":0,"timeout":"1s"}`},
+		{"nested field of the same name", `{"query":{"term":{"timeout":"yes"}}}`, `{"timeout":"5000ms","query":{"term":{"timeout":"yes"}}}`},
+		{"not an object", `[]`, `[]`},
+	}
+	for _, tc := range cases {
+		if got := string(withField([]byte(tc.line), searchTimeoutParam, "5000ms")); got != tc.want {
+			t.Errorf("%s: withField = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/connector"
+	"freepik.com/searchruler/internal/controller"
+)
+
+const (
+	// Prometheus HTTP API endpoint for instant queries
+	prometheusQueryURL = "%s/api/v1/query"
+
+	// Default conditionFields for the responses of the Prometheus HTTP API, which Loki shares:
+	// the value of the first sample of a vector, or the value of a scalar
+	vectorConditionField = "data.result.0.value.1"
+	scalarConditionField = "data.result.1"
+	scalarResultType     = "scalar"
+
+	// Key the result of the query is exposed under in the aggregations
+	vectorAggregationsField = "result"
+)
+
+// Prometheus runs PromQL instant queries against the Prometheus HTTP API
+type Prometheus struct{}
+
+// Name identifies the backend
+func (p *Prometheus) Name() string {
+	return connector.FlavorPrometheus
+}
+
+// Validate checks that the rule defines a PromQL query
+func (p *Prometheus) Validate(rule *v1alpha1.SearchRule) error {
+	if rule.Spec.Prometheus == nil || rule.Spec.Prometheus.Query == "" {
+		return fmt.Errorf("%w: "+controller.BackendQueryNotDefinedErrorMessage, ErrInvalidRule, p.Name(), rule.Name)
+	}
+	return nil
+}
+
+// BuildRequest creates an instant query evaluated at the evaluation time of the context, now by
+// default. The query travels form-encoded in the body so long expressions do not hit URL length
+// limits
+func (p *Prometheus) BuildRequest(ctx context.Context, conn *Connector, rule *v1alpha1.SearchRule) (*http.Request, error) {
+
+	form := url.Values{}
+	form.Set("query", rule.Spec.Prometheus.Query)
+	form.Set("time", strconv.FormatInt(evaluationTime(ctx).Unix(), 10))
+
+	req, err := connector.NewRequest(ctx, http.MethodPost, fmt.Sprintf(prometheusQueryURL, conn.Spec.URL),
+		strings.NewReader(form.Encode()), conn.Spec, conn.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return req, nil
+}
+
+// Execute sends the request to Prometheus
+func (p *Prometheus) Execute(doer Doer, req *http.Request) ([]byte, error) {
+	return execute(p.Name(), doer, req)
+}
+
+// Extract reads the value of the rule from the query result
+func (p *Prometheus) Extract(rule *v1alpha1.SearchRule, body []byte) (*Result, error) {
+	return extractQueryResult(body, rule.Spec.Prometheus.ConditionField)
+}
+
+// extractQueryResult reads a response of the Prometheus HTTP API, also used by Loki. The series
+// of the result are exposed as aggregations under `result`, so spec.customMetrics can emit one
+// sample per series with `aggregation_map: result`
+func extractQueryResult(body []byte, conditionField string) (*Result, error) {
+
+	response := gjson.ParseBytes(body)
+	if response.Get("status").String() != "success" {
+		return nil, fmt.Errorf("%w: "+controller.BackendResponseStatusErrorMessage, ErrQuery, response.Get("error").String())
+	}
+
+	if conditionField == "" {
+		conditionField = vectorConditionField
+		if response.Get("data.resultType").String() == scalarResultType {
+			conditionField = scalarConditionField
+		}
+	}
+
+	conditionValue := response.Get(conditionField)
+	if !conditionValue.Exists() {
+		return nil, fmt.Errorf("%w: "+controller.ConditionFieldNotFoundMessage, ErrNoData, conditionField, string(body))
+	}
+
+	return &Result{
+		Value: conditionValue.Float(),
+		Aggregations: map[string]interface{}{
+			vectorAggregationsField: response.Get("data.result").Value(),
+		},
+	}, nil
+}
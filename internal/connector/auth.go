@@ -0,0 +1,64 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connector
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	//
+	"freepik.com/searchruler/internal/pools"
+)
+
+const (
+
+	// Authentication modes stored in pools.Credentials.AuthMode
+	AuthModeBasic  = "basic"
+	AuthModeAPIKey = "apiKey"
+	AuthModeBearer = "bearer"
+	AuthModeSigV4  = "sigv4"
+
+	// Default signing name for Amazon OpenSearch Service domains
+	DefaultSigV4Service = "es"
+)
+
+// Authenticate adds the authentication of the connector to the request. SigV4 signatures
+// cover the host and the body, so it must be called once the request is final and again
+// whenever it is sent somewhere else
+func Authenticate(req *http.Request, creds *pools.Credentials) error {
+	if creds == nil {
+		return nil
+	}
+
+	switch creds.AuthMode {
+	case "":
+		return nil
+	case AuthModeBasic:
+		req.SetBasicAuth(creds.Username, creds.Password)
+	case AuthModeAPIKey:
+		req.Header.Set("Authorization", "ApiKey "+creds.APIKey)
+	case AuthModeBearer:
+		req.Header.Set("Authorization", "Bearer "+creds.BearerToken)
+	case AuthModeSigV4:
+		return signV4(req, creds, time.Now())
+	default:
+		return fmt.Errorf("unknown authentication mode %q", creds.AuthMode)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connector
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"freepik.com/searchruler/internal/pools"
+)
+
+func TestAuthenticate(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name  string
+		creds *pools.Credentials
+		want  string
+	}{
+		{"no credentials", nil, ""},
+		{"no auth mode", &pools.Credentials{}, ""},
+		{"basic", &pools.Credentials{AuthMode: AuthModeBasic, Username: "elastic", Password: "changeme"}, "Basic ZWxhc3RpYzpjaGFuZ2VtZQ=="},
+		{"api key", &pools.Credentials{AuthMode: AuthModeAPIKey, APIKey: "VnVhQ2ZHY0JDZGJrUW0tZTVhT3g6dWkybHAyYXhUTm1zeWFrdzl0dk5udw=="}, "ApiKey VnVhQ2ZHY0JDZGJrUW0tZTVhT3g6dWkybHAyYXhUTm1zeWFrdzl0dk5udw=="},
+		{"bearer", &pools.Credentials{AuthMode: AuthModeBearer, BearerToken: "token"}, "Bearer token"},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest(http.MethodGet, "https://cluster:9200/", nil)
+		if err := Authenticate(req, tc.creds); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := req.Header.Get("Authorization"); got != tc.want {
+			t.Errorf("%s: Authorization = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://cluster:9200/", nil)
+	if err := Authenticate(req, &pools.Credentials{AuthMode: "kerberos"}); err == nil {
+		t.Errorf("unknown auth mode must fail")
+	}
+}
+
+// Vectors of the AWS Signature Version 4 test suite
+func TestSignV4(t *testing.T) {
+	t.Parallel()
+	creds := &pools.Credentials{
+		AuthMode:        AuthModeSigV4,
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:          "us-east-1",
+		Service:         "service",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	cases := []struct {
+		name   string
+		method string
+		url    string
+		want   string
+	}{
+		{
+			name:   "get-vanilla",
+			method: http.MethodGet,
+			url:    "https://example.amazonaws.com/",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:   "post-vanilla",
+			method: http.MethodPost,
+			url:    "https://example.amazonaws.com/",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:   "get-vanilla-query-order-key-case",
+			method: http.MethodGet,
+			url:    "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest(tc.method, tc.url, nil)
+		if err := signV4(req, creds, now); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := req.Header.Get("Authorization"); got != tc.want {
+			t.Errorf("%s:\n got %s\nwant %s", tc.name, got, tc.want)
+		}
+		if got := req.Header.Get(headerAmzDate); got != "20150830T123600Z" {
+			t.Errorf("%s: X-Amz-Date = %q", tc.name, got)
+		}
+	}
+}
+
+func TestSignV4_SessionTokenAndServerless(t *testing.T) {
+	t.Parallel()
+	creds := &pools.Credentials{
+		AuthMode:        AuthModeSigV4,
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		SessionToken:    "session",
+		Region:          "eu-west-1",
+		Service:         "aoss",
+	}
+	req, _ := http.NewRequest(http.MethodPost, "https://collection.eu-west-1.aoss.amazonaws.com/logs-*/_search",
+		strings.NewReader(`{"size":0}`))
+	if err := signV4(req, creds, time.Now()); err != nil {
+		t.Fatalf("signV4: %v", err)
+	}
+	authorization := req.Header.Get("Authorization")
+	if !strings.Contains(authorization, "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token,") {
+		t.Errorf("unexpected signed headers in %q", authorization)
+	}
+	if req.Header.Get(headerAmzSecurityToken) != "session" {
+		t.Errorf("session token header not set")
+	}
+	if req.Header.Get(headerAmzContentSHA256) != sha256Hex([]byte(`{"size":0}`)) {
+		t.Errorf("payload hash header does not match the body")
+	}
+}
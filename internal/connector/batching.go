@@ -0,0 +1,64 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connector
+
+import (
+	"fmt"
+	"time"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+)
+
+const (
+
+	// Defaults of QueryBatching, also set by the CRD
+	defaultBatchWindow  = 5 * time.Second
+	defaultBatchMaxSize = 50
+)
+
+// BatchingSettings is the QueryBatching of a connector with the defaults filled in
+type BatchingSettings struct {
+	Window  time.Duration
+	MaxSize int
+}
+
+// ParseBatching returns the batching settings of the connector, and whether it batches at all
+func ParseBatching(connectorSpec *v1alpha1.QueryConnectorSpec) (settings BatchingSettings, enabled bool, err error) {
+
+	settings = BatchingSettings{
+		Window:  defaultBatchWindow,
+		MaxSize: defaultBatchMaxSize,
+	}
+
+	batching := connectorSpec.Batching
+	if batching == nil {
+		return settings, false, nil
+	}
+
+	if batching.Window != "" {
+		settings.Window, err = time.ParseDuration(batching.Window)
+		if err != nil {
+			return settings, false, fmt.Errorf("invalid window %q: %v", batching.Window, err)
+		}
+	}
+	if batching.MaxSize > 0 {
+		settings.MaxSize = int(batching.MaxSize)
+	}
+
+	return settings, true, nil
+}
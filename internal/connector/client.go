@@ -0,0 +1,379 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connector
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	//
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/pools"
+)
+
+var (
+	// Shared HTTP client with connection pooling
+	httpClientCache = make(map[string]*http.Client)
+	httpClientMutex sync.RWMutex
+)
+
+// httpClientKey identifies the HTTP client of a configuration. The TLS material is part of
+// it, so renewed certificates get a new client instead of the one built with the old ones
+func httpClientKey(connectorSpec *v1alpha1.QueryConnectorSpec, creds *pools.Credentials) string {
+	tlsMaterial := ""
+	if creds != nil && (creds.CA != "" || creds.Cert != "" || creds.Key != "" || creds.CABundle != "") {
+		sum := sha256.Sum256([]byte(creds.CA + "\x00" + creds.Cert + "\x00" + creds.Key + "\x00" + creds.CABundle))
+		tlsMaterial = hex.EncodeToString(sum[:8])
+	}
+	return fmt.Sprintf("%s_%s_%t_%s_%s_%v", connectorSpec.URL, connectorSpec.Credentials.SecretRef.Name,
+		connectorSpec.TlsSkipVerify, tlsMaterial, connectorSpec.ProxyURL, connectorSpec.NoProxy)
+}
+
+// GetOrCreateHTTPClient creates or reuses an HTTP client for the given configuration
+func GetOrCreateHTTPClient(connectorSpec *v1alpha1.QueryConnectorSpec, creds *pools.Credentials) *http.Client {
+	// Create a unique key for this configuration
+	key := httpClientKey(connectorSpec, creds)
+
+	httpClientMutex.RLock()
+	if client, exists := httpClientCache[key]; exists {
+		httpClientMutex.RUnlock()
+		return client
+	}
+	httpClientMutex.RUnlock()
+
+	// Configure TLS settings
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: connectorSpec.TlsSkipVerify,
+	}
+
+	// Add certificates if set for elasticsearch queries
+	if connectorSpec.Certificates.SecretRef.Name != "" && creds != nil {
+		// Load client certificates for mTLS
+		cert, err := tls.X509KeyPair([]byte(creds.Cert), []byte(creds.Key))
+		if err == nil {
+			tlsConfig.Certificates = []tls.Certificate{cert}
+
+			// Add CA certificate if available for server verification
+			if creds.CA != "" {
+				caCertPool := x509.NewCertPool()
+				if caCertPool.AppendCertsFromPEM([]byte(creds.CA)) {
+					tlsConfig.RootCAs = caCertPool
+				}
+			}
+		}
+	}
+
+	// Trust the CA bundle on top of the CAs already trusted. Wrong bundles are reported by the
+	// QueryConnector controller
+	if creds != nil && creds.CABundle != "" {
+		if tlsConfig.RootCAs == nil {
+			if rootCAs, err := RootCAs(creds.CABundle); err == nil {
+				tlsConfig.RootCAs = rootCAs
+			}
+		} else {
+			tlsConfig.RootCAs.AppendCertsFromPEM([]byte(creds.CABundle))
+		}
+	}
+
+	// Route the requests through the proxy if set. A wrong proxy fails the requests instead of
+	// sending them directly
+	proxy, err := ProxyFunc(connectorSpec.ProxyURL, connectorSpec.NoProxy)
+	if err != nil {
+		proxy = func(*http.Request) (*url.URL, error) { return nil, err }
+	}
+
+	// Create HTTP client with proper connection pooling and timeouts
+	transport := &http.Transport{
+		Proxy:           proxy,
+		TLSClientConfig: tlsConfig,
+		// Connection pooling settings
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+		// Timeouts. Requests are bounded by the timeout of their RequestPolicy instead, as
+		// a search only gets its response headers once it is done
+		TLSHandshakeTimeout: 10 * time.Second,
+		// Keep alive
+		DisableKeepAlives:  false,
+		DisableCompression: false,
+	}
+
+	client := &http.Client{
+		Transport: transport,
+	}
+
+	// Cache the client
+	httpClientMutex.Lock()
+	httpClientCache[key] = client
+	httpClientMutex.Unlock()
+
+	return client
+}
+
+// SameHTTPClient tells whether both configurations use the same cached HTTP client
+func SameHTTPClient(connectorSpec *v1alpha1.QueryConnectorSpec, creds *pools.Credentials,
+	otherSpec *v1alpha1.QueryConnectorSpec, otherCreds *pools.Credentials) bool {
+	return httpClientKey(connectorSpec, creds) == httpClientKey(otherSpec, otherCreds)
+}
+
+// ForgetHTTPClient drops the cached HTTP client of the configuration and closes its idle
+// connections, once its certificates, URL, proxy or TLS settings were replaced
+func ForgetHTTPClient(connectorSpec *v1alpha1.QueryConnectorSpec, creds *pools.Credentials) {
+	key := httpClientKey(connectorSpec, creds)
+
+	httpClientMutex.Lock()
+	client, exists := httpClientCache[key]
+	delete(httpClientCache, key)
+	httpClientMutex.Unlock()
+
+	if exists {
+		client.CloseIdleConnections()
+	}
+}
+
+// NewRequest builds a request against the connector with the content type, the custom
+// headers and the authentication of the QueryConnector already set
+func NewRequest(ctx context.Context, method, url string, body io.Reader,
+	connectorSpec *v1alpha1.QueryConnectorSpec, creds *pools.Credentials) (*http.Request, error) {
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add headers and custom headers for the queries
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range connectorSpec.Headers {
+		req.Header.Set(key, value)
+	}
+
+	// Add authentication if set for the queries
+	if err = Authenticate(req, creds); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// Client sends the requests of a connector to its endpoints. Requests are built against URL,
+// and every attempt is moved to the endpoint chosen by the load balancing strategy. When an
+// endpoint fails the next one is tried, so the caller only sees an error if all of them fail.
+// When every endpoint failed, the request is sent again as the RequestPolicy allows
+type Client struct {
+	httpClient    *http.Client
+	endpoints     *Endpoints
+	baseURL       string
+	connectorSpec *v1alpha1.QueryConnectorSpec
+	creds         *pools.Credentials
+	settings      RequestSettings
+}
+
+// NewClient returns the client for the connector. The HTTP client and the endpoints state
+// are cached, so creating a client for every request is cheap
+func NewClient(connectorSpec *v1alpha1.QueryConnectorSpec, creds *pools.Credentials) *Client {
+	settings, _ := RequestSettingsFor(connectorSpec, nil)
+	return &Client{
+		httpClient:    GetOrCreateHTTPClient(connectorSpec, creds),
+		endpoints:     GetOrCreateEndpoints(connectorSpec),
+		baseURL:       strings.TrimSuffix(connectorSpec.URL, "/"),
+		connectorSpec: connectorSpec,
+		creds:         creds,
+		settings:      settings,
+	}
+}
+
+// WithRequestSettings replaces the timeout and retries of the connector, for the rules
+// overriding them
+func (c *Client) WithRequestSettings(settings RequestSettings) *Client {
+	c.settings = settings
+	return c
+}
+
+// Do sends the request to the first endpoint that answers. Connection errors and the status
+// codes of a node that can not serve the request count as failures of the endpoint. Each
+// attempt is bounded by the timeout of the RequestPolicy, and the retryable failures are
+// retried after a backoff
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	logger := log.FromContext(req.Context())
+
+	if IsElasticsearchCompatible(c.connectorSpec.Type) && c.endpoints.sniffDue(time.Now()) {
+		c.sniff(req.Context())
+	}
+
+	// A body that can not be replayed can only be sent once
+	retries := c.settings.Retries
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		retries = 0
+	}
+
+	for retry := 0; ; retry++ {
+		attemptCtx, cancel := context.WithTimeout(req.Context(), c.settings.Timeout)
+		resp, err := c.do(req.WithContext(attemptCtx))
+		if err != nil {
+			cancel()
+		} else {
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+		}
+
+		if retry >= retries || req.Context().Err() != nil || !isRetryable(resp, err) {
+			return resp, err
+		}
+
+		wait := c.settings.backoff(retry)
+		if resp != nil {
+			wait = min(max(wait, retryAfter(resp)), c.settings.MaxInterval)
+			logger.V(1).Info(fmt.Sprintf("retrying request to %s in %s: status %d", req.URL.Redacted(), wait, resp.StatusCode))
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			logger.V(1).Info(fmt.Sprintf("retrying request to %s in %s: %v", req.URL.Redacted(), wait, err))
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+
+	targets := c.endpoints.order(time.Now())
+
+	// A body that can not be replayed can only be sent once
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		targets = targets[:1]
+	}
+
+	for i, target := range targets {
+		attempt, err := c.retarget(req, target)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.httpClient.Do(attempt)
+		if err == nil && !isNodeFailure(resp.StatusCode) {
+			c.endpoints.report(target, true, time.Now())
+			return resp, nil
+		}
+		c.endpoints.report(target, false, time.Now())
+
+		// Give up when the caller did, or when there is nowhere else to go
+		if req.Context().Err() != nil || i == len(targets)-1 {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}
+
+	return nil, fmt.Errorf("no endpoints configured")
+}
+
+// retarget returns a copy of the request sent to the endpoint, with a fresh body and the
+// authentication done again, as SigV4 signs the host
+func (c *Client) retarget(req *http.Request, target string) (*http.Request, error) {
+
+	attempt := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		attempt.Body = body
+	}
+
+	if target == c.baseURL {
+		return attempt, nil
+	}
+
+	requestURL := req.URL.String()
+	if !strings.HasPrefix(requestURL, c.baseURL) {
+		return attempt, nil
+	}
+	targetURL, err := url.Parse(target + strings.TrimPrefix(requestURL, c.baseURL))
+	if err != nil {
+		return nil, err
+	}
+	attempt.URL = targetURL
+	attempt.Host = ""
+
+	if err = Authenticate(attempt, c.creds); err != nil {
+		return nil, err
+	}
+	return attempt, nil
+}
+
+// sniff discovers the nodes of the cluster and adds their HTTP address to the endpoints.
+// On failure the endpoints discovered before are kept until the next sniff
+func (c *Client) sniff(ctx context.Context) {
+	logger := log.FromContext(ctx)
+
+	ctx, cancel := context.WithTimeout(ctx, c.settings.Timeout)
+	defer cancel()
+
+	req, err := NewRequest(ctx, http.MethodGet, c.baseURL+nodesHTTPPath, nil, c.connectorSpec, c.creds)
+	if err != nil {
+		logger.Info(fmt.Sprintf("can not sniff the nodes of %s: %v", c.baseURL, err))
+		return
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		logger.Info(fmt.Sprintf("can not sniff the nodes of %s: %v", c.baseURL, err))
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		logger.Info(fmt.Sprintf("can not sniff the nodes of %s: status %d %v", c.baseURL, resp.StatusCode, err))
+		return
+	}
+
+	scheme := "http"
+	if base, err := url.Parse(c.baseURL); err == nil && base.Scheme != "" {
+		scheme = base.Scheme
+	}
+	c.endpoints.setSniffed(sniffedURLs(body, scheme))
+}
+
+// isNodeFailure reports whether the status code tells the node could not serve the request,
+// so another endpoint may succeed
+func isNodeFailure(statusCode int) bool {
+	switch statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connector
+
+import (
+	"testing"
+
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/pools"
+)
+
+func TestHTTPClientCertificateRotation(t *testing.T) {
+	t.Parallel()
+	spec := &v1alpha1.QueryConnectorSpec{URL: "https://rotation.test:9200"}
+	spec.Certificates.SecretRef.Name = "es-certs"
+	current := &pools.Credentials{CA: "ca-1", Cert: "cert-1", Key: "key-1"}
+
+	client := GetOrCreateHTTPClient(spec, current)
+	if GetOrCreateHTTPClient(spec, &pools.Credentials{CA: "ca-1", Cert: "cert-1", Key: "key-1"}) != client {
+		t.Fatalf("the same certificates must reuse the client")
+	}
+
+	// Renewed certificates get a client of their own, and the old one is forgotten
+	renewed := &pools.Credentials{CA: "ca-1", Cert: "cert-2", Key: "key-2"}
+	if GetOrCreateHTTPClient(spec, renewed) == client {
+		t.Errorf("renewed certificates must not reuse the client built with the old ones")
+	}
+	ForgetHTTPClient(spec, current)
+	httpClientMutex.RLock()
+	_, cached := httpClientCache[httpClientKey(spec, current)]
+	httpClientMutex.RUnlock()
+	if cached {
+		t.Errorf("forgotten client still cached")
+	}
+}
@@ -0,0 +1,282 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connector
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	//
+	"github.com/tidwall/gjson"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+)
+
+const (
+
+	// Strategies accepted in LoadBalancing.Strategy
+	StrategyFailover   = "failover"
+	StrategyRoundRobin = "roundRobin"
+
+	// Defaults of LoadBalancing, also set by the CRD
+	defaultMaxFailures   = 3
+	defaultEjectionTime  = 30 * time.Second
+	defaultSniffInterval = 5 * time.Minute
+)
+
+var (
+	// Endpoints of every connector, shared by all the SearchRules using it so an
+	// endpoint ejected by one rule is skipped by the others
+	endpointsCache = make(map[string]*Endpoints)
+	endpointsMutex sync.Mutex
+)
+
+// LoadBalancingSettings is the LoadBalancing of a connector with its durations parsed
+// and the defaults filled in
+type LoadBalancingSettings struct {
+	Strategy      string
+	MaxFailures   int
+	EjectionTime  time.Duration
+	Sniff         bool
+	SniffInterval time.Duration
+}
+
+// ParseLoadBalancing returns the load balancing settings of the connector
+func ParseLoadBalancing(connectorSpec *v1alpha1.QueryConnectorSpec) (settings LoadBalancingSettings, err error) {
+
+	settings = LoadBalancingSettings{
+		Strategy:      StrategyFailover,
+		MaxFailures:   defaultMaxFailures,
+		EjectionTime:  defaultEjectionTime,
+		SniffInterval: defaultSniffInterval,
+	}
+
+	lb := connectorSpec.LoadBalancing
+	if lb == nil {
+		return settings, nil
+	}
+
+	if lb.Strategy != "" {
+		settings.Strategy = lb.Strategy
+	}
+	if lb.MaxFailures > 0 {
+		settings.MaxFailures = int(lb.MaxFailures)
+	}
+	if lb.EjectionTime != "" {
+		settings.EjectionTime, err = time.ParseDuration(lb.EjectionTime)
+		if err != nil {
+			return settings, fmt.Errorf("invalid ejectionTime %q: %v", lb.EjectionTime, err)
+		}
+	}
+	settings.Sniff = lb.Sniff
+	if lb.SniffInterval != "" {
+		settings.SniffInterval, err = time.ParseDuration(lb.SniffInterval)
+		if err != nil {
+			return settings, fmt.Errorf("invalid sniffInterval %q: %v", lb.SniffInterval, err)
+		}
+	}
+
+	return settings, nil
+}
+
+// endpoint is one base URL of the connector and how its last requests went
+type endpoint struct {
+	url          string
+	sniffed      bool
+	failures     int
+	ejectedUntil time.Time
+}
+
+// Endpoints are the base URLs of a connector: the configured ones, followed by the nodes
+// discovered through sniffing
+type Endpoints struct {
+	mu        sync.Mutex
+	settings  LoadBalancingSettings
+	endpoints []*endpoint
+	next      int
+	lastSniff time.Time
+}
+
+// GetOrCreateEndpoints returns the endpoints of the connector, keeping their state
+// between calls while the spec does not change
+func GetOrCreateEndpoints(connectorSpec *v1alpha1.QueryConnectorSpec) *Endpoints {
+
+	// Invalid durations are reported by the QueryConnector controller. Requests are still
+	// sent, with the defaults
+	settings, _ := ParseLoadBalancing(connectorSpec)
+	urls := configuredURLs(connectorSpec)
+	key := fmt.Sprintf("%v_%+v", urls, settings)
+
+	endpointsMutex.Lock()
+	defer endpointsMutex.Unlock()
+	if e, exists := endpointsCache[key]; exists {
+		return e
+	}
+
+	e := &Endpoints{settings: settings}
+	for _, u := range urls {
+		e.endpoints = append(e.endpoints, &endpoint{url: u})
+	}
+	endpointsCache[key] = e
+	return e
+}
+
+// configuredURLs returns URL followed by URLs, without trailing slashes nor duplicates
+func configuredURLs(connectorSpec *v1alpha1.QueryConnectorSpec) []string {
+	seen := map[string]bool{}
+	urls := []string{}
+	for _, u := range append([]string{connectorSpec.URL}, connectorSpec.URLs...) {
+		u = strings.TrimSuffix(u, "/")
+		if u == "" || seen[u] {
+			continue
+		}
+		seen[u] = true
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+// order returns the endpoints in the order they must be tried by a request. Ejected
+// endpoints go last, the one readmitted soonest first, so requests still have somewhere
+// to go when every endpoint is failing
+func (e *Endpoints) order(now time.Time) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	candidates := make([]*endpoint, len(e.endpoints))
+	copy(candidates, e.endpoints)
+
+	if e.settings.Strategy == StrategyRoundRobin && len(candidates) > 0 {
+		start := e.next % len(candidates)
+		e.next = start + 1
+		candidates = append(candidates[start:], candidates[:start]...)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		iEjected := candidates[i].ejectedUntil.After(now)
+		jEjected := candidates[j].ejectedUntil.After(now)
+		if iEjected != jEjected {
+			return !iEjected
+		}
+		return iEjected && candidates[i].ejectedUntil.Before(candidates[j].ejectedUntil)
+	})
+
+	urls := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		urls = append(urls, c.url)
+	}
+	return urls
+}
+
+// report records the result of a request sent to the endpoint. An endpoint is ejected after
+// MaxFailures consecutive failures, and a single success brings it back
+func (e *Endpoints) report(u string, ok bool, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, c := range e.endpoints {
+		if c.url != u {
+			continue
+		}
+		if ok {
+			c.failures = 0
+			c.ejectedUntil = time.Time{}
+			return
+		}
+		c.failures++
+		if c.failures >= e.settings.MaxFailures {
+			c.ejectedUntil = now.Add(e.settings.EjectionTime)
+		}
+		return
+	}
+}
+
+// sniffDue tells whether the nodes must be discovered again, and marks the sniff as done so
+// concurrent requests do not repeat it
+func (e *Endpoints) sniffDue(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.settings.Sniff || now.Sub(e.lastSniff) < e.settings.SniffInterval {
+		return false
+	}
+	e.lastSniff = now
+	return true
+}
+
+// setSniffed replaces the discovered endpoints, keeping the state of the ones already known
+func (e *Endpoints) setSniffed(urls []string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	known := map[string]*endpoint{}
+	endpoints := []*endpoint{}
+	for _, c := range e.endpoints {
+		if c.sniffed {
+			known[c.url] = c
+			continue
+		}
+		endpoints = append(endpoints, c)
+		known[c.url] = nil
+	}
+
+	for _, u := range urls {
+		c, exists := known[u]
+		switch {
+		case exists && c == nil:
+			// Already configured
+			continue
+		case !exists:
+			c = &endpoint{url: u, sniffed: true}
+		}
+		known[u] = nil
+		endpoints = append(endpoints, c)
+	}
+	e.endpoints = endpoints
+}
+
+// sniffedURLs reads the HTTP address of every node from a `_nodes/http` response. The scheme
+// is taken from the configured URL, as nodes do not report it
+func sniffedURLs(body []byte, scheme string) []string {
+	urls := []string{}
+	gjson.GetBytes(body, "nodes").ForEach(func(_, node gjson.Result) bool {
+		address := node.Get("http.publish_address").String()
+		if address == "" {
+			return true
+		}
+
+		// Nodes with a published hostname report `hostname/ip:port`
+		host := address
+		if hostname, ipPort, found := strings.Cut(address, "/"); found {
+			_, port, err := net.SplitHostPort(ipPort)
+			if err != nil {
+				return true
+			}
+			host = net.JoinHostPort(hostname, port)
+		}
+		urls = append(urls, (&url.URL{Scheme: scheme, Host: host}).String())
+		return true
+	})
+	sort.Strings(urls)
+	return urls
+}
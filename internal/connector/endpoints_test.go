@@ -0,0 +1,219 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"freepik.com/searchruler/api/v1alpha1"
+)
+
+func TestParseLoadBalancing(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name    string
+		lb      *v1alpha1.LoadBalancing
+		want    LoadBalancingSettings
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: LoadBalancingSettings{Strategy: StrategyFailover, MaxFailures: 3, EjectionTime: 30 * time.Second, SniffInterval: 5 * time.Minute},
+		},
+		{
+			name: "custom",
+			lb:   &v1alpha1.LoadBalancing{Strategy: StrategyRoundRobin, MaxFailures: 1, EjectionTime: "1m", Sniff: true, SniffInterval: "30s"},
+			want: LoadBalancingSettings{Strategy: StrategyRoundRobin, MaxFailures: 1, EjectionTime: time.Minute, Sniff: true, SniffInterval: 30 * time.Second},
+		},
+		{name: "invalid ejection time", lb: &v1alpha1.LoadBalancing{EjectionTime: "soon"}, wantErr: true},
+		{name: "invalid sniff interval", lb: &v1alpha1.LoadBalancing{SniffInterval: "5"}, wantErr: true},
+	}
+	for _, tc := range cases {
+		got, err := ParseLoadBalancing(&v1alpha1.QueryConnectorSpec{LoadBalancing: tc.lb})
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("%s: err = %v, wantErr %v", tc.name, err, tc.wantErr)
+		}
+		if !tc.wantErr && got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestEndpointsOrder(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	newEndpoints := func(strategy string) *Endpoints {
+		e := &Endpoints{settings: LoadBalancingSettings{Strategy: strategy, MaxFailures: 2, EjectionTime: time.Minute}}
+		for _, u := range []string{"http://a", "http://b", "http://c"} {
+			e.endpoints = append(e.endpoints, &endpoint{url: u})
+		}
+		return e
+	}
+
+	t.Run("failover keeps the configured order", func(t *testing.T) {
+		t.Parallel()
+		e := newEndpoints(StrategyFailover)
+		for i := 0; i < 3; i++ {
+			if got := e.order(now); !reflect.DeepEqual(got, []string{"http://a", "http://b", "http://c"}) {
+				t.Fatalf("order = %v", got)
+			}
+		}
+	})
+
+	t.Run("round robin rotates", func(t *testing.T) {
+		t.Parallel()
+		e := newEndpoints(StrategyRoundRobin)
+		firsts := []string{}
+		for i := 0; i < 4; i++ {
+			firsts = append(firsts, e.order(now)[0])
+		}
+		if !reflect.DeepEqual(firsts, []string{"http://a", "http://b", "http://c", "http://a"}) {
+			t.Errorf("first endpoints = %v", firsts)
+		}
+	})
+
+	t.Run("ejected endpoints go last until readmitted", func(t *testing.T) {
+		t.Parallel()
+		e := newEndpoints(StrategyFailover)
+		e.report("http://a", false, now)
+		if got := e.order(now)[0]; got != "http://a" {
+			t.Fatalf("a single failure must not eject, first = %s", got)
+		}
+		e.report("http://a", false, now)
+		if got := e.order(now); !reflect.DeepEqual(got, []string{"http://b", "http://c", "http://a"}) {
+			t.Fatalf("order after ejection = %v", got)
+		}
+		if got := e.order(now.Add(2 * time.Minute))[0]; got != "http://a" {
+			t.Errorf("endpoint not readmitted after the ejection time, first = %s", got)
+		}
+		e.report("http://a", true, now)
+		if got := e.order(now)[0]; got != "http://a" {
+			t.Errorf("a success must readmit the endpoint, first = %s", got)
+		}
+	})
+}
+
+func TestSniffedURLs(t *testing.T) {
+	t.Parallel()
+	body := []byte(`{"nodes": {
+		"n1": {"http": {"publish_address": "10.0.0.2:9200"}},
+		"n2": {"http": {"publish_address": "es-1.logs.svc/10.0.0.1:9200"}},
+		"n3": {"roles": ["master"]}
+	}}`)
+	want := []string{"https://10.0.0.2:9200", "https://es-1.logs.svc:9200"}
+	if got := sniffedURLs(body, "https"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// newCountingServer starts a server answering every request with status and counting them
+func newCountingServer(t *testing.T, status int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	hits := &atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, hits
+}
+
+func TestClientFailover(t *testing.T) {
+	t.Parallel()
+	down, downHits := newCountingServer(t, http.StatusServiceUnavailable)
+	up, upHits := newCountingServer(t, http.StatusOK)
+	spec := &v1alpha1.QueryConnectorSpec{
+		URL:           down.URL,
+		URLs:          []string{up.URL},
+		LoadBalancing: &v1alpha1.LoadBalancing{MaxFailures: 2, EjectionTime: "1h"},
+	}
+	client := NewClient(spec, nil)
+
+	for i := 0; i < 4; i++ {
+		req, _ := NewRequest(context.Background(), http.MethodPost, down.URL+"/logs/_search",
+			strings.NewReader(`{"size":0}`), spec, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != `{"size":0}` {
+			t.Fatalf("request %d: status %d, body %q", i, resp.StatusCode, body)
+		}
+	}
+
+	// The failing endpoint is ejected after two failures and not tried again
+	if downHits.Load() != 2 || upHits.Load() != 4 {
+		t.Errorf("down got %d requests, up got %d", downHits.Load(), upHits.Load())
+	}
+}
+
+func TestClientAllEndpointsFailing(t *testing.T) {
+	t.Parallel()
+	first, _ := newCountingServer(t, http.StatusBadGateway)
+	second, _ := newCountingServer(t, http.StatusGatewayTimeout)
+	spec := &v1alpha1.QueryConnectorSpec{URL: first.URL, URLs: []string{second.URL}}
+
+	req, _ := NewRequest(context.Background(), http.MethodGet, first.URL+"/", nil, spec, nil)
+	resp, err := NewClient(spec, nil).Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want the response of the last endpoint", resp.StatusCode)
+	}
+}
+
+func TestClientSniff(t *testing.T) {
+	t.Parallel()
+	node, nodeHits := newCountingServer(t, http.StatusOK)
+	seed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_nodes/http" {
+			fmt.Fprintf(w, `{"nodes": {"n1": {"http": {"publish_address": %q}}}}`, strings.TrimPrefix(node.URL, "http://"))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(seed.Close)
+
+	spec := &v1alpha1.QueryConnectorSpec{
+		URL:           seed.URL,
+		LoadBalancing: &v1alpha1.LoadBalancing{Sniff: true},
+	}
+	req, _ := NewRequest(context.Background(), http.MethodGet, seed.URL+"/logs/_search", nil, spec, nil)
+	resp, err := NewClient(spec, nil).Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || nodeHits.Load() != 1 {
+		t.Errorf("status = %d, sniffed node got %d requests", resp.StatusCode, nodeHits.Load())
+	}
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/pools"
+)
+
+const (
+
+	// Flavors accepted in QueryConnectorSpec.Type
+	FlavorAuto          = "auto"
+	FlavorElasticsearch = "elasticsearch"
+	FlavorOpenSearch    = "opensearch"
+
+	// Query engines that are not Elasticsearch compatible, so they are never probed
+	FlavorLoki       = "loki"
+	FlavorPrometheus = "prometheus"
+	FlavorClickHouse = "clickhouse"
+
+	// Endpoints of Elasticsearch compatible clusters
+	searchURL              = "%s/%s/_search"
+	multiSearchURL         = "%s/_msearch"
+	elasticsearchSQLURL    = "%s/_sql?format=json"
+	opensearchSQLURL       = "%s/_plugins/_sql"
+	opensearchPPLURL       = "%s/_plugins/_ppl"
+	trackTotalHitsParam    = "track_total_hits=true"
+	trackTotalHitsField    = "track_total_hits"
+	trackTotalHitsMinMajor = 7
+)
+
+// Info is what the root endpoint of a cluster tells about itself
+type Info struct {
+	Distribution string
+	Version      string
+	ClusterName  string
+}
+
+// rootResponse is the subset of the `GET /` payload needed to identify the cluster.
+// OpenSearch fills `version.distribution`, Elasticsearch does not send that field.
+type rootResponse struct {
+	ClusterName string `json:"cluster_name"`
+	Version     struct {
+		Distribution string `json:"distribution"`
+		Number       string `json:"number"`
+	} `json:"version"`
+}
+
+// Detect probes the root endpoint of the connector and returns the distribution
+// and version reported by the cluster
+func Detect(ctx context.Context, connectorSpec *v1alpha1.QueryConnectorSpec, creds *pools.Credentials) (*Info, error) {
+
+	body, err := get(ctx, connectorSpec, creds, rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	root := rootResponse{}
+	if err = json.Unmarshal(body, &root); err != nil {
+		return nil, fmt.Errorf("root endpoint did not return a valid JSON document: %v", err)
+	}
+	if root.Version.Number == "" {
+		return nil, fmt.Errorf("root endpoint did not report any version: %s", string(body))
+	}
+
+	info := &Info{
+		Distribution: FlavorElasticsearch,
+		Version:      root.Version.Number,
+		ClusterName:  root.ClusterName,
+	}
+	if strings.EqualFold(root.Version.Distribution, FlavorOpenSearch) {
+		info.Distribution = FlavorOpenSearch
+	}
+
+	return info, nil
+}
+
+// ResolveFlavor returns the flavor the requests must be shaped for. An explicit type
+// in the spec always wins; otherwise the distribution detected on the last probe is used,
+// falling back to Elasticsearch when the cluster was never probed successfully
+func ResolveFlavor(specType, detectedDistribution string) string {
+	if specType != "" && specType != FlavorAuto {
+		return specType
+	}
+	if detectedDistribution != "" {
+		return detectedDistribution
+	}
+	return FlavorElasticsearch
+}
+
+// IsElasticsearchCompatible reports whether the connector type speaks the Elasticsearch API,
+// which is required to detect its distribution through the root endpoint
+func IsElasticsearchCompatible(specType string) bool {
+	switch specType {
+	case "", FlavorAuto, FlavorElasticsearch, FlavorOpenSearch:
+		return true
+	}
+	return false
+}
+
+// Profile describes how requests must be shaped for a flavor and version of the cluster
+type Profile struct {
+	Flavor string
+
+	// Major version of the cluster. Zero when unknown
+	Major int
+}
+
+// NewProfile builds the request profile for the given flavor and version number
+func NewProfile(flavor, version string) Profile {
+	major, _ := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	return Profile{
+		Flavor: flavor,
+		Major:  major,
+	}
+}
+
+// TracksTotalHits reports whether the cluster understands `track_total_hits`. It was
+// introduced in Elasticsearch 7, so every OpenSearch release inherits it. When the
+// version is unknown we assume a modern cluster.
+func (p Profile) TracksTotalHits() bool {
+	if p.Flavor == FlavorOpenSearch || p.Major == 0 {
+		return true
+	}
+	return p.Major >= trackTotalHitsMinMajor
+}
+
+// SearchURL returns the `_search` URL for the index. When countTotalHits is set, as for
+// conditions on the total hits, clusters that cap `hits.total` at 10k by default are asked
+// to count every hit, unless the query already decides about it, so the conditions see the
+// real value. Counting every hit is slower, so other searches keep the default of the cluster.
+func (p Profile) SearchURL(baseURL, index string, query []byte, countTotalHits bool) string {
+	url := fmt.Sprintf(searchURL, baseURL, index)
+	if countTotalHits && p.TracksTotalHits() && !decidesTotalHits(query) {
+		url += "?" + trackTotalHitsParam
+	}
+	return url
+}
+
+// decidesTotalHits tells whether the query sets `track_total_hits` itself
+func decidesTotalHits(query []byte) bool {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(query, &fields); err != nil {
+		return false
+	}
+	_, decided := fields[trackTotalHitsField]
+	return decided
+}
+
+// SQLURL returns the endpoint for SQL statements
+func (p Profile) SQLURL(baseURL string) string {
+	if p.Flavor == FlavorOpenSearch {
+		return fmt.Sprintf(opensearchSQLURL, baseURL)
+	}
+	return fmt.Sprintf(elasticsearchSQLURL, baseURL)
+}
+
+// PPLURL returns the endpoint for PPL queries, which only OpenSearch provides
+func (p Profile) PPLURL(baseURL string) (string, error) {
+	if p.Flavor != FlavorOpenSearch {
+		return "", fmt.Errorf("PPL queries are only supported by OpenSearch, connector flavor is %s", p.Flavor)
+	}
+	return fmt.Sprintf(opensearchPPLURL, baseURL), nil
+}
+
+// MultiSearchURL returns the `_msearch` endpoint, which runs several searches in one request
+func (p Profile) MultiSearchURL(baseURL string) string {
+	return fmt.Sprintf(multiSearchURL, baseURL)
+}
+
+// MultiSearchBody returns the query as a line of a `_msearch` request. Searches in a batch do
+// not take URL parameters, so total hits are tracked in the query itself, as SearchURL does
+func (p Profile) MultiSearchBody(query []byte, countTotalHits bool) ([]byte, error) {
+	compacted := &bytes.Buffer{}
+	if err := json.Compact(compacted, query); err != nil {
+		return nil, err
+	}
+
+	line := compacted.Bytes()
+	if !countTotalHits || !p.TracksTotalHits() || decidesTotalHits(line) {
+		return line, nil
+	}
+	if !bytes.HasPrefix(line, []byte("{")) {
+		return nil, fmt.Errorf("query is not a JSON object: %s", string(line))
+	}
+
+	separator := ","
+	if bytes.Equal(line, []byte("{}")) {
+		separator = ""
+	}
+	return []byte(`{"` + trackTotalHitsField + `":true` + separator + string(line[1:])), nil
+}
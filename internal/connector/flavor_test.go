@@ -0,0 +1,207 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/pools"
+)
+
+const (
+	elasticsearchRootResponse = `{
+		"name": "es-node-0",
+		"cluster_name": "logs",
+		"version": {"number": "8.15.2", "build_flavor": "default", "lucene_version": "9.11.1"},
+		"tagline": "You Know, for Search"
+	}`
+	opensearchRootResponse = `{
+		"name": "os-node-0",
+		"cluster_name": "audit",
+		"version": {"distribution": "opensearch", "number": "2.17.1", "lucene_version": "9.11.1"},
+		"tagline": "The OpenSearch Project: https://opensearch.org/"
+	}`
+)
+
+// newFakeCluster starts a server answering the root endpoint with the given payload
+func newFakeCluster(t *testing.T, status int, payload string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "elastic" || pass != "changeme" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(payload))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name    string
+		status  int
+		payload string
+		want    Info
+		wantErr bool
+	}{
+		{
+			name:    "elasticsearch",
+			status:  http.StatusOK,
+			payload: elasticsearchRootResponse,
+			want:    Info{Distribution: FlavorElasticsearch, Version: "8.15.2", ClusterName: "logs"},
+		},
+		{
+			name:    "opensearch",
+			status:  http.StatusOK,
+			payload: opensearchRootResponse,
+			want:    Info{Distribution: FlavorOpenSearch, Version: "2.17.1", ClusterName: "audit"},
+		},
+		{name: "error status", status: http.StatusServiceUnavailable, payload: `{}`, wantErr: true},
+		{name: "no version", status: http.StatusOK, payload: `{"cluster_name": "logs"}`, wantErr: true},
+		{name: "not json", status: http.StatusOK, payload: `ok`, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			srv := newFakeCluster(t, tc.status, tc.payload)
+			spec := &v1alpha1.QueryConnectorSpec{URL: srv.URL}
+			creds := &pools.Credentials{AuthMode: AuthModeBasic, Username: "elastic", Password: "changeme"}
+
+			got, err := Detect(context.Background(), spec, creds)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if *got != tc.want {
+				t.Errorf("got %+v, want %+v", *got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveFlavor(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		specType, detected, want string
+	}{
+		{"", "", FlavorElasticsearch},
+		{FlavorAuto, "", FlavorElasticsearch},
+		{"", FlavorOpenSearch, FlavorOpenSearch},
+		{FlavorAuto, FlavorOpenSearch, FlavorOpenSearch},
+		{FlavorElasticsearch, FlavorOpenSearch, FlavorElasticsearch},
+		{FlavorOpenSearch, "", FlavorOpenSearch},
+	}
+	for _, tc := range cases {
+		if got := ResolveFlavor(tc.specType, tc.detected); got != tc.want {
+			t.Errorf("ResolveFlavor(%q, %q) = %q, want %q", tc.specType, tc.detected, got, tc.want)
+		}
+	}
+}
+
+func TestProfileURLs(t *testing.T) {
+	t.Parallel()
+	const base = "https://cluster:9200"
+	cases := []struct {
+		name           string
+		profile        Profile
+		query          string
+		countTotalHits bool
+		wantSearch     string
+		wantSQL        string
+		wantPPL        string
+	}{
+		{
+			name:           "elasticsearch 8",
+			profile:        NewProfile(FlavorElasticsearch, "8.15.2"),
+			query:          `{"size":0}`,
+			countTotalHits: true,
+			wantSearch:     base + "/logs/_search?track_total_hits=true",
+			wantSQL:        base + "/_sql?format=json",
+		},
+		{
+			name:       "total hits not read",
+			profile:    NewProfile(FlavorElasticsearch, "8.15.2"),
+			query:      `{"size":0}`,
+			wantSearch: base + "/logs/_search",
+			wantSQL:    base + "/_sql?format=json",
+		},
+		{
+			name:           "elasticsearch 6 has no track_total_hits",
+			profile:        NewProfile(FlavorElasticsearch, "6.8.23"),
+			query:          `{"size":0}`,
+			countTotalHits: true,
+			wantSearch:     base + "/logs/_search",
+			wantSQL:        base + "/_sql?format=json",
+		},
+		{
+			name:           "query decides about total hits",
+			profile:        NewProfile(FlavorElasticsearch, "8.15.2"),
+			query:          `{"size":0,"track_total_hits":false}`,
+			countTotalHits: true,
+			wantSearch:     base + "/logs/_search",
+			wantSQL:        base + "/_sql?format=json",
+		},
+		{
+			name:           "query only mentions total hits",
+			profile:        NewProfile(FlavorElasticsearch, "8.15.2"),
+			query:          `{"size":0,"query":{"match":{"message":"track_total_hits"}}}`,
+			countTotalHits: true,
+			wantSearch:     base + "/logs/_search?track_total_hits=true",
+			wantSQL:        base + "/_sql?format=json",
+		},
+		{
+			name:           "opensearch",
+			profile:        NewProfile(FlavorOpenSearch, "2.17.1"),
+			query:          `{"size":0}`,
+			countTotalHits: true,
+			wantSearch:     base + "/logs/_search?track_total_hits=true",
+			wantSQL:        base + "/_plugins/_sql",
+			wantPPL:        base + "/_plugins/_ppl",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tc.profile.SearchURL(base, "logs", []byte(tc.query), tc.countTotalHits); got != tc.wantSearch {
+				t.Errorf("SearchURL = %q, want %q", got, tc.wantSearch)
+			}
+			if got := tc.profile.SQLURL(base); got != tc.wantSQL {
+				t.Errorf("SQLURL = %q, want %q", got, tc.wantSQL)
+			}
+			got, err := tc.profile.PPLURL(base)
+			if (err != nil) != (tc.wantPPL == "") {
+				t.Fatalf("PPLURL err = %v", err)
+			}
+			if got != tc.wantPPL {
+				t.Errorf("PPLURL = %q, want %q", got, tc.wantPPL)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/pools"
+)
+
+const (
+
+	// Colors reported by `_cluster/health`
+	HealthGreen  = "green"
+	HealthYellow = "yellow"
+	HealthRed    = "red"
+
+	// Endpoints probed to check the connectivity of each query engine
+	rootPath                = "/"
+	clusterHealthPath       = "/_cluster/health"
+	lokiReadyPath           = "/ready"
+	prometheusReadyPath     = "/-/ready"
+	clickHousePingPath      = "/ping"
+	nodesHTTPPath           = "/_nodes/http"
+	unexpectedStatusMessage = "unexpected status code %d from %s: %s"
+)
+
+var (
+	// ErrUnauthorized is returned when the cluster answers but rejects the credentials
+	ErrUnauthorized = errors.New("credentials rejected by the cluster")
+)
+
+// Health is the result of probing a connector
+type Health struct {
+	Info
+
+	// Status is the color reported by `_cluster/health`. Empty when the engine has no
+	// such endpoint or the credentials are not allowed to call it
+	Status string
+
+	// Latency is the round trip of the first request of the probe
+	Latency time.Duration
+}
+
+// clusterHealthResponse is the subset of the `GET _cluster/health` payload used by the probe
+type clusterHealthResponse struct {
+	ClusterName string `json:"cluster_name"`
+	Status      string `json:"status"`
+}
+
+// CheckHealth calls the connector to know whether it is reachable and accepts the credentials.
+// Elasticsearch compatible clusters are asked for their version and health color, other
+// engines only for their readiness endpoint
+func CheckHealth(ctx context.Context, connectorSpec *v1alpha1.QueryConnectorSpec, creds *pools.Credentials) (*Health, error) {
+
+	if !IsElasticsearchCompatible(connectorSpec.Type) {
+		path := readinessPath(connectorSpec.Type)
+		start := time.Now()
+		_, err := get(ctx, connectorSpec, creds, path)
+		if err != nil {
+			return nil, err
+		}
+		return &Health{Latency: time.Since(start)}, nil
+	}
+
+	start := time.Now()
+	info, err := Detect(ctx, connectorSpec, creds)
+	if err != nil {
+		return nil, err
+	}
+	health := &Health{Info: *info, Latency: time.Since(start)}
+
+	// Monitoring users are often not allowed to call `_cluster/health`, and Serverless
+	// collections do not have it. The cluster is reachable anyway, so the color is left unknown
+	body, err := get(ctx, connectorSpec, creds, clusterHealthPath)
+	if err != nil {
+		return health, nil
+	}
+	clusterHealth := clusterHealthResponse{}
+	if err = json.Unmarshal(body, &clusterHealth); err == nil {
+		health.Status = clusterHealth.Status
+		if health.ClusterName == "" {
+			health.ClusterName = clusterHealth.ClusterName
+		}
+	}
+
+	return health, nil
+}
+
+// readinessPath returns the endpoint that tells whether an engine is ready to be queried
+func readinessPath(specType string) string {
+	switch specType {
+	case FlavorLoki:
+		return lokiReadyPath
+	case FlavorPrometheus:
+		return prometheusReadyPath
+	case FlavorClickHouse:
+		return clickHousePingPath
+	}
+	return rootPath
+}
+
+// get calls the path of the connector and returns the body of a successful response.
+// Rejected credentials are reported wrapping ErrUnauthorized
+func get(ctx context.Context, connectorSpec *v1alpha1.QueryConnectorSpec, creds *pools.Credentials, path string) ([]byte, error) {
+
+	req, err := NewRequest(ctx, http.MethodGet, strings.TrimSuffix(connectorSpec.URL, "/")+path, nil, connectorSpec, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := NewClient(connectorSpec, creds).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("%w: "+unexpectedStatusMessage, ErrUnauthorized, resp.StatusCode, path, string(body))
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf(unexpectedStatusMessage, resp.StatusCode, path, string(body))
+	}
+
+	return body, nil
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"freepik.com/searchruler/api/v1alpha1"
+)
+
+func TestCheckHealth(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name         string
+		specType     string
+		handler      http.HandlerFunc
+		want         Info
+		wantStatus   string
+		wantErr      bool
+		unauthorized bool
+	}{
+		{
+			name: "elasticsearch with health",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/":
+					_, _ = w.Write([]byte(elasticsearchRootResponse))
+				case "/_cluster/health":
+					_, _ = w.Write([]byte(`{"cluster_name": "logs", "status": "yellow"}`))
+				}
+			},
+			want:       Info{Distribution: FlavorElasticsearch, Version: "8.15.2", ClusterName: "logs"},
+			wantStatus: HealthYellow,
+		},
+		{
+			name: "health forbidden is still reachable",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/" {
+					_, _ = w.Write([]byte(opensearchRootResponse))
+					return
+				}
+				w.WriteHeader(http.StatusForbidden)
+			},
+			want: Info{Distribution: FlavorOpenSearch, Version: "2.17.1", ClusterName: "audit"},
+		},
+		{
+			name: "credentials rejected",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			},
+			wantErr:      true,
+			unauthorized: true,
+		},
+		{
+			name: "cluster failing",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			wantErr: true,
+		},
+		{
+			name:     "loki ready",
+			specType: FlavorLoki,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/ready" {
+					http.NotFound(w, r)
+					return
+				}
+				_, _ = w.Write([]byte("ready"))
+			},
+		},
+		{
+			name:     "prometheus not ready",
+			specType: FlavorPrometheus,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			srv := httptest.NewServer(tc.handler)
+			t.Cleanup(srv.Close)
+			spec := &v1alpha1.QueryConnectorSpec{URL: srv.URL, Type: tc.specType}
+
+			got, err := CheckHealth(context.Background(), spec, nil)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if errors.Is(err, ErrUnauthorized) != tc.unauthorized {
+				t.Errorf("err = %v, unauthorized %v", err, tc.unauthorized)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got.Info != tc.want || got.Status != tc.wantStatus {
+				t.Errorf("got %+v, want %+v with status %q", *got, tc.want, tc.wantStatus)
+			}
+			if got.Latency <= 0 {
+				t.Errorf("latency not measured")
+			}
+		})
+	}
+}
+
+func TestCheckHealth_Unreachable(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	_, err := CheckHealth(context.Background(), &v1alpha1.QueryConnectorSpec{URL: url}, nil)
+	if err == nil || errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("err = %v, want a connection error", err)
+	}
+}
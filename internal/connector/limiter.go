@@ -0,0 +1,260 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	//
+	"golang.org/x/time/rate"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+)
+
+const (
+
+	// Default of QueryLimits.MaxQueueTime, also set by the CRD
+	defaultMaxQueueTime = 10 * time.Second
+)
+
+var (
+	// ErrThrottled is returned when a query waited MaxQueueTime without getting a slot
+	ErrThrottled = errors.New("query rejected by the limits of the connector")
+
+	// Limiters of the connectors defining limits, shared by all the SearchRules using them
+	limiters      = make(map[string]*Limiter)
+	limitersMutex sync.RWMutex
+)
+
+// Limiter enforces the query limits of a connector across every SearchRule using it
+type Limiter struct {
+	Namespace string
+	Name      string
+
+	mu           sync.Mutex
+	limits       v1alpha1.QueryLimits
+	slots        chan struct{}
+	rateLimiter  *rate.Limiter
+	maxQueueTime time.Duration
+
+	inFlight atomic.Int64
+	waiting  atomic.Int64
+	queued   atomic.Uint64
+	rejected atomic.Uint64
+
+	// Totals already reported by Throttled
+	reportedQueued   uint64
+	reportedRejected uint64
+}
+
+// LimiterStats is a point in time view of a Limiter
+type LimiterStats struct {
+	Namespace     string
+	Name          string
+	InFlight      int64
+	Waiting       int64
+	QueuedTotal   uint64
+	RejectedTotal uint64
+}
+
+// SetLimiter creates or updates the limiter of the connector. Counters are kept when the
+// limits change
+func SetLimiter(namespace, name string, limits *v1alpha1.QueryLimits) (*Limiter, error) {
+
+	maxQueueTime := defaultMaxQueueTime
+	if limits.MaxQueueTime != "" {
+		var err error
+		maxQueueTime, err = time.ParseDuration(limits.MaxQueueTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maxQueueTime %q: %v", limits.MaxQueueTime, err)
+		}
+	}
+
+	key := fmt.Sprintf("%s_%s", namespace, name)
+	limitersMutex.Lock()
+	l, exists := limiters[key]
+	if !exists {
+		l = &Limiter{Namespace: namespace, Name: name}
+		limiters[key] = l
+	}
+	limitersMutex.Unlock()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxQueueTime = maxQueueTime
+	if exists && l.limits == *limits {
+		return l, nil
+	}
+	l.limits = *limits
+
+	// Queries holding a slot of the previous channel give it back there, so a new
+	// channel only bounds the queries started after the change
+	l.slots = nil
+	if limits.MaxConcurrentQueries > 0 {
+		l.slots = make(chan struct{}, limits.MaxConcurrentQueries)
+	}
+
+	l.rateLimiter = nil
+	if limits.QueriesPerSecond > 0 {
+		burst := int(limits.Burst)
+		if burst <= 0 {
+			burst = int(limits.QueriesPerSecond)
+		}
+		l.rateLimiter = rate.NewLimiter(rate.Limit(limits.QueriesPerSecond), burst)
+	}
+
+	return l, nil
+}
+
+// GetLimiter returns the limiter of the connector, if it defines limits
+func GetLimiter(namespace, name string) (*Limiter, bool) {
+	limitersMutex.RLock()
+	defer limitersMutex.RUnlock()
+	l, exists := limiters[fmt.Sprintf("%s_%s", namespace, name)]
+	return l, exists
+}
+
+// DeleteLimiter forgets the limiter of the connector
+func DeleteLimiter(namespace, name string) {
+	limitersMutex.Lock()
+	defer limitersMutex.Unlock()
+	delete(limiters, fmt.Sprintf("%s_%s", namespace, name))
+}
+
+// Limiters returns the stats of every limiter
+func Limiters() []LimiterStats {
+	limitersMutex.RLock()
+	defer limitersMutex.RUnlock()
+	stats := make([]LimiterStats, 0, len(limiters))
+	for _, l := range limiters {
+		stats = append(stats, l.Stats())
+	}
+	return stats
+}
+
+// Acquire waits until the query can be sent to the connector. It waits at most MaxQueueTime,
+// and returns an error wrapping ErrThrottled if the query could not be sent by then. The
+// returned function must be called once the query is done
+func (l *Limiter) Acquire(ctx context.Context) (release func(), err error) {
+
+	l.mu.Lock()
+	slots, rateLimiter, maxQueueTime := l.slots, l.rateLimiter, l.maxQueueTime
+	l.mu.Unlock()
+
+	waitCtx, cancel := context.WithTimeout(ctx, maxQueueTime)
+	defer cancel()
+
+	queued := false
+	markQueued := func() {
+		if !queued {
+			queued = true
+			l.queued.Add(1)
+		}
+	}
+	reject := func() error {
+		l.rejected.Add(1)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w: waited %s", ErrThrottled, maxQueueTime)
+	}
+
+	// First a slot among the concurrent queries
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+		default:
+			markQueued()
+			l.waiting.Add(1)
+			select {
+			case slots <- struct{}{}:
+				l.waiting.Add(-1)
+			case <-waitCtx.Done():
+				l.waiting.Add(-1)
+				return nil, reject()
+			}
+		}
+	}
+	releaseSlot := func() {
+		if slots != nil {
+			<-slots
+		}
+	}
+
+	// Then a token of the rate. Reservations longer than the time left are rejected
+	// right away instead of waiting for nothing
+	if rateLimiter != nil {
+		reservation := rateLimiter.Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			markQueued()
+			deadline, _ := waitCtx.Deadline()
+			if time.Until(deadline) < delay {
+				reservation.Cancel()
+				releaseSlot()
+				return nil, reject()
+			}
+
+			l.waiting.Add(1)
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+				l.waiting.Add(-1)
+			case <-waitCtx.Done():
+				l.waiting.Add(-1)
+				timer.Stop()
+				reservation.Cancel()
+				releaseSlot()
+				return nil, reject()
+			}
+		}
+	}
+
+	l.inFlight.Add(1)
+	return func() {
+		l.inFlight.Add(-1)
+		releaseSlot()
+	}, nil
+}
+
+// Stats returns the counters of the limiter
+func (l *Limiter) Stats() LimiterStats {
+	return LimiterStats{
+		Namespace:     l.Namespace,
+		Name:          l.Name,
+		InFlight:      l.inFlight.Load(),
+		Waiting:       l.waiting.Load(),
+		QueuedTotal:   l.queued.Load(),
+		RejectedTotal: l.rejected.Load(),
+	}
+}
+
+// Throttled returns how many queries were queued and rejected since the last call
+func (l *Limiter) Throttled() (queued, rejected uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	queuedTotal, rejectedTotal := l.queued.Load(), l.rejected.Load()
+	queued, rejected = queuedTotal-l.reportedQueued, rejectedTotal-l.reportedRejected
+	l.reportedQueued, l.reportedRejected = queuedTotal, rejectedTotal
+	return queued, rejected
+}
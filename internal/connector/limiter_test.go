@@ -0,0 +1,163 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"freepik.com/searchruler/api/v1alpha1"
+)
+
+func TestLimiterConcurrency(t *testing.T) {
+	t.Parallel()
+	limiter, err := SetLimiter("test", "concurrency", &v1alpha1.QueryLimits{MaxConcurrentQueries: 2, MaxQueueTime: "50ms"})
+	if err != nil {
+		t.Fatalf("SetLimiter: %v", err)
+	}
+	t.Cleanup(func() { DeleteLimiter("test", "concurrency") })
+
+	first, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("first Acquire: %v", err)
+	}
+	second, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("second Acquire: %v", err)
+	}
+	if got := limiter.Stats().InFlight; got != 2 {
+		t.Errorf("in flight = %d, want 2", got)
+	}
+
+	// No slot is released in time
+	if _, err = limiter.Acquire(context.Background()); !errors.Is(err, ErrThrottled) {
+		t.Fatalf("third Acquire err = %v, want ErrThrottled", err)
+	}
+
+	// A slot released while waiting is taken
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		first()
+	}()
+	third, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("queued Acquire: %v", err)
+	}
+	second()
+	third()
+
+	stats := limiter.Stats()
+	if stats.InFlight != 0 || stats.Waiting != 0 || stats.QueuedTotal != 2 || stats.RejectedTotal != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if queued, rejected := limiter.Throttled(); queued != 2 || rejected != 1 {
+		t.Errorf("Throttled = %d, %d, want 2, 1", queued, rejected)
+	}
+	if queued, rejected := limiter.Throttled(); queued != 0 || rejected != 0 {
+		t.Errorf("Throttled after report = %d, %d, want 0, 0", queued, rejected)
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	t.Parallel()
+	limiter, err := SetLimiter("test", "rate", &v1alpha1.QueryLimits{QueriesPerSecond: 10, Burst: 1, MaxQueueTime: "1s"})
+	if err != nil {
+		t.Fatalf("SetLimiter: %v", err)
+	}
+	t.Cleanup(func() { DeleteLimiter("test", "rate") })
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		release, err := limiter.Acquire(context.Background())
+		if err != nil {
+			t.Fatalf("Acquire %d: %v", i, err)
+		}
+		release()
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("3 queries at 10 per second took %s", elapsed)
+	}
+
+	// Waits longer than maxQueueTime are rejected without waiting
+	if _, err = SetLimiter("test", "rate", &v1alpha1.QueryLimits{QueriesPerSecond: 1, Burst: 1, MaxQueueTime: "100ms"}); err != nil {
+		t.Fatalf("SetLimiter: %v", err)
+	}
+	release, err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	release()
+	start = time.Now()
+	if _, err = limiter.Acquire(context.Background()); !errors.Is(err, ErrThrottled) {
+		t.Fatalf("Acquire err = %v, want ErrThrottled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("rejection took %s", elapsed)
+	}
+}
+
+func TestLimiterShared(t *testing.T) {
+	t.Parallel()
+	if _, err := SetLimiter("test", "shared", &v1alpha1.QueryLimits{MaxConcurrentQueries: 3}); err != nil {
+		t.Fatalf("SetLimiter: %v", err)
+	}
+	t.Cleanup(func() { DeleteLimiter("test", "shared") })
+
+	// Every rule gets the limiter of the connector, and never more than 3 run at once
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		running int
+		peak    int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter, exists := GetLimiter("test", "shared")
+			if !exists {
+				t.Error("limiter not found")
+				return
+			}
+			release, err := limiter.Acquire(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			release()
+		}()
+	}
+	wg.Wait()
+	if peak > 3 {
+		t.Errorf("%d queries ran at once", peak)
+	}
+
+	if _, err := SetLimiter("test", "invalid", &v1alpha1.QueryLimits{MaxQueueTime: "forever"}); err == nil {
+		t.Errorf("invalid maxQueueTime must fail")
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+)
+
+const (
+
+	// Defaults of RequestPolicy
+	defaultRequestTimeout  = 60 * time.Second
+	defaultInitialInterval = 500 * time.Millisecond
+	defaultMaxInterval     = 10 * time.Second
+)
+
+// RequestSettings is a RequestPolicy with its durations parsed and the defaults filled in
+type RequestSettings struct {
+	Timeout         time.Duration
+	Retries         int
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+}
+
+// DefaultRequestSettings returns the settings of the connectors without a RequestPolicy
+func DefaultRequestSettings() RequestSettings {
+	return RequestSettings{
+		Timeout:         defaultRequestTimeout,
+		InitialInterval: defaultInitialInterval,
+		MaxInterval:     defaultMaxInterval,
+	}
+}
+
+// ParseRequestPolicy returns the settings with the fields set in the policy replacing theirs
+func ParseRequestPolicy(settings RequestSettings, policy *v1alpha1.RequestPolicy) (RequestSettings, error) {
+
+	if policy == nil {
+		return settings, nil
+	}
+
+	var err error
+	if policy.Timeout != "" {
+		settings.Timeout, err = time.ParseDuration(policy.Timeout)
+		if err != nil || settings.Timeout <= 0 {
+			return settings, fmt.Errorf("invalid timeout %q: must be a positive duration", policy.Timeout)
+		}
+	}
+	if policy.Retries != nil {
+		settings.Retries = int(*policy.Retries)
+	}
+	if policy.Backoff == nil {
+		return settings, nil
+	}
+	if policy.Backoff.InitialInterval != "" {
+		settings.InitialInterval, err = time.ParseDuration(policy.Backoff.InitialInterval)
+		if err != nil {
+			return settings, fmt.Errorf("invalid backoff.initialInterval %q: %v", policy.Backoff.InitialInterval, err)
+		}
+	}
+	if policy.Backoff.MaxInterval != "" {
+		settings.MaxInterval, err = time.ParseDuration(policy.Backoff.MaxInterval)
+		if err != nil {
+			return settings, fmt.Errorf("invalid backoff.maxInterval %q: %v", policy.Backoff.MaxInterval, err)
+		}
+	}
+	if settings.MaxInterval < settings.InitialInterval {
+		return settings, fmt.Errorf("backoff.maxInterval %s is lower than backoff.initialInterval %s",
+			settings.MaxInterval, settings.InitialInterval)
+	}
+
+	return settings, nil
+}
+
+// RequestSettingsFor returns the settings of the queries of a rule: the ones of the connector
+// overridden by the policy of the rule. A wrong policy in the connector is reported by the
+// QueryConnector controller, and its queries use the defaults meanwhile
+func RequestSettingsFor(connectorSpec *v1alpha1.QueryConnectorSpec, rulePolicy *v1alpha1.RequestPolicy) (RequestSettings, error) {
+	settings, err := ParseRequestPolicy(DefaultRequestSettings(), connectorSpec.RequestPolicy)
+	if err != nil {
+		settings = DefaultRequestSettings()
+	}
+	return ParseRequestPolicy(settings, rulePolicy)
+}
+
+// SearchTimeout formats the timeout as the time units of Elasticsearch, which does not take
+// durations such as `1m30s`
+func SearchTimeout(timeout time.Duration) string {
+	return fmt.Sprintf("%dms", timeout.Milliseconds())
+}
+
+// backoff returns the wait before the retry. It doubles with every retry up to MaxInterval,
+// and a random half of it is dropped so rules failing together do not retry together
+func (s RequestSettings) backoff(retry int) time.Duration {
+	wait := s.InitialInterval
+	for i := 0; i < retry && wait < s.MaxInterval; i++ {
+		wait *= 2
+	}
+	wait = min(wait, s.MaxInterval)
+	if wait <= 0 {
+		return 0
+	}
+	half := wait / 2
+	return half + rand.N(wait-half+1)
+}
+
+// retryAfter reads the seconds a 429 or 503 response asks to wait, if any
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// isRetryable reports whether the attempt failed in a way another attempt may not, like a
+// connection closed by a node restarting or a cluster shedding load
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+			errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || isNodeFailure(resp.StatusCode)
+}
+
+// cancelOnClose ends the context of an attempt once its response is read, as the body
+// can not be read anymore after that
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
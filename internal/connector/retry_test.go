@@ -0,0 +1,172 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connector
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"freepik.com/searchruler/api/v1alpha1"
+)
+
+func TestRequestSettingsFor(t *testing.T) {
+	t.Parallel()
+	retries := func(n int32) *int32 { return &n }
+	cases := []struct {
+		name      string
+		connector *v1alpha1.RequestPolicy
+		rule      *v1alpha1.RequestPolicy
+		want      RequestSettings
+		wantErr   bool
+	}{
+		{
+			name: "defaults",
+			want: RequestSettings{Timeout: time.Minute, InitialInterval: 500 * time.Millisecond, MaxInterval: 10 * time.Second},
+		},
+		{
+			name: "rule overrides the connector field by field",
+			connector: &v1alpha1.RequestPolicy{Timeout: "30s", Retries: retries(3),
+				Backoff: &v1alpha1.RequestBackoff{InitialInterval: "1s", MaxInterval: "20s"}},
+			rule: &v1alpha1.RequestPolicy{Timeout: "2m", Retries: retries(0)},
+			want: RequestSettings{Timeout: 2 * time.Minute, Retries: 0, InitialInterval: time.Second, MaxInterval: 20 * time.Second},
+		},
+		{
+			name:      "wrong connector falls back to the defaults",
+			connector: &v1alpha1.RequestPolicy{Timeout: "soon", Retries: retries(3)},
+			rule:      &v1alpha1.RequestPolicy{Retries: retries(1)},
+			want:      RequestSettings{Timeout: time.Minute, Retries: 1, InitialInterval: 500 * time.Millisecond, MaxInterval: 10 * time.Second},
+		},
+		{name: "invalid timeout", rule: &v1alpha1.RequestPolicy{Timeout: "0s"}, wantErr: true},
+		{name: "invalid backoff", rule: &v1alpha1.RequestPolicy{Backoff: &v1alpha1.RequestBackoff{MaxInterval: "5"}}, wantErr: true},
+		{name: "max under initial", rule: &v1alpha1.RequestPolicy{Backoff: &v1alpha1.RequestBackoff{MaxInterval: "100ms"}}, wantErr: true},
+	}
+	for _, tc := range cases {
+		got, err := RequestSettingsFor(&v1alpha1.QueryConnectorSpec{RequestPolicy: tc.connector}, tc.rule)
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("%s: err = %v, wantErr %v", tc.name, err, tc.wantErr)
+		}
+		if !tc.wantErr && got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+	settings := RequestSettings{InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second}
+	for retry, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		want *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			if got := settings.backoff(retry); got < want/2 || got > want {
+				t.Fatalf("backoff(%d) = %s, want within [%s, %s]", retry, got, want/2, want)
+			}
+		}
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	t.Parallel()
+
+	// newFlakyServer fails the first requests with the status and then answers them
+	newFlakyServer := func(t *testing.T, status, failures int) (*httptest.Server, *atomic.Int32) {
+		hits := &atomic.Int32{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if int(hits.Add(1)) <= failures {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(status)
+				return
+			}
+			_, _ = w.Write(body)
+		}))
+		t.Cleanup(srv.Close)
+		return srv, hits
+	}
+	retries := int32(2)
+	policy := &v1alpha1.RequestPolicy{Retries: &retries,
+		Backoff: &v1alpha1.RequestBackoff{InitialInterval: "1ms", MaxInterval: "5ms"}}
+
+	cases := []struct {
+		name       string
+		status     int
+		failures   int
+		wantStatus int
+		wantHits   int32
+	}{
+		{"recovers after 503", http.StatusServiceUnavailable, 2, http.StatusOK, 3},
+		{"recovers after 429", http.StatusTooManyRequests, 1, http.StatusOK, 2},
+		{"gives up after the retries", http.StatusBadGateway, 5, http.StatusBadGateway, 3},
+		{"does not retry other errors", http.StatusInternalServerError, 5, http.StatusInternalServerError, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			srv, hits := newFlakyServer(t, tc.status, tc.failures)
+			spec := &v1alpha1.QueryConnectorSpec{URL: srv.URL, RequestPolicy: policy}
+
+			req, _ := NewRequest(context.Background(), http.MethodPost, srv.URL+"/logs/_search",
+				strings.NewReader(`{"size":0}`), spec, nil)
+			resp, err := NewClient(spec, nil).Do(req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus || hits.Load() != tc.wantHits {
+				t.Errorf("status %d after %d requests, want %d after %d", resp.StatusCode, hits.Load(), tc.wantStatus, tc.wantHits)
+			}
+			if resp.StatusCode == http.StatusOK && string(body) != `{"size":0}` {
+				t.Errorf("body %q was not replayed", body)
+			}
+		})
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	t.Parallel()
+	hits := &atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	retries := int32(3)
+	spec := &v1alpha1.QueryConnectorSpec{URL: srv.URL, RequestPolicy: &v1alpha1.RequestPolicy{Timeout: "50ms", Retries: &retries}}
+	req, _ := NewRequest(context.Background(), http.MethodGet, srv.URL+"/", nil, spec, nil)
+
+	start := time.Now()
+	_, err := NewClient(spec, nil).Do(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want a deadline exceeded", err)
+	}
+
+	// A search too slow for the timeout is not sent again
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond || hits.Load() != 1 {
+		t.Errorf("gave up after %s and %d requests", elapsed, hits.Load())
+	}
+}
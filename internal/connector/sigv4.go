@@ -0,0 +1,185 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connector
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	//
+	"freepik.com/searchruler/internal/pools"
+)
+
+// AWS Signature Version 4, as described in
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html
+const (
+	sigV4Algorithm         = "AWS4-HMAC-SHA256"
+	sigV4Terminator        = "aws4_request"
+	sigV4TimeFormat        = "20060102T150405Z"
+	sigV4DateFormat        = "20060102"
+	sigV4ServerlessService = "aoss"
+
+	headerAmzDate          = "X-Amz-Date"
+	headerAmzSecurityToken = "X-Amz-Security-Token"
+	headerAmzContentSHA256 = "X-Amz-Content-Sha256"
+)
+
+// signV4 signs the request in place with the AWS credentials of the connector. Only the host
+// and the X-Amz-* headers are signed: proxies and the HTTP client itself may touch the others
+func signV4(req *http.Request, creds *pools.Credentials, now time.Time) error {
+
+	service := creds.Service
+	if service == "" {
+		service = DefaultSigV4Service
+	}
+
+	// The payload is part of the signature. Requests built from a buffer can replay their body
+	payload := []byte{}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return fmt.Errorf("can not read the body to sign it: %v", err)
+		}
+		payload, err = io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return fmt.Errorf("can not read the body to sign it: %v", err)
+		}
+	}
+	payloadHash := sha256Hex(payload)
+
+	amzDate := now.UTC().Format(sigV4TimeFormat)
+	req.Header.Set(headerAmzDate, amzDate)
+	req.Header.Del(headerAmzSecurityToken)
+	if creds.SessionToken != "" {
+		req.Header.Set(headerAmzSecurityToken, creds.SessionToken)
+	}
+	// OpenSearch Serverless refuses requests without the payload hash header
+	if service == sigV4ServerlessService {
+		req.Header.Set(headerAmzContentSHA256, payloadHash)
+	}
+
+	// Canonical headers: host plus every X-Amz-* header, lowercased and sorted
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		lowerName := strings.ToLower(name)
+		if strings.HasPrefix(lowerName, "x-amz-") {
+			headers[lowerName] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	headerNames := make([]string, 0, len(headers))
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+
+	canonicalHeaders := strings.Builder{}
+	for _, name := range headerNames {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	// Services other than S3 expect the already escaped path to be escaped again
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIEscape(path, false),
+		canonicalQueryString(req),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	date := now.UTC().Format(sigV4DateFormat)
+	scope := strings.Join([]string{date, creds.Region, service, sigV4Terminator}, "/")
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	// Derive the signing key for the day, region and service
+	signingKey := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, creds.Region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, sigV4Terminator)
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, creds.AccessKeyID, scope, signedHeaders, signature))
+
+	return nil
+}
+
+// canonicalQueryString sorts the query parameters by name and value, escaping both
+func canonicalQueryString(req *http.Request) string {
+	query := req.URL.Query()
+	params := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, awsURIEscape(name, true)+"="+awsURIEscape(value, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// awsURIEscape escapes every byte but the unreserved characters of RFC 3986. Slashes are
+// kept when escaping paths
+func awsURIEscape(in string, escapeSlash bool) string {
+	out := strings.Builder{}
+	for i := 0; i < len(in); i++ {
+		c := in[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			out.WriteByte(c)
+		case c == '/' && !escapeSlash:
+			out.WriteByte(c)
+		default:
+			fmt.Fprintf(&out, "%%%02X", c)
+		}
+	}
+	return out.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
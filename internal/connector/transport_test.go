@@ -0,0 +1,115 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connector
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/pools"
+)
+
+func TestProxyFunc(t *testing.T) {
+	t.Parallel()
+	proxy, err := ProxyFunc("http://proxy.internal:3128", []string{".svc.cluster.local", "10.0.0.0/8", "es-direct:9200"})
+	if err != nil {
+		t.Fatalf("ProxyFunc: %v", err)
+	}
+
+	cases := map[string]bool{
+		"https://logs.example.com:9243/_search":          true,
+		"http://es.logging.svc.cluster.local:9200/":      false,
+		"http://10.1.2.3:9200/":                          false,
+		"http://es-direct:9200/":                         false,
+		"http://es-direct:9201/":                         true,
+		"https://alertmanager.example.com/api/v2/alerts": true,
+	}
+	for target, proxied := range cases {
+		req, _ := http.NewRequest(http.MethodGet, target, nil)
+		got, err := proxy(req)
+		if err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		if (got != nil) != proxied {
+			t.Errorf("%s: proxy = %v, want proxied %t", target, got, proxied)
+		}
+	}
+
+	if proxy, err = ProxyFunc("", nil); err != nil || proxy != nil {
+		t.Errorf("no proxyURL must mean no proxy, got err %v", err)
+	}
+	if _, err = ProxyFunc("proxy.internal:3128", nil); err == nil {
+		t.Errorf("a proxyURL without scheme must fail")
+	}
+}
+
+func TestClientThroughProxy(t *testing.T) {
+	t.Parallel()
+
+	// The proxy answers itself, recording the host it was asked for
+	proxiedHost := ""
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedHost = r.Host
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(proxy.Close)
+
+	spec := &v1alpha1.QueryConnectorSpec{URL: "http://es.internal:9200", ProxyURL: proxy.URL}
+	req, _ := NewRequest(context.Background(), http.MethodGet, spec.URL+"/", nil, spec, nil)
+	resp, err := NewClient(spec, nil).Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	if proxiedHost != "es.internal:9200" {
+		t.Errorf("proxy got a request for %q", proxiedHost)
+	}
+}
+
+func TestClientCABundle(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(srv.Close)
+	bundle := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+
+	get := func(creds *pools.Credentials) error {
+		spec := &v1alpha1.QueryConnectorSpec{URL: srv.URL}
+		req, _ := NewRequest(context.Background(), http.MethodGet, srv.URL+"/", nil, spec, creds)
+		resp, err := NewClient(spec, creds).Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(&pools.Credentials{}); err == nil {
+		t.Errorf("a certificate signed by an unknown CA must be rejected")
+	}
+	if err := get(&pools.Credentials{CABundle: bundle}); err != nil {
+		t.Errorf("the CA bundle must be trusted: %v", err)
+	}
+
+	if _, err := RootCAs("not a certificate"); err == nil {
+		t.Errorf("a bundle without certificates must fail")
+	}
+}
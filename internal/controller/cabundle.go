@@ -0,0 +1,86 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	//
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+)
+
+const (
+
+	// Kinds of object a CABundleRef can point to
+	CABundleKindSecret    = "Secret"
+	CABundleKindConfigMap = "ConfigMap"
+
+	// Default of CABundleRef.Key, also set by the CRD
+	DefaultCABundleKey = "ca.crt"
+)
+
+// CABundleObject returns the kind and name of the object holding the bundle. References
+// without namespace point to the namespace of the resource holding them
+func CABundleObject(ref *v1alpha1.CABundleRef, defaultNamespace string) (kind string, namespacedName types.NamespacedName) {
+
+	kind = ref.Kind
+	if kind == "" {
+		kind = CABundleKindSecret
+	}
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	return kind, types.NamespacedName{Namespace: namespace, Name: ref.Name}
+}
+
+// GetCABundle reads the PEM bundle the reference points to, from a Secret or a ConfigMap
+func GetCABundle(ctx context.Context, c client.Reader, ref *v1alpha1.CABundleRef, defaultNamespace string) (string, error) {
+
+	kind, namespacedName := CABundleObject(ref, defaultNamespace)
+	key := ref.Key
+	if key == "" {
+		key = DefaultCABundleKey
+	}
+
+	bundle := ""
+	switch kind {
+	case CABundleKindConfigMap:
+		configMap := &corev1.ConfigMap{}
+		if err := c.Get(ctx, namespacedName, configMap); err != nil {
+			return "", fmt.Errorf(ConfigMapNotFoundErrorMessage, namespacedName, err)
+		}
+		bundle = configMap.Data[key]
+	default:
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, namespacedName, secret); err != nil {
+			return "", fmt.Errorf(SecretNotFoundErrorMessage, namespacedName, err)
+		}
+		bundle = string(secret.Data[key])
+	}
+
+	if bundle == "" {
+		return "", fmt.Errorf(MissingCABundleMessage, key, kind, namespacedName)
+	}
+	return bundle, nil
+}
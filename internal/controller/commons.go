@@ -8,40 +8,79 @@ const (
 	QueryConnectorResourceType        = "QueryConnector"
 	ClusterQueryConnectorResourceType = "ClusterQueryConnector"
 	ClusterRulerActionResourceType    = "ClusterRulerAction"
+	SearchRuleTemplateResourceType    = "SearchRuleTemplate"
 
 	// Sync interval to check if secrets of SearchRuleAction and SearchRuleQueryConnector are up to date
 	DefaultSyncInterval            = "1m"
 	DefaultSyncIntervalRulerAction = "5s"
 
 	// Error messages
-	ResourceNotFoundError                  = "%s '%s' resource not found. Ignoring since object must be deleted."
-	CanNotGetResourceError                 = "%s '%s' resource not found. Error: %v"
-	ResourceFinalizersUpdateError          = "Failed to update finalizer of %s '%s': %s"
-	ResourceConditionUpdateError           = "Failed to update the condition on %s '%s': %s"
-	ResourceSyncTimeRetrievalError         = "can not get synchronization time from the %s '%s': %s"
-	SyncTargetError                        = "can not sync the target for the %s '%s': %s"
-	ValidatorNotFoundErrorMessage          = "validator %s not found"
-	ValidationFailedErrorMessage           = "validation failed: %s"
-	HttpRequestCreationErrorMessage        = "error creating http request: %s"
-	HttpRequestSendingErrorMessage         = "error sending http request: %s"
-	AlertFiringInfoMessage                 = "alert firing for searchRule with namespaced name %s/%s. Description: %s"
-	SecretNotFoundErrorMessage             = "error fetching secret %s: %v"
-	MissingCredentialsMessage              = "missing credentials in secret %s"
-	EvaluateTemplateErrorMessage           = "error evaluating template message: %v"
-	AlertsPoolErrorMessage                 = "error getting alerts pool: %v"
-	QueryConnectorNotFoundMessage          = "queryConnector %s not found in the resource namespace %s"
-	QueryNotDefinedErrorMessage            = "query not defined in resource %s"
-	QueryDefinedInBothErrorMessage         = "both query and queryJSON are defined in resource %s. Only one of them must be defined"
-	JSONMarshalErrorMessage                = "error marshaling json: %v"
-	ElasticsearchQueryErrorMessage         = "error executing elasticsearch request %s: %v"
-	ResponseBodyReadErrorMessage           = "error reading response body: %v"
-	ElasticsearchQueryResponseErrorMessage = "error response from Elasticsearch executing request %s: %s"
-	ConditionFieldNotFoundMessage          = "conditionField %s not found in the response: %s"
-	EvaluatingConditionErrorMessage        = "error evaluating condition: %v"
-	ForValueParseErrorMessage              = "error parsing `for` time: %v"
-	KubeEventCreationErrorMessage          = "error creating kube event: %v"
-	MissingCertsMessage                    = "missing certificates in secret %s"
+	ResourceNotFoundError              = "%s '%s' resource not found. Ignoring since object must be deleted."
+	CanNotGetResourceError             = "%s '%s' resource not found. Error: %v"
+	ResourceFinalizersUpdateError      = "Failed to update finalizer of %s '%s': %s"
+	ResourceConditionUpdateError       = "Failed to update the condition on %s '%s': %s"
+	ResourceSyncTimeRetrievalError     = "can not get synchronization time from the %s '%s': %s"
+	SyncTargetError                    = "can not sync the target for the %s '%s': %s"
+	ValidatorNotFoundErrorMessage      = "validator %s not found"
+	ValidationFailedErrorMessage       = "validation failed: %s"
+	HttpRequestCreationErrorMessage    = "error creating http request: %s"
+	HttpRequestSendingErrorMessage     = "error sending http request: %s"
+	AlertFiringInfoMessage             = "alert firing for searchRule with namespaced name %s/%s. Description: %s"
+	SecretNotFoundErrorMessage         = "error fetching secret %s: %v"
+	MissingCredentialsMessage          = "missing credentials in secret %s"
+	ConfigMapNotFoundErrorMessage      = "error fetching configmap %s: %v"
+	MissingCABundleMessage             = "missing CA bundle %s in %s %s"
+	CABundleErrorMessage               = "invalid CA bundle: %v"
+	ProxyErrorMessage                  = "invalid proxy: %v"
+	EvaluateTemplateErrorMessage       = "error evaluating template message: %v"
+	AlertsPoolErrorMessage             = "error getting alerts pool: %v"
+	QueryConnectorNotFoundMessage      = "queryConnector %s not found in the resource namespace %s"
+	QueryNotDefinedErrorMessage        = "query not defined in resource %s"
+	QueryDefinedInBothErrorMessage     = "more than one of query, queryJSON, sql or ppl are defined in resource %s. Only one of them must be defined"
+	IndexNotDefinedErrorMessage        = "index not defined in resource %s. It is required for query and queryJSON"
+	JSONMarshalErrorMessage            = "error marshaling json: %v"
+	BackendRequestErrorMessage         = "error executing %s request %s: %v"
+	ResponseBodyReadErrorMessage       = "error reading response body: %v"
+	BackendResponseErrorMessage        = "error response from %s executing request %s: %s"
+	BackendResponseStatusErrorMessage  = "query failed: %s"
+	SearchTimedOutErrorMessage         = "search timed out on the cluster, its results are partial"
+	BackendQueryNotDefinedErrorMessage = "%s query not defined in resource %s"
+	UnknownBackendErrorMessage         = "unknown query backend %q"
+	ConditionFieldNotFoundMessage      = "conditionField %s not found in the response: %s"
+	EvaluatingConditionErrorMessage    = "error evaluating condition: %w"
+	InvalidConditionErrorMessage       = "invalid condition: %v"
+	FieldNotFoundMessage               = "field %s not found in the response: %s"
+	ForValueParseErrorMessage          = "error parsing `for` time: %v"
+	KubeEventCreationErrorMessage      = "error creating kube event: %v"
+	MissingCertsMessage                = "missing certificates in secret %s"
+	AuthDefinedTwiceErrorMessage       = "both credentials and auth are defined. Only one of them must be defined"
+	AuthModeNotDefinedErrorMessage     = "auth is defined without any mode. One of basic, apiKey, bearer or sigv4 must be defined"
+	DistributionDetectionErrorMessage  = "can not detect the distribution of %s '%s': %v"
+	DistributionDetectedMessage        = "%s %s detected"
+	DistributionMismatchMessage        = "type is %s but the cluster reports %s %s"
+	ConnectorProbeErrorMessage         = "can not reach %s '%s': %v"
+	ConnectorReachableMessage          = "Connector answered in %dms"
+	ConnectorHealthMessage             = "Cluster %s is %s, answered in %dms"
+	LoadBalancingParseErrorMessage     = "error parsing loadBalancing: %v"
+	LimitsParseErrorMessage            = "error parsing limits: %v"
+	ConnectorThrottledMessage          = "%d queries queued and %d rejected since the last sync"
+	BatchingParseErrorMessage          = "error parsing batching: %v"
+	BatchQueryErrorMessage             = "query of SearchRule %s/%s can not be batched: %v"
+	BatchResponseSizeErrorMessage      = "_msearch returned %d responses for %d queries"
+	RequestPolicyParseErrorMessage     = "error parsing requestPolicy: %v"
+	ReferencesListErrorMessage         = "error listing the %s resources referencing %s %s: %v"
+	TemplateParameterMissingMessage    = "parameter %s is required"
+	TemplateParameterUnknownMessage    = "unknown parameter %s"
+	TemplateRenderErrorMessage         = "error rendering %s: %v"
+	TemplateMissingValueMessage        = "the template reads a value that does not exist"
+	TemplateSpecErrorMessage           = "rendered spec is not a valid SearchRule spec: %v"
+	TemplateInstanceConflictMessage    = "SearchRule %s already exists and is not generated by the template"
+	TemplateInstancesErrorMessage      = "%d of %d SearchRules could not be rendered or applied"
 
 	// Finalizer
 	ResourceFinalizer = "searchruler.freepik.com/finalizer"
+
+	// Label and annotation of the SearchRules generated from a SearchRuleTemplate
+	TemplateLabel              = "searchruler.freepik.com/template"
+	TemplateRevisionAnnotation = "searchruler.freepik.com/template-revision"
 )
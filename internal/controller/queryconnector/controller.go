@@ -23,11 +23,14 @@ import (
 	"time"
 
 	//
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	runtimecontroller "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -44,6 +47,18 @@ type QueryConnectorReconciler struct {
 	client.Client
 	Scheme          *runtime.Scheme
 	CredentialsPool *pools.CredentialsStore
+	ConnectorsPool  *pools.ConnectorsStore
+
+	// Sharded runs the controller on every replica instead of only on the leader, as every
+	// replica needs the credentials of the QueryConnectors when the SearchRules are sharded.
+	// Only the leader probes the connectors and writes their finalizers and status then
+	Sharded bool
+
+	// MaxConcurrentReconciles is how many QueryConnectors and ClusterQueryConnectors are reconciled at the same time
+	MaxConcurrentReconciles int
+
+	// elected is closed once the replica is the leader, nil when the controller only runs on it
+	elected <-chan struct{}
 }
 
 type CompoundQueryConnectorResource struct {
@@ -51,16 +66,12 @@ type CompoundQueryConnectorResource struct {
 	ClusterQueryConnectorResource *searchrulerv1alpha1.ClusterQueryConnector
 }
 
-var (
-	resourceType      string
-	containsFinalizer bool
-)
-
 // +kubebuilder:rbac:groups=searchruler.freepik.com,resources=queryconnectors,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=searchruler.freepik.com,resources=queryconnectors/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=searchruler.freepik.com,resources=queryconnectors/finalizers,verbs=update
 
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -75,6 +86,7 @@ func (r *QueryConnectorReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		QueryConnectorResource:        &searchrulerv1alpha1.QueryConnector{},
 		ClusterQueryConnectorResource: &searchrulerv1alpha1.ClusterQueryConnector{},
 	}
+	var resourceType string
 	switch req.Namespace {
 	case "":
 		resourceType = controller.ClusterQueryConnectorResourceType
@@ -87,10 +99,13 @@ func (r *QueryConnectorReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	// 2. Check existence on the cluster
 	if err != nil {
 
-		// 2.1 It does NOT exist: manage removal
+		// 2.1 It does NOT exist: manage removal. The replicas not removing the finalizer
+		// only see the resource gone, so they forget it here
 		if err = client.IgnoreNotFound(err); err == nil {
 			logger.Info(fmt.Sprintf(controller.ResourceNotFoundError, resourceType, req.NamespacedName))
-			return result, err
+			CompoundQueryConnectorResource.QueryConnectorResource.ObjectMeta = v1.ObjectMeta{Namespace: req.Namespace, Name: req.Name}
+			CompoundQueryConnectorResource.ClusterQueryConnectorResource.ObjectMeta = v1.ObjectMeta{Name: req.Name}
+			return result, r.Sync(ctx, watch.Deleted, CompoundQueryConnectorResource, resourceType)
 		}
 
 		// 2.2 Failed to get the resource, requeue the request
@@ -100,6 +115,7 @@ func (r *QueryConnectorReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 
 	// 3. Check if the QueryConnector or ClusterQueryConnector instance is marked to be deleted: indicated by the deletion timestamp being set
 	deletionTimestamp := &v1.Time{}
+	var containsFinalizer bool
 	switch resourceType {
 	case controller.ClusterQueryConnectorResourceType:
 		deletionTimestamp = CompoundQueryConnectorResource.ClusterQueryConnectorResource.DeletionTimestamp
@@ -108,11 +124,13 @@ func (r *QueryConnectorReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		deletionTimestamp = CompoundQueryConnectorResource.QueryConnectorResource.DeletionTimestamp
 		containsFinalizer = controllerutil.ContainsFinalizer(CompoundQueryConnectorResource.QueryConnectorResource, controller.ResourceFinalizer)
 	}
+	leader := controller.IsLeader(r.elected)
 	if !deletionTimestamp.IsZero() {
-		if containsFinalizer {
 
-			// 3.1 Delete the resources associated with the QueryConnector
-			err = r.Sync(ctx, watch.Deleted, CompoundQueryConnectorResource, resourceType)
+		// 3.1 Delete the resources associated with the QueryConnector
+		err = r.Sync(ctx, watch.Deleted, CompoundQueryConnectorResource, resourceType)
+
+		if containsFinalizer && leader {
 
 			// Remove the finalizers on Patch CR
 			switch resourceType {
@@ -134,7 +152,7 @@ func (r *QueryConnectorReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	}
 
 	// 4. Add finalizer to the QueryConnector or ClusterQueryConnector CR
-	if !containsFinalizer {
+	if !containsFinalizer && leader {
 		switch resourceType {
 		case controller.ClusterQueryConnectorResourceType:
 			controllerutil.AddFinalizer(CompoundQueryConnectorResource.ClusterQueryConnectorResource, controller.ResourceFinalizer)
@@ -150,6 +168,9 @@ func (r *QueryConnectorReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 
 	// 5. Update the status before the requeue
 	defer func() {
+		if !leader {
+			return
+		}
 		switch resourceType {
 		case controller.ClusterQueryConnectorResourceType:
 			err = r.Status().Update(ctx, CompoundQueryConnectorResource.ClusterQueryConnectorResource)
@@ -199,10 +220,35 @@ func (r *QueryConnectorReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *QueryConnectorReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	needLeaderElection := !r.Sharded
+	if r.Sharded {
+		r.elected = mgr.Elected()
+	}
+
+	// Index the QueryConnectors by the Secrets and ConfigMaps they read, to find the ones to enqueue
+	// when one of them changes
+	ctx := context.Background()
+	if err := controller.IndexReferences(ctx, mgr.GetFieldIndexer(), &searchrulerv1alpha1.QueryConnector{}, queryConnectorReferences); err != nil {
+		return err
+	}
+	if err := controller.IndexReferences(ctx, mgr.GetFieldIndexer(), &searchrulerv1alpha1.ClusterQueryConnector{}, clusterQueryConnectorReferences); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&searchrulerv1alpha1.QueryConnector{}).
-		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		WithOptions(runtimecontroller.Options{
+			NeedLeaderElection:      &needLeaderElection,
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+		}).
+		For(&searchrulerv1alpha1.QueryConnector{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Named("QueryConnector").
-		Watches(&searchrulerv1alpha1.ClusterQueryConnector{}, &handler.EnqueueRequestForObject{}).
+		Watches(&searchrulerv1alpha1.ClusterQueryConnector{}, &handler.EnqueueRequestForObject{},
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		// Secrets and ConfigMaps have no generation, every change of their data must be seen. Only
+		// their metadata is cached, as they are read from the API server when synced
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.requestsForSecret),
+			builder.OnlyMetadata, builder.WithPredicates(predicate.ResourceVersionChangedPredicate{})).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.requestsForConfigMap),
+			builder.OnlyMetadata, builder.WithPredicates(predicate.ResourceVersionChangedPredicate{})).
 		Complete(r)
 }
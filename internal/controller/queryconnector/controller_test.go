@@ -0,0 +1,149 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queryconnector
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/connector"
+	"freepik.com/searchruler/internal/controller"
+	"freepik.com/searchruler/internal/pools"
+)
+
+func TestReconcileOnlyLeaderWritesStatus(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("clientgoscheme: %v", err)
+	}
+	if err := searchrulerv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("searchrulerv1alpha1: %v", err)
+	}
+
+	key := types.NamespacedName{Namespace: "observability", Name: "logs"}
+	resource := &searchrulerv1alpha1.QueryConnector{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+		Spec: searchrulerv1alpha1.QueryConnectorSpec{URL: "http://127.0.0.1:1", Credentials: searchrulerv1alpha1.QueryConnectorCredentials{
+			SecretRef: searchrulerv1alpha1.SecretRef{Name: "es-credentials", KeyUsername: "username", KeyPassword: "password"},
+		}},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "es-credentials", Namespace: key.Namespace},
+		Data:       map[string][]byte{"username": []byte("elastic"), "password": []byte("changeme")},
+	}
+	elected := make(chan struct{})
+	r := &QueryConnectorReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(resource, secret).WithStatusSubresource(resource).Build(),
+		Scheme:          scheme,
+		CredentialsPool: &pools.CredentialsStore{Store: map[string]*pools.Credentials{}},
+		ConnectorsPool:  &pools.ConnectorsStore{Store: map[string]*pools.ConnectorHealth{}},
+		Sharded:         true,
+		elected:         elected,
+	}
+	reconcileAndGet := func() *searchrulerv1alpha1.QueryConnector {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile: %v", err)
+		}
+		stored := &searchrulerv1alpha1.QueryConnector{}
+		if err := r.Get(ctx, key, stored); err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		return stored
+	}
+
+	// Replicas other than the leader fill their pools, without probing nor writing the resource
+	stored := reconcileAndGet()
+	if creds, exists := r.CredentialsPool.Get("observability_logs"); !exists || creds.Username != "elastic" {
+		t.Errorf("credentials in the pool = %+v, want the ones of the Secret", creds)
+	}
+	if _, probed := r.ConnectorsPool.Get("observability_logs"); probed {
+		t.Errorf("connector probed by a replica other than the leader")
+	}
+	if controllerutil.ContainsFinalizer(stored, controller.ResourceFinalizer) || len(stored.Status.Conditions) != 0 {
+		t.Errorf("resource written by a replica other than the leader: %+v, %+v", stored.Finalizers, stored.Status.Conditions)
+	}
+
+	// The leader probes the connector and reports it
+	close(elected)
+	stored = reconcileAndGet()
+	if _, probed := r.ConnectorsPool.Get("observability_logs"); !probed {
+		t.Errorf("connector not probed by the leader")
+	}
+	if !controllerutil.ContainsFinalizer(stored, controller.ResourceFinalizer) || len(stored.Status.Conditions) == 0 {
+		t.Errorf("resource not written by the leader: %+v, %+v", stored.Finalizers, stored.Status.Conditions)
+	}
+}
+
+func TestReconcileForgetsReplacedHTTPClient(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("clientgoscheme: %v", err)
+	}
+	if err := searchrulerv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("searchrulerv1alpha1: %v", err)
+	}
+
+	key := types.NamespacedName{Name: "forget-replaced-client"}
+	resource := &searchrulerv1alpha1.ClusterQueryConnector{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name},
+		Spec:       searchrulerv1alpha1.QueryConnectorSpec{URL: "http://127.0.0.1:1", ProxyURL: "http://127.0.0.1:2"},
+	}
+	r := &QueryConnectorReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(resource).WithStatusSubresource(resource).Build(),
+		Scheme:          scheme,
+		CredentialsPool: &pools.CredentialsStore{Store: map[string]*pools.Credentials{}},
+		ConnectorsPool:  &pools.ConnectorsStore{Store: map[string]*pools.ConnectorHealth{}},
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	previous, _ := r.CredentialsPool.Get("_" + key.Name)
+	client := connector.GetOrCreateHTTPClient(previous.Spec, previous)
+
+	// Changing the proxy replaces the client, and the one of the previous spec is forgotten
+	stored := &searchrulerv1alpha1.ClusterQueryConnector{}
+	if err := r.Get(ctx, key, stored); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	stored.Spec.ProxyURL = "http://127.0.0.1:3"
+	if err := r.Update(ctx, stored); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if connector.GetOrCreateHTTPClient(previous.Spec, previous) == client {
+		t.Errorf("the client of the previous proxy is still cached")
+	}
+}
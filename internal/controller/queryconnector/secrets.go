@@ -0,0 +1,96 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queryconnector
+
+import (
+	"context"
+
+	//
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/controller"
+)
+
+// referencedObjects returns the Secrets and ConfigMaps the connector reads its credentials and
+// certificates from. References without namespace point to the namespace of the connector
+func referencedObjects(spec *v1alpha1.QueryConnectorSpec, defaultNamespace string) []controller.Reference {
+
+	references := []controller.Reference{}
+	addSecret := func(name, namespace string) {
+		if name != "" {
+			references = append(references, controller.NewReference(controller.CABundleKindSecret, name, namespace, defaultNamespace))
+		}
+	}
+
+	addSecret(spec.Credentials.SecretRef.Name, spec.Credentials.SecretRef.Namespace)
+	addSecret(spec.Certificates.SecretRef.Name, spec.Certificates.SecretRef.Namespace)
+	if auth := spec.Auth; auth != nil {
+		if auth.Basic != nil {
+			addSecret(auth.Basic.SecretRef.Name, auth.Basic.SecretRef.Namespace)
+		}
+		if auth.APIKey != nil {
+			addSecret(auth.APIKey.Name, auth.APIKey.Namespace)
+		}
+		if auth.Bearer != nil {
+			addSecret(auth.Bearer.Name, auth.Bearer.Namespace)
+		}
+		if auth.SigV4 != nil {
+			addSecret(auth.SigV4.SecretRef.Name, auth.SigV4.SecretRef.Namespace)
+		}
+	}
+	if spec.CABundle != nil {
+		kind, namespacedName := controller.CABundleObject(spec.CABundle, defaultNamespace)
+		references = append(references, controller.Reference{Kind: kind, NamespacedName: namespacedName})
+	}
+
+	return references
+}
+
+// queryConnectorReferences returns the objects read by a QueryConnector, for the references index
+func queryConnectorReferences(object client.Object) []controller.Reference {
+	queryConnector := object.(*v1alpha1.QueryConnector)
+	return referencedObjects(&queryConnector.Spec, queryConnector.Namespace)
+}
+
+// clusterQueryConnectorReferences returns the objects read by a ClusterQueryConnector, for the
+// references index
+func clusterQueryConnectorReferences(object client.Object) []controller.Reference {
+	return referencedObjects(&object.(*v1alpha1.ClusterQueryConnector).Spec, "")
+}
+
+// requestsForSecret enqueues the connectors referencing the Secret, so rotated credentials and
+// renewed certificates are used without waiting for the next sync
+func (r *QueryConnectorReconciler) requestsForSecret(ctx context.Context, secret client.Object) []reconcile.Request {
+	return r.requestsReferencing(ctx, controller.CABundleKindSecret, secret)
+}
+
+// requestsForConfigMap enqueues the connectors reading their CA bundle from the ConfigMap
+func (r *QueryConnectorReconciler) requestsForConfigMap(ctx context.Context, configMap client.Object) []reconcile.Request {
+	return r.requestsReferencing(ctx, controller.CABundleKindConfigMap, configMap)
+}
+
+// requestsReferencing enqueues the QueryConnectors and ClusterQueryConnectors referencing the object
+func (r *QueryConnectorReconciler) requestsReferencing(ctx context.Context, kind string, object client.Object) []reconcile.Request {
+	return append(
+		controller.RequestsReferencing(ctx, r.Client, controller.QueryConnectorResourceType,
+			&v1alpha1.QueryConnectorList{}, kind, object),
+		controller.RequestsReferencing(ctx, r.Client, controller.ClusterQueryConnectorResourceType,
+			&v1alpha1.ClusterQueryConnectorList{}, kind, object)...)
+}
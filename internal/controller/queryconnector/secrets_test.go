@@ -0,0 +1,93 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queryconnector
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/controller"
+)
+
+func TestRequestsForReferencedObjects(t *testing.T) {
+	t.Parallel()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("clientgoscheme: %v", err)
+	}
+	if err := searchrulerv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("searchrulerv1alpha1: %v", err)
+	}
+
+	credentials := searchrulerv1alpha1.QueryConnectorCredentials{
+		SecretRef: searchrulerv1alpha1.SecretRef{Name: "es-credentials"},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithIndex(&searchrulerv1alpha1.QueryConnector{}, controller.ReferencesField, controller.ReferencesIndexer(queryConnectorReferences)).
+		WithIndex(&searchrulerv1alpha1.ClusterQueryConnector{}, controller.ReferencesField, controller.ReferencesIndexer(clusterQueryConnectorReferences)).
+		WithObjects(
+			// Reads the Secret from its own namespace
+			&searchrulerv1alpha1.QueryConnector{
+				ObjectMeta: metav1.ObjectMeta{Name: "logs", Namespace: "observability"},
+				Spec:       searchrulerv1alpha1.QueryConnectorSpec{URL: "http://es", Credentials: credentials},
+			},
+			// Same name, another namespace
+			&searchrulerv1alpha1.QueryConnector{
+				ObjectMeta: metav1.ObjectMeta{Name: "logs", Namespace: "team-a"},
+				Spec:       searchrulerv1alpha1.QueryConnectorSpec{URL: "http://es", Credentials: credentials},
+			},
+			&searchrulerv1alpha1.ClusterQueryConnector{
+				ObjectMeta: metav1.ObjectMeta{Name: "shared"},
+				Spec: searchrulerv1alpha1.QueryConnectorSpec{URL: "https://es", Auth: &searchrulerv1alpha1.QueryConnectorAuth{
+					APIKey: &searchrulerv1alpha1.SecretKeyRef{Name: "es-credentials", Namespace: "observability", Key: "apiKey"},
+				}},
+			},
+			// Reads its CA bundle from a ConfigMap of the same name
+			&searchrulerv1alpha1.ClusterQueryConnector{
+				ObjectMeta: metav1.ObjectMeta{Name: "internal-ca"},
+				Spec: searchrulerv1alpha1.QueryConnectorSpec{URL: "https://internal", CABundle: &searchrulerv1alpha1.CABundleRef{
+					Kind: "ConfigMap", Name: "es-credentials", Namespace: "observability",
+				}},
+			},
+		).Build()
+	r := &QueryConnectorReconciler{Client: c, Scheme: scheme}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "es-credentials", Namespace: "observability"}}
+	want := []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "observability", Name: "logs"}},
+		{NamespacedName: types.NamespacedName{Name: "shared"}},
+	}
+	if got := r.requestsForSecret(context.Background(), secret); !reflect.DeepEqual(got, want) {
+		t.Errorf("Secret: got %v, want %v", got, want)
+	}
+
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "es-credentials", Namespace: "observability"}}
+	want = []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "internal-ca"}}}
+	if got := r.requestsForConfigMap(context.Background(), configMap); !reflect.DeepEqual(got, want) {
+		t.Errorf("ConfigMap: got %v, want %v", got, want)
+	}
+}
@@ -17,9 +17,13 @@ limitations under the License.
 package queryconnector
 
 import (
+	"fmt"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/connector"
 	"freepik.com/searchruler/internal/controller"
 	"freepik.com/searchruler/internal/globals"
 )
@@ -103,3 +107,100 @@ func (r *QueryConnectorReconciler) UpdateConditionNoCertsFound(resource *Compoun
 		globals.UpdateCondition(&resource.QueryConnectorResource.Status.Conditions, condition)
 	}
 }
+
+// resourceStatus returns the status of the QueryConnector or ClusterQueryConnector wrapped in the resource
+func resourceStatus(resource *CompoundQueryConnectorResource, resourceType string) *v1alpha1.QueryConnectorStatus {
+	if resourceType == controller.ClusterQueryConnectorResourceType {
+		return &resource.ClusterQueryConnectorResource.Status
+	}
+	return &resource.QueryConnectorResource.Status
+}
+
+// UpdateDistributionDetected records the distribution and version reported by the cluster. When the
+// type of the spec is explicit and does not match what the cluster reports, the condition warns about it
+func (r *QueryConnectorReconciler) UpdateDistributionDetected(resource *CompoundQueryConnectorResource, resourceType string,
+	specType string, info *connector.Info) {
+
+	status := resourceStatus(resource, resourceType)
+	status.Distribution = info.Distribution
+	status.Version = info.Version
+
+	condition := globals.NewCondition(globals.ConditionTypeDistribution, metav1.ConditionTrue,
+		globals.ConditionReasonDistributionDetectedType,
+		fmt.Sprintf(controller.DistributionDetectedMessage, info.Distribution, info.Version))
+
+	if specType != "" && specType != connector.FlavorAuto && specType != info.Distribution {
+		condition = globals.NewCondition(globals.ConditionTypeDistribution, metav1.ConditionFalse,
+			globals.ConditionReasonDistributionMismatchType,
+			fmt.Sprintf(controller.DistributionMismatchMessage, specType, info.Distribution, info.Version))
+	}
+
+	globals.UpdateCondition(&status.Conditions, condition)
+}
+
+// UpdateConditionDistributionDetectionFailed updates the status of the resource when the root endpoint
+// can not be probed. The distribution detected on previous probes is kept
+func (r *QueryConnectorReconciler) UpdateConditionDistributionDetectionFailed(resource *CompoundQueryConnectorResource, resourceType string, message string) {
+
+	condition := globals.NewCondition(globals.ConditionTypeDistribution, metav1.ConditionFalse,
+		globals.ConditionReasonDistributionDetectionFailedType, message)
+
+	globals.UpdateCondition(&resourceStatus(resource, resourceType).Conditions, condition)
+}
+
+// UpdateConditionReachable records what the cluster reported on the last probe
+func (r *QueryConnectorReconciler) UpdateConditionReachable(resource *CompoundQueryConnectorResource, resourceType string,
+	health *connector.Health) {
+
+	status := resourceStatus(resource, resourceType)
+	status.ClusterName = health.ClusterName
+	status.Health = health.Status
+	status.LatencyMilliseconds = health.Latency.Milliseconds()
+
+	message := fmt.Sprintf(controller.ConnectorReachableMessage, health.Latency.Milliseconds())
+	if health.Status != "" {
+		message = fmt.Sprintf(controller.ConnectorHealthMessage, health.ClusterName, health.Status, health.Latency.Milliseconds())
+	}
+
+	condition := globals.NewCondition(globals.ConditionTypeReachable, metav1.ConditionTrue,
+		globals.ConditionReasonReachableType, message)
+
+	globals.UpdateCondition(&status.Conditions, condition)
+}
+
+// UpdateConditionUnreachable updates the status of the resource when the probe fails. The health and
+// latency of previous probes are cleared, as they do not describe the cluster anymore
+func (r *QueryConnectorReconciler) UpdateConditionUnreachable(resource *CompoundQueryConnectorResource, resourceType string,
+	unauthorized bool, message string) {
+
+	status := resourceStatus(resource, resourceType)
+	status.Health = ""
+	status.LatencyMilliseconds = 0
+
+	reason := globals.ConditionReasonUnreachableType
+	if unauthorized {
+		reason = globals.ConditionReasonUnauthorizedType
+	}
+	condition := globals.NewCondition(globals.ConditionTypeReachable, metav1.ConditionFalse, reason, message)
+
+	globals.UpdateCondition(&status.Conditions, condition)
+}
+
+// UpdateConditionThrottled tells whether the limits of the connector made queries wait or rejected them
+func (r *QueryConnectorReconciler) UpdateConditionThrottled(resource *CompoundQueryConnectorResource, resourceType string,
+	queued, rejected uint64) {
+
+	condition := globals.NewCondition(globals.ConditionTypeThrottled, metav1.ConditionFalse,
+		globals.ConditionReasonNotThrottledType, globals.ConditionReasonNotThrottledMessage)
+	if queued > 0 || rejected > 0 {
+		condition = globals.NewCondition(globals.ConditionTypeThrottled, metav1.ConditionTrue,
+			globals.ConditionReasonThrottledType, fmt.Sprintf(controller.ConnectorThrottledMessage, queued, rejected))
+	}
+
+	globals.UpdateCondition(&resourceStatus(resource, resourceType).Conditions, condition)
+}
+
+// RemoveConditionThrottled drops the Throttled condition of connectors without limits
+func (r *QueryConnectorReconciler) RemoveConditionThrottled(resource *CompoundQueryConnectorResource, resourceType string) {
+	globals.RemoveCondition(&resourceStatus(resource, resourceType).Conditions, globals.ConditionTypeThrottled)
+}
@@ -18,6 +18,7 @@ package queryconnector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 
@@ -25,24 +26,22 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	//
 	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/connector"
 	"freepik.com/searchruler/internal/controller"
 	"freepik.com/searchruler/internal/pools"
 )
 
-var (
-	resourceNamespace string
-	resourceName      string
-	resourceSpec      v1alpha1.QueryConnectorSpec
-)
-
 // Sync function is used to synchronize the QueryConnector resource with the credentials. Adds the credentials to the
 // credentials pool to be used in SearchRule resources. Just executed when the resource has a secretRef defined.
 func (r *QueryConnectorReconciler) Sync(ctx context.Context, eventType watch.EventType, resource *CompoundQueryConnectorResource, resourceType string) (err error) {
 
 	// Get the resource values depending on the resourceType
+	var resourceNamespace, resourceName string
+	var resourceSpec v1alpha1.QueryConnectorSpec
 	switch resourceType {
 	case controller.ClusterQueryConnectorResourceType:
 		resourceNamespace = ""
@@ -58,7 +57,12 @@ func (r *QueryConnectorReconciler) Sync(ctx context.Context, eventType watch.Eve
 	// In other cases get the credentials from the secret and add them to the pool
 	if eventType == watch.Deleted {
 		credentialsKey := fmt.Sprintf("%s_%s", resourceNamespace, resourceName)
+		if previous, exists := r.CredentialsPool.Get(credentialsKey); exists && previous.Spec != nil {
+			connector.ForgetHTTPClient(previous.Spec, previous)
+		}
 		r.CredentialsPool.Delete(credentialsKey)
+		r.ConnectorsPool.Delete(credentialsKey)
+		connector.DeleteLimiter(resourceNamespace, resourceName)
 		return nil
 	}
 
@@ -134,17 +138,218 @@ func (r *QueryConnectorReconciler) Sync(ctx context.Context, eventType watch.Eve
 		}
 	}
 
-	// Save credentials and certificates in the credentials pool
-	poolKey := fmt.Sprintf("%s_%s", resourceNamespace, resourceName)
-	r.CredentialsPool.Set(poolKey, &pools.Credentials{
+	// Credentials were the only way to authenticate before auth modes existed, and they are basic auth
+	creds := &pools.Credentials{
 		Username: username,
 		Password: password,
 		CA:       ca,
 		Cert:     cert,
 		Key:      key,
-	})
+		Spec:     resourceSpec.DeepCopy(),
+	}
+	if username != "" {
+		creds.AuthMode = connector.AuthModeBasic
+	}
+
+	// If an auth mode is defined, get its secrets
+	if resourceSpec.Auth != nil {
+		if username != "" {
+			r.UpdateConditionNoCredsFound(resource, resourceType)
+			return fmt.Errorf(controller.AuthDefinedTwiceErrorMessage)
+		}
+
+		err = r.resolveAuth(ctx, resourceSpec.Auth, resourceNamespace, creds)
+		if err != nil {
+			// Updates status to NoCredsFound
+			r.UpdateConditionNoCredsFound(resource, resourceType)
+			return err
+		}
+	}
+
+	// If a CA bundle is defined, get it from its Secret or ConfigMap
+	if resourceSpec.CABundle != nil {
+		creds.CABundle, err = controller.GetCABundle(ctx, r.Client, resourceSpec.CABundle, resourceNamespace)
+		if err == nil {
+			if _, err = connector.RootCAs(creds.CABundle); err != nil {
+				err = fmt.Errorf(controller.CABundleErrorMessage, err)
+			}
+		}
+		if err != nil {
+			// Updates status to NoCertsFound
+			r.UpdateConditionNoCertsFound(resource, resourceType)
+			return err
+		}
+	}
+
+	// Save credentials and certificates in the credentials pool. Requests read the credentials from
+	// the pool, but the certificates, the URL, the proxy and the TLS settings live in the cached
+	// HTTP client, so the one of the previous spec and credentials is dropped when they change
+	poolKey := fmt.Sprintf("%s_%s", resourceNamespace, resourceName)
+	previous, exists := r.CredentialsPool.Get(poolKey)
+	if exists && previous.Spec != nil && !connector.SameHTTPClient(previous.Spec, previous, creds.Spec, creds) {
+		connector.ForgetHTTPClient(previous.Spec, previous)
+	}
+	r.CredentialsPool.Set(poolKey, creds)
+
+	// Requests fall back to the default load balancing, batching and request policy when their
+	// settings are wrong, tell it here
+	_, err = connector.ParseLoadBalancing(&resourceSpec)
+	if err != nil {
+		return fmt.Errorf(controller.LoadBalancingParseErrorMessage, err)
+	}
+
+	_, _, err = connector.ParseBatching(&resourceSpec)
+	if err != nil {
+		return fmt.Errorf(controller.BatchingParseErrorMessage, err)
+	}
+
+	_, err = connector.ParseRequestPolicy(connector.DefaultRequestSettings(), resourceSpec.RequestPolicy)
+	if err != nil {
+		return fmt.Errorf(controller.RequestPolicyParseErrorMessage, err)
+	}
+
+	// Requests through a wrong proxy fail, tell why
+	_, err = connector.ProxyFunc(resourceSpec.ProxyURL, resourceSpec.NoProxy)
+	if err != nil {
+		return fmt.Errorf(controller.ProxyErrorMessage, err)
+	}
+
+	// Configure the limits shared by the SearchRules using the connector, and tell whether
+	// their queries had to wait or were rejected since the last sync
+	if resourceSpec.Limits == nil {
+		connector.DeleteLimiter(resourceNamespace, resourceName)
+		r.RemoveConditionThrottled(resource, resourceType)
+	} else {
+		limiter, err := connector.SetLimiter(resourceNamespace, resourceName, resourceSpec.Limits)
+		if err != nil {
+			return fmt.Errorf(controller.LimitsParseErrorMessage, err)
+		}
+		queued, rejected := limiter.Throttled()
+		r.UpdateConditionThrottled(resource, resourceType, queued, rejected)
+	}
+
+	// Only the leader probes the connector and reports it, the other replicas sharing the
+	// SearchRules only need the pools above
+	if !controller.IsLeader(r.elected) {
+		return nil
+	}
+
+	// Probe the connector, so a wrong URL or rejected credentials are reported once here instead of
+	// on every SearchRule using it. Elasticsearch compatible clusters also report their distribution
+	// and version, which SearchRules use to shape their requests. An unreachable cluster is not a sync
+	// failure: the last detected distribution is kept and the conditions tell what happened
+	connectorHealth := &pools.ConnectorHealth{
+		Namespace: resourceNamespace,
+		Name:      resourceName,
+	}
+	health, err := connector.CheckHealth(ctx, &resourceSpec, creds)
+	if err != nil {
+		message := fmt.Sprintf(controller.ConnectorProbeErrorMessage, resourceType, poolKey, err)
+		log.FromContext(ctx).Info(message)
+		r.UpdateConditionUnreachable(resource, resourceType, errors.Is(err, connector.ErrUnauthorized), message)
+		if connector.IsElasticsearchCompatible(resourceSpec.Type) {
+			r.UpdateConditionDistributionDetectionFailed(resource, resourceType, message)
+		}
+	} else {
+		r.UpdateConditionReachable(resource, resourceType, health)
+		if connector.IsElasticsearchCompatible(resourceSpec.Type) {
+			r.UpdateDistributionDetected(resource, resourceType, resourceSpec.Type, &health.Info)
+		}
+		connectorHealth.Reachable = true
+		connectorHealth.ClusterName = health.ClusterName
+		connectorHealth.Distribution = health.Distribution
+		connectorHealth.Version = health.Version
+		connectorHealth.Status = health.Status
+		connectorHealth.Latency = health.Latency
+	}
+	r.ConnectorsPool.Set(poolKey, connectorHealth)
 
 	// Updates status to Success
 	r.UpdateStateSuccess(resource, resourceType)
 	return nil
 }
+
+// getSecretData returns the data of the Secret. References without namespace point to the
+// namespace of the QueryConnector
+func (r *QueryConnectorReconciler) getSecretData(ctx context.Context, name, namespace, defaultNamespace string) (
+	map[string][]byte, types.NamespacedName, error) {
+
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	namespacedName := types.NamespacedName{
+		Namespace: namespace,
+		Name:      name,
+	}
+
+	secret := &v1.Secret{}
+	err := r.Get(ctx, namespacedName, secret)
+	if err != nil {
+		return nil, namespacedName, fmt.Errorf(controller.SecretNotFoundErrorMessage, namespacedName, err)
+	}
+	return secret.Data, namespacedName, nil
+}
+
+// resolveAuth reads the secrets of the auth mode and stores what is needed to authenticate the requests in creds
+func (r *QueryConnectorReconciler) resolveAuth(ctx context.Context, auth *v1alpha1.QueryConnectorAuth,
+	defaultNamespace string, creds *pools.Credentials) error {
+
+	switch {
+	case auth.Basic != nil:
+		data, namespacedName, err := r.getSecretData(ctx, auth.Basic.SecretRef.Name, auth.Basic.SecretRef.Namespace, defaultNamespace)
+		if err != nil {
+			return err
+		}
+		creds.AuthMode = connector.AuthModeBasic
+		creds.Username = string(data[auth.Basic.SecretRef.KeyUsername])
+		creds.Password = string(data[auth.Basic.SecretRef.KeyPassword])
+		if creds.Username == "" || creds.Password == "" {
+			return fmt.Errorf(controller.MissingCredentialsMessage, namespacedName)
+		}
+
+	case auth.APIKey != nil:
+		data, namespacedName, err := r.getSecretData(ctx, auth.APIKey.Name, auth.APIKey.Namespace, defaultNamespace)
+		if err != nil {
+			return err
+		}
+		creds.AuthMode = connector.AuthModeAPIKey
+		creds.APIKey = string(data[auth.APIKey.Key])
+		if creds.APIKey == "" {
+			return fmt.Errorf(controller.MissingCredentialsMessage, namespacedName)
+		}
+
+	case auth.Bearer != nil:
+		data, namespacedName, err := r.getSecretData(ctx, auth.Bearer.Name, auth.Bearer.Namespace, defaultNamespace)
+		if err != nil {
+			return err
+		}
+		creds.AuthMode = connector.AuthModeBearer
+		creds.BearerToken = string(data[auth.Bearer.Key])
+		if creds.BearerToken == "" {
+			return fmt.Errorf(controller.MissingCredentialsMessage, namespacedName)
+		}
+
+	case auth.SigV4 != nil:
+		secretRef := auth.SigV4.SecretRef
+		data, namespacedName, err := r.getSecretData(ctx, secretRef.Name, secretRef.Namespace, defaultNamespace)
+		if err != nil {
+			return err
+		}
+		creds.AuthMode = connector.AuthModeSigV4
+		creds.AccessKeyID = string(data[secretRef.KeyAccessKeyID])
+		creds.SecretAccessKey = string(data[secretRef.KeySecretAccessKey])
+		if secretRef.KeySessionToken != "" {
+			creds.SessionToken = string(data[secretRef.KeySessionToken])
+		}
+		creds.Region = auth.SigV4.Region
+		creds.Service = auth.SigV4.Service
+		if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+			return fmt.Errorf(controller.MissingCredentialsMessage, namespacedName)
+		}
+
+	default:
+		return fmt.Errorf(controller.AuthModeNotDefinedErrorMessage)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ReferencesField is the field index of the resources by the Secrets and ConfigMaps they read,
+// so the ones reading an object are found without listing them all
+const ReferencesField = "searchruler.freepik.com/references"
+
+// Reference is a Secret or ConfigMap read by a resource
+type Reference struct {
+	Kind string
+	types.NamespacedName
+}
+
+// NewReference returns the reference to the object of the kind. References without namespace
+// point to the namespace of the resource holding them
+func NewReference(kind, name, namespace, defaultNamespace string) Reference {
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	return Reference{Kind: kind, NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}}
+}
+
+// indexKey is the value of the reference in the ReferencesField index
+func (r Reference) indexKey() string {
+	return fmt.Sprintf("%s/%s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+// ReferencesIndexer indexes the resources by the objects they read, as returned by references
+func ReferencesIndexer(references func(client.Object) []Reference) client.IndexerFunc {
+	return func(object client.Object) []string {
+		keys := []string{}
+		for _, reference := range references(object) {
+			keys = append(keys, reference.indexKey())
+		}
+		return keys
+	}
+}
+
+// IndexReferences adds the ReferencesField index of the resources of the object's type
+func IndexReferences(ctx context.Context, indexer client.FieldIndexer, object client.Object,
+	references func(client.Object) []Reference) error {
+	return indexer.IndexField(ctx, object, ReferencesField, ReferencesIndexer(references))
+}
+
+// RequestsReferencing returns the requests of the resources of the list reading the object of
+// the kind, from the ReferencesField index
+func RequestsReferencing(ctx context.Context, c client.Reader, resourceType string, list client.ObjectList,
+	kind string, object client.Object) []reconcile.Request {
+
+	reference := Reference{Kind: kind, NamespacedName: client.ObjectKeyFromObject(object)}
+	err := c.List(ctx, list, client.MatchingFields{ReferencesField: reference.indexKey()})
+	if err != nil {
+		log.FromContext(ctx).Info(fmt.Sprintf(ReferencesListErrorMessage, resourceType, kind, reference.NamespacedName, err))
+		return nil
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		log.FromContext(ctx).Info(fmt.Sprintf(ReferencesListErrorMessage, resourceType, kind, reference.NamespacedName, err))
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(items))
+	for _, item := range items {
+		if resource, ok := item.(client.Object); ok {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(resource)})
+		}
+	}
+	return requests
+}
@@ -22,10 +22,13 @@ import (
 	"reflect"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	runtimecontroller "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -42,6 +45,17 @@ type RulerActionReconciler struct {
 	client.Client
 	Scheme     *runtime.Scheme
 	AlertsPool *pools.AlertsStore
+
+	// Sharded runs the controller on every replica instead of only on the leader, as every
+	// replica sends the alerts of the SearchRules it evaluates when they are sharded. Only the
+	// leader writes the finalizers and status of the RulerActions then
+	Sharded bool
+
+	// MaxConcurrentReconciles is how many RulerActions and ClusterRulerActions are reconciled at the same time
+	MaxConcurrentReconciles int
+
+	// elected is closed once the replica is the leader, nil when the controller only runs on it
+	elected <-chan struct{}
 }
 
 type CompoundRulerActionResource struct {
@@ -49,17 +63,12 @@ type CompoundRulerActionResource struct {
 	ClusterRulerActionResource *searchrulerv1alpha1.ClusterRulerAction
 }
 
-var (
-	resourceType      string
-	containsFinalizer bool
-	deletionTimestamp *v1.Time
-)
-
 // +kubebuilder:rbac:groups=searchruler.freepik.com,resources=ruleractions,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=searchruler.freepik.com,resources=ruleractions/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=searchruler.freepik.com,resources=ruleractions/finalizers,verbs=update
 
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -78,6 +87,7 @@ func (r *RulerActionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 
 	// 1 Get the RulerAction or ClusterRulerAction resource
+	var resourceType string
 	switch req.Namespace {
 	case "":
 		resourceType = controller.ClusterRulerActionResourceType
@@ -102,6 +112,8 @@ func (r *RulerActionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 
 	// 3. Check if the RulerAction instance is marked to be deleted: indicated by the deletion timestamp being set
+	var deletionTimestamp *v1.Time
+	var containsFinalizer bool
 	switch resourceType {
 	case controller.ClusterRulerActionResourceType:
 		deletionTimestamp = CompoundRulerActionResource.ClusterRulerActionResource.DeletionTimestamp
@@ -110,8 +122,9 @@ func (r *RulerActionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		deletionTimestamp = CompoundRulerActionResource.RulerActionResource.DeletionTimestamp
 		containsFinalizer = controllerutil.ContainsFinalizer(CompoundRulerActionResource.RulerActionResource, controller.ResourceFinalizer)
 	}
+	leader := controller.IsLeader(r.elected)
 	if !deletionTimestamp.IsZero() {
-		if containsFinalizer {
+		if containsFinalizer && leader {
 
 			// Remove the finalizers on Patch CR
 			switch resourceType {
@@ -133,7 +146,7 @@ func (r *RulerActionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 
 	// 4. Add finalizer to the RulerAction CR
-	if !containsFinalizer {
+	if !containsFinalizer && leader {
 		switch resourceType {
 		case controller.ClusterRulerActionResourceType:
 			controllerutil.AddFinalizer(CompoundRulerActionResource.ClusterRulerActionResource, controller.ResourceFinalizer)
@@ -149,6 +162,9 @@ func (r *RulerActionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	// 5. Update the status before the requeue
 	defer func() {
+		if !leader {
+			return
+		}
 		switch resourceType {
 		case controller.ClusterRulerActionResourceType:
 			err = r.Status().Update(ctx, CompoundRulerActionResource.ClusterRulerActionResource)
@@ -198,10 +214,35 @@ func (r *RulerActionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *RulerActionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	needLeaderElection := !r.Sharded
+	if r.Sharded {
+		r.elected = mgr.Elected()
+	}
+
+	// Index the RulerActions by the Secrets and ConfigMaps they read, to find the ones to enqueue
+	// when one of them changes
+	ctx := context.Background()
+	if err := controller.IndexReferences(ctx, mgr.GetFieldIndexer(), &searchrulerv1alpha1.RulerAction{}, rulerActionReferences); err != nil {
+		return err
+	}
+	if err := controller.IndexReferences(ctx, mgr.GetFieldIndexer(), &searchrulerv1alpha1.ClusterRulerAction{}, clusterRulerActionReferences); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&searchrulerv1alpha1.RulerAction{}).
+		WithOptions(runtimecontroller.Options{
+			NeedLeaderElection:      &needLeaderElection,
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+		}).
+		For(&searchrulerv1alpha1.RulerAction{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Named("RulerAction").
-		WithEventFilter(predicate.GenerationChangedPredicate{}).
-		Watches(&searchrulerv1alpha1.ClusterRulerAction{}, &handler.EnqueueRequestForObject{}).
+		Watches(&searchrulerv1alpha1.ClusterRulerAction{}, &handler.EnqueueRequestForObject{},
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		// Secrets and ConfigMaps have no generation, every change of their data must be seen. Only
+		// their metadata is cached, as they are read from the API server when synced
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.requestsForSecret),
+			builder.OnlyMetadata, builder.WithPredicates(predicate.ResourceVersionChangedPredicate{})).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.requestsForConfigMap),
+			builder.OnlyMetadata, builder.WithPredicates(predicate.ResourceVersionChangedPredicate{})).
 		Complete(r)
 }
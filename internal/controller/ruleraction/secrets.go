@@ -0,0 +1,77 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ruleraction
+
+import (
+	"context"
+
+	//
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/controller"
+)
+
+// referencedObjects returns the Secrets and ConfigMaps the webhook reads its credentials and CA
+// bundle from. References without namespace point to the namespace of the action
+func referencedObjects(spec *v1alpha1.RulerActionSpec, defaultNamespace string) []controller.Reference {
+
+	references := []controller.Reference{}
+	if secretRef := spec.Webhook.Credentials.SecretRef; secretRef.Name != "" {
+		references = append(references, controller.NewReference(controller.CABundleKindSecret,
+			secretRef.Name, secretRef.Namespace, defaultNamespace))
+	}
+	if spec.Webhook.CABundle != nil {
+		kind, namespacedName := controller.CABundleObject(spec.Webhook.CABundle, defaultNamespace)
+		references = append(references, controller.Reference{Kind: kind, NamespacedName: namespacedName})
+	}
+	return references
+}
+
+// rulerActionReferences returns the objects read by a RulerAction, for the references index
+func rulerActionReferences(object client.Object) []controller.Reference {
+	rulerAction := object.(*v1alpha1.RulerAction)
+	return referencedObjects(&rulerAction.Spec, rulerAction.Namespace)
+}
+
+// clusterRulerActionReferences returns the objects read by a ClusterRulerAction, for the
+// references index
+func clusterRulerActionReferences(object client.Object) []controller.Reference {
+	return referencedObjects(&object.(*v1alpha1.ClusterRulerAction).Spec, "")
+}
+
+// requestsForSecret enqueues the actions referencing the Secret, so the webhooks are called
+// with rotated credentials right away
+func (r *RulerActionReconciler) requestsForSecret(ctx context.Context, secret client.Object) []reconcile.Request {
+	return r.requestsReferencing(ctx, controller.CABundleKindSecret, secret)
+}
+
+// requestsForConfigMap enqueues the actions reading their CA bundle from the ConfigMap
+func (r *RulerActionReconciler) requestsForConfigMap(ctx context.Context, configMap client.Object) []reconcile.Request {
+	return r.requestsReferencing(ctx, controller.CABundleKindConfigMap, configMap)
+}
+
+// requestsReferencing enqueues the RulerActions and ClusterRulerActions referencing the object
+func (r *RulerActionReconciler) requestsReferencing(ctx context.Context, kind string, object client.Object) []reconcile.Request {
+	return append(
+		controller.RequestsReferencing(ctx, r.Client, controller.RulerActionResourceType,
+			&v1alpha1.RulerActionList{}, kind, object),
+		controller.RequestsReferencing(ctx, r.Client, controller.ClusterRulerActionResourceType,
+			&v1alpha1.ClusterRulerActionList{}, kind, object)...)
+}
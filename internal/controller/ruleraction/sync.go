@@ -33,6 +33,7 @@ import (
 
 	//
 	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/connector"
 	"freepik.com/searchruler/internal/controller"
 	"freepik.com/searchruler/internal/pools"
 	"freepik.com/searchruler/internal/template"
@@ -44,9 +45,6 @@ var (
 	validatorsMap = map[string]func(data string) (result bool, hint string, err error){
 		"alertmanager": validators.ValidateAlertmanager,
 	}
-	resourceNamespace string
-	resourceName      string
-	resourceSpec      v1alpha1.RulerActionSpec
 )
 
 // Sync function is used to synchronize the RulerAction resource with the alerts. Executes the webhook defined in the
@@ -55,6 +53,8 @@ func (r *RulerActionReconciler) Sync(ctx context.Context, resource *CompoundRule
 
 	logger := log.FromContext(ctx)
 	// Get the resource values depending on the resourceType
+	var resourceNamespace, resourceName string
+	var resourceSpec v1alpha1.RulerActionSpec
 	switch resourceType {
 	case controller.ClusterRulerActionResourceType:
 		resourceNamespace = ""
@@ -95,6 +95,30 @@ func (r *RulerActionReconciler) Sync(ctx context.Context, resource *CompoundRule
 		}
 	}
 
+	// Get the CA bundle the webhook certificate is signed by, if defined
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: resourceSpec.Webhook.TlsSkipVerify,
+	}
+	if resourceSpec.Webhook.CABundle != nil {
+		bundle, err := controller.GetCABundle(ctx, r.Client, resourceSpec.Webhook.CABundle, resourceNamespace)
+		if err != nil {
+			r.UpdateConditionNoCredsFound(resource, resourceType)
+			return err
+		}
+		tlsConfig.RootCAs, err = connector.RootCAs(bundle)
+		if err != nil {
+			r.UpdateConditionNoCredsFound(resource, resourceType)
+			return fmt.Errorf(controller.CABundleErrorMessage, err)
+		}
+	}
+
+	// Route the webhook calls through the proxy, if defined
+	proxy, err := connector.ProxyFunc(resourceSpec.Webhook.ProxyURL, resourceSpec.Webhook.NoProxy)
+	if err != nil {
+		r.UpdateConditionConnectionError(resource, resourceType)
+		return fmt.Errorf(controller.ProxyErrorMessage, err)
+	}
+
 	// Check alert pool for alerts related to this rulerAction
 	// Alerts key pattern: namespace/rulerActionName/searchRuleName
 	alerts, err := r.getRulerActionAssociatedAlerts(resourceName)
@@ -107,9 +131,8 @@ func (r *RulerActionReconciler) Sync(ctx context.Context, resource *CompoundRule
 		// Create the HTTP client
 		httpClient := &http.Client{
 			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: resourceSpec.Webhook.TlsSkipVerify,
-				},
+				Proxy:           proxy,
+				TLSClientConfig: tlsConfig,
 			},
 		}
 
@@ -126,7 +149,7 @@ func (r *RulerActionReconciler) Sync(ctx context.Context, resource *CompoundRule
 		}
 
 		// Add authentication if set for the webhook
-		if username == "" || password == "" {
+		if username != "" && password != "" {
 			httpRequest.SetBasicAuth(username, password)
 		}
 
@@ -149,6 +172,15 @@ func (r *RulerActionReconciler) Sync(ctx context.Context, resource *CompoundRule
 			templateInjectedObject["value"] = alert.Value
 			templateInjectedObject["object"] = alert.SearchRule
 			templateInjectedObject["aggregations"] = alert.Aggregations
+			templateInjectedObject["conditions"] = conditionsTemplateData(alert.Conditions)
+			templateInjectedObject["severity"] = alert.Severity
+			templateInjectedObject["previousSeverity"] = alert.PreviousSeverity
+			templateInjectedObject["labels"] = alert.Labels
+			templateInjectedObject["error"] = alert.Error
+			if alert.Comparison != nil {
+				templateInjectedObject["baseline"] = alert.Comparison.Baseline
+				templateInjectedObject["change"] = alert.Comparison.Change
+			}
 
 			var parsedMessage string
 			var err error
@@ -217,11 +249,10 @@ func (r *RulerActionReconciler) Sync(ctx context.Context, resource *CompoundRule
 // generateAlertmanagerPayload generates a payload for Alertmanager with templated labels and annotations
 func (r *RulerActionReconciler) generateAlertmanagerPayload(alert *pools.Alert, templateInjectedObject map[string]interface{}) (string, error) {
 
-	// Get the checkInterval from the SearchRule to set the endsAt time to the double of the checkInterval
-	checkInterval := alert.SearchRule.Spec.CheckInterval
-	duration, err := time.ParseDuration(checkInterval)
+	// Set the endsAt time to the double of the time between two evaluations of the SearchRule
+	duration, err := controller.EvaluationInterval(&alert.SearchRule, time.Now())
 	if err != nil {
-		return "", fmt.Errorf("error parsing checkInterval: %v", err)
+		return "", fmt.Errorf("error getting the evaluation interval: %v", err)
 	}
 	endsAt := time.Now().UTC().Add(duration * 2)
 
@@ -253,6 +284,18 @@ func (r *RulerActionReconciler) generateAlertmanagerPayload(alert *pools.Alert,
 		amAlert.Annotations[key] = parsedValue
 	}
 
+	// The labels of the bucket firing the alert tell apart the alerts of rules evaluated
+	// per bucket, so every bucket is an alert of its own for Alertmanager
+	for key, value := range alert.Labels {
+		amAlert.Labels[key] = value
+	}
+
+	// The level of a rule with severities replaces the severity label, so each level is a
+	// different alert for Alertmanager
+	if alert.Severity != "" {
+		amAlert.Labels["severity"] = alert.Severity
+	}
+
 	// Ensure required alertname label exists
 	if _, exists := amAlert.Labels["alertname"]; !exists {
 		amAlert.Labels["alertname"] = alert.SearchRule.Name
@@ -268,6 +311,26 @@ func (r *RulerActionReconciler) generateAlertmanagerPayload(alert *pools.Alert,
 	return string(payload), nil
 }
 
+// conditionsTemplateData returns the matched leaves of the condition keyed like the rest of
+// the template data, e.g. `{{ range .conditions }}{{ .name }} is {{ .value }}{{ end }}`
+func conditionsTemplateData(matches []pools.ConditionMatch) []map[string]interface{} {
+
+	conditions := make([]map[string]interface{}, 0, len(matches))
+	for _, match := range matches {
+		conditions = append(conditions, map[string]interface{}{
+			"name":           match.Name,
+			"field":          match.Field,
+			"operator":       match.Operator,
+			"threshold":      match.Threshold,
+			"lowerThreshold": match.LowerThreshold,
+			"upperThreshold": match.UpperThreshold,
+			"expression":     match.Expression,
+			"value":          match.Value,
+		})
+	}
+	return conditions
+}
+
 // getRulerActionAssociatedAlerts returns all alerts associated with the RulerAction
 func (r *RulerActionReconciler) getRulerActionAssociatedAlerts(resourceName string) (alerts []*pools.Alert, err error) {
 
@@ -0,0 +1,128 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ruleraction
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/controller"
+	"freepik.com/searchruler/internal/pools"
+)
+
+func TestSyncSetsWebhookBasicAuth(t *testing.T) {
+	t.Parallel()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("clientgoscheme: %v", err)
+	}
+	if err := searchrulerv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("searchrulerv1alpha1: %v", err)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "webhook-credentials", Namespace: "observability"},
+		Data:       map[string][]byte{"username": []byte("alerts"), "password": []byte("changeme")},
+	}
+
+	cases := []struct {
+		name         string
+		credentials  searchrulerv1alpha1.RulerActionCredentials
+		wantAuth     bool
+		wantUsername string
+		wantPassword string
+	}{
+		{
+			name: "credentials",
+			credentials: searchrulerv1alpha1.RulerActionCredentials{SecretRef: searchrulerv1alpha1.SecretRef{
+				Name: "webhook-credentials", KeyUsername: "username", KeyPassword: "password",
+			}},
+			wantAuth:     true,
+			wantUsername: "alerts",
+			wantPassword: "changeme",
+		},
+		{
+			name:     "no credentials",
+			wantAuth: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var mu sync.Mutex
+			var gotAuth bool
+			var gotUsername, gotPassword string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				gotUsername, gotPassword, gotAuth = req.BasicAuth()
+			}))
+			defer server.Close()
+
+			resource := &searchrulerv1alpha1.RulerAction{
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook", Namespace: "observability"},
+				Spec: searchrulerv1alpha1.RulerActionSpec{Webhook: searchrulerv1alpha1.Webhook{
+					Url:         server.URL,
+					Verb:        http.MethodPost,
+					Credentials: tc.credentials,
+				}},
+			}
+			alerts := &pools.AlertsStore{Store: map[string]*pools.Alert{}}
+			alerts.Set("observability/webhook/errors", &pools.Alert{
+				RulerActionName: "webhook",
+				SearchRule: searchrulerv1alpha1.SearchRule{
+					ObjectMeta: metav1.ObjectMeta{Name: "errors", Namespace: "observability"},
+					Spec: searchrulerv1alpha1.SearchRuleSpec{
+						ActionRef: &searchrulerv1alpha1.ActionRef{Data: `{"value": {{ .value }}}`},
+					},
+				},
+				Value: 12,
+			})
+			r := &RulerActionReconciler{
+				Client:     fake.NewClientBuilder().WithScheme(scheme).WithObjects(secret).Build(),
+				Scheme:     scheme,
+				AlertsPool: alerts,
+			}
+
+			err := r.Sync(context.Background(), &CompoundRulerActionResource{RulerActionResource: resource},
+				controller.RulerActionResourceType)
+			if err != nil {
+				t.Fatalf("Sync: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if gotAuth != tc.wantAuth {
+				t.Fatalf("basic auth sent = %v, want %v", gotAuth, tc.wantAuth)
+			}
+			if gotUsername != tc.wantUsername || gotPassword != tc.wantPassword {
+				t.Errorf("basic auth = %q:%q, want %q:%q", gotUsername, gotPassword, tc.wantUsername, tc.wantPassword)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/cron"
+)
+
+// EvaluationSchedule returns the cron schedule of the SearchRule, or nil when it is evaluated
+// every checkInterval
+func EvaluationSchedule(resource *v1alpha1.SearchRule) (*cron.Schedule, error) {
+
+	if resource.Spec.Schedule == nil {
+		return nil, nil
+	}
+	location, err := time.LoadLocation(resource.Spec.Schedule.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("schedule.timezone %q: %v", resource.Spec.Schedule.Timezone, err)
+	}
+	return cron.Parse(resource.Spec.Schedule.Cron, location)
+}
+
+// EvaluationInterval returns the time between two evaluations of the SearchRule: its
+// checkInterval, or the time between the next two times of its schedule
+func EvaluationInterval(resource *v1alpha1.SearchRule, now time.Time) (time.Duration, error) {
+
+	schedule, err := EvaluationSchedule(resource)
+	if err != nil {
+		return 0, err
+	}
+	if schedule == nil {
+		return checkInterval(resource)
+	}
+
+	first := schedule.Next(now)
+	if first.IsZero() {
+		return 0, fmt.Errorf("schedule %q has no time left", resource.Spec.Schedule.Cron)
+	}
+	if second := schedule.Next(first); !second.IsZero() {
+		return second.Sub(first), nil
+	}
+	return first.Sub(now), nil
+}
+
+// EvaluationWindow returns how far back the query of the SearchRule looks: its checkInterval,
+// which defaults to the time between two evaluations for rules with a schedule
+func EvaluationWindow(resource *v1alpha1.SearchRule, now time.Time) (time.Duration, error) {
+	if resource.Spec.CheckInterval == "" && resource.Spec.Schedule != nil {
+		return EvaluationInterval(resource, now)
+	}
+	return checkInterval(resource)
+}
+
+// NextEvaluation returns when the SearchRule evaluated last at the time is due again
+func NextEvaluation(resource *v1alpha1.SearchRule, last time.Time) (time.Time, error) {
+
+	schedule, err := EvaluationSchedule(resource)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if schedule != nil {
+		return schedule.Next(last), nil
+	}
+	interval, err := checkInterval(resource)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return last.Add(interval), nil
+}
+
+// checkInterval returns the checkInterval of the SearchRule, which must be positive
+func checkInterval(resource *v1alpha1.SearchRule) (time.Duration, error) {
+	interval, err := time.ParseDuration(resource.Spec.CheckInterval)
+	if err != nil {
+		return 0, fmt.Errorf("checkInterval %q: %v", resource.Spec.CheckInterval, err)
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("checkInterval must be positive, got %s", resource.Spec.CheckInterval)
+	}
+	return interval, nil
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/pools"
+)
+
+const (
+
+	// Methods computing the mean and the standard deviation of the history of a rule
+	anomalyMethodZScore = "zscore"
+	anomalyMethodEWMA   = "ewma"
+
+	// Directions of the deviations firing an anomaly condition
+	anomalyDirectionBoth  = "both"
+	anomalyDirectionAbove = "above"
+	anomalyDirectionBelow = "below"
+
+	// Defaults of the anomaly conditions, matching the CRD
+	anomalyDefaultSigmas  = 3
+	anomalyDefaultSamples = 60
+	anomalyDefaultAlpha   = 0.1
+
+	// Name of the matched leaf of an anomaly condition
+	conditionAnomalyName = "anomaly"
+)
+
+// anomalyDetector is the anomaly condition of a rule, ready to be evaluated
+type anomalyDetector struct {
+	method    string
+	direction string
+	sigmas    float64
+	alpha     float64
+	samples   int
+	warmUp    int
+}
+
+// compileAnomaly checks the anomaly condition of the rule and fills its defaults. It replaces
+// what the condition compares, so it can not be combined with any other way of comparing
+func compileAnomaly(condition *v1alpha1.Condition) (*anomalyDetector, error) {
+
+	spec := condition.Anomaly
+	switch {
+	case condition.Operator != "" || condition.Threshold != "" || condition.ResolveThreshold != "" ||
+		condition.LowerThreshold != "" || condition.UpperThreshold != "":
+		return nil, fmt.Errorf("condition.anomaly replaces operator and thresholds")
+	case isCompoundCondition(condition), condition.Expression != "", len(condition.Severities) > 0:
+		return nil, fmt.Errorf("condition.anomaly can not be combined with all, any, not, expression or severities")
+	case condition.Buckets != nil, condition.Comparison != nil:
+		return nil, fmt.Errorf("condition.anomaly is not supported with buckets or comparison")
+	}
+
+	detector := &anomalyDetector{
+		method:    spec.Method,
+		direction: spec.Direction,
+		sigmas:    anomalyDefaultSigmas,
+		alpha:     anomalyDefaultAlpha,
+		samples:   int(spec.Samples),
+		warmUp:    int(spec.WarmUp),
+	}
+	if detector.method == "" {
+		detector.method = anomalyMethodZScore
+	}
+	if detector.method != anomalyMethodZScore && detector.method != anomalyMethodEWMA {
+		return nil, fmt.Errorf("unknown condition.anomaly.method %q", spec.Method)
+	}
+	if detector.direction == "" {
+		detector.direction = anomalyDirectionBoth
+	}
+	switch detector.direction {
+	case anomalyDirectionBoth, anomalyDirectionAbove, anomalyDirectionBelow:
+	default:
+		return nil, fmt.Errorf("unknown condition.anomaly.direction %q", spec.Direction)
+	}
+
+	var err error
+	if spec.Sigmas != "" {
+		detector.sigmas, err = strconv.ParseFloat(spec.Sigmas, 64)
+		if err != nil || detector.sigmas <= 0 {
+			return nil, fmt.Errorf("condition.anomaly.sigmas %q must be a positive float", spec.Sigmas)
+		}
+	}
+	if spec.Alpha != "" {
+		detector.alpha, err = strconv.ParseFloat(spec.Alpha, 64)
+		if err != nil || detector.alpha <= 0 || detector.alpha > 1 {
+			return nil, fmt.Errorf("condition.anomaly.alpha %q must be a float between 0 and 1", spec.Alpha)
+		}
+	}
+	if detector.samples == 0 {
+		detector.samples = anomalyDefaultSamples
+	}
+	if detector.samples < 2 {
+		return nil, fmt.Errorf("condition.anomaly.samples must be at least 2")
+	}
+	if detector.warmUp == 0 {
+		detector.warmUp = detector.samples
+	}
+	if detector.warmUp < 2 {
+		return nil, fmt.Errorf("condition.anomaly.warmUp must be at least 2")
+	}
+	return detector, nil
+}
+
+// bounds returns the values the detector expects from the history, or nil during the warm-up
+func (d *anomalyDetector) bounds(state *pools.AnomalyState) *pools.AnomalyBounds {
+
+	if state == nil || state.Method != d.method || state.Count < d.warmUp {
+		return nil
+	}
+
+	mean, variance := state.Mean, state.Variance
+	if d.method == anomalyMethodZScore {
+		mean, variance = 0, 0
+		for _, sample := range state.Samples {
+			mean += sample
+		}
+		mean /= float64(len(state.Samples))
+		for _, sample := range state.Samples {
+			variance += (sample - mean) * (sample - mean)
+		}
+		variance /= float64(len(state.Samples))
+	}
+
+	deviation := d.sigmas * math.Sqrt(variance)
+	return &pools.AnomalyBounds{Mean: mean, Lower: mean - deviation, Upper: mean + deviation}
+}
+
+// learn returns a new history with the value added to the one of the rule. A history learned
+// with another method starts over, and values that are not finite are not learned
+func (d *anomalyDetector) learn(state *pools.AnomalyState, value float64) *pools.AnomalyState {
+
+	learned := &pools.AnomalyState{Method: d.method}
+	var samples []float64
+	if state != nil && state.Method == d.method {
+		learned.Count = state.Count
+		learned.Mean = state.Mean
+		learned.Variance = state.Variance
+		samples = state.Samples
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		learned.Samples = samples
+		return learned
+	}
+	learned.Count++
+
+	if d.method == anomalyMethodZScore {
+		if len(samples) >= d.samples {
+			samples = samples[len(samples)-d.samples+1:]
+		}
+		learned.Samples = append(append(make([]float64, 0, len(samples)+1), samples...), value)
+		return learned
+	}
+
+	// Exponentially weighted moving average and variance, seeded with the first value
+	if learned.Count == 1 {
+		learned.Mean = value
+		return learned
+	}
+	diff := value - learned.Mean
+	increment := d.alpha * diff
+	learned.Mean += increment
+	learned.Variance = (1 - d.alpha) * (learned.Variance + diff*increment)
+	return learned
+}
+
+// check tells whether the value deviates from the bounds in the direction of the detector. It
+// is exposed as a leaf comparing the value with the bounds
+func (d *anomalyDetector) check(value float64, bounds *pools.AnomalyBounds) (bool, []pools.ConditionMatch) {
+
+	if bounds == nil {
+		return false, nil
+	}
+
+	match := pools.ConditionMatch{Name: conditionAnomalyName, Value: value}
+	lower := strconv.FormatFloat(bounds.Lower, 'f', -1, 64)
+	upper := strconv.FormatFloat(bounds.Upper, 'f', -1, 64)
+	var firing bool
+	switch d.direction {
+	case anomalyDirectionAbove:
+		firing = value > bounds.Upper
+		match.Operator, match.Threshold = conditionGreaterThan, upper
+	case anomalyDirectionBelow:
+		firing = value < bounds.Lower
+		match.Operator, match.Threshold = conditionLessThan, lower
+	default:
+		firing = value > bounds.Upper || value < bounds.Lower
+		match.Operator, match.LowerThreshold, match.UpperThreshold = conditionOutside, lower, upper
+	}
+	if !firing {
+		return false, nil
+	}
+	return true, []pools.ConditionMatch{match}
+}
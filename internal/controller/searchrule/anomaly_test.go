@@ -0,0 +1,154 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/pools"
+)
+
+func TestCompileAnomaly(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name      string
+		condition searchrulerv1alpha1.Condition
+		want      anomalyDetector
+		wantErr   string
+	}{
+		{
+			name:      "defaults",
+			condition: searchrulerv1alpha1.Condition{Anomaly: &searchrulerv1alpha1.AnomalyDetection{}},
+			want: anomalyDetector{method: anomalyMethodZScore, direction: anomalyDirectionBoth,
+				sigmas: 3, alpha: 0.1, samples: 60, warmUp: 60},
+		},
+		{
+			name: "ewma",
+			condition: searchrulerv1alpha1.Condition{Anomaly: &searchrulerv1alpha1.AnomalyDetection{
+				Method: "ewma", Direction: "above", Sigmas: "2.5", Alpha: "0.3", WarmUp: 20,
+			}},
+			want: anomalyDetector{method: anomalyMethodEWMA, direction: anomalyDirectionAbove,
+				sigmas: 2.5, alpha: 0.3, samples: 60, warmUp: 20},
+		},
+		{
+			name: "with a threshold",
+			condition: searchrulerv1alpha1.Condition{Operator: conditionGreaterThan, Threshold: "10",
+				Anomaly: &searchrulerv1alpha1.AnomalyDetection{}},
+			wantErr: "replaces operator and thresholds",
+		},
+		{
+			name: "with buckets",
+			condition: searchrulerv1alpha1.Condition{Anomaly: &searchrulerv1alpha1.AnomalyDetection{},
+				Buckets: &searchrulerv1alpha1.ConditionBuckets{AggregationMap: "by_service.buckets"}},
+			wantErr: "not supported with buckets",
+		},
+		{
+			name:      "invalid alpha",
+			condition: searchrulerv1alpha1.Condition{Anomaly: &searchrulerv1alpha1.AnomalyDetection{Alpha: "1.5"}},
+			wantErr:   "alpha",
+		},
+		{
+			name:      "invalid sigmas",
+			condition: searchrulerv1alpha1.Condition{Anomaly: &searchrulerv1alpha1.AnomalyDetection{Sigmas: "-1"}},
+			wantErr:   "sigmas",
+		},
+	}
+	for _, tc := range cases {
+		compiled, err := compileCondition(&tc.condition)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s: error = %v, want it to contain %q", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		if *compiled.anomaly != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, *compiled.anomaly, tc.want)
+		}
+	}
+}
+
+func TestAnomalyZScore(t *testing.T) {
+	t.Parallel()
+	detector := &anomalyDetector{method: anomalyMethodZScore, direction: anomalyDirectionBoth, sigmas: 2, samples: 4, warmUp: 3}
+
+	var state *pools.AnomalyState
+	for _, value := range []float64{10, 12} {
+		if detector.bounds(state) != nil {
+			t.Fatalf("bounds during the warm-up")
+		}
+		state = detector.learn(state, value)
+	}
+	for _, value := range []float64{10, 12, 10, 12} {
+		state = detector.learn(state, value)
+	}
+	if len(state.Samples) != 4 || state.Count != 6 {
+		t.Fatalf("samples = %v, count = %d, want the last 4 of 6", state.Samples, state.Count)
+	}
+
+	// The mean of 10, 12, 10 and 12 is 11 with a standard deviation of 1
+	bounds := detector.bounds(state)
+	if bounds == nil || bounds.Mean != 11 || bounds.Lower != 9 || bounds.Upper != 13 {
+		t.Fatalf("bounds = %+v, want 9 to 13 around 11", bounds)
+	}
+	if firing, _ := detector.check(12.5, bounds); firing {
+		t.Errorf("12.5 is within the bounds")
+	}
+	firing, matches := detector.check(8, bounds)
+	if !firing || len(matches) != 1 || matches[0].Operator != conditionOutside || matches[0].LowerThreshold != "9" {
+		t.Errorf("8 should fire below the bounds, got %v %+v", firing, matches)
+	}
+
+	detector.direction = anomalyDirectionAbove
+	if firing, _ := detector.check(8, bounds); firing {
+		t.Errorf("8 should not fire when only deviations above fire")
+	}
+
+	// Values that are not finite are not learned
+	if learned := detector.learn(state, math.NaN()); learned.Count != state.Count {
+		t.Errorf("NaN was learned")
+	}
+}
+
+func TestAnomalyEWMA(t *testing.T) {
+	t.Parallel()
+	detector := &anomalyDetector{method: anomalyMethodEWMA, direction: anomalyDirectionBoth, sigmas: 3, alpha: 0.5, warmUp: 2}
+
+	state := detector.learn(nil, 10)
+	if state.Mean != 10 || state.Variance != 0 {
+		t.Fatalf("state = %+v, want seeded with the first value", state)
+	}
+	state = detector.learn(state, 20)
+	if state.Mean != 15 || state.Variance != 25 {
+		t.Fatalf("state = %+v, want mean 15 and variance 25", state)
+	}
+	bounds := detector.bounds(state)
+	if bounds == nil || bounds.Lower != 0 || bounds.Upper != 30 {
+		t.Fatalf("bounds = %+v, want 0 to 30", bounds)
+	}
+
+	// A history learned with another method starts over
+	detector.method, detector.samples = anomalyMethodZScore, 60
+	if detector.bounds(state) != nil || detector.learn(state, 1).Count != 1 {
+		t.Errorf("the history of the ewma method was kept for zscore")
+	}
+}
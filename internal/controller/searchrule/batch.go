@@ -0,0 +1,170 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/backend"
+	"freepik.com/searchruler/internal/connector"
+	"freepik.com/searchruler/internal/controller"
+	"freepik.com/searchruler/internal/pools"
+)
+
+// executeQuery returns the response to the query of the rule. When the QueryConnector batches
+// queries, the rule takes the response obtained in the batch of another rule if there is one.
+// Otherwise its query is sent in a `_msearch` with the queries of the rules on the same
+// connector that are due within the batching window, and their responses are kept for them
+func (r *SearchRuleReconciler) executeQuery(ctx context.Context, resource *v1alpha1.SearchRule,
+	conn *backend.Connector, queryBackend backend.Backend) ([]byte, error) {
+
+	batcher, canBatch := queryBackend.(backend.Batcher)
+	settings, batching, err := connector.ParseBatching(conn.Spec)
+	if err != nil || !batching || !canBatch || !batcher.Batchable(resource) || r.QueryResultsPool == nil {
+		req, err := queryBackend.BuildRequest(ctx, conn, resource)
+		if err != nil {
+			return nil, fmt.Errorf(controller.HttpRequestCreationErrorMessage, err)
+		}
+		return r.send(ctx, resource, conn, queryBackend, req)
+	}
+
+	// A rule evaluated a bit earlier in the batch of another one takes that response. Results
+	// older than the window are left, as the rule could not be requeued in time to use them
+	ruleKey := fmt.Sprintf("%s_%s", resource.Namespace, resource.Name)
+	if result, found := r.QueryResultsPool.Take(ruleKey, resource.Generation, 2*settings.Window); found {
+		return result.Body, result.Err
+	}
+
+	rules := []*v1alpha1.SearchRule{resource}
+	keys := []string{ruleKey}
+	for _, sibling := range r.dueSiblings(resource, batcher, settings) {
+		if len(rules) >= settings.MaxSize {
+			break
+		}
+		rules = append(rules, &sibling.rule.SearchRule)
+		keys = append(keys, sibling.key)
+	}
+
+	req, err := batcher.BuildBatchRequest(ctx, conn, rules)
+	if errors.Is(err, backend.ErrInvalidRule) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf(controller.HttpRequestCreationErrorMessage, err)
+	}
+	body, err := r.send(ctx, resource, conn, queryBackend, req)
+	if err != nil {
+		return nil, err
+	}
+	items, err := batcher.SplitBatchResponse(body, len(rules))
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the responses of the other rules until they are evaluated
+	now := time.Now()
+	for i := 1; i < len(items); i++ {
+		r.QueryResultsPool.Set(keys[i], &pools.QueryResult{
+			Generation: rules[i].Generation,
+			Body:       items[i].Body,
+			Err:        items[i].Err,
+			Time:       now,
+		})
+	}
+	if len(rules) > 1 {
+		log.FromContext(ctx).V(1).Info(fmt.Sprintf("Query of rule %s batched with %d other rules", resource.Name, len(rules)-1))
+	}
+
+	return items[0].Body, items[0].Err
+}
+
+// batchSibling is a rule that can join the batch of the rule being evaluated
+type batchSibling struct {
+	key  string
+	rule pools.Rule
+	due  time.Time
+}
+
+// dueSiblings returns the rules on the same QueryConnector whose next evaluation is within the
+// batching window, the ones due first first. Rules never evaluated are left out, as nothing
+// tells when they are due
+func (r *SearchRuleReconciler) dueSiblings(resource *v1alpha1.SearchRule, batcher backend.Batcher,
+	settings connector.BatchingSettings) []batchSibling {
+
+	deadline := time.Now().Add(settings.Window)
+	siblings := []batchSibling{}
+	for key, rule := range r.RulesPool.Snapshot() {
+		sibling := &rule.SearchRule
+		if sibling.Namespace == resource.Namespace && sibling.Name == resource.Name {
+			continue
+		}
+		if sibling.Spec.QueryConnectorRef != resource.Spec.QueryConnectorRef || !batcher.Batchable(sibling) {
+			continue
+		}
+		if rule.LastEvaluationTime.IsZero() || r.QueryResultsPool.Has(key) {
+			continue
+		}
+
+		// Rules suspended when due are not evaluated, so their query is not sent
+		due, err := controller.NextEvaluation(sibling, rule.LastEvaluationTime)
+		if err != nil || due.IsZero() || due.After(deadline) || !ruleActive(sibling, due) {
+			continue
+		}
+		siblings = append(siblings, batchSibling{key: key, rule: rule, due: due})
+	}
+
+	sort.Slice(siblings, func(i, j int) bool {
+		if !siblings[i].due.Equal(siblings[j].due) {
+			return siblings[i].due.Before(siblings[j].due)
+		}
+		return siblings[i].key < siblings[j].key
+	})
+	return siblings
+}
+
+// send runs the request against the QueryConnector, waiting for its turn when the connector
+// limits the queries. It is retried as the RequestPolicy of the rule, or else the one of the
+// connector, allows
+func (r *SearchRuleReconciler) send(ctx context.Context, resource *v1alpha1.SearchRule, conn *backend.Connector,
+	queryBackend backend.Backend, req *http.Request) ([]byte, error) {
+
+	settings, err := connector.RequestSettingsFor(conn.Spec, resource.Spec.RequestPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("%w: "+controller.RequestPolicyParseErrorMessage, backend.ErrInvalidRule, err)
+	}
+
+	if limiter, limited := connector.GetLimiter(conn.Namespace, conn.Name); limited {
+		release, err := limiter.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	// Make request with the client of the QueryConnector, which spreads them across its endpoints
+	client := connector.NewClient(conn.Spec, conn.Credentials).WithRequestSettings(settings)
+	return queryBackend.Execute(client, req)
+}
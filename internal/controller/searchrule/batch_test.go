@@ -0,0 +1,163 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/backend"
+	"freepik.com/searchruler/internal/pools"
+)
+
+// newBatchRule returns a rule searching the index through the logs connector
+func newBatchRule(name, index string) *searchrulerv1alpha1.SearchRule {
+	return newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+		r.Name = name
+		r.Generation = 1
+		r.Spec.QueryConnectorRef = searchrulerv1alpha1.QueryConnectorRef{Name: "logs", Namespace: "default"}
+		r.Spec.CheckInterval = "1m"
+		r.Spec.Elasticsearch.Index = index
+		r.Spec.Elasticsearch.QueryJSON = `{"size":0}`
+		r.Spec.Elasticsearch.ConditionField = "hits.total"
+	})
+}
+
+func TestExecuteQuery_Batching(t *testing.T) {
+	t.Parallel()
+
+	// The fake cluster answers each search of a `_msearch` with the number of its line, and
+	// fails the searches on the missing index
+	requests := &atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/_msearch" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+		responses := []string{}
+		for i := 0; i < len(lines); i += 2 {
+			if strings.Contains(lines[i], "missing") {
+				responses = append(responses, `{"error": {"type": "index_not_found_exception"}, "status": 404}`)
+				continue
+			}
+			responses = append(responses, `{"hits": {"total": {"value": `+string(rune('0'+i/2))+`}}, "status": 200}`)
+		}
+		_, _ = w.Write([]byte(`{"responses": [` + strings.Join(responses, ",") + `]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	r := &SearchRuleReconciler{
+		RulesPool:        &pools.RulesStore{Store: map[string]*pools.Rule{}},
+		QueryResultsPool: &pools.QueryResultsStore{Store: map[string]*pools.QueryResult{}},
+	}
+	now := time.Now()
+	evaluated := func(rule *searchrulerv1alpha1.SearchRule, ago time.Duration) {
+		r.RulesPool.Set(rule.Namespace+"_"+rule.Name, &pools.Rule{SearchRule: *rule, LastEvaluationTime: now.Add(-ago)})
+	}
+
+	// Due within the window, the first one already late
+	dueSoon := newBatchRule("due-soon", "logs-b")
+	evaluated(dueSoon, 58*time.Second)
+	dueLate := newBatchRule("due-late", "logs-a")
+	evaluated(dueLate, 70*time.Second)
+	missing := newBatchRule("missing-index", "missing")
+	evaluated(missing, time.Minute)
+
+	// Not due, on another connector, or not batchable
+	notDue := newBatchRule("not-due", "logs")
+	evaluated(notDue, 10*time.Second)
+	otherConnector := newBatchRule("other-connector", "logs")
+	otherConnector.Spec.QueryConnectorRef.Name = "metrics"
+	evaluated(otherConnector, time.Minute)
+	sql := newBatchRule("sql", "")
+	sql.Spec.Elasticsearch.QueryJSON = ""
+	sql.Spec.Elasticsearch.SQL = "SELECT count(*) FROM logs"
+	evaluated(sql, time.Minute)
+
+	conn := &backend.Connector{
+		Namespace:   "default",
+		Name:        "logs",
+		Spec:        &searchrulerv1alpha1.QueryConnectorSpec{URL: srv.URL, Batching: &searchrulerv1alpha1.QueryBatching{Window: "5s"}},
+		Status:      &searchrulerv1alpha1.QueryConnectorStatus{},
+		Credentials: &pools.Credentials{},
+	}
+	queryBackend, err := backend.For(conn)
+	if err != nil {
+		t.Fatalf("For: %v", err)
+	}
+	value := func(body []byte, rule *searchrulerv1alpha1.SearchRule) float64 {
+		t.Helper()
+		result, err := queryBackend.Extract(rule, body)
+		if err != nil {
+			t.Fatalf("Extract: %v", err)
+		}
+		return result.Value
+	}
+
+	// The rule evaluated now brings the due ones with it, sorted by when they are due
+	rule := newBatchRule("current", "logs")
+	body, err := r.executeQuery(context.Background(), rule, conn, queryBackend)
+	if err != nil {
+		t.Fatalf("executeQuery: %v", err)
+	}
+	if got := value(body, rule); got != 0 {
+		t.Errorf("current rule got the response of search %v", got)
+	}
+
+	// Each of them takes its own response without querying the cluster again
+	for want, sibling := range map[float64]*searchrulerv1alpha1.SearchRule{1: dueLate, 3: dueSoon} {
+		body, err = r.executeQuery(context.Background(), sibling, conn, queryBackend)
+		if err != nil {
+			t.Fatalf("%s: %v", sibling.Name, err)
+		}
+		if got := value(body, sibling); got != want {
+			t.Errorf("%s got the response of search %v, want %v", sibling.Name, got, want)
+		}
+	}
+	if _, err = r.executeQuery(context.Background(), missing, conn, queryBackend); !errors.Is(err, backend.ErrQuery) {
+		t.Errorf("missing-index err = %v, want ErrQuery", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("cluster got %d requests, want 1", requests.Load())
+	}
+
+	// Responses are taken once and only for the generation they were obtained for
+	for _, name := range []string{"not-due", "other-connector", "sql"} {
+		if r.QueryResultsPool.Has("default_" + name) {
+			t.Errorf("%s was batched", name)
+		}
+	}
+	r.QueryResultsPool.Set("default_due-soon", &pools.QueryResult{Generation: 1, Time: now})
+	dueSoon.Generation = 2
+	if _, err = r.executeQuery(context.Background(), dueSoon, conn, queryBackend); err != nil {
+		t.Fatalf("executeQuery: %v", err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("a response for an old generation must not be used")
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	//
+	"github.com/tidwall/gjson"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/backend"
+	"freepik.com/searchruler/internal/controller"
+	"freepik.com/searchruler/internal/pools"
+)
+
+const (
+
+	// bucketsLimit caps the buckets evaluated per rule, as every one of them can keep a
+	// state and fire an alert
+	bucketsLimit = 1000
+
+	// Defaults of the buckets of a condition, matching a bare `terms` aggregation
+	bucketDefaultLabel = "key"
+	bucketDefaultValue = "doc_count"
+)
+
+// bucketReservedLabels are set on the alerts by the operator, so buckets can not use them
+var bucketReservedLabels = map[string]bool{
+	"alertname": true,
+	"severity":  true,
+}
+
+// bucket is a bucket of the aggregation of a rule evaluating its condition per bucket
+type bucket struct {
+	key    string
+	labels map[string]string
+	value  float64
+	body   []byte
+}
+
+// bucketEvaluation is the result of evaluating the condition on a bucket
+type bucketEvaluation struct {
+	bucket
+	firing     bool
+	matches    []pools.ConditionMatch
+	severities *severityEvaluation
+}
+
+// validateBuckets checks the labels extracted from the buckets are valid and unique
+func validateBuckets(buckets *v1alpha1.ConditionBuckets) error {
+
+	names := map[string]bool{}
+	for i, label := range buckets.Labels {
+		switch {
+		case !v1alpha1.IsValidLabelName(label.Name):
+			return fmt.Errorf("labels[%d] has an invalid name %q", i, label.Name)
+		case bucketReservedLabels[label.Name]:
+			return fmt.Errorf("labels[%d] uses the reserved name %q", i, label.Name)
+		case names[label.Name]:
+			return fmt.Errorf("labels[%d] duplicates the name %q", i, label.Name)
+		}
+		names[label.Name] = true
+	}
+	return nil
+}
+
+// extractBuckets reads the buckets of the condition from the aggregations of the response.
+// Buckets missing one of the labels or the value are skipped, as they can not be told apart
+// from the others or compared
+func extractBuckets(aggregations interface{}, spec *v1alpha1.ConditionBuckets) ([]bucket, error) {
+
+	notFound := fmt.Errorf("%w: condition.buckets.aggregation_map path %q not found in aggregations",
+		backend.ErrQuery, spec.AggregationMap)
+	if aggregations == nil {
+		return nil, notFound
+	}
+	raw, err := json.Marshal(aggregations)
+	if err != nil {
+		return nil, fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+	}
+	root := gjson.GetBytes(raw, spec.AggregationMap)
+	if !root.Exists() {
+		return nil, notFound
+	}
+
+	results := []gjson.Result{root}
+	if root.IsArray() {
+		results = root.Array()
+	}
+	if len(results) > bucketsLimit {
+		results = results[:bucketsLimit]
+	}
+
+	labels := spec.Labels
+	if len(labels) == 0 {
+		labels = []v1alpha1.MetricLabel{{Name: bucketDefaultLabel, Value: bucketDefaultLabel}}
+	}
+	valuePath := spec.Value
+	if valuePath == "" {
+		valuePath = bucketDefaultValue
+	}
+
+	buckets := make([]bucket, 0, len(results))
+	for _, result := range results {
+		value := result.Get(valuePath)
+		if value.Type != gjson.Number && value.Type != gjson.String {
+			continue
+		}
+
+		b := bucket{labels: map[string]string{}, value: value.Float(), body: []byte(result.Raw)}
+		keyParts := make([]string, 0, len(labels))
+		complete := true
+		for _, label := range labels {
+			labelValue := label.Value
+			if !label.StaticValue {
+				field := result.Get(label.Value)
+				if !field.Exists() {
+					complete = false
+					break
+				}
+				labelValue = field.String()
+			}
+			b.labels[label.Name] = labelValue
+			keyParts = append(keyParts, fmt.Sprintf("%s=%q", label.Name, labelValue))
+		}
+		if !complete {
+			continue
+		}
+		b.key = strings.Join(keyParts, ",")
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
+
+// evaluateBuckets evaluates the condition on every bucket, on the state the bucket had
+func (c *compiledCondition) evaluateBuckets(buckets []bucket, states map[string]pools.BucketState) ([]bucketEvaluation, error) {
+
+	evaluations := make([]bucketEvaluation, 0, len(buckets))
+	for _, b := range buckets {
+		state, ok := states[b.key]
+		if !ok {
+			state.State = RuleNormalState
+		}
+		firing, matches, severities, err := c.check(conditionInput{value: b.value, body: b.body}, state.RuleState)
+		if err != nil {
+			return nil, fmt.Errorf("bucket %s: %w", b.key, err)
+		}
+		evaluations = append(evaluations, bucketEvaluation{
+			bucket:     b,
+			firing:     firing,
+			matches:    matches,
+			severities: severities,
+		})
+	}
+	return evaluations, nil
+}
+
+// summarizeBuckets returns the state of a rule from the states of its buckets: the one of the
+// most advanced bucket, at the most severe level of the buckets in that state
+func (c *compiledCondition) summarizeBuckets(states map[string]pools.BucketState) pools.RuleState {
+
+	priority := map[string]int{
+		RuleNormalState:          0,
+		RulePendingFiringState:   1,
+		RulePendingResolvedState: 2,
+		RuleFiringState:          3,
+	}
+
+	summary := pools.RuleState{State: RuleNormalState}
+	for _, state := range states {
+		switch {
+		case priority[state.State] > priority[summary.State],
+			state.State == summary.State && state.FiringTime.Before(summary.FiringTime):
+			summary.State = state.State
+			summary.FiringTime = state.FiringTime
+			summary.ResolvingTime = state.ResolvingTime
+		}
+	}
+	for _, state := range states {
+		if state.State == summary.State && c.severityIndex(state.Severity) > c.severityIndex(summary.Severity) {
+			summary.Severity = state.Severity
+		}
+	}
+	return summary
+}
+
+// bucketAlertKey returns the key of the alert of a bucket in the alerts pool
+func bucketAlertKey(ruleKey, bucketKey string) string {
+	return ruleKey + "/" + bucketKey
+}
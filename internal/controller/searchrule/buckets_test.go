@@ -0,0 +1,192 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/backend"
+	"freepik.com/searchruler/internal/pools"
+)
+
+// serviceAggregations returns the aggregations of a terms aggregation by service
+func serviceAggregations(t *testing.T, counts map[string]float64) interface{} {
+	t.Helper()
+	buckets := []map[string]interface{}{}
+	for service, count := range counts {
+		buckets = append(buckets, map[string]interface{}{"key": service, "doc_count": count, "ratio": map[string]float64{"value": count / 100}})
+	}
+	var aggregations interface{}
+	raw, _ := json.Marshal(map[string]interface{}{"by_service": map[string]interface{}{"buckets": buckets}})
+	if err := json.Unmarshal(raw, &aggregations); err != nil {
+		t.Fatalf("unmarshal aggregations: %v", err)
+	}
+	return aggregations
+}
+
+func TestExtractBuckets(t *testing.T) {
+	t.Parallel()
+	aggregations := map[string]interface{}{}
+	_ = json.Unmarshal([]byte(`{"by_service": {"buckets": [
+		{"key": "api", "doc_count": 12, "ratio": {"value": 0.2}},
+		{"key": "web", "doc_count": 3},
+		{"doc_count": 7}
+	]}}`), &aggregations)
+
+	buckets, err := extractBuckets(aggregations, &searchrulerv1alpha1.ConditionBuckets{AggregationMap: "by_service.buckets"})
+	if err != nil {
+		t.Fatalf("extractBuckets: %v", err)
+	}
+	if len(buckets) != 2 {
+		t.Fatalf("got %d buckets, want the 2 with a key", len(buckets))
+	}
+	if buckets[0].key != `key="api"` || buckets[0].value != 12 || !reflect.DeepEqual(buckets[0].labels, map[string]string{"key": "api"}) {
+		t.Errorf("unexpected default bucket %+v", buckets[0])
+	}
+
+	buckets, err = extractBuckets(aggregations, &searchrulerv1alpha1.ConditionBuckets{
+		AggregationMap: "by_service.buckets",
+		Value:          "ratio.value",
+		Labels: []searchrulerv1alpha1.MetricLabel{
+			{Name: "service", Value: "key"},
+			{Name: "team", Value: "search", StaticValue: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("extractBuckets: %v", err)
+	}
+	if len(buckets) != 1 || buckets[0].value != 0.2 || buckets[0].key != `service="api",team="search"` {
+		t.Errorf("got %+v, want the only bucket with a ratio", buckets)
+	}
+
+	_, err = extractBuckets(aggregations, &searchrulerv1alpha1.ConditionBuckets{AggregationMap: "by_host.buckets"})
+	if !errors.Is(err, backend.ErrQuery) {
+		t.Errorf("missing aggregation_map: error = %v, want a query error", err)
+	}
+}
+
+func TestCompileCondition_Buckets(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		labels  []searchrulerv1alpha1.MetricLabel
+		wantErr string
+	}{
+		{labels: []searchrulerv1alpha1.MetricLabel{{Name: "service", Value: "key"}}},
+		{labels: []searchrulerv1alpha1.MetricLabel{{Name: "service-name", Value: "key"}}, wantErr: "invalid name"},
+		{labels: []searchrulerv1alpha1.MetricLabel{{Name: "severity", Value: "key"}}, wantErr: "reserved name"},
+		{labels: []searchrulerv1alpha1.MetricLabel{{Name: "a", Value: "key"}, {Name: "a", Value: "x"}}, wantErr: "duplicates"},
+	}
+	for _, tc := range cases {
+		condition := searchrulerv1alpha1.Condition{
+			Operator:  conditionGreaterThan,
+			Threshold: "10",
+			Buckets:   &searchrulerv1alpha1.ConditionBuckets{AggregationMap: "by_service.buckets", Labels: tc.labels},
+		}
+		_, err := compileCondition(&condition)
+		if tc.wantErr == "" && err != nil || tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Errorf("labels %v: error = %v, want %q", tc.labels, err, tc.wantErr)
+		}
+	}
+}
+
+func TestSyncBuckets(t *testing.T) {
+	t.Parallel()
+	resource := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+		r.Spec.Condition.For = "0s"
+		r.Spec.Condition.Buckets = &searchrulerv1alpha1.ConditionBuckets{
+			AggregationMap: "by_service.buckets",
+			Labels:         []searchrulerv1alpha1.MetricLabel{{Name: "service", Value: "key"}},
+		}
+	})
+	condition, err := compileCondition(&resource.Spec.Condition)
+	if err != nil {
+		t.Fatalf("compileCondition: %v", err)
+	}
+	r := &SearchRuleReconciler{
+		RulesPool:  &pools.RulesStore{Store: map[string]*pools.Rule{}},
+		AlertsPool: &pools.AlertsStore{Store: map[string]*pools.Alert{}},
+	}
+	ruleKey := "default_demo"
+
+	evaluate := func(counts map[string]float64) pools.Rule {
+		rule, _ := r.RulesPool.Get(ruleKey)
+		buckets, err := extractBuckets(serviceAggregations(t, counts), condition.buckets)
+		if err != nil {
+			t.Fatalf("extractBuckets: %v", err)
+		}
+		evaluations, err := condition.evaluateBuckets(buckets, rule.Buckets)
+		if err != nil {
+			t.Fatalf("evaluateBuckets: %v", err)
+		}
+		if err := r.syncBuckets(context.Background(), resource, ruleKey, &rule, condition, evaluations, 0); err != nil {
+			t.Fatalf("syncBuckets: %v", err)
+		}
+		rule, _ = r.RulesPool.Get(ruleKey)
+		return rule
+	}
+
+	// Only the bucket over the threshold of 100 is kept, and fires on its own
+	rule := evaluate(map[string]float64{"api": 500, "web": 5})
+	if len(rule.Buckets) != 1 || rule.Buckets[`service="api"`].State != RuleFiringState {
+		t.Fatalf("buckets = %+v, want api firing", rule.Buckets)
+	}
+	if rule.State != RuleFiringState || rule.Buckets[`service="api"`].Labels["service"] != "api" {
+		t.Fatalf("rule state = %s, buckets = %+v", rule.State, rule.Buckets)
+	}
+
+	// api goes away from the response and resolves, while web fires
+	rule = evaluate(map[string]float64{"web": 500})
+	if _, ok := rule.Buckets[`service="api"`]; ok {
+		t.Errorf("api bucket should have resolved, got %+v", rule.Buckets)
+	}
+	if rule.Buckets[`service="web"`].State != RuleFiringState || rule.Buckets[`service="web"`].Value != 500 {
+		t.Errorf("web bucket should fire, got %+v", rule.Buckets)
+	}
+
+	// Nothing over the threshold, the rule is back to normal
+	rule = evaluate(map[string]float64{"web": 1})
+	if len(rule.Buckets) != 0 || rule.State != RuleNormalState {
+		t.Errorf("rule state = %s, buckets = %+v, want normal", rule.State, rule.Buckets)
+	}
+}
+
+func TestSummarizeBuckets(t *testing.T) {
+	t.Parallel()
+	condition := severitiesCondition()
+	compiled, err := compileCondition(&condition)
+	if err != nil {
+		t.Fatalf("compileCondition: %v", err)
+	}
+	summary := compiled.summarizeBuckets(map[string]pools.BucketState{
+		"a": {RuleState: pools.RuleState{State: RulePendingFiringState}},
+		"b": {RuleState: pools.RuleState{State: RuleFiringState, Severity: "warning"}},
+		"c": {RuleState: pools.RuleState{State: RuleFiringState, Severity: "critical"}},
+		"d": {RuleState: pools.RuleState{State: RulePendingResolvedState, Severity: "critical"}},
+	})
+	if summary.State != RuleFiringState || summary.Severity != "critical" {
+		t.Errorf("summary = %+v, want firing at critical", summary)
+	}
+	if summary := compiled.summarizeBuckets(nil); summary.State != RuleNormalState {
+		t.Errorf("summary without buckets = %+v, want normal", summary)
+	}
+}
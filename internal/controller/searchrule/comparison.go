@@ -0,0 +1,136 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/backend"
+	"freepik.com/searchruler/internal/controller"
+)
+
+const (
+
+	// Changes between the current and the baseline values a comparison can evaluate
+	comparisonChangeAbsolute = "absolute"
+	comparisonChangePercent  = "percent"
+	comparisonChangeRatio    = "ratio"
+)
+
+// comparison is the comparison of a rule with its baseline, ready to be evaluated
+type comparison struct {
+	offset time.Duration
+	window time.Duration
+	change string
+}
+
+// compileComparison checks the comparison of the rule. The window defaults to the one of the
+// evaluations, the checkInterval
+func compileComparison(resource *v1alpha1.SearchRule) (*comparison, error) {
+
+	spec := resource.Spec.Condition.Comparison
+	if resource.Spec.Condition.Buckets != nil {
+		return nil, fmt.Errorf("condition.comparison is not supported with buckets")
+	}
+
+	compiled := &comparison{change: spec.Change}
+	if compiled.change == "" {
+		compiled.change = comparisonChangePercent
+	}
+	switch compiled.change {
+	case comparisonChangeAbsolute, comparisonChangePercent, comparisonChangeRatio:
+	default:
+		return nil, fmt.Errorf("unknown condition.comparison.change %q", spec.Change)
+	}
+
+	var err error
+	compiled.offset, err = time.ParseDuration(spec.Offset)
+	if err != nil || compiled.offset <= 0 {
+		return nil, fmt.Errorf("condition.comparison.offset %q must be a positive duration", spec.Offset)
+	}
+	if spec.Window == "" {
+		compiled.window, err = controller.EvaluationWindow(resource, time.Now())
+		return compiled, err
+	}
+	compiled.window, err = time.ParseDuration(spec.Window)
+	if err != nil || compiled.window <= 0 {
+		return nil, fmt.Errorf("condition.comparison.window %q must be a positive duration", spec.Window)
+	}
+	return compiled, nil
+}
+
+// windows returns the current window, ending now, and the baseline one
+func (c *comparison) windows(now time.Time) (current, baseline queryWindow) {
+	current = queryWindow{from: now.Add(-c.window), to: now}
+	baseline = queryWindow{
+		from:   current.from.Add(-c.offset),
+		to:     current.to.Add(-c.offset),
+		offset: c.offset,
+	}
+	return current, baseline
+}
+
+// compare returns the change from the baseline value to the current one. A change from a zero
+// baseline is infinite, unless the current value is zero too
+func (c *comparison) compare(current, baseline float64) float64 {
+
+	if c.change == comparisonChangeAbsolute {
+		return current - baseline
+	}
+	if baseline == 0 {
+		switch {
+		case current == 0 && c.change == comparisonChangeRatio:
+			return 1
+		case current == 0:
+			return 0
+		}
+		return math.Inf(int(math.Copysign(1, current)))
+	}
+	if c.change == comparisonChangeRatio {
+		return current / baseline
+	}
+	return (current - baseline) / math.Abs(baseline) * 100
+}
+
+// queryBaseline runs the query of the rule for the baseline window and returns its value.
+// It is never batched, as every rule has a baseline window of its own
+func (r *SearchRuleReconciler) queryBaseline(ctx context.Context, resource *v1alpha1.SearchRule,
+	conn *backend.Connector, queryBackend backend.Backend, window queryWindow, lastEvaluation time.Time) (float64, error) {
+
+	baselineResource, err := renderQuery(resource, window, lastEvaluation)
+	if err != nil {
+		return 0, fmt.Errorf("baseline: %w", err)
+	}
+	req, err := queryBackend.BuildRequest(backend.WithEvaluationTime(ctx, window.to), conn, baselineResource)
+	if err != nil {
+		return 0, fmt.Errorf(controller.HttpRequestCreationErrorMessage, err)
+	}
+	responseBody, err := r.send(ctx, resource, conn, queryBackend, req)
+	if err != nil {
+		return 0, err
+	}
+	result, err := queryBackend.Extract(baselineResource, responseBody)
+	if err != nil {
+		return 0, fmt.Errorf("baseline: %w", err)
+	}
+	return result.Value, nil
+}
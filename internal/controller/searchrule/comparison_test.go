@@ -0,0 +1,103 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+)
+
+func TestCompileComparison(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name       string
+		comparison searchrulerv1alpha1.Comparison
+		buckets    bool
+		wantWindow time.Duration
+		wantErr    string
+	}{
+		{name: "window from checkInterval", comparison: searchrulerv1alpha1.Comparison{Offset: "168h"}, wantWindow: 30 * time.Second},
+		{name: "own window", comparison: searchrulerv1alpha1.Comparison{Offset: "24h", Window: "1h"}, wantWindow: time.Hour},
+		{name: "invalid offset", comparison: searchrulerv1alpha1.Comparison{Offset: "-1h"}, wantErr: "offset"},
+		{name: "invalid window", comparison: searchrulerv1alpha1.Comparison{Offset: "1h", Window: "soon"}, wantErr: "window"},
+		{name: "invalid change", comparison: searchrulerv1alpha1.Comparison{Offset: "1h", Change: "double"}, wantErr: "change"},
+		{name: "with buckets", comparison: searchrulerv1alpha1.Comparison{Offset: "1h"}, buckets: true, wantErr: "buckets"},
+	}
+	for _, tc := range cases {
+		resource := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+			r.Spec.CheckInterval = "30s"
+			r.Spec.Condition.Comparison = &tc.comparison
+			if tc.buckets {
+				r.Spec.Condition.Buckets = &searchrulerv1alpha1.ConditionBuckets{AggregationMap: "by_service.buckets"}
+			}
+		})
+		compiled, err := compileComparison(resource)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s: error = %v, want it to contain %q", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		if compiled.window != tc.wantWindow || compiled.change != comparisonChangePercent {
+			t.Errorf("%s: got %+v, want a window of %s changing in percent", tc.name, compiled, tc.wantWindow)
+		}
+	}
+}
+
+func TestComparisonCompare(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		change            string
+		current, baseline float64
+		want              float64
+	}{
+		{change: comparisonChangeAbsolute, current: 150, baseline: 100, want: 50},
+		{change: comparisonChangePercent, current: 150, baseline: 100, want: 50},
+		{change: comparisonChangePercent, current: 50, baseline: -100, want: 150},
+		{change: comparisonChangePercent, current: 0, baseline: 0, want: 0},
+		{change: comparisonChangePercent, current: 10, baseline: 0, want: math.Inf(1)},
+		{change: comparisonChangeRatio, current: 50, baseline: 100, want: 0.5},
+		{change: comparisonChangeRatio, current: 0, baseline: 0, want: 1},
+		{change: comparisonChangeRatio, current: -3, baseline: 0, want: math.Inf(-1)},
+	}
+	for _, tc := range cases {
+		c := &comparison{change: tc.change}
+		if got := c.compare(tc.current, tc.baseline); got != tc.want {
+			t.Errorf("%s from %v to %v = %v, want %v", tc.change, tc.baseline, tc.current, got, tc.want)
+		}
+	}
+}
+
+func TestComparisonWindows(t *testing.T) {
+	t.Parallel()
+	c := &comparison{offset: 24 * time.Hour, window: 5 * time.Minute}
+	now := time.Date(2024, 6, 2, 12, 0, 0, 0, time.UTC)
+	current, baseline := c.windows(now)
+	if !current.to.Equal(now) || !current.from.Equal(now.Add(-5*time.Minute)) {
+		t.Errorf("current window = %+v", current)
+	}
+	if !baseline.to.Equal(now.Add(-24*time.Hour)) || !baseline.from.Equal(now.Add(-24*time.Hour-5*time.Minute)) {
+		t.Errorf("baseline window = %+v", baseline)
+	}
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/globals"
+	"freepik.com/searchruler/internal/pools"
+	"freepik.com/searchruler/internal/scheduler"
+)
+
+// concurrentRules is how many rules are evaluated at the same time. Rules above 100 fire
+const concurrentRules = 300
+
+// searchIndex extracts the index of a `_search` request
+var searchIndex = regexp.MustCompile(`/logs-(\d+)/_search`)
+
+// newFakeElasticsearch answers the search of the index `logs-N` with N hits
+func newFakeElasticsearch(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		match := searchIndex.FindStringSubmatch(r.URL.Path)
+		if match == nil {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"hits": {"total": {"value": %s, "relation": "eq"}}}`, match[1])
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newFakeAPIServer serves the ClusterQueryConnector of the rules and accepts the events of
+// their alerts, as the API server does for the clients in globals.Application
+func newFakeAPIServer(t *testing.T, elasticsearchURL string, events *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/apis/searchruler.freepik.com/v1alpha1/clusterqueryconnectors/logs":
+			_, _ = fmt.Fprintf(w, `{"apiVersion": "searchruler.freepik.com/v1alpha1", "kind": "ClusterQueryConnector",
+				"metadata": {"name": "logs"}, "spec": {"type": "elasticsearch", "url": %q}}`, elasticsearchURL)
+		case r.Method == http.MethodPost && r.URL.Path == "/apis/events.k8s.io/v1/namespaces/default/events":
+			events.Add(1)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.Copy(w, r.Body)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestConcurrentEvaluations reconciles and evaluates hundreds of rules at the same time, to be
+// run with the race detector. It replaces the clients of globals.Application, so it does not
+// run in parallel with other tests
+func TestConcurrentEvaluations(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := &atomic.Int32{}
+	elasticsearch := newFakeElasticsearch(t)
+	apiServer := newFakeAPIServer(t, elasticsearch.URL, events)
+	config := &rest.Config{Host: apiServer.URL, QPS: -1}
+	previous := globals.Application
+	t.Cleanup(func() { globals.Application = previous })
+	var err error
+	if globals.Application.KubeRawClient, err = dynamic.NewForConfig(config); err != nil {
+		t.Fatalf("dynamic client: %v", err)
+	}
+	if globals.Application.KubeRawCoreClient, err = kubernetes.NewForConfig(config); err != nil {
+		t.Fatalf("core client: %v", err)
+	}
+
+	objects := []client.Object{}
+	for i := range concurrentRules {
+		objects = append(objects, newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+			r.Name = fmt.Sprintf("rule-%d", i)
+			r.UID = types.UID(r.Name)
+			r.Spec.QueryConnectorRef = searchrulerv1alpha1.QueryConnectorRef{Name: "logs"}
+			r.Spec.ActionRef = &searchrulerv1alpha1.ActionRef{Name: "slack"}
+			r.Spec.CheckInterval = "1h"
+			r.Spec.Condition.For = "0s"
+			r.Spec.Elasticsearch.Index = fmt.Sprintf("logs-%d", i)
+			r.Spec.Elasticsearch.QueryJSON = `{"size": 0}`
+			r.Spec.Elasticsearch.ConditionField = "hits.total"
+		}))
+	}
+	r := &SearchRuleReconciler{
+		Client: fake.NewClientBuilder().WithScheme(newScheme(t)).
+			WithObjects(objects...).WithStatusSubresource(objects...).Build(),
+		QueryConnectorCredentialsPool: &pools.CredentialsStore{Store: map[string]*pools.Credentials{"_logs": {}}},
+		RulesPool:                     newRulesPool(),
+		AlertsPool:                    &pools.AlertsStore{Store: map[string]*pools.Alert{}},
+		QueryResultsPool:              &pools.QueryResultsStore{Store: map[string]*pools.QueryResult{}},
+	}
+	r.Scheduler = scheduler.New(r.evaluate, scheduler.Options{Workers: 32})
+	go func() { _ = r.Scheduler.Start(ctx) }()
+
+	// The rules are reconciled by several workers, as with MaxConcurrentReconciles, and every
+	// rule is evaluated right away as it was never evaluated before
+	requests := make(chan string)
+	var reconcilers sync.WaitGroup
+	for range 16 {
+		reconcilers.Add(1)
+		go func() {
+			defer reconcilers.Done()
+			for name := range requests {
+				request := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}}
+				for {
+					_, err := r.Reconcile(ctx, request)
+					if err == nil {
+						break
+					}
+					// Status updates of the evaluations conflict with the reconciliation, any
+					// other error is a failure
+					if !apierrors.IsConflict(err) {
+						t.Errorf("Reconcile %s: %v", name, err)
+						break
+					}
+					if ctx.Err() != nil {
+						return
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+		}()
+	}
+	for i := range concurrentRules {
+		requests <- fmt.Sprintf("rule-%d", i)
+	}
+	close(requests)
+	reconcilers.Wait()
+
+	// Every rule ends up evaluated with the response of its own index, and the firing ones send
+	// their event after being evaluated
+	firing := concurrentRules - 101
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		evaluated := 0
+		for i := range concurrentRules {
+			if rule, exists := r.RulesPool.Get(fmt.Sprintf("default_rule-%d", i)); exists && !rule.LastEvaluationTime.IsZero() {
+				evaluated++
+			}
+		}
+		if evaluated == concurrentRules && int(events.Load()) >= firing {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d rules evaluated, %d events", evaluated, concurrentRules, events.Load())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	for i := range concurrentRules {
+		name := fmt.Sprintf("rule-%d", i)
+		rule, _ := r.RulesPool.Get("default_" + name)
+		if rule.Value != float64(i) {
+			t.Errorf("%s: value = %v, want %d", name, rule.Value, i)
+		}
+		wantState := RuleNormalState
+		if i > 100 {
+			wantState = RuleFiringState
+		}
+		if rule.State != wantState {
+			t.Errorf("%s: state = %s, want %s", name, rule.State, wantState)
+		}
+		if _, exists := r.AlertsPool.Get("default_" + name); exists != (i > 100) {
+			t.Errorf("%s: alert in the pool = %t", name, exists)
+		}
+	}
+	if got := int(events.Load()); got != firing {
+		t.Errorf("%d events, want one per firing rule (%d)", got, firing)
+	}
+
+	// The state of the rules reaches their status, apart from the evaluations racing with the
+	// reconciliation and retried on the next slot
+	stored := &searchrulerv1alpha1.SearchRuleList{}
+	if err := r.List(ctx, stored); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	withState := 0
+	for _, rule := range stored.Items {
+		if rule.Status.RuleState == nil {
+			continue
+		}
+		withState++
+		if firing := rule.Status.RuleState.State == RuleFiringState; firing != (rulesIndex(rule.Name) > 100) {
+			t.Errorf("%s: state in the status = %s", rule.Name, rule.Status.RuleState.State)
+		}
+	}
+	if withState == 0 {
+		t.Errorf("no rule has its state in the status")
+	}
+}
+
+// rulesIndex returns the number of the rule in its name
+func rulesIndex(name string) int {
+	i, _ := strconv.Atoi(name[len("rule-"):])
+	return i
+}
@@ -0,0 +1,456 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	//
+	"github.com/google/cel-go/cel"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/backend"
+	"freepik.com/searchruler/internal/pools"
+)
+
+const (
+
+	// Names of the matched leaves comparing the value of the rule and of firing expressions
+	conditionValueName      = "value"
+	conditionExpressionName = "expression"
+)
+
+// conditionInput is what the leaves of a condition are compared against: the value of the
+// rule, read from its conditionField, and the whole response for the leaves with a field.
+// fired is set while the rule is firing or resolving, when the leaves compare their
+// resolveThreshold instead of the threshold. bounds are the ones learned from the history of
+// the rule, for anomaly conditions
+type conditionInput struct {
+	value  float64
+	body   []byte
+	fired  bool
+	bounds *pools.AnomalyBounds
+}
+
+// conditionTree returns the condition of the rule as the root of a tree, so a single
+// operator and threshold is evaluated as a leaf comparing the value of the rule
+func conditionTree(condition *v1alpha1.Condition) v1alpha1.ConditionNode {
+	return v1alpha1.ConditionNode{
+		Operator:         condition.Operator,
+		Threshold:        condition.Threshold,
+		LowerThreshold:   condition.LowerThreshold,
+		UpperThreshold:   condition.UpperThreshold,
+		ResolveThreshold: condition.ResolveThreshold,
+		All:              condition.All,
+		Any:              condition.Any,
+		Not:              condition.Not,
+	}
+}
+
+// hasResolveThreshold tells whether a leaf or a level of the condition has a resolveThreshold
+func hasResolveThreshold(condition *v1alpha1.Condition) bool {
+	for _, severity := range condition.Severities {
+		if severity.ResolveThreshold != "" {
+			return true
+		}
+	}
+	return nodeHasResolveThreshold(conditionTree(condition))
+}
+
+// nodeHasResolveThreshold tells whether the node or one of its children has a resolveThreshold
+func nodeHasResolveThreshold(node v1alpha1.ConditionNode) bool {
+	if node.ResolveThreshold != "" {
+		return true
+	}
+	for _, children := range [][]v1alpha1.ConditionNode{node.All, node.Any} {
+		for _, child := range children {
+			if nodeHasResolveThreshold(child) {
+				return true
+			}
+		}
+	}
+	return node.Not != nil && nodeHasResolveThreshold(*node.Not)
+}
+
+// isCompoundCondition tells whether the condition is a tree of all, any and not nodes
+func isCompoundCondition(condition *v1alpha1.Condition) bool {
+	return condition.All != nil || condition.Any != nil || condition.Not != nil
+}
+
+// compiledCondition is the condition of a rule ready to be evaluated: either a tree of
+// nodes or a CEL program
+type compiledCondition struct {
+	tree       v1alpha1.ConditionNode
+	expression string
+	program    cel.Program
+
+	// levels are the severities of the condition, evaluated instead of the tree when set
+	levels []severityLevel
+
+	// buckets is set when the condition is evaluated on every bucket of an aggregation
+	buckets *v1alpha1.ConditionBuckets
+
+	// anomaly is evaluated instead of the tree when set
+	anomaly *anomalyDetector
+
+	// hysteresis is set when a leaf or a level of the condition has a resolveThreshold
+	hysteresis bool
+}
+
+// compileCondition checks the condition before the query runs, so a typo in a threshold or
+// an expression is reported once in the status of the rule rather than as a query error on
+// every evaluation. The CRD only validates the first level of the tree
+func compileCondition(condition *v1alpha1.Condition) (*compiledCondition, error) {
+
+	compiled, err := compileMatcher(condition)
+	if err != nil {
+		return nil, err
+	}
+	if condition.Buckets != nil {
+		if err := validateBuckets(condition.Buckets); err != nil {
+			return nil, fmt.Errorf("condition.buckets: %v", err)
+		}
+		compiled.buckets = condition.Buckets
+	}
+	compiled.hysteresis = hasResolveThreshold(condition)
+	return compiled, nil
+}
+
+// compileMatcher compiles what the condition compares: its anomaly detection, its severities,
+// its tree of nodes or its expression
+func compileMatcher(condition *v1alpha1.Condition) (*compiledCondition, error) {
+
+	if condition.Anomaly != nil {
+		detector, err := compileAnomaly(condition)
+		if err != nil {
+			return nil, err
+		}
+		return &compiledCondition{anomaly: detector}, nil
+	}
+
+	if len(condition.Severities) > 0 {
+		defaultFor, err := time.ParseDuration(condition.For)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition.for %q: %v", condition.For, err)
+		}
+		levels, err := compileSeverities(condition, defaultFor)
+		if err != nil {
+			return nil, err
+		}
+		return &compiledCondition{levels: levels}, nil
+	}
+
+	if condition.Expression == "" {
+		if condition.Operator == "" && !isCompoundCondition(condition) {
+			return nil, fmt.Errorf("condition defines none of operator, all, any, not, expression or anomaly")
+		}
+		tree := conditionTree(condition)
+		if err := validateConditionNode(tree, "condition"); err != nil {
+			return nil, err
+		}
+		return &compiledCondition{tree: tree}, nil
+	}
+
+	if condition.Operator != "" || isCompoundCondition(condition) {
+		return nil, fmt.Errorf("condition defines expression and one of operator, all, any or not")
+	}
+	if condition.ResolveThreshold != "" {
+		return nil, fmt.Errorf("resolveThreshold is not supported by expressions")
+	}
+	program, err := compileExpression(condition.Expression)
+	if err != nil {
+		return nil, fmt.Errorf("condition.expression: %v", err)
+	}
+	return &compiledCondition{expression: condition.Expression, program: program}, nil
+}
+
+// check evaluates the condition against the input, on the state of the rule or of the bucket
+// it comes from. It returns the evaluation of the severities when the condition has them
+func (c *compiledCondition) check(input conditionInput, state pools.RuleState) (bool, []pools.ConditionMatch, *severityEvaluation, error) {
+
+	// Once fired, the leaves with a resolveThreshold compare it instead of the threshold
+	input.fired = hasFired(state)
+
+	if c.anomaly != nil {
+		firing, matches := c.anomaly.check(input.value, input.bounds)
+		return firing, matches, nil, nil
+	}
+	if len(c.levels) > 0 {
+		severities, err := c.evaluateSeverities(input, state)
+		if err != nil {
+			return false, nil, nil, err
+		}
+		return severities.matching, severities.matches, severities, nil
+	}
+	firing, matches, err := c.evaluate(input)
+	return firing, matches, nil, err
+}
+
+// evaluate evaluates the condition against the response of the query, returning the
+// matched leaves. A firing expression is exposed as a single leaf holding it
+func (c *compiledCondition) evaluate(input conditionInput) (bool, []pools.ConditionMatch, error) {
+
+	if c.program == nil {
+		return evaluateCondition(c.tree, input)
+	}
+
+	firing, err := evaluateExpression(c.program, input)
+	if err != nil || !firing {
+		return false, nil, err
+	}
+	return true, []pools.ConditionMatch{{
+		Name:       conditionExpressionName,
+		Expression: c.expression,
+		Value:      input.value,
+	}}, nil
+}
+
+// validateConditionNode checks the node at path and its children
+func validateConditionNode(node v1alpha1.ConditionNode, path string) error {
+
+	defined := 0
+	for _, isSet := range []bool{node.Operator != "", node.All != nil, node.Any != nil, node.Not != nil} {
+		if isSet {
+			defined++
+		}
+	}
+	switch {
+	case defined == 0:
+		return fmt.Errorf("%s defines none of operator, all, any or not", path)
+	case defined > 1:
+		return fmt.Errorf("%s defines more than one of operator, all, any or not", path)
+	case node.Operator == "" && (node.Threshold != "" || node.LowerThreshold != "" ||
+		node.UpperThreshold != "" || node.ResolveThreshold != ""):
+		return fmt.Errorf("%s defines thresholds without operator", path)
+	}
+
+	switch {
+	case node.All != nil:
+		return validateConditionNodes(node.All, path+".all")
+	case node.Any != nil:
+		return validateConditionNodes(node.Any, path+".any")
+	case node.Not != nil:
+		return validateConditionNode(*node.Not, path+".not")
+	}
+
+	if err := validateLeaf(node); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// validateLeaf checks the operator of the leaf and the thresholds it uses
+func validateLeaf(node v1alpha1.ConditionNode) error {
+
+	if node.Operator == conditionBetween || node.Operator == conditionOutside {
+		if node.ResolveThreshold != "" {
+			return fmt.Errorf("resolveThreshold is not supported by the %s operator", node.Operator)
+		}
+		_, _, err := parseBounds(node.LowerThreshold, node.UpperThreshold)
+		return err
+	}
+
+	// Comparing a zero value checks the operator and the threshold
+	if _, err := compareValue(0, node.Operator, node.Threshold); err != nil {
+		return err
+	}
+	if node.ResolveThreshold == "" {
+		return nil
+	}
+
+	// The rule must be resolved on the far side of the threshold, or it would resolve while
+	// still matching it and fire again on the next evaluation
+	threshold, _ := strconv.ParseFloat(node.Threshold, 64)
+	resolveThreshold, err := strconv.ParseFloat(node.ResolveThreshold, 64)
+	if err != nil {
+		return fmt.Errorf("configured resolveThreshold is not a valid float: %v", node.ResolveThreshold)
+	}
+	switch node.Operator {
+	case conditionGreaterThan, conditionGreaterThanOrEqual:
+		if resolveThreshold > threshold {
+			return fmt.Errorf("resolveThreshold %v is greater than the threshold %v", resolveThreshold, threshold)
+		}
+	case conditionLessThan, conditionLessThanOrEqual:
+		if resolveThreshold < threshold {
+			return fmt.Errorf("resolveThreshold %v is less than the threshold %v", resolveThreshold, threshold)
+		}
+	default:
+		return fmt.Errorf("resolveThreshold is not supported by the %s operator", node.Operator)
+	}
+	return nil
+}
+
+// validateConditionNodes checks the children of an all or any node
+func validateConditionNodes(nodes []v1alpha1.ConditionNode, path string) error {
+	if len(nodes) == 0 {
+		return fmt.Errorf("%s is empty", path)
+	}
+	for i, node := range nodes {
+		if err := validateConditionNode(node, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evaluateCondition evaluates the node against the response of the query. It returns the
+// leaves matched to reach the result, exposed to the action templates: all of them for
+// an `all`, the ones that matched for an `any`, and none below a `not`, as it only holds
+// when its leaves do not match
+func evaluateCondition(node v1alpha1.ConditionNode, input conditionInput) (bool, []pools.ConditionMatch, error) {
+
+	switch {
+	case node.All != nil:
+		matches := []pools.ConditionMatch{}
+		for _, child := range node.All {
+			matched, childMatches, err := evaluateCondition(child, input)
+			if err != nil || !matched {
+				return false, nil, err
+			}
+			matches = append(matches, childMatches...)
+		}
+		return true, matches, nil
+
+	// Every child of an `any` is evaluated, so all of the matched leaves are exposed
+	case node.Any != nil:
+		firing := false
+		matches := []pools.ConditionMatch{}
+		for _, child := range node.Any {
+			matched, childMatches, err := evaluateCondition(child, input)
+			if err != nil {
+				return false, nil, err
+			}
+			if matched {
+				firing = true
+				matches = append(matches, childMatches...)
+			}
+		}
+		return firing, matches, nil
+
+	case node.Not != nil:
+		matched, _, err := evaluateCondition(*node.Not, input)
+		if err != nil {
+			return false, nil, err
+		}
+		return !matched, nil, nil
+	}
+
+	// Leaves without field compare the value of the rule
+	value := input.value
+	name := node.Name
+	if node.Field != "" {
+		var err error
+		value, err = backend.FieldValue(input.body, node.Field)
+		if err != nil {
+			return false, nil, err
+		}
+		if name == "" {
+			name = node.Field
+		}
+	}
+	if name == "" {
+		name = conditionValueName
+	}
+
+	match := pools.ConditionMatch{
+		Name:     name,
+		Field:    node.Field,
+		Operator: node.Operator,
+		Value:    value,
+	}
+	var matched bool
+	var err error
+	switch node.Operator {
+	case conditionBetween, conditionOutside:
+		match.LowerThreshold, match.UpperThreshold = node.LowerThreshold, node.UpperThreshold
+		matched, err = compareRange(value, node.Operator, node.LowerThreshold, node.UpperThreshold)
+	default:
+		match.Threshold = resolveThreshold(node, input.fired)
+		matched, err = compareValue(value, node.Operator, match.Threshold)
+	}
+	if err != nil || !matched {
+		return false, nil, err
+	}
+	return true, []pools.ConditionMatch{match}, nil
+}
+
+// resolveThreshold returns the threshold the leaf compares: its resolveThreshold once the
+// rule fired, when it has one, and its threshold otherwise
+func resolveThreshold(node v1alpha1.ConditionNode, fired bool) string {
+	if fired && node.ResolveThreshold != "" {
+		return node.ResolveThreshold
+	}
+	return node.Threshold
+}
+
+// compareRange tells whether the value is between the bounds, or outside of them, both
+// bounds included in the range
+func compareRange(value float64, operator, lowerThreshold, upperThreshold string) (bool, error) {
+
+	lower, upper, err := parseBounds(lowerThreshold, upperThreshold)
+	if err != nil {
+		return false, err
+	}
+	inside := value >= lower && value <= upper
+	return inside == (operator == conditionBetween), nil
+}
+
+// parseBounds parses the bounds of the range operators
+func parseBounds(lowerThreshold, upperThreshold string) (lower, upper float64, err error) {
+
+	lower, err = strconv.ParseFloat(lowerThreshold, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("configured lowerThreshold is not a valid float: %v", lowerThreshold)
+	}
+	upper, err = strconv.ParseFloat(upperThreshold, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("configured upperThreshold is not a valid float: %v", upperThreshold)
+	}
+	if lower > upper {
+		return 0, 0, fmt.Errorf("lowerThreshold %v is greater than upperThreshold %v", lower, upper)
+	}
+	return lower, upper, nil
+}
+
+// compareValue compares the value with the threshold using the operator
+func compareValue(value float64, operator string, threshold string) (bool, error) {
+
+	// Parse threshold to float
+	floatThreshold, err := strconv.ParseFloat(threshold, 64)
+	if err != nil {
+		return false, fmt.Errorf("configured threshold is not a valid float: %v", threshold)
+	}
+
+	// Evaluate condition
+	switch operator {
+	case conditionGreaterThan:
+		return value > floatThreshold, nil
+	case conditionGreaterThanOrEqual:
+		return value >= floatThreshold, nil
+	case conditionLessThan:
+		return value < floatThreshold, nil
+	case conditionLessThanOrEqual:
+		return value <= floatThreshold, nil
+	case conditionEqual:
+		return value == floatThreshold, nil
+	default:
+		return false, fmt.Errorf("unknown configured operator: %q", operator)
+	}
+}
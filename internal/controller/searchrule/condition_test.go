@@ -0,0 +1,392 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/backend"
+	"freepik.com/searchruler/internal/pools"
+)
+
+// leaf returns a condition node comparing the field
+func leaf(name, field, operator, threshold string) searchrulerv1alpha1.ConditionNode {
+	return searchrulerv1alpha1.ConditionNode{Name: name, Field: field, Operator: operator, Threshold: threshold}
+}
+
+func TestCompileCondition(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name      string
+		condition searchrulerv1alpha1.Condition
+		wantErr   string
+	}{
+		{
+			name:      "single operator",
+			condition: searchrulerv1alpha1.Condition{Operator: conditionGreaterThan, Threshold: "10"},
+		},
+		{
+			name: "nested tree",
+			condition: searchrulerv1alpha1.Condition{All: []searchrulerv1alpha1.ConditionNode{
+				leaf("errors", "hits.total", conditionGreaterThan, "100"),
+				{Any: []searchrulerv1alpha1.ConditionNode{
+					leaf("", "aggregations.ratio.value", conditionGreaterThan, "0.05"),
+					{Not: &searchrulerv1alpha1.ConditionNode{Operator: conditionEqual, Threshold: "0"}},
+				}},
+			}},
+		},
+		{
+			name:      "nothing defined",
+			condition: searchrulerv1alpha1.Condition{For: "1m"},
+			wantErr:   "condition defines none",
+		},
+		{
+			name: "operator and tree",
+			condition: searchrulerv1alpha1.Condition{Operator: conditionEqual, Threshold: "1",
+				Any: []searchrulerv1alpha1.ConditionNode{leaf("", "", conditionEqual, "1")}},
+			wantErr: "condition defines more than one",
+		},
+		{
+			name:      "empty all",
+			condition: searchrulerv1alpha1.Condition{All: []searchrulerv1alpha1.ConditionNode{}},
+			wantErr:   "condition.all is empty",
+		},
+		{
+			name: "wrong nested threshold",
+			condition: searchrulerv1alpha1.Condition{All: []searchrulerv1alpha1.ConditionNode{
+				leaf("", "", conditionEqual, "1"),
+				{Not: &searchrulerv1alpha1.ConditionNode{Any: []searchrulerv1alpha1.ConditionNode{
+					leaf("", "hits.total", conditionLessThan, "5%"),
+				}}},
+			}},
+			wantErr: "condition.all[1].not.any[0]: configured threshold is not a valid float",
+		},
+		{
+			name:      "expression",
+			condition: searchrulerv1alpha1.Condition{Expression: `response.aggregations.errors.doc_count / response.hits.total.value > 0.05`},
+		},
+		{
+			name:      "expression and operator",
+			condition: searchrulerv1alpha1.Condition{Expression: "value > 1", Operator: conditionEqual, Threshold: "1"},
+			wantErr:   "condition defines expression and one of",
+		},
+		{
+			name:      "expression not returning a bool",
+			condition: searchrulerv1alpha1.Condition{Expression: "value * 2.0"},
+			wantErr:   "condition.expression: expression returns double instead of bool",
+		},
+		{
+			name:      "expression with an unknown variable",
+			condition: searchrulerv1alpha1.Condition{Expression: "respons.took > 100"},
+			wantErr:   "undeclared reference to 'respons'",
+		},
+		{
+			name:      "range",
+			condition: searchrulerv1alpha1.Condition{Operator: conditionBetween, LowerThreshold: "10", UpperThreshold: "20"},
+		},
+		{
+			name:      "range with the bounds swapped",
+			condition: searchrulerv1alpha1.Condition{Operator: conditionOutside, LowerThreshold: "20", UpperThreshold: "10"},
+			wantErr:   "lowerThreshold 20 is greater than upperThreshold 10",
+		},
+		{
+			name:      "range without upper bound",
+			condition: searchrulerv1alpha1.Condition{Operator: conditionBetween, LowerThreshold: "10"},
+			wantErr:   "upperThreshold is not a valid float",
+		},
+		{
+			name:      "resolve threshold",
+			condition: searchrulerv1alpha1.Condition{Operator: conditionGreaterThan, Threshold: "100", ResolveThreshold: "80"},
+		},
+		{
+			name:      "resolve threshold on the firing side",
+			condition: searchrulerv1alpha1.Condition{Operator: conditionLessThan, Threshold: "10", ResolveThreshold: "5"},
+			wantErr:   "resolveThreshold 5 is less than the threshold 10",
+		},
+		{
+			name:      "resolve threshold of a range",
+			condition: searchrulerv1alpha1.Condition{Operator: conditionBetween, LowerThreshold: "1", UpperThreshold: "2", ResolveThreshold: "3"},
+			wantErr:   "resolveThreshold is not supported by the between operator",
+		},
+		{
+			name: "thresholds without operator",
+			condition: searchrulerv1alpha1.Condition{ResolveThreshold: "80",
+				All: []searchrulerv1alpha1.ConditionNode{leaf("", "", conditionEqual, "1")}},
+			wantErr: "condition defines thresholds without operator",
+		},
+		{
+			name:      "unknown operator",
+			condition: searchrulerv1alpha1.Condition{Not: &searchrulerv1alpha1.ConditionNode{Operator: "above", Threshold: "1"}},
+			wantErr:   "condition.not: unknown configured operator",
+		},
+	}
+	for _, tc := range cases {
+		_, err := compileCondition(&tc.condition)
+		if tc.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Errorf("%s: err = %v, want it to contain %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestEvaluateCondition(t *testing.T) {
+	t.Parallel()
+	input := conditionInput{
+		value: 150,
+		body:  []byte(`{"hits":{"total":{"value":150}},"aggregations":{"ratio":{"value":0.08},"latency":{"value":900}}}`),
+	}
+	errorsLeaf := leaf("errors", "hits.total", conditionGreaterThan, "100")
+	ratioLeaf := leaf("ratio", "aggregations.ratio.value", conditionGreaterThan, "0.05")
+	latencyLeaf := leaf("", "aggregations.latency.value", conditionGreaterThan, "1000")
+
+	cases := []struct {
+		name        string
+		condition   searchrulerv1alpha1.Condition
+		wantFiring  bool
+		wantMatches []pools.ConditionMatch
+	}{
+		{
+			name:        "single operator compares the value of the rule",
+			condition:   searchrulerv1alpha1.Condition{Operator: conditionGreaterThanOrEqual, Threshold: "150"},
+			wantFiring:  true,
+			wantMatches: []pools.ConditionMatch{{Name: "value", Operator: conditionGreaterThanOrEqual, Threshold: "150", Value: 150}},
+		},
+		{
+			name:       "all matching",
+			condition:  searchrulerv1alpha1.Condition{All: []searchrulerv1alpha1.ConditionNode{errorsLeaf, ratioLeaf}},
+			wantFiring: true,
+			wantMatches: []pools.ConditionMatch{
+				{Name: "errors", Field: "hits.total", Operator: conditionGreaterThan, Threshold: "100", Value: 150},
+				{Name: "ratio", Field: "aggregations.ratio.value", Operator: conditionGreaterThan, Threshold: "0.05", Value: 0.08},
+			},
+		},
+		{
+			name:      "all with a leaf not matching",
+			condition: searchrulerv1alpha1.Condition{All: []searchrulerv1alpha1.ConditionNode{errorsLeaf, latencyLeaf}},
+		},
+		{
+			name:       "any exposes only the matched leaves",
+			condition:  searchrulerv1alpha1.Condition{Any: []searchrulerv1alpha1.ConditionNode{latencyLeaf, ratioLeaf}},
+			wantFiring: true,
+			wantMatches: []pools.ConditionMatch{
+				{Name: "ratio", Field: "aggregations.ratio.value", Operator: conditionGreaterThan, Threshold: "0.05", Value: 0.08},
+			},
+		},
+		{
+			name: "not exposes no leaves",
+			condition: searchrulerv1alpha1.Condition{All: []searchrulerv1alpha1.ConditionNode{
+				errorsLeaf,
+				{Not: &latencyLeaf},
+			}},
+			wantFiring: true,
+			wantMatches: []pools.ConditionMatch{
+				{Name: "errors", Field: "hits.total", Operator: conditionGreaterThan, Threshold: "100", Value: 150},
+			},
+		},
+		{
+			name:      "not matching",
+			condition: searchrulerv1alpha1.Condition{Not: &errorsLeaf},
+		},
+	}
+	for _, tc := range cases {
+		firing, matches, err := evaluateCondition(conditionTree(&tc.condition), input)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		if firing != tc.wantFiring {
+			t.Errorf("%s: firing = %v, want %v", tc.name, firing, tc.wantFiring)
+		}
+		if tc.wantFiring && !reflect.DeepEqual(matches, tc.wantMatches) {
+			t.Errorf("%s: matches = %+v, want %+v", tc.name, matches, tc.wantMatches)
+		}
+	}
+
+	// A leaf reading a field missing in the response fails as a query error
+	missing := searchrulerv1alpha1.Condition{Any: []searchrulerv1alpha1.ConditionNode{ratioLeaf, leaf("", "aggregations.missing.value", conditionEqual, "1")}}
+	if _, _, err := evaluateCondition(conditionTree(&missing), input); !errors.Is(err, backend.ErrQuery) {
+		t.Errorf("missing field: err = %v, want a query error", err)
+	}
+}
+
+func TestBuildPromQLExpr_CompoundCondition(t *testing.T) {
+	t.Parallel()
+	rule := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+		r.Spec.Condition = searchrulerv1alpha1.Condition{For: "1m",
+			All: []searchrulerv1alpha1.ConditionNode{leaf("", "hits.total", conditionGreaterThan, "100")}}
+	})
+	if _, err := buildPromQLExpr(rule); err == nil {
+		t.Error("compound conditions must not be translated to PromQL")
+	}
+}
+
+func TestEvaluateExpression(t *testing.T) {
+	t.Parallel()
+	input := conditionInput{
+		value: 200,
+		body:  []byte(`{"took":12,"timed_out":false,"hits":{"total":{"value":1000}},"aggregations":{"errors":{"doc_count":80}}}`),
+	}
+	cases := []struct {
+		expression string
+		wantFiring bool
+		wantErr    bool
+	}{
+		{expression: `response.aggregations.errors.doc_count / response.hits.total.value > 0.05`, wantFiring: true},
+		{expression: `response.aggregations.errors.doc_count > 100 || response.timed_out`},
+		{expression: `value >= 200 && response.took < 50`, wantFiring: true},
+		{expression: `response.aggregations.missing.doc_count > 1`, wantErr: true},
+		{expression: `response.aggregations`, wantErr: true},
+	}
+	for _, tc := range cases {
+		condition, err := compileCondition(&searchrulerv1alpha1.Condition{Expression: tc.expression})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expression, err)
+		}
+		firing, matches, err := condition.evaluate(input)
+		if tc.wantErr {
+			if !errors.Is(err, backend.ErrQuery) {
+				t.Errorf("%s: err = %v, want a query error", tc.expression, err)
+			}
+			continue
+		}
+		if err != nil || firing != tc.wantFiring {
+			t.Errorf("%s: firing = %v, err = %v, want %v", tc.expression, firing, err, tc.wantFiring)
+		}
+		if firing && (len(matches) != 1 || matches[0].Expression != tc.expression || matches[0].Value != input.value) {
+			t.Errorf("%s: matches = %+v", tc.expression, matches)
+		}
+	}
+}
+
+func TestEvaluateCondition_RangesAndHysteresis(t *testing.T) {
+	t.Parallel()
+	hysteresis := searchrulerv1alpha1.Condition{Operator: conditionGreaterThan, Threshold: "100", ResolveThreshold: "80"}
+	cases := []struct {
+		name       string
+		condition  searchrulerv1alpha1.Condition
+		value      float64
+		fired      bool
+		wantFiring bool
+	}{
+		{"between includes the bounds", searchrulerv1alpha1.Condition{Operator: conditionBetween, LowerThreshold: "10", UpperThreshold: "20"}, 20, false, true},
+		{"between", searchrulerv1alpha1.Condition{Operator: conditionBetween, LowerThreshold: "10", UpperThreshold: "20"}, 21, false, false},
+		{"outside", searchrulerv1alpha1.Condition{Operator: conditionOutside, LowerThreshold: "10", UpperThreshold: "20"}, 9, false, true},
+		{"outside excludes the bounds", searchrulerv1alpha1.Condition{Operator: conditionOutside, LowerThreshold: "10", UpperThreshold: "20"}, 10, false, false},
+		{"under the threshold before firing", hysteresis, 90, false, false},
+		{"over the resolve threshold once fired", hysteresis, 90, true, true},
+		{"under the resolve threshold once fired", hysteresis, 79, true, false},
+	}
+	for _, tc := range cases {
+		firing, matches, err := evaluateCondition(conditionTree(&tc.condition), conditionInput{value: tc.value, fired: tc.fired})
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		if firing != tc.wantFiring {
+			t.Errorf("%s: firing = %v, want %v", tc.name, firing, tc.wantFiring)
+		}
+		if tc.fired && firing && matches[0].Threshold != "80" {
+			t.Errorf("%s: matched threshold %q, want the resolve threshold", tc.name, matches[0].Threshold)
+		}
+	}
+}
+
+func TestHasFired(t *testing.T) {
+	t.Parallel()
+	firingTime := time.Now().Add(-time.Hour)
+	cases := []struct {
+		state pools.RuleState
+		want  bool
+	}{
+		{pools.RuleState{State: RuleNormalState}, false},
+		{pools.RuleState{State: RulePendingFiringState, FiringTime: firingTime}, false},
+		{pools.RuleState{State: RuleFiringState, FiringTime: firingTime}, true},
+		{pools.RuleState{State: RulePendingResolvedState, FiringTime: firingTime}, true},
+		{pools.RuleState{State: RulePendingResolvedState}, false},
+	}
+	for _, tc := range cases {
+		if got := hasFired(tc.state); got != tc.want {
+			t.Errorf("hasFired(%s, firingTime %v) = %v, want %v", tc.state.State, tc.state.FiringTime, got, tc.want)
+		}
+	}
+}
+
+func TestAdvanceState_Hysteresis(t *testing.T) {
+	t.Parallel()
+	firingTime := time.Now().Add(-time.Hour)
+	resolvingTime := time.Now().Add(-time.Second)
+	plain := searchrulerv1alpha1.Condition{Operator: conditionGreaterThan, Threshold: "100", For: "1m"}
+	hysteresis := searchrulerv1alpha1.Condition{Operator: conditionGreaterThan, Threshold: "100", ResolveThreshold: "80", For: "1m"}
+	cases := []struct {
+		name           string
+		condition      searchrulerv1alpha1.Condition
+		state          pools.RuleState
+		firing         bool
+		wantState      string
+		wantNotify     bool
+		wantFiringTime bool
+	}{
+		{
+			name:      "plain rule matching again while resolving is pending again",
+			condition: plain,
+			state:     pools.RuleState{State: RulePendingResolvedState, FiringTime: firingTime, ResolvingTime: resolvingTime},
+			firing:    true,
+			wantState: RulePendingFiringState,
+		},
+		{
+			name:           "rule with resolveThreshold matching again while resolving keeps firing",
+			condition:      hysteresis,
+			state:          pools.RuleState{State: RulePendingResolvedState, FiringTime: firingTime, ResolvingTime: resolvingTime},
+			firing:         true,
+			wantState:      RuleFiringState,
+			wantNotify:     true,
+			wantFiringTime: true,
+		},
+		{
+			name:           "plain rule resolving before it fired keeps its firingTime",
+			condition:      plain,
+			state:          pools.RuleState{State: RulePendingFiringState, FiringTime: firingTime},
+			wantState:      RulePendingResolvedState,
+			wantFiringTime: true,
+		},
+		{
+			name:      "rule with resolveThreshold resolving before it fired forgets its firingTime",
+			condition: hysteresis,
+			state:     pools.RuleState{State: RulePendingFiringState, FiringTime: firingTime},
+			wantState: RulePendingResolvedState,
+		},
+	}
+	for _, tc := range cases {
+		condition, err := compileCondition(&tc.condition)
+		if err != nil {
+			t.Fatalf("%s: compileCondition: %v", tc.name, err)
+		}
+		state := tc.state
+		step := condition.advanceState(&state, tc.firing, nil, time.Minute)
+		if state.State != tc.wantState || step.notify != tc.wantNotify {
+			t.Errorf("%s: state = %s, notify = %v, want %s and %v", tc.name, state.State, step.notify, tc.wantState, tc.wantNotify)
+		}
+		if state.FiringTime.Equal(firingTime) != tc.wantFiringTime {
+			t.Errorf("%s: firingTime = %v, want the previous one kept: %v", tc.name, state.FiringTime, tc.wantFiringTime)
+		}
+	}
+}
@@ -29,14 +29,21 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	runtimecontroller "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	//
 	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
 	"freepik.com/searchruler/internal/controller"
 	"freepik.com/searchruler/internal/pools"
+	"freepik.com/searchruler/internal/scheduler"
+	"freepik.com/searchruler/internal/sharding"
 )
 
 // SearchRuleReconciler reconciles a SearchRule object
@@ -47,6 +54,10 @@ type SearchRuleReconciler struct {
 	RulesPool                     *pools.RulesStore
 	AlertsPool                    *pools.AlertsStore
 
+	// QueryResultsPool keeps the responses obtained for a rule in the `_msearch`
+	// batch of another one, until the rule is evaluated
+	QueryResultsPool *pools.QueryResultsStore
+
 	// PrometheusRuleSupported indicates whether the cluster has the
 	// monitoring.coreos.com/v1 PrometheusRule CRD installed. Detected once at
 	// boot time. When false, SearchRules that opt into spec.prometheusRule are
@@ -60,6 +71,25 @@ type SearchRuleReconciler struct {
 	// not exposed; we still create them but flag the SearchRule status with a
 	// MetricsNotExposed condition so the user can spot the misconfiguration.
 	MetricsExposed bool
+
+	// Shard tells which SearchRules this replica evaluates, when they are sharded across the
+	// replicas of the operator. Nil when every rule is evaluated by the leader
+	Shard *sharding.Shard
+
+	// Scheduler evaluates the rules every checkInterval, or at the times of their schedule.
+	// Reconciling a rule only updates its schedule, so retries and status updates do not move
+	// its evaluations. Built on setup from EvaluationWorkers and EvaluationMaxJitter when not set
+	Scheduler *scheduler.Scheduler
+
+	// EvaluationWorkers is how many rules are evaluated at the same time
+	EvaluationWorkers int
+
+	// EvaluationMaxJitter caps the offset spreading the evaluations of the rules with the same
+	// checkInterval
+	EvaluationMaxJitter time.Duration
+
+	// MaxConcurrentReconciles is how many SearchRules are reconciled at the same time
+	MaxConcurrentReconciles int
 }
 
 // +kubebuilder:rbac:groups=searchruler.freepik.com,resources=searchrules,verbs=get;list;watch;create;update;patch;delete
@@ -101,13 +131,17 @@ func (r *SearchRuleReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		if controllerutil.ContainsFinalizer(searchRuleResource, controller.ResourceFinalizer) {
 
 			// 3.1 Delete the resources associated with the SearchRule
+			r.Scheduler.Unschedule(req.NamespacedName)
 			err = r.Sync(ctx, watch.Deleted, searchRuleResource)
 
-			// Remove the finalizers on Patch CR
-			controllerutil.RemoveFinalizer(searchRuleResource, controller.ResourceFinalizer)
-			err = r.Update(ctx, searchRuleResource)
-			if err != nil {
-				logger.Info(fmt.Sprintf(controller.ResourceFinalizersUpdateError, controller.SearchRuleResourceType, req.NamespacedName, err.Error()))
+			// Remove the finalizers on Patch CR. When the rules are sharded, every replica
+			// drops the rule from its pools but only its owner removes the finalizer
+			if r.ownsRule(searchRuleResource) {
+				controllerutil.RemoveFinalizer(searchRuleResource, controller.ResourceFinalizer)
+				err = r.Update(ctx, searchRuleResource)
+				if err != nil {
+					logger.Info(fmt.Sprintf(controller.ResourceFinalizersUpdateError, controller.SearchRuleResourceType, req.NamespacedName, err.Error()))
+				}
 			}
 		}
 
@@ -116,7 +150,13 @@ func (r *SearchRuleReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return result, err
 	}
 
-	// 4. Add finalizer to the SearchRule CR
+	// 4. Rules owned by another replica are handed off to it, and not evaluated here
+	if !r.ownsRule(searchRuleResource) {
+		r.Scheduler.Unschedule(req.NamespacedName)
+		return result, r.releaseRule(ctx, searchRuleResource)
+	}
+
+	// 5. Add finalizer to the SearchRule CR
 	if !controllerutil.ContainsFinalizer(searchRuleResource, controller.ResourceFinalizer) {
 		controllerutil.AddFinalizer(searchRuleResource, controller.ResourceFinalizer)
 		err = r.Update(ctx, searchRuleResource)
@@ -125,10 +165,11 @@ func (r *SearchRuleReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		}
 	}
 
-	// 5. Update the status before the requeue. We must not overwrite the
+	// 6. Update the status before returning. We must not overwrite the
 	// outer `err` here, otherwise a transient PrometheusRule/Sync failure
 	// would be hidden by a successful status update and the controller
-	// would not retry until the spec changes.
+	// would not retry until the spec changes. Evaluations write the status
+	// on their own, only when they change it.
 	defer func() {
 		if statusErr := r.Status().Update(ctx, searchRuleResource); statusErr != nil {
 			logger.Info(fmt.Sprintf(controller.ResourceConditionUpdateError, controller.SearchRuleResourceType, req.NamespacedName, statusErr.Error()))
@@ -138,7 +179,7 @@ func (r *SearchRuleReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		}
 	}()
 
-	// 6. Validate spec.customMetrics regardless of whether prometheusRule is
+	// 7. Validate spec.customMetrics regardless of whether prometheusRule is
 	// enabled. The metrics goroutine will try to register a GaugeVec for
 	// every entry on each refresh tick; a malformed name or label there
 	// would only land in logs. Surfacing the issue as a status condition
@@ -156,7 +197,7 @@ func (r *SearchRuleReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		r.UpdateConditionPrometheusRuleCustomMetricsInvalid(searchRuleResource, customMetricsErr.Error())
 	}
 
-	// 7. Reconcile the auto-generated PrometheusRule first so a transition
+	// 8. Reconcile the auto-generated PrometheusRule first so a transition
 	// from "enabled" to "disabled" (or to "no outputs at all") deletes the
 	// existing PrometheusRule before any short-circuit return below. If we
 	// returned earlier on MissingOutput, a previously-created PrometheusRule
@@ -178,17 +219,18 @@ func (r *SearchRuleReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			req.NamespacedName, prErr.Error()))
 	}
 
-	// 7. Validate that at least one output is defined. A SearchRule whose only
+	// 8. Validate that at least one output is defined. A SearchRule whose only
 	// purpose is to update its own status (without actionRef and without an
 	// enabled prometheusRule) silently produces nothing useful, so flag it.
 	// A non-nil but disabled prometheusRule does not count as an output.
 	hasPromRule := searchRuleResource.Spec.PrometheusRule != nil &&
 		searchRuleResource.Spec.PrometheusRule.Enabled
 	if searchRuleResource.Spec.ActionRef == nil && !hasPromRule {
-		// Drop any in-flight alert for this rule. Without this, removing
-		// actionRef on a firing SearchRule would leave a stale entry in the
-		// AlertsPool (Sync never runs because of the early return below) and
-		// the RulerAction controller would keep delivering it.
+		// Drop any in-flight alert for this rule and stop evaluating it.
+		// Without this, removing actionRef on a firing SearchRule would leave
+		// a stale entry in the AlertsPool (Sync never runs once unscheduled)
+		// and the RulerAction controller would keep delivering it.
+		r.Scheduler.Unschedule(req.NamespacedName)
 		r.AlertsPool.Delete(fmt.Sprintf("%s_%s",
 			searchRuleResource.Namespace, searchRuleResource.Name))
 		r.UpdateConditionMissingOutput(searchRuleResource)
@@ -196,28 +238,16 @@ func (r *SearchRuleReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			searchRuleResource.Namespace, searchRuleResource.Name))
 	}
 
-	// 8. Schedule periodical request
-	RequeueTime, err := time.ParseDuration(searchRuleResource.Spec.CheckInterval)
+	// 9. Schedule the evaluations of the rule. The scheduler checks the rule
+	// and keeps its state in the status, so it is not evaluated here. Rules
+	// with an invalid schedule are not evaluated until it is fixed
+	err = r.scheduleRule(searchRuleResource)
 	if err != nil {
+		r.Scheduler.Unschedule(req.NamespacedName)
+		r.UpdateConditionInvalidSchedule(searchRuleResource, err.Error())
 		logger.Info(fmt.Sprintf(controller.ResourceSyncTimeRetrievalError, controller.SearchRuleResourceType, req.NamespacedName, err.Error()))
 		return result, errors.Join(prErr, err)
 	}
-	result = ctrl.Result{
-		RequeueAfter: RequeueTime,
-	}
-
-	// 9. Check the rule
-	syncErr := r.Sync(ctx, watch.Modified, searchRuleResource)
-	if syncErr != nil {
-		r.UpdateConditionKubernetesApiCallFailure(searchRuleResource)
-		logger.Info(fmt.Sprintf(controller.SyncTargetError, controller.SearchRuleResourceType, req.NamespacedName, syncErr.Error()))
-		return result, errors.Join(prErr, syncErr)
-	}
-
-	// 10. Success, update the status (only when neither path failed)
-	if prErr == nil {
-		r.UpdateConditionSuccess(searchRuleResource)
-	}
 
 	return result, prErr
 
@@ -225,14 +255,42 @@ func (r *SearchRuleReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *SearchRuleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+
+	// The scheduler runs on every replica, and only evaluates the rules its reconciler scheduled
+	if r.Scheduler == nil {
+		r.Scheduler = scheduler.New(r.evaluate, scheduler.Options{
+			Workers:   r.EvaluationWorkers,
+			MaxJitter: r.EvaluationMaxJitter,
+		})
+	}
+	if err := mgr.Add(r.Scheduler); err != nil {
+		return err
+	}
+	if err := metrics.Registry.Register(r.Scheduler); err != nil {
+		return err
+	}
+
+	options := runtimecontroller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}
 	b := ctrl.NewControllerManagedBy(mgr).
 		For(&searchrulerv1alpha1.SearchRule{}).
 		WithEventFilter(predicate.GenerationChangedPredicate{}).
 		Named("searchrule")
+
+	// Sharded rules are evaluated by every replica, and all of them are reconciled again when
+	// the members of the shard change, to hand off the ones moving to another replica
+	if r.Shard != nil {
+		needLeaderElection := false
+		options.NeedLeaderElection = &needLeaderElection
+		rebalance := make(chan event.GenericEvent)
+		r.Shard.OnChange(func() {
+			go r.enqueueRules(context.Background(), rebalance)
+		})
+		b = b.WatchesRawSource(source.Channel(rebalance, &handler.EnqueueRequestForObject{}))
+	}
 	// Only watch PrometheusRule when the CRD exists, otherwise controller-runtime
 	// will fail to set up the informer with a NoMatch error.
 	if r.PrometheusRuleSupported {
 		b = b.Owns(&monitoringv1.PrometheusRule{}, builder.MatchEveryOwner)
 	}
-	return b.Complete(r)
+	return b.WithOptions(options).Complete(r)
 }
@@ -0,0 +1,155 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	//
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/backend"
+	"freepik.com/searchruler/internal/connector"
+	"freepik.com/searchruler/internal/controller"
+	"freepik.com/searchruler/internal/pools"
+)
+
+const (
+
+	// What the noDataState and execErrorState of a rule make of a failed evaluation
+	errorStateKeepLast = "KeepLast"
+	errorStateAlerting = "Alerting"
+	errorStateNormal   = "Normal"
+	errorStateNoData   = "NoData"
+	errorStateError    = "Error"
+
+	// Names of the dedicated alerts of the NoData and Error states, the ones used by Grafana
+	alertNameNoData = "DatasourceNoData"
+	alertNameError  = "DatasourceError"
+
+	// kubeEvent
+	kubeEventReasonAlertNoData = "AlertNoData"
+	kubeEventReasonAlertError  = "AlertError"
+)
+
+// errorState returns the state the rule takes for the error of its evaluation, and whether the
+// error is a response without data
+func errorState(resource *v1alpha1.SearchRule, err error) (state string, noData bool) {
+
+	noData = errors.Is(err, backend.ErrNoData)
+	state = resource.Spec.ExecErrorState
+	if noData {
+		state = resource.Spec.NoDataState
+	}
+	if state == "" {
+		state = errorStateKeepLast
+	}
+	return state, noData
+}
+
+// applyErrorState handles the evaluation of the rule that failed with evalErr. The Alerting and
+// Normal states return an evaluation matching or not matching the condition, which moves the
+// rule through its states with the last values it had. The other states leave the state of
+// the rule as it is and return evalErr, after firing the dedicated alert of the NoData and
+// Error states
+func (r *SearchRuleReconciler) applyErrorState(ctx context.Context, resource *v1alpha1.SearchRule,
+	ruleKey string, previousRule pools.Rule, evalErr error) (*ruleEvaluation, error) {
+
+	logger := log.FromContext(ctx)
+
+	// Queries rejected by the limits of the QueryConnector never ran, so they tell nothing
+	if errors.Is(evalErr, connector.ErrThrottled) {
+		return nil, evalErr
+	}
+
+	state, noData := errorState(resource, evalErr)
+	switch state {
+	case errorStateAlerting, errorStateNormal:
+		r.deleteErrorAlerts(ruleKey)
+		logger.Info(fmt.Sprintf("Rule %s is evaluated as %s after a failed evaluation: %v", resource.Name, state, evalErr))
+
+		// Known buckets keep firing when alerting, and resolve otherwise
+		evaluation := &ruleEvaluation{
+			value:        previousRule.Value,
+			aggregations: previousRule.Aggregations,
+			comparison:   previousRule.Comparison,
+			anomaly:      previousRule.Anomaly,
+			firing:       state == errorStateAlerting,
+		}
+		if evaluation.firing {
+			for key, bucketState := range previousRule.Buckets {
+				evaluation.buckets = append(evaluation.buckets, bucketEvaluation{
+					bucket: bucket{key: key, labels: bucketState.Labels, value: bucketState.Value},
+					firing: true,
+				})
+			}
+		}
+		return evaluation, nil
+
+	case errorStateNoData, errorStateError:
+		if err := r.notifyErrorAlert(ctx, resource, ruleKey, noData, evalErr); err != nil {
+			return nil, err
+		}
+	default:
+		r.deleteErrorAlerts(ruleKey)
+	}
+	return nil, evalErr
+}
+
+// notifyErrorAlert enqueues the DatasourceNoData or DatasourceError alert of the rule. It is
+// labeled with its own alertname, so it is told apart from the alert of the condition
+func (r *SearchRuleReconciler) notifyErrorAlert(ctx context.Context, resource *v1alpha1.SearchRule,
+	ruleKey string, noData bool, evalErr error) error {
+
+	alertName, reason, otherName := alertNameError, kubeEventReasonAlertError, alertNameNoData
+	if noData {
+		alertName, reason, otherName = alertNameNoData, kubeEventReasonAlertNoData, alertNameError
+	}
+	r.AlertsPool.Delete(errorAlertKey(ruleKey, otherName))
+	if resource.Spec.ActionRef == nil {
+		r.AlertsPool.Delete(errorAlertKey(ruleKey, alertName))
+		return nil
+	}
+
+	r.AlertsPool.Set(errorAlertKey(ruleKey, alertName), &pools.Alert{
+		RulerActionName: resource.Spec.ActionRef.Name,
+		SearchRule:      *resource,
+		Labels:          map[string]string{"alertname": alertName, "rulename": resource.Name},
+		Error:           evalErr.Error(),
+	})
+
+	err := createKubeEvent(ctx, *resource, reason, fmt.Sprintf("Rule %s is firing %s: %v", resource.Name, alertName, evalErr))
+	if err != nil {
+		return fmt.Errorf(controller.KubeEventCreationErrorMessage, err)
+	}
+	return nil
+}
+
+// deleteErrorAlerts resolves the DatasourceNoData and DatasourceError alerts of the rule
+func (r *SearchRuleReconciler) deleteErrorAlerts(ruleKey string) {
+	r.AlertsPool.Delete(errorAlertKey(ruleKey, alertNameNoData))
+	r.AlertsPool.Delete(errorAlertKey(ruleKey, alertNameError))
+}
+
+// errorAlertKey returns the key of a dedicated alert of the rule in the alerts pool
+func errorAlertKey(ruleKey, alertName string) string {
+	return ruleKey + "/" + alertName
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/backend"
+	"freepik.com/searchruler/internal/connector"
+	"freepik.com/searchruler/internal/pools"
+)
+
+func TestErrorState(t *testing.T) {
+	t.Parallel()
+	resource := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+		r.Spec.NoDataState = errorStateNoData
+		r.Spec.ExecErrorState = errorStateAlerting
+	})
+	cases := []struct {
+		name       string
+		err        error
+		wantState  string
+		wantNoData bool
+	}{
+		{name: "no data", err: fmt.Errorf("%w: conditionField not found", backend.ErrNoData), wantState: errorStateNoData, wantNoData: true},
+		{name: "rejected query", err: fmt.Errorf("%w: parsing_exception", backend.ErrQuery), wantState: errorStateAlerting},
+		{name: "unreachable", err: fmt.Errorf("%w: refused", backend.ErrConnection), wantState: errorStateAlerting},
+	}
+	for _, tc := range cases {
+		state, noData := errorState(resource, tc.err)
+		if state != tc.wantState || noData != tc.wantNoData {
+			t.Errorf("%s: state = %s, noData = %v, want %s and %v", tc.name, state, noData, tc.wantState, tc.wantNoData)
+		}
+	}
+
+	if state, _ := errorState(newSearchRule(nil), backend.ErrNoData); state != errorStateKeepLast {
+		t.Errorf("default state = %s, want %s", state, errorStateKeepLast)
+	}
+}
+
+func TestApplyErrorState(t *testing.T) {
+	t.Parallel()
+	previousRule := pools.Rule{
+		RuleState: pools.RuleState{State: RuleFiringState},
+		Value:     120,
+		Buckets: map[string]pools.BucketState{
+			`service="api"`: {RuleState: pools.RuleState{State: RuleFiringState}, Labels: map[string]string{"service": "api"}, Value: 500},
+		},
+	}
+	noData := fmt.Errorf("%w: conditionField not found", backend.ErrNoData)
+
+	cases := []struct {
+		name        string
+		state       string
+		err         error
+		wantErr     bool
+		wantFiring  bool
+		wantBuckets int
+	}{
+		{name: "keep last", state: errorStateKeepLast, err: noData, wantErr: true},
+		{name: "alerting", state: errorStateAlerting, err: noData, wantFiring: true, wantBuckets: 1},
+		{name: "normal", state: errorStateNormal, err: noData},
+		{name: "no data alert without actionRef", state: errorStateNoData, err: noData, wantErr: true},
+		{name: "throttled keeps the last state", state: errorStateAlerting, err: connector.ErrThrottled, wantErr: true},
+	}
+	for _, tc := range cases {
+		r := &SearchRuleReconciler{AlertsPool: &pools.AlertsStore{Store: map[string]*pools.Alert{}}}
+		r.AlertsPool.Set(errorAlertKey("default_demo", alertNameError), &pools.Alert{})
+		resource := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+			r.Spec.NoDataState = tc.state
+			r.Spec.ExecErrorState = tc.state
+		})
+
+		evaluation, err := r.applyErrorState(context.Background(), resource, "default_demo", previousRule, tc.err)
+		if tc.wantErr {
+			if !errors.Is(err, tc.err) || evaluation != nil {
+				t.Errorf("%s: evaluation = %+v, error = %v, want the error back", tc.name, evaluation, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		if evaluation.firing != tc.wantFiring || len(evaluation.buckets) != tc.wantBuckets || evaluation.value != 120 {
+			t.Errorf("%s: evaluation = %+v, want firing %v with the last value", tc.name, evaluation, tc.wantFiring)
+		}
+		if _, exists := r.AlertsPool.Get(errorAlertKey("default_demo", alertNameError)); exists {
+			t.Errorf("%s: the DatasourceError alert was not resolved", tc.name)
+		}
+	}
+}
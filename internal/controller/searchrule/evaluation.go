@@ -0,0 +1,131 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/backend"
+	"freepik.com/searchruler/internal/controller"
+	"freepik.com/searchruler/internal/pools"
+)
+
+// ruleEvaluation is the result of evaluating the condition of a rule on the response of its
+// query, or the one decided by its noDataState or execErrorState when the evaluation failed
+type ruleEvaluation struct {
+	value        float64
+	aggregations interface{}
+	comparison   *pools.Comparison
+	anomaly      *pools.AnomalyState
+
+	// firing, matches and severities are the evaluation of the rule, and buckets the one
+	// of every bucket for the conditions evaluated per bucket
+	firing     bool
+	matches    []pools.ConditionMatch
+	severities *severityEvaluation
+	buckets    []bucketEvaluation
+}
+
+// evaluateRule runs the query of the rule, and the one of its baseline if compared with it,
+// and evaluates the condition on the response. The errors wrap the ones of the backend, so
+// the caller can tell what failed
+func (r *SearchRuleReconciler) evaluateRule(ctx context.Context, resource *v1alpha1.SearchRule,
+	conn *backend.Connector, queryBackend backend.Backend, condition *compiledCondition,
+	ruleComparison *comparison, previousRule pools.Rule) (*ruleEvaluation, error) {
+
+	// The query is rendered for the window of this evaluation: the checkInterval ending now,
+	// or the current window of the comparison with a baseline
+	now := time.Now()
+	currentWindow, err := evaluationWindow(resource, now)
+	if err != nil {
+		return nil, err
+	}
+	var baselineWindow queryWindow
+	if ruleComparison != nil {
+		currentWindow, baselineWindow = ruleComparison.windows(now)
+	}
+	queryResource, err := renderQuery(resource, currentWindow, previousRule.LastEvaluationTime)
+	if err != nil {
+		return nil, err
+	}
+
+	// Run the query, alone or batched with the rules due soon on the same QueryConnector. The
+	// backends taking the time as a parameter evaluate it at the time it was rendered for
+	responseBody, err := r.executeQuery(backend.WithEvaluationTime(ctx, now), queryResource, conn, queryBackend)
+	if err != nil {
+		return nil, err
+	}
+
+	// Extract the value for the condition and the aggregations from the response
+	queryResult, err := queryBackend.Extract(queryResource, responseBody)
+	if err != nil {
+		return nil, err
+	}
+	evaluation := &ruleEvaluation{value: queryResult.Value, aggregations: queryResult.Aggregations}
+
+	// The condition of a rule compared with a baseline is evaluated on the change from the
+	// value of the baseline window to the current one
+	evaluatedValue := evaluation.value
+	if ruleComparison != nil {
+		baselineValue, err := r.queryBaseline(ctx, resource, conn, queryBackend, baselineWindow, previousRule.LastEvaluationTime)
+		if err != nil {
+			return nil, err
+		}
+		evaluation.comparison = &pools.Comparison{
+			Baseline: baselineValue,
+			Change:   ruleComparison.compare(evaluation.value, baselineValue),
+		}
+		evaluatedValue = evaluation.comparison.Change
+	}
+
+	// Anomaly conditions compare the value with the bounds learned from the previous ones,
+	// and learn it then
+	var anomalyBounds *pools.AnomalyBounds
+	if condition.anomaly != nil {
+		anomalyBounds = condition.anomaly.bounds(previousRule.Anomaly)
+		evaluation.anomaly = condition.anomaly.learn(previousRule.Anomaly, evaluation.value)
+		evaluation.anomaly.Bounds = anomalyBounds
+	}
+
+	// Evaluate condition and check if the alert is firing or not, once for the rule or once
+	// for every bucket of the aggregation
+	if condition.buckets != nil {
+		var buckets []bucket
+		buckets, err = extractBuckets(evaluation.aggregations, condition.buckets)
+		if err == nil {
+			evaluation.buckets, err = condition.evaluateBuckets(buckets, previousRule.Buckets)
+		}
+	} else {
+		evaluation.firing, evaluation.matches, evaluation.severities, err = condition.check(conditionInput{
+			value:  evaluatedValue,
+			body:   responseBody,
+			bounds: anomalyBounds,
+		}, previousRule.RuleState)
+	}
+	if err != nil {
+		if !errors.Is(err, backend.ErrQuery) {
+			err = fmt.Errorf("%w: %v", backend.ErrQuery, err)
+		}
+		return nil, fmt.Errorf(controller.EvaluatingConditionErrorMessage, err)
+	}
+	return evaluation, nil
+}
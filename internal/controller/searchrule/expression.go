@@ -0,0 +1,91 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	//
+	"github.com/google/cel-go/cel"
+
+	//
+	"freepik.com/searchruler/internal/backend"
+	"freepik.com/searchruler/internal/controller"
+)
+
+const (
+
+	// Variables available to the CEL expressions of the conditions
+	expressionResponseVariable = "response"
+	expressionValueVariable    = "value"
+)
+
+// expressionEnvironment declares the variables of the expressions. It is built once and only
+// read after that, so it is shared by every rule. The response is dynamic, as its fields
+// depend on the query, and numbers of different types compare as in the JSON they come from
+var expressionEnvironment = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable(expressionResponseVariable, cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable(expressionValueVariable, cel.DoubleType),
+		cel.CrossTypeNumericComparisons(true),
+	)
+})
+
+// compileExpression parses and type-checks the expression, which must return a bool
+func compileExpression(expression string) (cel.Program, error) {
+
+	env, err := expressionEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if outputType := ast.OutputType(); !outputType.IsExactType(cel.BoolType) && !outputType.IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("expression returns %s instead of bool", outputType)
+	}
+
+	return env.Program(ast)
+}
+
+// evaluateExpression runs the program against the response of the query. Fields missing in
+// the response fail at this point, as they are unknown until the query runs
+func evaluateExpression(program cel.Program, input conditionInput) (bool, error) {
+
+	response := map[string]interface{}{}
+	if err := json.Unmarshal(input.body, &response); err != nil {
+		return false, fmt.Errorf("%w: "+controller.JSONMarshalErrorMessage, backend.ErrQuery, err)
+	}
+
+	result, _, err := program.Eval(map[string]interface{}{
+		expressionResponseVariable: response,
+		expressionValueVariable:    input.value,
+	})
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", backend.ErrQuery, err)
+	}
+
+	firing, ok := result.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: expression returned %v instead of a bool", backend.ErrQuery, result.Value())
+	}
+	return firing, nil
+}
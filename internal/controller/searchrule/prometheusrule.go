@@ -102,16 +102,10 @@ func (r *SearchRuleReconciler) reconcilePrometheusRule(ctx context.Context, rule
 	// it covers SearchRules that opt out of prometheusRule too. By the
 	// time we are here, every cm.Validate() has already passed.
 
-	expr, err := buildPromQLExpr(rule)
+	alertingRules, err := buildAlertingRules(rule)
 	if err != nil {
 		r.UpdateConditionPrometheusRuleError(rule, err.Error())
-		return fmt.Errorf("failed to build PromQL expression: %w", err)
-	}
-
-	forDuration, err := parsePromDuration(rule.Spec.Condition.For)
-	if err != nil {
-		r.UpdateConditionPrometheusRuleError(rule, err.Error())
-		return fmt.Errorf("failed to parse condition.for: %w", err)
+		return err
 	}
 
 	// Refuse to adopt a PrometheusRule that already exists with a different
@@ -147,7 +141,7 @@ func (r *SearchRuleReconciler) reconcilePrometheusRule(ctx context.Context, rule
 		pr.Spec = monitoringv1.PrometheusRuleSpec{
 			Groups: []monitoringv1.RuleGroup{{
 				Name:  promRuleGroupName,
-				Rules: []monitoringv1.Rule{buildAlertingRule(rule, expr, forDuration)},
+				Rules: alertingRules,
 			}},
 		}
 		return nil
@@ -184,7 +178,51 @@ func (r *SearchRuleReconciler) reconcilePrometheusRule(ctx context.Context, rule
 	return nil
 }
 
-// buildAlertingRule renders the single alerting rule embedded in the
+// buildAlertingRules renders the alerting rules embedded in the
+// PrometheusRule for this SearchRule: a single one, or one per level when
+// the condition defines severities. Every level is rendered as a rule of
+// its own with the thresholds and `for` of the level and its name as the
+// `severity` label, so Alertmanager routes each tier separately.
+func buildAlertingRules(rule *v1alpha1.SearchRule) ([]monitoringv1.Rule, error) {
+	if len(rule.Spec.Condition.Severities) == 0 {
+		expr, err := buildPromQLExpr(rule)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build PromQL expression: %w", err)
+		}
+		forDuration, err := parsePromDuration(rule.Spec.Condition.For)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse condition.for: %w", err)
+		}
+		return []monitoringv1.Rule{buildAlertingRule(rule, expr, forDuration)}, nil
+	}
+
+	rules := make([]monitoringv1.Rule, 0, len(rule.Spec.Condition.Severities))
+	for _, severity := range rule.Spec.Condition.Severities {
+		levelRule := rule.DeepCopy()
+		levelRule.Spec.Condition.Severities = nil
+		levelRule.Spec.Condition.Threshold = severity.Threshold
+		levelRule.Spec.Condition.LowerThreshold = severity.LowerThreshold
+		levelRule.Spec.Condition.UpperThreshold = severity.UpperThreshold
+		if severity.For != "" {
+			levelRule.Spec.Condition.For = severity.For
+		}
+
+		expr, err := buildPromQLExpr(levelRule)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build PromQL expression for severity %q: %w", severity.Name, err)
+		}
+		forDuration, err := parsePromDuration(levelRule.Spec.Condition.For)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse for of severity %q: %w", severity.Name, err)
+		}
+		alertingRule := buildAlertingRule(levelRule, expr, forDuration)
+		alertingRule.Labels["severity"] = severity.Name
+		rules = append(rules, alertingRule)
+	}
+	return rules, nil
+}
+
+// buildAlertingRule renders a single alerting rule embedded in the
 // PrometheusRule for this SearchRule.
 func buildAlertingRule(rule *v1alpha1.SearchRule, expr string, forDuration monitoringv1.Duration) monitoringv1.Rule {
 	// Prometheus accepts metric/alert names matching [a-zA-Z_:][a-zA-Z0-9_:]*
@@ -210,12 +248,15 @@ func buildAlertingRule(rule *v1alpha1.SearchRule, expr string, forDuration monit
 	}
 
 	metric, _ := chooseAlertMetric(rule)
+	condition := fmt.Sprintf("%s threshold %s", rule.Spec.Condition.Operator, rule.Spec.Condition.Threshold)
+	if rule.Spec.Condition.Operator == conditionBetween || rule.Spec.Condition.Operator == conditionOutside {
+		condition = fmt.Sprintf("%s %s and %s", rule.Spec.Condition.Operator,
+			rule.Spec.Condition.LowerThreshold, rule.Spec.Condition.UpperThreshold)
+	}
 	annotations := map[string]string{
 		"description": fmt.Sprintf(
-			"SearchRule %s/%s condition (%s %s %s) is firing on metric %s.",
-			rule.Namespace, rule.Name,
-			rule.Spec.Condition.Operator, "threshold", rule.Spec.Condition.Threshold,
-			metric,
+			"SearchRule %s/%s condition (%s) is firing on metric %s.",
+			rule.Namespace, rule.Name, condition, metric,
 		),
 	}
 	if rule.Spec.PrometheusRule != nil {
@@ -247,25 +288,102 @@ func buildAlertingRule(rule *v1alpha1.SearchRule, expr string, forDuration monit
 // We never embed the user-provided string directly: it would let a SearchRule
 // author smuggle arbitrary PromQL into the alert expression
 // (e.g. "100 or vector(0)"), bypassing the intended scalar comparison.
+//
+// Rules with active windows do not alert while they are suspended outside of
+// them: their last value is still exported, so the expression leaves out the
+// rule while its searchrule_state is Suspended.
 func buildPromQLExpr(rule *v1alpha1.SearchRule) (string, error) {
+	expr, err := conditionPromQLExpr(rule)
+	if err != nil || len(rule.Spec.ActiveWindows) == 0 {
+		return expr, err
+	}
+	return fmt.Sprintf(`(%s) unless on(searchrule_namespace,rule) searchrule_state{searchrule_namespace=%q,rule=%q,state=%q} == 1`,
+		expr, rule.Namespace, rule.Name, RuleSuspendedState), nil
+}
+
+// conditionPromQLExpr translates the condition of the SearchRule into the
+// PromQL expression matching when it does.
+func conditionPromQLExpr(rule *v1alpha1.SearchRule) (string, error) {
+	// The leaves of a compound condition and expressions read fields of the
+	// response that are not exported as metrics, so there is nothing to
+	// write PromQL on.
+	if isCompoundCondition(&rule.Spec.Condition) {
+		return "", fmt.Errorf("compound conditions (all, any, not) can not be translated to PromQL")
+	}
+	if rule.Spec.Condition.Expression != "" {
+		return "", fmt.Errorf("condition.expression can not be translated to PromQL")
+	}
+	// Anomalies compare the value with the bounds exposed by the operator, which are
+	// only there once the history is warmed up.
+	if rule.Spec.Condition.Anomaly != nil {
+		return anomalyPromQLExpr(rule), nil
+	}
+	// The buckets are only exported through a custom metric, which carries
+	// their dimensions so the alert fires once per bucket as well.
+	if rule.Spec.Condition.Buckets != nil && len(rule.Spec.CustomMetrics) == 0 {
+		return "", fmt.Errorf("condition.buckets needs a customMetric exposing the buckets to be translated to PromQL")
+	}
+	metric, _ := chooseAlertMetric(rule)
+	selector := fmt.Sprintf(`%s{searchrule_namespace=%q,rule=%q}`, metric, rule.Namespace, rule.Name)
+
+	// The range operators compare the value with both bounds, which are
+	// parsed and re-rendered like the threshold.
+	switch rule.Spec.Condition.Operator {
+	case conditionBetween, conditionOutside:
+		lower, err := promQLThreshold("condition.lowerThreshold", rule.Spec.Condition.LowerThreshold)
+		if err != nil {
+			return "", err
+		}
+		upper, err := promQLThreshold("condition.upperThreshold", rule.Spec.Condition.UpperThreshold)
+		if err != nil {
+			return "", err
+		}
+		if rule.Spec.Condition.Operator == conditionBetween {
+			return fmt.Sprintf(`(%s >= %s and %s <= %s)`, selector, lower, selector, upper), nil
+		}
+		return fmt.Sprintf(`(%s < %s or %s > %s)`, selector, lower, selector, upper), nil
+	}
+
 	op, err := promqlOperator(rule.Spec.Condition.Operator)
 	if err != nil {
 		return "", err
 	}
-	rawThreshold := rule.Spec.Condition.Threshold
-	if rawThreshold == "" {
-		return "", fmt.Errorf("condition.threshold is empty")
+	threshold, err := promQLThreshold("condition.threshold", rule.Spec.Condition.Threshold)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`%s %s %s`, selector, op, threshold), nil
+}
+
+// promQLThreshold parses a threshold of the condition as a float and renders
+// it back, so only a number is ever inlined in the expression.
+// strconv.FormatFloat with -1 precision keeps the shortest representation
+// that round-trips, so "100" stays "100" and "0.5" stays "0.5".
+func promQLThreshold(name, raw string) (string, error) {
+	if raw == "" {
+		return "", fmt.Errorf("%s is empty", name)
 	}
-	threshold, err := strconv.ParseFloat(rawThreshold, 64)
+	threshold, err := strconv.ParseFloat(raw, 64)
 	if err != nil {
-		return "", fmt.Errorf("condition.threshold %q is not a valid float: %w", rawThreshold, err)
+		return "", fmt.Errorf("%s %q is not a valid float: %w", name, raw, err)
 	}
-	thresholdStr := strconv.FormatFloat(threshold, 'f', -1, 64)
-	metric, _ := chooseAlertMetric(rule)
-	// strconv.FormatFloat with -1 precision keeps the shortest representation
-	// that round-trips, so "100" stays "100" and "0.5" stays "0.5".
-	return fmt.Sprintf(`%s{searchrule_namespace=%q,rule=%q} %s %s`,
-		metric, rule.Namespace, rule.Name, op, thresholdStr), nil
+	return strconv.FormatFloat(threshold, 'f', -1, 64), nil
+}
+
+// anomalyPromQLExpr compares searchrule_value with the anomaly bounds of the
+// rule in the direction of its condition. Both series have the same labels, so
+// they match one to one.
+func anomalyPromQLExpr(rule *v1alpha1.SearchRule) string {
+	selector := fmt.Sprintf(`{searchrule_namespace=%q,rule=%q}`, rule.Namespace, rule.Name)
+	above := "searchrule_value" + selector + " > searchrule_anomaly_upper_bound" + selector
+	below := "searchrule_value" + selector + " < searchrule_anomaly_lower_bound" + selector
+	switch rule.Spec.Condition.Anomaly.Direction {
+	case anomalyDirectionAbove:
+		return above
+	case anomalyDirectionBelow:
+		return below
+	}
+	return above + " or " + below
 }
 
 // firstCustomMetricValidationError walks spec.customMetrics in order and
@@ -294,6 +412,10 @@ func firstCustomMetricValidationError(metrics []v1alpha1.CustomMetric) error {
 // silently routing alerts to the wrong gauge.
 func chooseAlertMetric(rule *v1alpha1.SearchRule) (metric, fallbackReason string) {
 	const legacy = "searchrule_value"
+	// Rules compared with a baseline evaluate the change, which has a gauge of its own
+	if rule.Spec.Condition.Comparison != nil {
+		return "searchrule_change", ""
+	}
 	if len(rule.Spec.CustomMetrics) == 0 {
 		return legacy, ""
 	}
@@ -317,8 +439,9 @@ func chooseAlertMetric(rule *v1alpha1.SearchRule) (metric, fallbackReason string
 	return "searchrule_" + rule.Spec.CustomMetrics[0].Name, ""
 }
 
-// promqlOperator maps a SearchRule condition operator to its PromQL syntax.
-// The set is fixed and matches the operators understood by evaluateCondition.
+// promqlOperator maps a SearchRule condition operator comparing with a single
+// threshold to its PromQL syntax. The range operators are rendered by
+// conditionPromQLExpr, as they need both bounds.
 func promqlOperator(op string) (string, error) {
 	switch op {
 	case conditionGreaterThan:
@@ -158,6 +158,14 @@ func TestChooseAlertMetric(t *testing.T) {
 			want:         "searchrule_primary",
 			wantFallback: true,
 		},
+		{
+			name: "baseline comparison targets the change",
+			rule: newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+				r.Spec.Condition.Comparison = &searchrulerv1alpha1.Comparison{Offset: "24h"}
+				r.Spec.PrometheusRule = &searchrulerv1alpha1.PrometheusRuleSpec{Enabled: true}
+			}),
+			want: "searchrule_change",
+		},
 	}
 	for _, c := range cases {
 		c := c
@@ -189,6 +197,22 @@ func TestBuildPromQLExpr_UsesCustomMetric(t *testing.T) {
 	}
 }
 
+func TestBuildPromQLExpr_LeavesOutSuspendedRules(t *testing.T) {
+	t.Parallel()
+	rule := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+		r.Spec.ActiveWindows = []searchrulerv1alpha1.ActiveWindow{{Start: "09:00", End: "18:00"}}
+	})
+	got, err := buildPromQLExpr(rule)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	want := `(searchrule_value{searchrule_namespace="default",rule="demo"} > 100)` +
+		` unless on(searchrule_namespace,rule) searchrule_state{searchrule_namespace="default",rule="demo",state="Suspended"} == 1`
+	if got != want {
+		t.Fatalf("got=%q\nwant=%q", got, want)
+	}
+}
+
 func TestBuildPromQLExpr(t *testing.T) {
 	t.Parallel()
 	cases := []struct {
@@ -232,6 +256,39 @@ func TestBuildPromQLExpr(t *testing.T) {
 			condition: searchrulerv1alpha1.Condition{Operator: conditionGreaterThan, Threshold: "1e3", For: "1m"},
 			want:      `searchrule_value{searchrule_namespace="default",rule="demo"} > 1000`,
 		},
+		{
+			name:      "between",
+			condition: searchrulerv1alpha1.Condition{Operator: conditionBetween, LowerThreshold: "10", UpperThreshold: "2e1", For: "1m"},
+			want: `(searchrule_value{searchrule_namespace="default",rule="demo"} >= 10` +
+				` and searchrule_value{searchrule_namespace="default",rule="demo"} <= 20)`,
+		},
+		{
+			name:      "outside",
+			condition: searchrulerv1alpha1.Condition{Operator: conditionOutside, LowerThreshold: "0.5", UpperThreshold: "100", For: "1m"},
+			want: `(searchrule_value{searchrule_namespace="default",rule="demo"} < 0.5` +
+				` or searchrule_value{searchrule_namespace="default",rule="demo"} > 100)`,
+		},
+		{
+			name:      "between without upper bound",
+			condition: searchrulerv1alpha1.Condition{Operator: conditionBetween, LowerThreshold: "10", For: "1m"},
+			wantErr:   true,
+		},
+		{
+			name:      "outside promql injection attempt rejected",
+			condition: searchrulerv1alpha1.Condition{Operator: conditionOutside, LowerThreshold: "10", UpperThreshold: "20 or vector(0)", For: "1m"},
+			wantErr:   true,
+		},
+		{
+			name:      "anomaly above the upper bound",
+			condition: searchrulerv1alpha1.Condition{For: "1m", Anomaly: &searchrulerv1alpha1.AnomalyDetection{Direction: "above"}},
+			want:      `searchrule_value{searchrule_namespace="default",rule="demo"} > searchrule_anomaly_upper_bound{searchrule_namespace="default",rule="demo"}`,
+		},
+		{
+			name:      "anomaly in both directions",
+			condition: searchrulerv1alpha1.Condition{For: "1m", Anomaly: &searchrulerv1alpha1.AnomalyDetection{}},
+			want: `searchrule_value{searchrule_namespace="default",rule="demo"} > searchrule_anomaly_upper_bound{searchrule_namespace="default",rule="demo"}` +
+				` or searchrule_value{searchrule_namespace="default",rule="demo"} < searchrule_anomaly_lower_bound{searchrule_namespace="default",rule="demo"}`,
+		},
 	}
 	for _, c := range cases {
 		c := c
@@ -0,0 +1,157 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	//
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/backend"
+	"freepik.com/searchruler/internal/controller"
+	"freepik.com/searchruler/internal/template"
+)
+
+// errQueryTemplate is wrapped by the errors rendering the query of a rule. It wraps
+// ErrInvalidRule, as the query can not run until the rule is fixed
+var errQueryTemplate = fmt.Errorf("%w: query template", backend.ErrInvalidRule)
+
+// queryWindow is the time range a query is rendered and evaluated for
+type queryWindow struct {
+	from   time.Time
+	to     time.Time
+	offset time.Duration
+}
+
+// evaluationWindow returns the window of a rule evaluated now, lasting its checkInterval
+func evaluationWindow(resource *v1alpha1.SearchRule, now time.Time) (queryWindow, error) {
+
+	length, err := controller.EvaluationWindow(resource, now)
+	if err != nil {
+		return queryWindow{}, fmt.Errorf("%w: %v", backend.ErrInvalidRule, err)
+	}
+	return queryWindow{from: now.Add(-length), to: now}, nil
+}
+
+// queryTemplateData returns the data the query of a rule is rendered with for the window. The
+// evaluation time is the end of the window before shifting it, and lastEvaluation is zero for
+// rules never evaluated
+func queryTemplateData(resource *v1alpha1.SearchRule, window queryWindow, lastEvaluation time.Time) map[string]interface{} {
+
+	now := window.to.Add(window.offset)
+	data := map[string]interface{}{
+		"object":               resource,
+		"now":                  now.UTC().Format(time.RFC3339),
+		"nowMillis":            now.UnixMilli(),
+		"from":                 window.from.UTC().Format(time.RFC3339),
+		"to":                   window.to.UTC().Format(time.RFC3339),
+		"fromMillis":           window.from.UnixMilli(),
+		"toMillis":             window.to.UnixMilli(),
+		"offset":               window.offset.String(),
+		"checkInterval":        resource.Spec.CheckInterval,
+		"lastEvaluation":       "",
+		"lastEvaluationMillis": int64(0),
+	}
+	// Rules with a schedule and no checkInterval look back at the time between two evaluations
+	if resource.Spec.CheckInterval == "" {
+		data["checkInterval"] = window.to.Sub(window.from).String()
+	}
+	if !lastEvaluation.IsZero() {
+		data["lastEvaluation"] = lastEvaluation.UTC().Format(time.RFC3339)
+		data["lastEvaluationMillis"] = lastEvaluation.UnixMilli()
+	}
+	return data
+}
+
+// renderQuery returns a copy of the rule with its query, and the index it runs against, rendered
+// for the window. Rules without templates are returned as they are
+func renderQuery(resource *v1alpha1.SearchRule, window queryWindow, lastEvaluation time.Time) (*v1alpha1.SearchRule, error) {
+
+	if !hasQueryTemplate(resource) {
+		return resource, nil
+	}
+
+	data := queryTemplateData(resource, window, lastEvaluation)
+	render := func(query *string) error {
+		if !strings.Contains(*query, "{{") {
+			return nil
+		}
+		rendered, err := template.EvaluateTemplate(*query, data)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errQueryTemplate, err)
+		}
+		*query = rendered
+		return nil
+	}
+
+	rendered := resource.DeepCopy()
+	for _, query := range queryFields(rendered) {
+		if err := render(query); err != nil {
+			return nil, err
+		}
+	}
+
+	// The query object is rendered as its JSON, where the templates are string values
+	if rendered.Spec.Elasticsearch.Query != nil {
+		query := string(rendered.Spec.Elasticsearch.Query.Raw)
+		if err := render(&query); err != nil {
+			return nil, err
+		}
+		rendered.Spec.Elasticsearch.Query = &apiextensionsv1.JSON{Raw: []byte(query)}
+	}
+	return rendered, nil
+}
+
+// hasQueryTemplate tells whether the query of the rule, or its index, holds a template
+func hasQueryTemplate(resource *v1alpha1.SearchRule) bool {
+
+	if query := resource.Spec.Elasticsearch.Query; query != nil && strings.Contains(string(query.Raw), "{{") {
+		return true
+	}
+	for _, query := range queryFields(resource) {
+		if strings.Contains(*query, "{{") {
+			return true
+		}
+	}
+	return false
+}
+
+// queryFields returns the text fields of the rule that are rendered as templates
+func queryFields(resource *v1alpha1.SearchRule) []*string {
+
+	queries := []*string{
+		&resource.Spec.Elasticsearch.Index,
+		&resource.Spec.Elasticsearch.QueryJSON,
+		&resource.Spec.Elasticsearch.SQL,
+		&resource.Spec.Elasticsearch.PPL,
+	}
+	if resource.Spec.Loki != nil {
+		queries = append(queries, &resource.Spec.Loki.Query)
+	}
+	if resource.Spec.Prometheus != nil {
+		queries = append(queries, &resource.Spec.Prometheus.Query)
+	}
+	if resource.Spec.ClickHouse != nil {
+		queries = append(queries, &resource.Spec.ClickHouse.Query)
+	}
+	return queries
+}
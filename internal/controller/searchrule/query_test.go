@@ -0,0 +1,187 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/backend"
+	"freepik.com/searchruler/internal/globals"
+)
+
+func TestRenderQuery(t *testing.T) {
+	t.Parallel()
+	resource := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+		r.Spec.Elasticsearch.Query = &apiextensionsv1.JSON{
+			Raw: []byte(`{"range":{"@timestamp":{"gte":"{{ .from }}","lt":"{{ .to }}"}}}`),
+		}
+		r.Spec.Elasticsearch.SQL = "SELECT COUNT(*) FROM logs WHERE ts >= {{ .fromMillis }}"
+	})
+	window := queryWindow{
+		from: time.Date(2024, 6, 1, 11, 55, 0, 0, time.UTC),
+		to:   time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	rendered, err := renderQuery(resource, window, time.Time{})
+	if err != nil {
+		t.Fatalf("renderQuery: %v", err)
+	}
+	wantQuery := `{"range":{"@timestamp":{"gte":"2024-06-01T11:55:00Z","lt":"2024-06-01T12:00:00Z"}}}`
+	if got := string(rendered.Spec.Elasticsearch.Query.Raw); got != wantQuery {
+		t.Errorf("query = %s, want %s", got, wantQuery)
+	}
+	if got := rendered.Spec.Elasticsearch.SQL; got != "SELECT COUNT(*) FROM logs WHERE ts >= 1717242900000" {
+		t.Errorf("sql = %s", got)
+	}
+	if strings.Contains(string(resource.Spec.Elasticsearch.Query.Raw), "2024") {
+		t.Errorf("the rule itself must not be rendered")
+	}
+
+	resource.Spec.Elasticsearch.SQL = "SELECT {{ .from "
+	if _, err := renderQuery(resource, window, time.Time{}); !errors.Is(err, errQueryTemplate) {
+		t.Errorf("expected a query template error for an invalid template, got %v", err)
+	}
+}
+
+func TestRenderQueryVariables(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	lastEvaluation := now.Add(-30 * time.Second)
+	cases := []struct {
+		name           string
+		query          string
+		lastEvaluation time.Time
+		want           string
+	}{
+		{
+			name:  "evaluation time",
+			query: "{{ .now }} {{ .nowMillis }}",
+			want:  "2024-06-01T12:00:00Z 1717243200000",
+		},
+		{
+			name:  "window of the checkInterval",
+			query: "{{ .from }} {{ .to }} {{ .checkInterval }}",
+			want:  "2024-06-01T11:59:30Z 2024-06-01T12:00:00Z 30s",
+		},
+		{
+			name:           "last evaluation",
+			query:          "{{ .lastEvaluation }} {{ .lastEvaluationMillis }}",
+			lastEvaluation: lastEvaluation,
+			want:           "2024-06-01T11:59:30Z 1717243170000",
+		},
+		{
+			name:  "never evaluated",
+			query: `{{ .lastEvaluation | default .from }} {{ .lastEvaluationMillis }}`,
+			want:  "2024-06-01T11:59:30Z 0",
+		},
+		{
+			name:  "rule metadata",
+			query: "{{ .object.Namespace }}/{{ .object.Name }} {{ .object.Labels.team }}",
+			want:  "default/demo payments",
+		},
+	}
+	for _, tc := range cases {
+		resource := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+			r.Labels = map[string]string{"team": "payments"}
+			r.Spec.Prometheus = &searchrulerv1alpha1.Prometheus{Query: tc.query}
+		})
+		window, err := evaluationWindow(resource, now)
+		if err != nil {
+			t.Fatalf("%s: evaluationWindow: %v", tc.name, err)
+		}
+		rendered, err := renderQuery(resource, window, tc.lastEvaluation)
+		if err != nil {
+			t.Fatalf("%s: renderQuery: %v", tc.name, err)
+		}
+		if got := rendered.Spec.Prometheus.Query; got != tc.want {
+			t.Errorf("%s: query = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRenderQueryWithoutTemplate(t *testing.T) {
+	t.Parallel()
+	resource := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+		r.Spec.Elasticsearch.Index = "logs"
+		r.Spec.Elasticsearch.QueryJSON = `{"query":{"range":{"@timestamp":{"gte":"now-5m"}}}}`
+	})
+	rendered, err := renderQuery(resource, queryWindow{to: time.Now()}, time.Time{})
+	if err != nil {
+		t.Fatalf("renderQuery: %v", err)
+	}
+	if rendered != resource {
+		t.Errorf("a rule without templates must not be copied")
+	}
+}
+
+func TestUpdateQueryErrorConditionTemplate(t *testing.T) {
+	t.Parallel()
+	r := &SearchRuleReconciler{}
+	resource := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+		r.Spec.Elasticsearch.Index = `logs-{{ fail "no index for this window" }}`
+		r.Spec.Elasticsearch.QueryJSON = `{}`
+	})
+	_, err := renderQuery(resource, queryWindow{to: time.Now()}, time.Time{})
+	if !errors.Is(err, errQueryTemplate) || !errors.Is(err, backend.ErrInvalidRule) {
+		t.Fatalf("error = %v, want a query template error", err)
+	}
+
+	r.updateQueryErrorCondition(resource, err)
+	if !hasCondition(resource.Status.Conditions, globals.ConditionTypeState, globals.ConditionReasonQueryTemplateErrorType) {
+		t.Fatalf("expected State/QueryTemplateError condition, got=%v", resource.Status.Conditions)
+	}
+	if message := resource.Status.Conditions[0].Message; !strings.Contains(message, "no index for this window") {
+		t.Errorf("message = %q, want the reason", message)
+	}
+}
+
+func TestEvaluationWindowSchedule(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name          string
+		checkInterval string
+		want          string
+	}{
+		{name: "time between two evaluations", want: "2024-06-01T11:45:00Z 15m0s"},
+		{name: "checkInterval", checkInterval: "1h", want: "2024-06-01T11:00:00Z 1h"},
+	}
+	for _, tc := range cases {
+		resource := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+			r.Spec.CheckInterval = tc.checkInterval
+			r.Spec.Schedule = &searchrulerv1alpha1.EvaluationSchedule{Cron: "*/15 * * * *"}
+			r.Spec.Prometheus = &searchrulerv1alpha1.Prometheus{Query: "{{ .from }} {{ .checkInterval }}"}
+		})
+		window, err := evaluationWindow(resource, now)
+		if err != nil {
+			t.Fatalf("%s: evaluationWindow: %v", tc.name, err)
+		}
+		rendered, err := renderQuery(resource, window, time.Time{})
+		if err != nil {
+			t.Fatalf("%s: renderQuery: %v", tc.name, err)
+		}
+		if got := rendered.Spec.Prometheus.Query; got != tc.want {
+			t.Errorf("%s: query = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/controller"
+	"freepik.com/searchruler/internal/pools"
+	"freepik.com/searchruler/internal/scheduler"
+)
+
+// minLastEvaluationPersistPeriod is the least time between two writes of the time of the last
+// evaluation of a rule, when nothing else of its status changed
+const minLastEvaluationPersistPeriod = time.Minute
+
+// scheduleRule evaluates the rule every checkInterval, or at the times of its schedule, from now
+// on. A rule evaluated every checkInterval and not evaluated during the last interval, as a new
+// one or one resumed after a restart, is evaluated right away
+func (r *SearchRuleReconciler) scheduleRule(resource *v1alpha1.SearchRule) error {
+
+	spec, err := evaluationSpec(resource)
+	if err != nil {
+		return err
+	}
+	if _, err := compileActiveWindows(resource); err != nil {
+		return err
+	}
+
+	var lastEvaluation time.Time
+	if resource.Status.RuleState != nil {
+		lastEvaluation = timeFromStatus(resource.Status.RuleState.LastEvaluationTime)
+	}
+	r.Scheduler.Schedule(client.ObjectKeyFromObject(resource), spec, lastEvaluation)
+	return nil
+}
+
+// evaluationSpec returns when the rule is evaluated. The window of its query is checked too, as
+// the checkInterval of a rule with a schedule is only used for it
+func evaluationSpec(resource *v1alpha1.SearchRule) (scheduler.Spec, error) {
+
+	schedule, err := controller.EvaluationSchedule(resource)
+	if err != nil {
+		return scheduler.Spec{}, err
+	}
+	window, err := controller.EvaluationWindow(resource, time.Now())
+	if err != nil {
+		return scheduler.Spec{}, err
+	}
+	if schedule != nil {
+		return scheduler.Spec{Cron: schedule}, nil
+	}
+	return scheduler.Spec{Interval: window}, nil
+}
+
+// evaluate checks the rule of the key on its slot of the scheduler. The status is only written
+// when the evaluation changed it, or when the time of the last evaluation stored in it is stale,
+// so rules in a steady state cost few API calls between changes
+func (r *SearchRuleReconciler) evaluate(ctx context.Context, key types.NamespacedName) {
+
+	logger := log.FromContext(ctx)
+
+	resource := &v1alpha1.SearchRule{}
+	if err := r.Get(ctx, key, resource); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			r.Scheduler.Unschedule(key)
+			return
+		}
+		logger.Info(fmt.Sprintf(controller.ResourceSyncTimeRetrievalError, controller.SearchRuleResourceType, key, err.Error()))
+		return
+	}
+
+	// The reconciler unschedules rules being deleted or handed off, this covers the
+	// evaluations already due when it did
+	if !resource.DeletionTimestamp.IsZero() || !r.ownsRule(resource) {
+		return
+	}
+
+	before := resource.Status.DeepCopy()
+	persistEvery := lastEvaluationPersistPeriod(resource)
+
+	// Rules outside of their active windows are not evaluated, and their alerts are suspended
+	// until a window opens
+	if !ruleActive(resource, time.Now()) {
+		r.suspendRule(resource)
+		if statusChanged(before, &resource.Status, persistEvery) {
+			if err := r.Status().Update(ctx, resource); err != nil {
+				logger.Info(fmt.Sprintf(controller.ResourceConditionUpdateError, controller.SearchRuleResourceType, key, err.Error()))
+			}
+		}
+		return
+	}
+
+	err := r.Sync(ctx, watch.Modified, resource)
+	r.saveRuleState(resource)
+	if err != nil {
+		r.UpdateConditionKubernetesApiCallFailure(resource)
+		logger.Info(fmt.Sprintf(controller.SyncTargetError, controller.SearchRuleResourceType, key, err.Error()))
+	} else {
+		r.UpdateConditionSuccess(resource)
+	}
+
+	if !statusChanged(before, &resource.Status, persistEvery) {
+		return
+	}
+	if err := r.Status().Update(ctx, resource); err != nil {
+		logger.Info(fmt.Sprintf(controller.ResourceConditionUpdateError, controller.SearchRuleResourceType, key, err.Error()))
+	}
+}
+
+// suspendRule stops sending the alerts of the rule, of its buckets and of its errors, and sets
+// the rule as suspended. Its `for` timers do not run while it is suspended, so the rule starts
+// over from the normal state when a window opens, and fires again after a whole `for`
+func (r *SearchRuleReconciler) suspendRule(resource *v1alpha1.SearchRule) {
+
+	key := fmt.Sprintf("%s_%s", resource.Namespace, resource.Name)
+	rule := r.rehydrateRule(resource, key)
+	r.deleteBucketAlerts(key, rule.Buckets)
+	r.deleteErrorAlerts(key)
+	r.AlertsPool.Delete(key)
+
+	rule.SearchRule = *resource
+	rule.RuleState = pools.RuleState{State: RuleSuspendedState}
+	rule.Buckets = nil
+	r.RulesPool.Set(key, &rule)
+	r.saveRuleState(resource)
+	r.UpdateConditionSuspended(resource)
+}
+
+// resumeRule starts the state of a rule suspended until now over, so a rule pending or firing
+// when it was suspended waits its whole `for` again. It returns the rule in the pool
+func (r *SearchRuleReconciler) resumeRule(ruleKey string, rule pools.Rule) pools.Rule {
+	if rule.State != RuleSuspendedState {
+		return rule
+	}
+	rule.RuleState = pools.RuleState{State: RuleNormalState}
+	rule.Buckets = nil
+	r.RulesPool.Set(ruleKey, &rule)
+	return rule
+}
+
+// lastEvaluationPersistPeriod is how stale the time of the last evaluation stored in the status
+// gets before it is written: one evaluation interval of the rule, and a minute at least. A
+// restart resumes the rule from it, for its first slot and its `lastEvaluation` variable
+func lastEvaluationPersistPeriod(resource *v1alpha1.SearchRule) time.Duration {
+	interval, err := controller.EvaluationInterval(resource, time.Now())
+	if err != nil || interval < minLastEvaluationPersistPeriod {
+		return minLastEvaluationPersistPeriod
+	}
+	return interval
+}
+
+// statusChanged tells whether an evaluation changed the status beyond the times every evaluation
+// refreshes: when the rule was evaluated and when its conditions were set. The time of the last
+// evaluation changes it too once the stored one is older than persistEvery. The statuses are
+// compared as stored, so times only differing below the second are the same
+func statusChanged(before, after *v1alpha1.SearchRuleStatus, persistEvery time.Duration) bool {
+
+	if before.RuleState != nil && after.RuleState != nil {
+		stored := timeFromStatus(before.RuleState.LastEvaluationTime)
+		if timeFromStatus(after.RuleState.LastEvaluationTime).Sub(stored) > persistEvery {
+			return true
+		}
+	}
+
+	normalize := func(status *v1alpha1.SearchRuleStatus) []byte {
+		status = status.DeepCopy()
+		for i := range status.Conditions {
+			status.Conditions[i].LastTransitionTime = metav1.Time{}
+		}
+		if status.RuleState != nil {
+			status.RuleState.LastEvaluationTime = nil
+		}
+		content, _ := json.Marshal(status)
+		return content
+	}
+	return !bytes.Equal(normalize(before), normalize(after))
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/globals"
+	"freepik.com/searchruler/internal/pools"
+	"freepik.com/searchruler/internal/scheduler"
+)
+
+func TestStatusChanged(t *testing.T) {
+	t.Parallel()
+	evaluated := time.Date(2024, 11, 5, 10, 0, 0, 0, time.UTC)
+
+	newStatus := func(modify func(*searchrulerv1alpha1.SearchRuleStatus)) *searchrulerv1alpha1.SearchRuleStatus {
+		status := &searchrulerv1alpha1.SearchRuleStatus{
+			Conditions: []metav1.Condition{{Type: "ResourceSynced", Status: metav1.ConditionTrue, Reason: "TargetSynced",
+				LastTransitionTime: metav1.NewTime(evaluated)}},
+			RuleState: &searchrulerv1alpha1.SearchRuleStateStatus{
+				RuleStateStatus:    searchrulerv1alpha1.RuleStateStatus{State: RuleFiringState, FiringTime: timeToStatus(evaluated.Add(-time.Hour))},
+				LastEvaluationTime: timeToStatus(evaluated),
+			},
+		}
+		if modify != nil {
+			modify(status)
+		}
+		return status
+	}
+
+	cases := []struct {
+		name   string
+		modify func(*searchrulerv1alpha1.SearchRuleStatus)
+		want   bool
+	}{
+		{name: "same status", want: false},
+		{name: "evaluated again", modify: func(s *searchrulerv1alpha1.SearchRuleStatus) {
+			s.RuleState.LastEvaluationTime = timeToStatus(evaluated.Add(time.Minute))
+			s.Conditions[0].LastTransitionTime = metav1.NewTime(evaluated.Add(time.Minute))
+		}, want: false},
+		{name: "stored evaluation stale", modify: func(s *searchrulerv1alpha1.SearchRuleStatus) {
+			s.RuleState.LastEvaluationTime = timeToStatus(evaluated.Add(-2 * time.Minute))
+		}, want: true},
+		{name: "stored evaluation recent", modify: func(s *searchrulerv1alpha1.SearchRuleStatus) {
+			s.RuleState.LastEvaluationTime = timeToStatus(evaluated.Add(-30 * time.Second))
+		}, want: false},
+		{name: "same time below the second", modify: func(s *searchrulerv1alpha1.SearchRuleStatus) {
+			s.RuleState.FiringTime = timeToStatus(evaluated.Add(-time.Hour + 300*time.Millisecond))
+		}, want: false},
+		{name: "state changed", modify: func(s *searchrulerv1alpha1.SearchRuleStatus) {
+			s.RuleState.State = RulePendingResolvedState
+		}, want: true},
+		{name: "condition changed", modify: func(s *searchrulerv1alpha1.SearchRuleStatus) {
+			s.Conditions[0].Reason = "KubernetesApiCallError"
+		}, want: true},
+		{name: "first evaluation", modify: func(s *searchrulerv1alpha1.SearchRuleStatus) {
+			s.RuleState = nil
+		}, want: true},
+	}
+	for _, tc := range cases {
+		if got := statusChanged(newStatus(tc.modify), newStatus(nil), time.Minute); got != tc.want {
+			t.Errorf("%s: statusChanged = %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestReconcileSchedulesRule(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "demo"}
+
+	evaluations := 0
+	resource := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+		r.Spec.ActionRef = &searchrulerv1alpha1.ActionRef{Name: "slack"}
+		r.Status.RuleState = &searchrulerv1alpha1.SearchRuleStateStatus{LastEvaluationTime: timeToStatus(time.Now())}
+	})
+	r := &SearchRuleReconciler{
+		Client: fake.NewClientBuilder().WithScheme(newScheme(t)).
+			WithObjects(resource).WithStatusSubresource(resource).Build(),
+		RulesPool:  newRulesPool(),
+		AlertsPool: &pools.AlertsStore{Store: map[string]*pools.Alert{}},
+	}
+	r.Scheduler = scheduler.New(func(ctx context.Context, key types.NamespacedName) { evaluations++ }, scheduler.Options{})
+
+	// Reconciling the rule schedules it, and leaves its evaluation to the scheduler
+	result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if result.RequeueAfter != 0 {
+		t.Errorf("requeued after %s, want the rule evaluated on its schedule only", result.RequeueAfter)
+	}
+	if spec, scheduled := r.Scheduler.Scheduled(key); !scheduled || spec.Interval != 30*time.Second {
+		t.Errorf("scheduled = %t every %s, want every 30s", scheduled, spec.Interval)
+	}
+	if evaluations != 0 {
+		t.Errorf("the rule was evaluated by the reconciliation")
+	}
+
+	// A new checkInterval moves the schedule
+	stored := &searchrulerv1alpha1.SearchRule{}
+	if err := r.Get(ctx, key, stored); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	stored.Spec.CheckInterval = "5m"
+	if err := r.Update(ctx, stored); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if spec, _ := r.Scheduler.Scheduled(key); spec.Interval != 5*time.Minute {
+		t.Errorf("scheduled every %s, want every 5m", spec.Interval)
+	}
+
+	// A schedule replaces the checkInterval
+	if err := r.Get(ctx, key, stored); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	stored.Spec.CheckInterval = ""
+	stored.Spec.Schedule = &searchrulerv1alpha1.EvaluationSchedule{Cron: "5 6 * * *", Timezone: "Europe/Madrid"}
+	if err := r.Update(ctx, stored); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if spec, _ := r.Scheduler.Scheduled(key); spec.Cron == nil || spec.Cron.String() != "5 6 * * * Europe/Madrid" {
+		t.Errorf("scheduled with %+v, want the cron expression", spec)
+	}
+
+	// Rules with an invalid schedule are not evaluated until it is fixed
+	if err := r.Get(ctx, key, stored); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	stored.Spec.Schedule.Cron = "5 25 * * *"
+	if err := r.Update(ctx, stored); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err == nil {
+		t.Errorf("Reconcile succeeded for a rule with an invalid schedule")
+	}
+	if _, scheduled := r.Scheduler.Scheduled(key); scheduled {
+		t.Errorf("a rule with an invalid schedule is still scheduled")
+	}
+	if err := r.Get(ctx, key, stored); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if condition := meta.FindStatusCondition(stored.Status.Conditions, globals.ConditionTypeResourceSynced); condition == nil ||
+		condition.Reason != globals.ConditionReasonInvalidScheduleType {
+		t.Errorf("ResourceSynced condition = %+v, want InvalidSchedule", condition)
+	}
+	stored.Spec.Schedule.Cron = "5 6 * * *"
+	if err := r.Update(ctx, stored); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	// Rules without outputs are not evaluated anymore
+	if err := r.Get(ctx, key, stored); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	stored.Spec.ActionRef = nil
+	if err := r.Update(ctx, stored); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err == nil {
+		t.Errorf("Reconcile succeeded for a rule without outputs")
+	}
+	if _, scheduled := r.Scheduler.Scheduled(key); scheduled {
+		t.Errorf("a rule without outputs is still scheduled")
+	}
+}
+
+func TestEvaluateSuspendsRule(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "demo"}
+	ruleKey := "default_demo"
+
+	// The only window of the rule is two days from now, whole day long
+	inTwoDays := searchrulerv1alpha1.Weekday(time.Now().UTC().AddDate(0, 0, 2).Format("Mon"))
+	resource := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+		r.Spec.ActionRef = &searchrulerv1alpha1.ActionRef{Name: "slack"}
+		r.Spec.ActiveWindows = []searchrulerv1alpha1.ActiveWindow{{Days: []searchrulerv1alpha1.Weekday{inTwoDays}, Start: "00:00", End: "24:00"}}
+		r.Status.RuleState = &searchrulerv1alpha1.SearchRuleStateStatus{
+			RuleStateStatus: searchrulerv1alpha1.RuleStateStatus{State: RuleFiringState},
+		}
+	})
+	r := &SearchRuleReconciler{
+		Client: fake.NewClientBuilder().WithScheme(newScheme(t)).
+			WithObjects(resource).WithStatusSubresource(resource).Build(),
+		RulesPool:  newRulesPool(),
+		AlertsPool: &pools.AlertsStore{Store: map[string]*pools.Alert{}},
+	}
+	r.RulesPool.Set(ruleKey, &pools.Rule{
+		SearchRule: *resource,
+		RuleState:  pools.RuleState{State: RuleFiringState, FiringTime: time.Now().Add(-time.Hour)},
+		Buckets:    map[string]pools.BucketState{"key=api": {}},
+	})
+	r.AlertsPool.Set(ruleKey, &pools.Alert{})
+	r.AlertsPool.Set(bucketAlertKey(ruleKey, "key=api"), &pools.Alert{})
+	r.AlertsPool.Set(errorAlertKey(ruleKey, alertNameError), &pools.Alert{})
+
+	// The rule is not evaluated, as its query would fail without a QueryConnector
+	r.evaluate(ctx, key)
+
+	if alerts := r.AlertsPool.GetAll(); len(alerts) != 0 {
+		t.Errorf("%d alerts in the pool, want the alerts of the rule suspended", len(alerts))
+	}
+	rule, _ := r.RulesPool.Get(ruleKey)
+	if rule.State != RuleSuspendedState || !rule.FiringTime.IsZero() || rule.Buckets != nil {
+		t.Errorf("rule in the pool = %+v, want it suspended without timers nor buckets", rule.RuleState)
+	}
+	stored := &searchrulerv1alpha1.SearchRule{}
+	if err := r.Get(ctx, key, stored); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if condition := meta.FindStatusCondition(stored.Status.Conditions, globals.ConditionTypeState); condition == nil ||
+		condition.Reason != globals.ConditionReasonSuspendedType {
+		t.Errorf("State condition = %+v, want Suspended", condition)
+	}
+	if stored.Status.RuleState == nil || stored.Status.RuleState.State != RuleSuspendedState {
+		t.Errorf("state in the status = %+v, want the rule suspended", stored.Status.RuleState)
+	}
+}
+
+func TestResumeRule(t *testing.T) {
+	t.Parallel()
+	r := &SearchRuleReconciler{RulesPool: newRulesPool()}
+	ruleKey := "default_demo"
+
+	// Rules not suspended keep their state
+	pending := pools.Rule{RuleState: pools.RuleState{State: RulePendingFiringState, FiringTime: time.Now().Add(-time.Hour)}}
+	if rule := r.resumeRule(ruleKey, pending); rule.State != RulePendingFiringState || rule.FiringTime.IsZero() {
+		t.Errorf("pending rule resumed as %+v, want it unchanged", rule.RuleState)
+	}
+
+	// A rule resuming from a suspension waits its whole `for` before firing again
+	suspended := pools.Rule{
+		RuleState: pools.RuleState{State: RuleSuspendedState},
+		Buckets:   map[string]pools.BucketState{"key=api": {}},
+	}
+	rule := r.resumeRule(ruleKey, suspended)
+	if rule.State != RuleNormalState || rule.Buckets != nil {
+		t.Fatalf("suspended rule resumed as %+v, want it normal without buckets", rule)
+	}
+	if pooled, _ := r.RulesPool.Get(ruleKey); pooled.State != RuleNormalState {
+		t.Errorf("state in the pool = %s, want %s", pooled.State, RuleNormalState)
+	}
+	step := (&compiledCondition{}).advanceState(&rule.RuleState, true, nil, time.Minute)
+	if step.notify || rule.State != RulePendingFiringState {
+		t.Errorf("first evaluation after resuming: state %s, notify %t, want pending for the whole for", rule.State, step.notify)
+	}
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"fmt"
+	"time"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/pools"
+)
+
+const (
+
+	// kubeEvent emitted when a rule with several severities changes its level
+	kubeEventReasonSeverityChanged = "AlertSeverityChanged"
+)
+
+// severityLevel is a level of a condition with several severities, as a leaf comparing
+// the value of the rule with the operator of the condition and the thresholds of the level
+type severityLevel struct {
+	name        string
+	leaf        v1alpha1.ConditionNode
+	forDuration time.Duration
+}
+
+// severityEvaluation is the outcome of evaluating the levels of a rule
+type severityEvaluation struct {
+	// matching is set when any level matched
+	matching bool
+
+	// severity is the most severe level matched during its `for`, empty when there is none
+	severity string
+
+	// since holds when every matched level started to match
+	since map[string]time.Time
+
+	// matches are the leaves matched by the level of severity, or by the most severe one
+	// matched when none matched during its `for`
+	matches []pools.ConditionMatch
+}
+
+// compileSeverities checks the levels of the condition. They are only supported with a
+// single operator, whose thresholds they replace
+func compileSeverities(condition *v1alpha1.Condition, defaultFor time.Duration) ([]severityLevel, error) {
+
+	if condition.Operator == "" || isCompoundCondition(condition) || condition.Expression != "" {
+		return nil, fmt.Errorf("condition.severities are only supported with operator")
+	}
+	if condition.Threshold != "" || condition.LowerThreshold != "" || condition.UpperThreshold != "" ||
+		condition.ResolveThreshold != "" {
+		return nil, fmt.Errorf("condition defines thresholds and severities, whose thresholds replace them")
+	}
+
+	levels := make([]severityLevel, 0, len(condition.Severities))
+	names := map[string]bool{}
+	for i, severity := range condition.Severities {
+		path := fmt.Sprintf("condition.severities[%d]", i)
+		if severity.Name == "" || names[severity.Name] {
+			return nil, fmt.Errorf("%s must have a unique name", path)
+		}
+		names[severity.Name] = true
+
+		level := severityLevel{
+			name: severity.Name,
+			leaf: v1alpha1.ConditionNode{
+				Name:             severity.Name,
+				Operator:         condition.Operator,
+				Threshold:        severity.Threshold,
+				LowerThreshold:   severity.LowerThreshold,
+				UpperThreshold:   severity.UpperThreshold,
+				ResolveThreshold: severity.ResolveThreshold,
+			},
+			forDuration: defaultFor,
+		}
+		if err := validateLeaf(level.leaf); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if severity.For != "" {
+			var err error
+			level.forDuration, err = time.ParseDuration(severity.For)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid for %q: %v", path, severity.For, err)
+			}
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+// evaluateSeverities evaluates every level against the response. A level compares its
+// resolveThreshold while the rule fires at it or at a more severe level, so the hysteresis
+// also applies when the rule goes down to a lower level
+func (c *compiledCondition) evaluateSeverities(input conditionInput, state pools.RuleState) (*severityEvaluation, error) {
+
+	current := c.severityIndex(state.Severity)
+	now := time.Now()
+
+	evaluation := &severityEvaluation{since: map[string]time.Time{}}
+	for i, level := range c.levels {
+		levelInput := input
+		levelInput.fired = input.fired && i <= current
+		matched, matches, err := evaluateCondition(level.leaf, levelInput)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+
+		since, ok := state.SeveritySince[level.name]
+		if !ok {
+			since = now
+		}
+		evaluation.since[level.name] = since
+		evaluation.matching = true
+
+		// Levels are ordered from the least severe, so the last one matched wins
+		if time.Since(since) > level.forDuration {
+			evaluation.severity = level.name
+			evaluation.matches = matches
+		} else if evaluation.severity == "" {
+			evaluation.matches = matches
+		}
+	}
+	return evaluation, nil
+}
+
+// severityIndex returns the position of the level in the condition, or -1 when there is
+// no level with that name
+func (c *compiledCondition) severityIndex(name string) int {
+	for i, level := range c.levels {
+		if level.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// severityFor returns the `for` of the level, which is also waited before resolving an
+// alert firing at it. Unknown levels, like the ones removed from the rule, use defaultFor
+func (c *compiledCondition) severityFor(name string, defaultFor time.Duration) time.Duration {
+	if i := c.severityIndex(name); i >= 0 {
+		return c.levels[i].forDuration
+	}
+	return defaultFor
+}
@@ -0,0 +1,249 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/pools"
+)
+
+// severitiesCondition returns a condition firing as warning over 100 and as critical over
+// 200, the critical level resolving under 150
+func severitiesCondition() searchrulerv1alpha1.Condition {
+	return searchrulerv1alpha1.Condition{
+		Operator: conditionGreaterThan,
+		For:      "1m",
+		Severities: []searchrulerv1alpha1.SeverityLevel{
+			{Name: "warning", Threshold: "100"},
+			{Name: "critical", Threshold: "200", ResolveThreshold: "150", For: "0s"},
+		},
+	}
+}
+
+func TestCompileSeverities(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name    string
+		modify  func(*searchrulerv1alpha1.Condition)
+		wantErr string
+	}{
+		{name: "valid", modify: func(*searchrulerv1alpha1.Condition) {}},
+		{
+			name:    "without operator",
+			modify:  func(c *searchrulerv1alpha1.Condition) { c.Operator = "" },
+			wantErr: "only supported with operator",
+		},
+		{
+			name:    "with a threshold",
+			modify:  func(c *searchrulerv1alpha1.Condition) { c.Threshold = "10" },
+			wantErr: "defines thresholds and severities",
+		},
+		{
+			name:    "duplicated name",
+			modify:  func(c *searchrulerv1alpha1.Condition) { c.Severities[1].Name = "warning" },
+			wantErr: "severities[1] must have a unique name",
+		},
+		{
+			name:    "invalid threshold",
+			modify:  func(c *searchrulerv1alpha1.Condition) { c.Severities[0].Threshold = "many" },
+			wantErr: "severities[0]: configured threshold is not a valid float",
+		},
+		{
+			name:    "invalid for",
+			modify:  func(c *searchrulerv1alpha1.Condition) { c.Severities[1].For = "soon" },
+			wantErr: "severities[1]: invalid for",
+		},
+	}
+	for _, tc := range cases {
+		condition := severitiesCondition()
+		tc.modify(&condition)
+		compiled, err := compileCondition(&condition)
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", tc.name, err)
+			}
+			if len(compiled.levels) != 2 || compiled.levels[0].forDuration != time.Minute || compiled.levels[1].forDuration != 0 {
+				t.Fatalf("%s: unexpected levels %+v", tc.name, compiled.levels)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: error = %v, want it to contain %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestCheckSeverities(t *testing.T) {
+	t.Parallel()
+	condition := severitiesCondition()
+	compiled, err := compileCondition(&condition)
+	if err != nil {
+		t.Fatalf("compileCondition: %v", err)
+	}
+
+	longAgo := time.Now().Add(-time.Hour)
+	cases := []struct {
+		name         string
+		value        float64
+		state        pools.RuleState
+		wantMatching bool
+		wantSeverity string
+		wantSince    []string
+	}{
+		{
+			name:  "normal",
+			value: 50,
+			state: pools.RuleState{State: RuleNormalState},
+		},
+		{
+			name:         "warning during its for",
+			value:        120,
+			state:        pools.RuleState{State: RuleNormalState},
+			wantMatching: true,
+			wantSince:    []string{"warning"},
+		},
+		{
+			name:         "warning after its for",
+			value:        120,
+			state:        pools.RuleState{State: RulePendingFiringState, SeveritySince: map[string]time.Time{"warning": longAgo}},
+			wantMatching: true,
+			wantSeverity: "warning",
+			wantSince:    []string{"warning"},
+		},
+		{
+			name:         "critical without for",
+			value:        250,
+			state:        pools.RuleState{State: RuleFiringState, Severity: "warning", SeveritySince: map[string]time.Time{"warning": longAgo}},
+			wantMatching: true,
+			wantSeverity: "critical",
+			wantSince:    []string{"warning", "critical"},
+		},
+		{
+			name:         "critical over its resolve threshold",
+			value:        170,
+			state:        pools.RuleState{State: RuleFiringState, Severity: "critical", SeveritySince: map[string]time.Time{"warning": longAgo, "critical": longAgo}},
+			wantMatching: true,
+			wantSeverity: "critical",
+			wantSince:    []string{"warning", "critical"},
+		},
+		{
+			name:         "critical back to warning",
+			value:        140,
+			state:        pools.RuleState{State: RuleFiringState, Severity: "critical", SeveritySince: map[string]time.Time{"warning": longAgo, "critical": longAgo}},
+			wantMatching: true,
+			wantSeverity: "warning",
+			wantSince:    []string{"warning"},
+		},
+		{
+			name:         "warning does not use the resolve threshold of critical",
+			value:        170,
+			state:        pools.RuleState{State: RuleFiringState, Severity: "warning", SeveritySince: map[string]time.Time{"warning": longAgo}},
+			wantMatching: true,
+			wantSeverity: "warning",
+			wantSince:    []string{"warning"},
+		},
+	}
+	for _, tc := range cases {
+		if tc.state.State == RuleFiringState {
+			tc.state.FiringTime = longAgo
+		}
+		_, _, evaluation, err := compiled.check(conditionInput{value: tc.value}, tc.state)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		if evaluation.matching != tc.wantMatching || evaluation.severity != tc.wantSeverity {
+			t.Errorf("%s: matching = %v, severity = %q, want %v and %q",
+				tc.name, evaluation.matching, evaluation.severity, tc.wantMatching, tc.wantSeverity)
+		}
+		if len(evaluation.since) != len(tc.wantSince) {
+			t.Errorf("%s: since = %v, want levels %v", tc.name, evaluation.since, tc.wantSince)
+		}
+		for _, name := range tc.wantSince {
+			if previous, ok := tc.state.SeveritySince[name]; ok && !evaluation.since[name].Equal(previous) {
+				t.Errorf("%s: since of %s was not kept", tc.name, name)
+			}
+		}
+	}
+}
+
+func TestBuildAlertingRules_Severities(t *testing.T) {
+	t.Parallel()
+	rule := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+		r.Spec.Condition = severitiesCondition()
+		r.Spec.PrometheusRule = &searchrulerv1alpha1.PrometheusRuleSpec{
+			Enabled: true,
+			Labels:  map[string]string{"severity": "page", "team": "search"},
+		}
+	})
+	got, err := buildAlertingRules(rule)
+	if err != nil {
+		t.Fatalf("buildAlertingRules: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d alerting rules, want one per level", len(got))
+	}
+	want := []struct{ severity, expr, forDuration string }{
+		{"warning", `searchrule_value{searchrule_namespace="default",rule="demo"} > 100`, "1m"},
+		{"critical", `searchrule_value{searchrule_namespace="default",rule="demo"} > 200`, "0s"},
+	}
+	for i, w := range want {
+		if got[i].Labels["severity"] != w.severity || got[i].Labels["team"] != "search" {
+			t.Errorf("rule %d labels = %v, want severity %q and the user labels", i, got[i].Labels, w.severity)
+		}
+		if got[i].Expr.String() != w.expr {
+			t.Errorf("rule %d expr = %q, want %q", i, got[i].Expr.String(), w.expr)
+		}
+		if got[i].For == nil || string(*got[i].For) != w.forDuration {
+			t.Errorf("rule %d for = %v, want %s", i, got[i].For, w.forDuration)
+		}
+	}
+}
+
+func TestBuildAlertingRules_RangeSeverities(t *testing.T) {
+	t.Parallel()
+	rule := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+		r.Spec.Condition = searchrulerv1alpha1.Condition{
+			Operator: conditionOutside,
+			For:      "1m",
+			Severities: []searchrulerv1alpha1.SeverityLevel{
+				{Name: "warning", LowerThreshold: "10", UpperThreshold: "90"},
+				{Name: "critical", LowerThreshold: "1", UpperThreshold: "99", For: "0s"},
+			},
+		}
+		r.Spec.PrometheusRule = &searchrulerv1alpha1.PrometheusRuleSpec{Enabled: true}
+	})
+	got, err := buildAlertingRules(rule)
+	if err != nil {
+		t.Fatalf("buildAlertingRules: %v", err)
+	}
+	want := []string{
+		`(searchrule_value{searchrule_namespace="default",rule="demo"} < 10 or searchrule_value{searchrule_namespace="default",rule="demo"} > 90)`,
+		`(searchrule_value{searchrule_namespace="default",rule="demo"} < 1 or searchrule_value{searchrule_namespace="default",rule="demo"} > 99)`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d alerting rules, want one per level", len(got))
+	}
+	for i, expr := range want {
+		if got[i].Expr.String() != expr {
+			t.Errorf("rule %d expr = %q, want %q", i, got[i].Expr.String(), expr)
+		}
+	}
+}
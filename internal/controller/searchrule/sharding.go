@@ -0,0 +1,75 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	//
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+)
+
+// ownsRule tells whether this replica evaluates the rule. Every replica evaluates every rule
+// when the rules are not sharded
+func (r *SearchRuleReconciler) ownsRule(resource *searchrulerv1alpha1.SearchRule) bool {
+	if r.Shard == nil {
+		return true
+	}
+	return r.Shard.Owns(fmt.Sprintf("%s_%s", resource.Namespace, resource.Name))
+}
+
+// releaseRule hands the rule over to the replica owning it now. Its state is kept in its status
+// for the new owner to resume it, unless the new owner evaluated it already, and the rule leaves
+// the pools of this replica
+func (r *SearchRuleReconciler) releaseRule(ctx context.Context, resource *searchrulerv1alpha1.SearchRule) error {
+
+	rule, exists := r.RulesPool.Get(fmt.Sprintf("%s_%s", resource.Namespace, resource.Name))
+	if !exists {
+		return nil
+	}
+
+	status := resource.Status.RuleState
+	if status == nil || !timeFromStatus(status.LastEvaluationTime).After(rule.LastEvaluationTime) {
+		r.saveRuleState(resource)
+		if err := r.Status().Update(ctx, resource); err != nil {
+			return err
+		}
+	}
+
+	log.FromContext(ctx).Info(fmt.Sprintf("Rule %s/%s handed off to the replica %s",
+		resource.Namespace, resource.Name, r.Shard.Owner(fmt.Sprintf("%s_%s", resource.Namespace, resource.Name))))
+	return r.Sync(ctx, watch.Deleted, resource)
+}
+
+// enqueueRules sends every SearchRule to the channel, so each replica releases the rules it no
+// longer owns and evaluates the ones it owns now after the members of the shard changed
+func (r *SearchRuleReconciler) enqueueRules(ctx context.Context, rebalance chan<- event.GenericEvent) {
+
+	rules := &searchrulerv1alpha1.SearchRuleList{}
+	if err := r.List(ctx, rules); err != nil {
+		log.FromContext(ctx).Info(fmt.Sprintf("Failed to list the SearchRules to rebalance: %v", err))
+		return
+	}
+	for i := range rules.Items {
+		rebalance <- event.GenericEvent{Object: &rules.Items[i]}
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/pools"
+	"freepik.com/searchruler/internal/sharding"
+)
+
+func TestReleaseRule(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	evaluated := time.Now().Add(-time.Minute)
+
+	cases := []struct {
+		name string
+		// statusEvaluation is when the rule was evaluated for the status, zero when never
+		statusEvaluation time.Time
+		wantState        string
+	}{
+		{name: "state handed off", wantState: RuleFiringState},
+		{name: "evaluated by the new owner already", statusEvaluation: time.Now(), wantState: RulePendingFiringState},
+	}
+	for _, tc := range cases {
+		resource := newSearchRule(nil)
+		if !tc.statusEvaluation.IsZero() {
+			resource.Status.RuleState = &searchrulerv1alpha1.SearchRuleStateStatus{
+				RuleStateStatus:    searchrulerv1alpha1.RuleStateStatus{State: RulePendingFiringState},
+				LastEvaluationTime: timeToStatus(tc.statusEvaluation),
+			}
+		}
+		r := &SearchRuleReconciler{
+			Client: fake.NewClientBuilder().WithScheme(newScheme(t)).
+				WithObjects(resource).WithStatusSubresource(resource).Build(),
+			RulesPool:  newRulesPool(),
+			AlertsPool: &pools.AlertsStore{Store: map[string]*pools.Alert{}},
+			Shard:      sharding.NewShard(sharding.Options{Identity: "replica-1"}),
+		}
+		r.RulesPool.Set("default_demo", &pools.Rule{
+			RuleState:          pools.RuleState{State: RuleFiringState, FiringTime: evaluated.Add(-time.Hour)},
+			LastEvaluationTime: evaluated,
+		})
+		r.AlertsPool.Set("default_demo", &pools.Alert{})
+
+		if r.ownsRule(resource) {
+			t.Fatalf("%s: a replica without members must not own any rule", tc.name)
+		}
+		if err := r.releaseRule(ctx, resource); err != nil {
+			t.Fatalf("%s: releaseRule: %v", tc.name, err)
+		}
+
+		// The rule leaves the pools of the replica
+		if _, exists := r.RulesPool.Get("default_demo"); exists {
+			t.Errorf("%s: the rule is still in the rules pool", tc.name)
+		}
+		if _, exists := r.AlertsPool.Get("default_demo"); exists {
+			t.Errorf("%s: the alert of the rule is still in the alerts pool", tc.name)
+		}
+
+		// The new owner resumes it from the status
+		stored := &searchrulerv1alpha1.SearchRule{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(resource), stored); err != nil {
+			t.Fatalf("%s: get: %v", tc.name, err)
+		}
+		if stored.Status.RuleState == nil || stored.Status.RuleState.State != tc.wantState {
+			t.Errorf("%s: status = %+v, want state %s", tc.name, stored.Status.RuleState, tc.wantState)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/pools"
+)
+
+// The rules pool lives in memory, so the state of every rule is kept in its status too. A rule
+// missing in the pool, as after a restart of the operator, resumes from its status before its
+// first evaluation: the `for` timers keep running and a firing rule does not wait them again
+
+// rehydrateRule adds the rule to the rules pool with the state kept in its status, when it is not
+// in the pool yet or when the status is newer, as when another replica evaluated the rule since.
+// It returns the rule in the pool
+func (r *SearchRuleReconciler) rehydrateRule(resource *v1alpha1.SearchRule, ruleKey string) pools.Rule {
+
+	status := resource.Status.RuleState
+	rule, exists := r.RulesPool.Get(ruleKey)
+	if status == nil || exists && !timeFromStatus(status.LastEvaluationTime).After(rule.LastEvaluationTime) {
+		return rule
+	}
+
+	rule = pools.Rule{
+		SearchRule:         *resource,
+		RuleState:          ruleStateFromStatus(status.RuleStateStatus),
+		LastEvaluationTime: timeFromStatus(status.LastEvaluationTime),
+	}
+	if len(status.Buckets) > 0 {
+		rule.Buckets = make(map[string]pools.BucketState, len(status.Buckets))
+		for _, bucket := range status.Buckets {
+			rule.Buckets[bucket.Key] = pools.BucketState{
+				RuleState: ruleStateFromStatus(bucket.RuleStateStatus),
+				Labels:    bucket.Labels,
+			}
+		}
+	}
+	r.RulesPool.Set(ruleKey, &rule)
+	return rule
+}
+
+// saveRuleState keeps the state of the rule in the pool in its status
+func (r *SearchRuleReconciler) saveRuleState(resource *v1alpha1.SearchRule) {
+
+	rule, exists := r.RulesPool.Get(fmt.Sprintf("%s_%s", resource.Namespace, resource.Name))
+	if !exists {
+		return
+	}
+
+	status := &v1alpha1.SearchRuleStateStatus{
+		RuleStateStatus:    ruleStateToStatus(rule.RuleState),
+		LastEvaluationTime: timeToStatus(rule.LastEvaluationTime),
+	}
+
+	// Buckets are sorted, so the status does not change between evaluations without changes
+	keys := make([]string, 0, len(rule.Buckets))
+	for key := range rule.Buckets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		bucket := rule.Buckets[key]
+		status.Buckets = append(status.Buckets, v1alpha1.BucketStateStatus{
+			Key:             key,
+			Labels:          bucket.Labels,
+			RuleStateStatus: ruleStateToStatus(bucket.RuleState),
+		})
+	}
+	resource.Status.RuleState = status
+}
+
+// ruleStateToStatus returns the state of a rule, or of a bucket, as kept in the status
+func ruleStateToStatus(state pools.RuleState) v1alpha1.RuleStateStatus {
+
+	status := v1alpha1.RuleStateStatus{
+		State:         state.State,
+		FiringTime:    timeToStatus(state.FiringTime),
+		ResolvingTime: timeToStatus(state.ResolvingTime),
+		Severity:      state.Severity,
+	}
+	if len(state.SeveritySince) > 0 {
+		status.SeveritySince = make(map[string]metav1.Time, len(state.SeveritySince))
+		for level, since := range state.SeveritySince {
+			status.SeveritySince[level] = metav1.NewTime(since)
+		}
+	}
+	return status
+}
+
+// ruleStateFromStatus returns the state of a rule, or of a bucket, kept in the status
+func ruleStateFromStatus(status v1alpha1.RuleStateStatus) pools.RuleState {
+
+	state := pools.RuleState{
+		State:         status.State,
+		FiringTime:    timeFromStatus(status.FiringTime),
+		ResolvingTime: timeFromStatus(status.ResolvingTime),
+		Severity:      status.Severity,
+	}
+	if state.State == "" {
+		state.State = RuleNormalState
+	}
+	if len(status.SeveritySince) > 0 {
+		state.SeveritySince = make(map[string]time.Time, len(status.SeveritySince))
+		for level, since := range status.SeveritySince {
+			state.SeveritySince[level] = since.Time
+		}
+	}
+	return state
+}
+
+// timeToStatus returns the time as kept in the status, where zero times are not set
+func timeToStatus(t time.Time) *metav1.Time {
+	if t.IsZero() {
+		return nil
+	}
+	statusTime := metav1.NewTime(t)
+	return &statusTime
+}
+
+// timeFromStatus returns the time kept in the status, or the zero time when it is not set
+func timeFromStatus(t *metav1.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.Time
+}
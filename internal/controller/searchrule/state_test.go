@@ -0,0 +1,129 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/pools"
+)
+
+func newRulesPool() *pools.RulesStore {
+	return &pools.RulesStore{Store: map[string]*pools.Rule{}}
+}
+
+func TestRuleStateRoundTrip(t *testing.T) {
+	t.Parallel()
+	now := time.Now().Truncate(time.Second)
+	resource := newSearchRule(nil)
+
+	// The operator evaluated the rule and kept its state in the status
+	before := &SearchRuleReconciler{RulesPool: newRulesPool()}
+	before.RulesPool.Set("default_demo", &pools.Rule{
+		SearchRule: *resource,
+		RuleState: pools.RuleState{
+			State:         RulePendingResolvedState,
+			FiringTime:    now.Add(-10 * time.Minute),
+			ResolvingTime: now.Add(-30 * time.Second),
+			Severity:      "critical",
+			SeveritySince: map[string]time.Time{"critical": now.Add(-9 * time.Minute)},
+		},
+		Value:              42,
+		LastEvaluationTime: now,
+		Buckets: map[string]pools.BucketState{
+			`service="api"`: {
+				RuleState: pools.RuleState{State: RuleFiringState, FiringTime: now.Add(-5 * time.Minute)},
+				Labels:    map[string]string{"service": "api"},
+				Value:     500,
+			},
+		},
+	})
+	before.saveRuleState(resource)
+
+	// The status goes through the API server
+	content, err := json.Marshal(resource)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	restarted := &searchrulerv1alpha1.SearchRule{}
+	if err := json.Unmarshal(content, restarted); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	// A new operator resumes the rule before its first evaluation
+	after := &SearchRuleReconciler{RulesPool: newRulesPool()}
+	rule := after.rehydrateRule(restarted, "default_demo")
+	if rule.State != RulePendingResolvedState || !rule.FiringTime.Equal(now.Add(-10*time.Minute)) ||
+		!rule.ResolvingTime.Equal(now.Add(-30*time.Second)) || rule.Severity != "critical" {
+		t.Errorf("state = %+v", rule.RuleState)
+	}
+	if !rule.SeveritySince["critical"].Equal(now.Add(-9*time.Minute)) || !rule.LastEvaluationTime.Equal(now) {
+		t.Errorf("severitySince = %v, lastEvaluationTime = %v", rule.SeveritySince, rule.LastEvaluationTime)
+	}
+	bucket := rule.Buckets[`service="api"`]
+	if bucket.State != RuleFiringState || bucket.Labels["service"] != "api" || !bucket.FiringTime.Equal(now.Add(-5*time.Minute)) {
+		t.Errorf("bucket = %+v", bucket)
+	}
+	if _, exists := after.RulesPool.Get("default_demo"); !exists {
+		t.Errorf("the rule was not added to the pool")
+	}
+}
+
+func TestRehydrateRule(t *testing.T) {
+	t.Parallel()
+	firingTime := time.Now().Add(-time.Hour)
+	resource := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+		r.Status.RuleState = &searchrulerv1alpha1.SearchRuleStateStatus{
+			RuleStateStatus: ruleStateToStatus(pools.RuleState{State: RuleFiringState, FiringTime: firingTime}),
+		}
+	})
+
+	// The pool wins over the status, unless another replica evaluated the rule since
+	r := &SearchRuleReconciler{RulesPool: newRulesPool()}
+	r.RulesPool.Set("default_demo", &pools.Rule{RuleState: pools.RuleState{State: RulePendingFiringState}})
+	if rule := r.rehydrateRule(resource, "default_demo"); rule.State != RulePendingFiringState {
+		t.Errorf("state = %s, want the one of the pool", rule.State)
+	}
+	evaluatedElsewhere := resource.DeepCopy()
+	evaluatedElsewhere.Status.RuleState.LastEvaluationTime = timeToStatus(time.Now())
+	if rule := r.rehydrateRule(evaluatedElsewhere, "default_demo"); rule.State != RuleFiringState {
+		t.Errorf("state = %s, want the one of the newer status", rule.State)
+	}
+
+	// Rules never evaluated start in the pool on their first evaluation, as before
+	r = &SearchRuleReconciler{RulesPool: newRulesPool()}
+	if rule := r.rehydrateRule(newSearchRule(nil), "default_demo"); rule.State != "" {
+		t.Errorf("state = %s, want none", rule.State)
+	}
+	if _, exists := r.RulesPool.Get("default_demo"); exists {
+		t.Errorf("a rule without state must not be added to the pool")
+	}
+
+	// A rule firing before the restart fires on its first evaluation, without waiting its `for` again
+	condition, err := compileCondition(&resource.Spec.Condition)
+	if err != nil {
+		t.Fatalf("compileCondition: %v", err)
+	}
+	rule := r.rehydrateRule(resource, "default_demo")
+	step := condition.advanceState(&rule.RuleState, true, nil, time.Minute)
+	if !step.notify || rule.State != RuleFiringState || !rule.FiringTime.Equal(firingTime) {
+		t.Errorf("step = %+v, state = %+v, want the rule to keep firing", step, rule.RuleState)
+	}
+}
@@ -122,6 +122,17 @@ func (r *SearchRuleReconciler) UpdateConditionNoQueryFound(SearchRule *v1alpha1.
 	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
 }
 
+// UpdateConditionThrottled updates the status of the SearchRule resource with a Throttled condition
+func (r *SearchRuleReconciler) UpdateConditionThrottled(SearchRule *v1alpha1.SearchRule) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonThrottledType, globals.ConditionReasonThrottledMessage)
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
 // UpdateConditionConnectionError updates the status of the SearchRule resource with a ConnectionError condition
 func (r *SearchRuleReconciler) UpdateConditionConnectionError(SearchRule *v1alpha1.SearchRule) {
 
@@ -144,6 +155,61 @@ func (r *SearchRuleReconciler) UpdateConditionQueryError(SearchRule *v1alpha1.Se
 	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
 }
 
+// UpdateConditionNoData updates the status of the SearchRule resource with a NoData condition
+func (r *SearchRuleReconciler) UpdateConditionNoData(SearchRule *v1alpha1.SearchRule) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonNoDataType, globals.ConditionReasonNoDataMessage)
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionQueryTemplateError updates the status of the SearchRule resource with a QueryTemplateError
+// condition, explaining what failed rendering the query in the message
+func (r *SearchRuleReconciler) UpdateConditionQueryTemplateError(SearchRule *v1alpha1.SearchRule, message string) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonQueryTemplateErrorType, message)
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionInvalidCondition updates the status of the SearchRule resource with an InvalidCondition
+// condition, explaining what is wrong in the message
+func (r *SearchRuleReconciler) UpdateConditionInvalidCondition(SearchRule *v1alpha1.SearchRule, message string) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonInvalidConditionType, message)
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionSuspended updates the status of the SearchRule resource with a Suspended condition,
+// as it is outside of its active windows
+func (r *SearchRuleReconciler) UpdateConditionSuspended(SearchRule *v1alpha1.SearchRule) {
+
+	// Create the new condition with the suspended status
+	condition := globals.NewCondition(globals.ConditionTypeState, metav1.ConditionTrue,
+		globals.ConditionReasonSuspendedType, globals.ConditionReasonSuspendedMessage)
+
+	// Update the status of the SearchRule resource
+	globals.UpdateCondition(&SearchRule.Status.Conditions, condition)
+}
+
+// UpdateConditionInvalidSchedule reports that the SearchRule can not be scheduled, explaining
+// what is wrong in its schedule or active windows in the message
+func (r *SearchRuleReconciler) UpdateConditionInvalidSchedule(searchRule *v1alpha1.SearchRule, message string) {
+	condition := globals.NewCondition(globals.ConditionTypeResourceSynced, metav1.ConditionFalse,
+		globals.ConditionReasonInvalidScheduleType, message)
+	globals.UpdateCondition(&searchRule.Status.Conditions, condition)
+}
+
 // UpdateConditionPrometheusRuleSynced reports a successful reconcile of the
 // auto-generated PrometheusRule resource.
 func (r *SearchRuleReconciler) UpdateConditionPrometheusRuleSynced(searchRule *v1alpha1.SearchRule) {
@@ -17,17 +17,13 @@ limitations under the License.
 package searchrule
 
 import (
-	"bytes"
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"reflect"
-	"strconv"
-	"sync"
+	"sort"
+	"strings"
 	"time"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -38,10 +34,10 @@ import (
 	"k8s.io/apimachinery/pkg/watch"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
-	"github.com/tidwall/gjson"
-
 	//
 	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/backend"
+	"freepik.com/searchruler/internal/connector"
 	"freepik.com/searchruler/internal/controller"
 	"freepik.com/searchruler/internal/globals"
 	"freepik.com/searchruler/internal/pools"
@@ -54,6 +50,7 @@ const (
 	RuleFiringState          = "Firing"
 	RulePendingFiringState   = "PendingFiring"
 	RulePendingResolvedState = "PendingResolving"
+	RuleSuspendedState       = "Suspended"
 
 	// Conditions
 	conditionGreaterThan        = "greaterThan"
@@ -61,89 +58,14 @@ const (
 	conditionLessThan           = "lessThan"
 	conditionLessThanOrEqual    = "lessThanOrEqual"
 	conditionEqual              = "equal"
+	conditionBetween            = "between"
+	conditionOutside            = "outside"
 
 	// kubeEvent
 	kubeEventReasonAlertFiring = "AlertFiring"
-
-	// Elasticsearch aggregation field
-	elasticAggregationsField = "aggregations"
-)
-
-var (
-	queryConnectorCreds *pools.Credentials
-	credsExists         bool
-
-	// Elasticsearch search path
-	ElasticsearchSearchURL = "%s/%s/_search"
-
-	// Shared HTTP client with connection pooling
-	httpClientCache = make(map[string]*http.Client)
-	httpClientMutex sync.RWMutex
 )
 
-// getOrCreateHTTPClient creates or reuses an HTTP client for the given configuration
-func getOrCreateHTTPClient(connectorSpec *v1alpha1.QueryConnectorSpec, creds *pools.Credentials) *http.Client {
-	// Create a unique key for this configuration
-	key := fmt.Sprintf("%s_%s_%t", connectorSpec.URL, connectorSpec.Credentials.SecretRef.Name, connectorSpec.TlsSkipVerify)
-
-	httpClientMutex.RLock()
-	if client, exists := httpClientCache[key]; exists {
-		httpClientMutex.RUnlock()
-		return client
-	}
-	httpClientMutex.RUnlock()
-
-	// Configure TLS settings
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: connectorSpec.TlsSkipVerify,
-	}
-
-	// Add certificates if set for elasticsearch queries
-	if connectorSpec.Certificates.SecretRef.Name != "" && creds != nil {
-		// Load client certificates for mTLS
-		cert, err := tls.X509KeyPair([]byte(creds.Cert), []byte(creds.Key))
-		if err == nil {
-			tlsConfig.Certificates = []tls.Certificate{cert}
-
-			// Add CA certificate if available for server verification
-			if creds.CA != "" {
-				caCertPool := x509.NewCertPool()
-				if caCertPool.AppendCertsFromPEM([]byte(creds.CA)) {
-					tlsConfig.RootCAs = caCertPool
-				}
-			}
-		}
-	}
-
-	// Create HTTP client with proper connection pooling and timeouts
-	transport := &http.Transport{
-		TLSClientConfig: tlsConfig,
-		// Connection pooling settings
-		MaxIdleConns:        100,
-		MaxIdleConnsPerHost: 10,
-		IdleConnTimeout:     90 * time.Second,
-		// Timeouts
-		TLSHandshakeTimeout:   10 * time.Second,
-		ResponseHeaderTimeout: 30 * time.Second,
-		// Keep alive
-		DisableKeepAlives:  false,
-		DisableCompression: false,
-	}
-
-	client := &http.Client{
-		Transport: transport,
-		Timeout:   60 * time.Second, // Overall request timeout
-	}
-
-	// Cache the client
-	httpClientMutex.Lock()
-	httpClientCache[key] = client
-	httpClientMutex.Unlock()
-
-	return client
-}
-
-// Sync execute the query to the elasticsearch and evaluate the condition. Then trigger the action adding the alert to the pool
+// Sync execute the query against the backend of the QueryConnector and evaluate the condition. Then trigger the action adding the alert to the pool
 // and sending an event to the Kubernetes API
 func (r *SearchRuleReconciler) Sync(ctx context.Context, eventType watch.EventType, resource *v1alpha1.SearchRule) (err error) {
 
@@ -153,8 +75,15 @@ func (r *SearchRuleReconciler) Sync(ctx context.Context, eventType watch.EventTy
 	// In other cases, execute Sync logic
 	if eventType == watch.Deleted {
 		key := fmt.Sprintf("%s_%s", resource.Namespace, resource.Name)
+		if rule, exists := r.RulesPool.Get(key); exists {
+			r.deleteBucketAlerts(key, rule.Buckets)
+		}
+		r.deleteErrorAlerts(key)
 		r.RulesPool.Delete(key)
 		r.AlertsPool.Delete(key)
+		if r.QueryResultsPool != nil {
+			r.QueryResultsPool.Delete(key)
+		}
 		return nil
 	}
 
@@ -200,9 +129,22 @@ func (r *SearchRuleReconciler) Sync(ctx context.Context, eventType watch.EventTy
 		return fmt.Errorf(controller.JSONMarshalErrorMessage, err)
 	}
 
+	// Same trick for the status, where the QueryConnector controller records the distribution
+	// and version of the cluster. It is empty until the first successful probe
+	QueryConnectorStatus := &v1alpha1.QueryConnectorStatus{}
+	if QueryConnectorStatusI, ok := QueryConnectorResource.Object["status"]; ok {
+		statusBytes, err := json.Marshal(QueryConnectorStatusI)
+		if err != nil {
+			return fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+		}
+		err = json.Unmarshal(statusBytes, QueryConnectorStatus)
+		if err != nil {
+			return fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+		}
+	}
 	// Get credentials for QueryConnector attached if defined
 	key := fmt.Sprintf("%s_%s", QueryConnectorResource.GetNamespace(), QueryConnectorResource.GetName())
-	queryConnectorCreds, credsExists = r.QueryConnectorCredentialsPool.Get(key)
+	queryConnectorCreds, credsExists := r.QueryConnectorCredentialsPool.Get(key)
 	if !credsExists {
 		r.UpdateConditionNoCredsFound(resource)
 		return fmt.Errorf(controller.MissingCredentialsMessage, key)
@@ -215,115 +157,65 @@ func (r *SearchRuleReconciler) Sync(ctx context.Context, eventType watch.EventTy
 		return fmt.Errorf(controller.ForValueParseErrorMessage, err)
 	}
 
-	// Check if query is defined in the resource
-	if resource.Spec.Elasticsearch.Query == nil && resource.Spec.Elasticsearch.QueryJSON == "" {
-		r.UpdateConditionNoQueryFound(resource)
-		return fmt.Errorf(controller.QueryNotDefinedErrorMessage, resource.Name)
-	}
-
-	// Check if both query and queryJson are defined. If true, return error
-	if resource.Spec.Elasticsearch.Query != nil && resource.Spec.Elasticsearch.QueryJSON != "" {
-		r.UpdateConditionNoQueryFound(resource)
-		return fmt.Errorf(controller.QueryDefinedInBothErrorMessage, resource.Name)
+	// Check the whole condition before running the query, as its nested nodes and expressions
+	// are not validated by the CRD
+	condition, err := compileCondition(&resource.Spec.Condition)
+	if err != nil {
+		err = fmt.Errorf(controller.InvalidConditionErrorMessage, err)
+		r.UpdateConditionInvalidCondition(resource, err.Error())
+		return err
 	}
-
-	// Select query to use and marshall to JSON
-	var elasticQuery []byte
-	// If query is defined in the resource, just Marshal it
-	if resource.Spec.Elasticsearch.Query != nil {
-		elasticQuery, err = json.Marshal(resource.Spec.Elasticsearch.Query)
+	var ruleComparison *comparison
+	if resource.Spec.Condition.Comparison != nil {
+		ruleComparison, err = compileComparison(resource)
 		if err != nil {
-			return fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+			err = fmt.Errorf(controller.InvalidConditionErrorMessage, err)
+			r.UpdateConditionInvalidCondition(resource, err.Error())
+			return err
 		}
 	}
-	// If queryJSON is defined in the resource, it is already a JSON, just convert it to bytes
-	if resource.Spec.Elasticsearch.QueryJSON != "" {
-		elasticQuery = []byte(resource.Spec.Elasticsearch.QueryJSON)
-	}
-
-	// Get or create HTTP client for this configuration
-	httpClient := getOrCreateHTTPClient(QueryConnectorSpec, queryConnectorCreds)
-
-	// Generate URL for search to elasticsearch
-	searchURL := fmt.Sprintf(
-		ElasticsearchSearchURL,
-		QueryConnectorSpec.URL,
-		resource.Spec.Elasticsearch.Index,
-	)
-	req, err := http.NewRequest("POST", searchURL, bytes.NewBuffer(elasticQuery))
-	if err != nil {
-		r.UpdateConditionConnectionError(resource)
-		return fmt.Errorf(controller.HttpRequestCreationErrorMessage, err)
-	}
-	defer req.Body.Close()
-
-	// Add headers and custom headers for elasticsearch queries
-	req.Header.Set("Content-Type", "application/json")
-	for key, value := range QueryConnectorSpec.Headers {
-		req.Header.Set(key, value)
-	}
 
-	// Add authentication if set for elasticsearch queries
-	if QueryConnectorSpec.Credentials.SecretRef.Name != "" {
-		req.SetBasicAuth(queryConnectorCreds.Username, queryConnectorCreds.Password)
+	// Select the query backend for the type of the QueryConnector and check the rule
+	// defines a query it can run
+	conn := &backend.Connector{
+		Namespace:   QueryConnectorResource.GetNamespace(),
+		Name:        QueryConnectorResource.GetName(),
+		Spec:        QueryConnectorSpec,
+		Status:      QueryConnectorStatus,
+		Credentials: queryConnectorCreds,
 	}
-
-	// Make request to elasticsearch
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		r.UpdateConditionConnectionError(resource)
-		return fmt.Errorf(controller.ElasticsearchQueryErrorMessage, string(elasticQuery), err)
-	}
-	defer resp.Body.Close()
-
-	// Read response and check if it is ok
-	responseBody, err := io.ReadAll(resp.Body)
+	queryBackend, err := backend.For(conn)
 	if err != nil {
 		r.UpdateConditionQueryError(resource)
-		return fmt.Errorf(controller.ResponseBodyReadErrorMessage, err)
-	}
-	if resp.StatusCode != http.StatusOK {
-		r.UpdateConditionQueryError(resource)
-		return fmt.Errorf(
-			controller.ElasticsearchQueryResponseErrorMessage,
-			string(elasticQuery),
-			string(responseBody),
-		)
+		return err
 	}
-
-	// Extract conditionField from the response field of elasticsearch
-	conditionValue := gjson.Get(string(responseBody), resource.Spec.Elasticsearch.ConditionField)
-	if !conditionValue.Exists() {
-		r.UpdateConditionQueryError(resource)
-		return fmt.Errorf(
-			controller.ConditionFieldNotFoundMessage,
-			resource.Spec.Elasticsearch.ConditionField,
-			string(responseBody),
-		)
+	err = queryBackend.Validate(resource)
+	if err != nil {
+		r.UpdateConditionNoQueryFound(resource)
+		return err
 	}
 
-	// Save elastic response if the result has aggregations, this allows user
-	// to use the response in the action
-	aggregationsResource := interface{}(nil)
-	aggregationsResponse := gjson.Get(string(responseBody), elasticAggregationsField)
-	if aggregationsResponse.Exists() {
-		aggregationsResource = aggregationsResponse.Value()
+	// Get ruleKey for the pool <namespace>_<name>. A rule not in the pool yet resumes from the
+	// state kept in its status
+	ruleKey := fmt.Sprintf("%s_%s", resource.Namespace, resource.Name)
+	previousRule := r.resumeRule(ruleKey, r.rehydrateRule(resource, ruleKey))
+	if previousRule.State == "" {
+		previousRule.State = RuleNormalState
 	}
 
-	// Evaluate condition and check if the alert is firing or not
-	firing, err := evaluateCondition(conditionValue.Float(), resource.Spec.Condition.Operator, resource.Spec.Condition.Threshold)
+	// Run the query and evaluate the condition on the response. When it fails, the noDataState
+	// or execErrorState of the rule decides what it means for its state
+	evaluation, err := r.evaluateRule(ctx, resource, conn, queryBackend, condition, ruleComparison, previousRule)
 	if err != nil {
-		r.UpdateConditionQueryError(resource)
-		return fmt.Errorf(
-			controller.EvaluatingConditionErrorMessage,
-			err,
-		)
+		r.updateQueryErrorCondition(resource, err)
+		evaluation, err = r.applyErrorState(ctx, resource, ruleKey, previousRule, err)
+		if err != nil {
+			return err
+		}
+	} else {
+		r.deleteErrorAlerts(ruleKey)
 	}
 
-	// Get ruleKey for the pool <namespace>_<name> and get rule from the pool if exists
-	// If not, create a default skeleton rule and save it to the pool
-	ruleKey := fmt.Sprintf("%s_%s", resource.Namespace, resource.Name)
-
 	// If the user removed actionRef while this rule was firing, the
 	// previously-enqueued alert would otherwise keep being notified by the
 	// RulerAction controller until the condition resolves. Drop it here so
@@ -331,8 +223,12 @@ func (r *SearchRuleReconciler) Sync(ctx context.Context, eventType watch.EventTy
 	alertKey := ruleKey
 	if resource.Spec.ActionRef == nil {
 		r.AlertsPool.Delete(alertKey)
+		r.deleteBucketAlerts(ruleKey, previousRule.Buckets)
 	}
 
+	// Get the rule from the pool if exists. If not, create a default skeleton rule and
+	// save it to the pool.
+	//
 	// Get returns a struct-level copy of the pool entry: every mutation
 	// below is local and only becomes visible to readers (the metrics
 	// goroutine, the webserver) after the explicit Set, which performs
@@ -345,12 +241,10 @@ func (r *SearchRuleReconciler) Sync(ctx context.Context, eventType watch.EventTy
 	if !ruleInPool {
 		// Initialize rule with default values
 		rule = pools.Rule{
-			SearchRule:    *resource,
-			FiringTime:    time.Time{},
-			State:         RuleNormalState,
-			ResolvingTime: time.Time{},
-			Value:         conditionValue.Float(),
-			Aggregations:  aggregationsResource,
+			SearchRule:   *resource,
+			RuleState:    pools.RuleState{State: RuleNormalState},
+			Value:        evaluation.value,
+			Aggregations: evaluation.aggregations,
 		}
 		r.RulesPool.Set(ruleKey, &rule)
 	}
@@ -364,135 +258,359 @@ func (r *SearchRuleReconciler) Sync(ctx context.Context, eventType watch.EventTy
 	// Set the current value of the condition and the aggregations payload
 	// on the pool entry so the metrics goroutine can fan out
 	// spec.customMetrics into per-bucket samples on its next tick.
-	rule.Value = conditionValue.Float()
-	rule.Aggregations = aggregationsResource
+	rule.Value = evaluation.value
+	rule.Comparison = evaluation.comparison
+	rule.Anomaly = evaluation.anomaly
+	rule.Aggregations = evaluation.aggregations
+	rule.LastEvaluationTime = time.Now()
 	r.RulesPool.Set(ruleKey, &rule)
 
-	// If rule is firing right now
-	if firing {
+	// Rules evaluated per bucket keep a state and an alert for every bucket
+	if condition.buckets != nil {
+		r.AlertsPool.Delete(alertKey)
+		return r.syncBuckets(ctx, resource, ruleKey, &rule, condition, evaluation.buckets, forDuration)
+	}
+
+	// The rule was evaluated per bucket before, so the alerts of its buckets are stale
+	if rule.Buckets != nil {
+		r.deleteBucketAlerts(ruleKey, rule.Buckets)
+		rule.Buckets = nil
+	}
 
-		// If rule is not set as firing in the pool, set start fireTime and state PendingFiring
-		if rule.State == RuleNormalState || rule.State == RulePendingResolvedState {
-			rule.FiringTime = time.Now()
-			rule.State = RulePendingFiringState
-			r.RulesPool.Set(ruleKey, &rule)
+	// Move the rule through its states. It fires after matching during the `for` time, and
+	// resolves after not matching during the `for` time
+	step := condition.advanceState(&rule.RuleState, evaluation.firing, evaluation.severities, forDuration)
+	r.RulesPool.Set(ruleKey, &rule)
+
+	switch {
+
+	// If rule is firing the For time, notify it. The alert is refreshed on every evaluation
+	// while it fires
+	case step.notify:
+
+		// Only enqueue the alert (and emit a Kubernetes Event for the
+		// RulerAction controller) when actionRef is configured. SearchRules
+		// that route exclusively through prometheusRule will skip this
+		// path; their alert lifecycle is owned by Prometheus + Alertmanager.
+		if resource.Spec.ActionRef != nil {
+			err = r.notifyAlert(ctx, resource, alertKey, &pools.Alert{
+				Value:        evaluation.value,
+				Aggregations: evaluation.aggregations,
+				Conditions:   evaluation.matches,
+				Severity:     rule.Severity,
+				Comparison:   evaluation.comparison,
+			}, step.previousSeverity)
+			if err != nil {
+				return err
+			}
 		}
 
-		// If rule is firing the For time and it is not notified yet, do it and change state to Firing
-		if time.Since(rule.FiringTime) > forDuration {
-			rule.State = RuleFiringState
-			r.RulesPool.Set(ruleKey, &rule)
-
-			// Only enqueue the alert (and emit a Kubernetes Event for the
-			// RulerAction controller) when actionRef is configured. SearchRules
-			// that route exclusively through prometheusRule will skip this
-			// path; their alert lifecycle is owned by Prometheus + Alertmanager.
-			if resource.Spec.ActionRef != nil {
-				r.AlertsPool.Set(alertKey, &pools.Alert{
-					RulerActionName: resource.Spec.ActionRef.Name,
-					SearchRule:      *resource,
-					Value:           conditionValue.Float(),
-					Aggregations:    aggregationsResource,
-				})
-
-				// Create an event in Kubernetes of AlertFiring. This event will be readed by the RulerAction controller
-				// and will trigger the action inmediately
-				err = createKubeEvent(
-					ctx,
-					*resource,
-					kubeEventReasonAlertFiring,
-					fmt.Sprintf("Rule is in firing state. Current value is %v", conditionValue),
-				)
-				if err != nil {
-					return fmt.Errorf(controller.KubeEventCreationErrorMessage, err)
-				}
+		// Log the alert and change the AlertStatus to Firing of the searchRule
+		r.UpdateConditionAlertFiring(resource)
+		logger.Info(fmt.Sprintf(
+			"Rule %s is in firing state. Current value is %v",
+			resource.Name,
+			evaluation.value,
+		))
+		return nil
+
+	// If rule stayed in PendingResolved state during the `for` time, it is resolved
+	case step.resolved:
+
+		// Remove alert from the pool
+		r.AlertsPool.Delete(alertKey)
+
+		// Log and update the AlertStatus to Resolved
+		r.UpdateStateNormal(resource)
+		logger.Info(fmt.Sprintf(
+			"Rule %s is in normal state. Current value is %v",
+			resource.Name,
+			evaluation.value,
+		))
+		return nil
+	}
+
+	r.updateStateCondition(resource, rule.State)
+	return nil
+}
+
+// syncBuckets moves every bucket through its states with its evaluation, firing and
+// resolving the alert of each bucket on its own. Buckets missing in the response do
+// not match anymore, so they resolve after the `for` time
+func (r *SearchRuleReconciler) syncBuckets(ctx context.Context, resource *v1alpha1.SearchRule, ruleKey string,
+	rule *pools.Rule, condition *compiledCondition, evaluations []bucketEvaluation, forDuration time.Duration) error {
+
+	logger := log.FromContext(ctx)
+
+	missing := map[string]pools.BucketState{}
+	for key, state := range rule.Buckets {
+		missing[key] = state
+	}
+
+	states := map[string]pools.BucketState{}
+	advance := func(key string, state pools.BucketState, evaluation bucketEvaluation) error {
+
+		step := condition.advanceState(&state.RuleState, evaluation.firing, evaluation.severities, forDuration)
+		alertKey := bucketAlertKey(ruleKey, key)
+		switch {
+		case step.notify && resource.Spec.ActionRef != nil:
+			err := r.notifyAlert(ctx, resource, alertKey, &pools.Alert{
+				Value:        state.Value,
+				Aggregations: rule.Aggregations,
+				Conditions:   evaluation.matches,
+				Severity:     state.Severity,
+				Labels:       state.Labels,
+			}, step.previousSeverity)
+			if err != nil {
+				return err
 			}
+		case step.resolved:
+			r.AlertsPool.Delete(alertKey)
+			logger.Info(fmt.Sprintf("Bucket %s of rule %s is in normal state", key, resource.Name))
+		}
 
-			// Log the alert and change the AlertStatus to Firing of the searchRule
-			r.UpdateConditionAlertFiring(resource)
-			logger.Info(fmt.Sprintf(
-				"Rule %s is in firing state. Current value is %v",
-				resource.Name,
-				conditionValue,
-			))
-			return nil
+		if state.State != RuleNormalState {
+			states[key] = state
+		}
+		return nil
+	}
 
+	for _, evaluation := range evaluations {
+		state, ok := missing[evaluation.key]
+		if !ok {
+			state.State = RuleNormalState
 		}
+		delete(missing, evaluation.key)
 
-		r.UpdateStateAlertPendingFiring(resource)
+		state.Labels = evaluation.labels
+		state.Value = evaluation.value
+		if err := advance(evaluation.key, state, evaluation); err != nil {
+			return err
+		}
+	}
+	for key, state := range missing {
+		if err := advance(key, state, bucketEvaluation{}); err != nil {
+			return err
+		}
+	}
+
+	// The rule is in the state of its most advanced bucket
+	rule.Buckets = states
+	rule.RuleState = condition.summarizeBuckets(states)
+	r.RulesPool.Set(ruleKey, rule)
+
+	if rule.State == RuleFiringState {
+		r.UpdateConditionAlertFiring(resource)
+		logger.Info(fmt.Sprintf("Rule %s is in firing state for %d buckets", resource.Name, countFiring(states)))
 		return nil
+	}
+	r.updateStateCondition(resource, rule.State)
+	return nil
+}
+
+// notifyAlert enqueues the alert for the RulerAction of the rule and creates the Kubernetes
+// events of the firing alert and of its change of severity, if any
+func (r *SearchRuleReconciler) notifyAlert(ctx context.Context, resource *v1alpha1.SearchRule, alertKey string,
+	alert *pools.Alert, previousSeverity string) error {
 
+	alert.RulerActionName = resource.Spec.ActionRef.Name
+	alert.SearchRule = *resource
+	if previousAlert, exists := r.AlertsPool.Get(alertKey); exists {
+		alert.PreviousSeverity = previousAlert.PreviousSeverity
 	}
+	severityChanged := previousSeverity != "" && previousSeverity != alert.Severity
+	if severityChanged {
+		alert.PreviousSeverity = previousSeverity
+	}
+	r.AlertsPool.Set(alertKey, alert)
 
-	// If alert is not firing right now and it is not in healthy state
-	if !firing && rule.State != RuleNormalState {
+	// The labels of the bucket tell which one of the alerts of the rule is firing
+	subject := "Rule"
+	if len(alert.Labels) > 0 {
+		subject = fmt.Sprintf("Rule bucket %s", formatLabels(alert.Labels))
+	}
 
-		// If rule is not marked as resolving in the pool, change state to PendingResolved and set resolvingTime now
-		if rule.State != RulePendingResolvedState {
-			rule.State = RulePendingResolvedState
-			rule.ResolvingTime = time.Now()
-			r.RulesPool.Set(ruleKey, &rule)
+	// Create an event in Kubernetes of AlertFiring. This event will be readed by the RulerAction controller
+	// and will trigger the action inmediately
+	err := createKubeEvent(
+		ctx,
+		*resource,
+		kubeEventReasonAlertFiring,
+		fmt.Sprintf("%s is in firing state. Current value is %v", subject, alert.Value),
+	)
+	if err != nil {
+		return fmt.Errorf(controller.KubeEventCreationErrorMessage, err)
+	}
+
+	// A change of level is notified as an event of its own, as (warning -> critical)
+	if severityChanged {
+		err = createKubeEvent(
+			ctx,
+			*resource,
+			kubeEventReasonSeverityChanged,
+			fmt.Sprintf("%s severity changed from %s to %s. Current value is %v",
+				subject, previousSeverity, alert.Severity, alert.Value),
+		)
+		if err != nil {
+			return fmt.Errorf(controller.KubeEventCreationErrorMessage, err)
 		}
+	}
+	return nil
+}
+
+// updateQueryErrorCondition updates the status of the rule with the reason its query failed
+func (r *SearchRuleReconciler) updateQueryErrorCondition(resource *v1alpha1.SearchRule, err error) {
+	switch {
+	case errors.Is(err, connector.ErrThrottled):
+		r.UpdateConditionThrottled(resource)
+	case errors.Is(err, backend.ErrNoData):
+		r.UpdateConditionNoData(resource)
+	case errors.Is(err, errQueryTemplate):
+		r.UpdateConditionQueryTemplateError(resource, err.Error())
+	case errors.Is(err, backend.ErrQuery), errors.Is(err, backend.ErrInvalidRule):
+		r.UpdateConditionQueryError(resource)
+	default:
+		r.UpdateConditionConnectionError(resource)
+	}
+}
 
-		// If rule stay in PendingResolved state during the `for` time, mark as resolved
-		if time.Since(rule.ResolvingTime) > forDuration {
+// updateStateCondition updates the State condition of the rule for the states not firing
+func (r *SearchRuleReconciler) updateStateCondition(resource *v1alpha1.SearchRule, state string) {
+	switch state {
+	case RulePendingFiringState:
+		r.UpdateStateAlertPendingFiring(resource)
+	case RulePendingResolvedState:
+		r.UpdateStateAlertPendingResolved(resource)
+	default:
+		r.UpdateStateNormal(resource)
+	}
+}
 
-			// Remove alert from the pool
-			r.AlertsPool.Delete(alertKey)
+// deleteBucketAlerts removes the alerts of the buckets of a rule from the alerts pool
+func (r *SearchRuleReconciler) deleteBucketAlerts(ruleKey string, buckets map[string]pools.BucketState) {
+	for key := range buckets {
+		r.AlertsPool.Delete(bucketAlertKey(ruleKey, key))
+	}
+}
 
-			// Restore rule to default values
-			rule = pools.Rule{
-				FiringTime:    time.Time{},
-				State:         RuleNormalState,
-				ResolvingTime: time.Time{},
-				SearchRule:    *resource,
-				Value:         conditionValue.Float(),
-				Aggregations:  aggregationsResource,
+// stateStep is what changed on a step of the state machine of a rule, or of a bucket
+type stateStep struct {
+	// notify is set while the alert is firing after its `for` time
+	notify bool
+
+	// resolved is set when the alert resolved, and the state is back to normal
+	resolved bool
+
+	// previousSeverity is the level the alert fired at before this step
+	previousSeverity string
+}
+
+// advanceState moves the state with the result of an evaluation. A matching rule is pending
+// until it matched during the `for` time, and fires then. A firing rule not matching anymore
+// is resolving until it did not match during the `for` time, and is back to normal then.
+// Rules with severities wait the `for` of their levels instead. A rule with a resolveThreshold
+// matching again while resolving after it fired keeps firing, as the hysteresis means it never
+// stopped, where any other rule is pending again
+func (c *compiledCondition) advanceState(state *pools.RuleState, firing bool, severities *severityEvaluation,
+	forDuration time.Duration) stateStep {
+
+	if severities != nil {
+		state.SeveritySince = severities.since
+	}
+
+	// If rule is firing right now
+	if firing {
+
+		// If rule is not set as firing in the pool, set start fireTime and state PendingFiring.
+		// A rule with a resolveThreshold that fired and did not resolve yet keeps firing since
+		// its firingTime instead
+		switch {
+		case state.State == RuleNormalState || state.State == RulePendingResolvedState && !(c.hysteresis && hasFired(*state)):
+			state.FiringTime = time.Now()
+			state.State = RulePendingFiringState
+		case state.State == RulePendingResolvedState:
+			state.ResolvingTime = time.Time{}
+			state.State = RuleFiringState
+		}
+
+		// If rule is firing the For time, change state to Firing. Rules with severities are
+		// ready once a level matched during its own `for`, and keep firing at their current
+		// level meanwhile
+		ready := time.Since(state.FiringTime) > forDuration
+		previousSeverity := state.Severity
+		if severities != nil {
+			ready = severities.severity != "" || state.State == RuleFiringState
+			if severities.severity != "" {
+				state.Severity = severities.severity
 			}
-			r.RulesPool.Set(ruleKey, &rule)
-
-			// Log and update the AlertStatus to Resolved
-			r.UpdateStateNormal(resource)
-			logger.Info(fmt.Sprintf(
-				"Rule %s is in normal state. Current value is %v",
-				resource.Name,
-				conditionValue,
-			))
-			return nil
 		}
+		if !ready {
+			return stateStep{}
+		}
+		state.State = RuleFiringState
+		return stateStep{notify: true, previousSeverity: previousSeverity}
+	}
 
-		r.UpdateStateAlertPendingResolved(resource)
-		return nil
+	// If alert is not firing right now and it is not in healthy state
+	if state.State == RuleNormalState {
+		return stateStep{}
 	}
 
-	r.UpdateStateNormal(resource)
-	return nil
+	// If rule is not marked as resolving, change state to PendingResolved and set resolvingTime now.
+	// A rule with a resolveThreshold resolving before it fired forgets its firingTime, so it is
+	// not taken as fired
+	if state.State != RulePendingResolvedState {
+		if c.hysteresis && state.State == RulePendingFiringState {
+			state.FiringTime = time.Time{}
+		}
+		state.State = RulePendingResolvedState
+		state.ResolvingTime = time.Now()
+	}
+
+	// If rule stay in PendingResolved state during the `for` time, mark as resolved. Rules with
+	// severities wait the `for` of the level they fired at
+	resolveFor := forDuration
+	if len(c.levels) > 0 {
+		resolveFor = c.severityFor(state.Severity, forDuration)
+	}
+	if time.Since(state.ResolvingTime) <= resolveFor {
+		return stateStep{}
+	}
+	*state = pools.RuleState{State: RuleNormalState}
+	return stateStep{resolved: true}
 }
 
-// evaluateCondition evaluates the conditionField with the operator and threshold
-func evaluateCondition(value float64, operator string, threshold string) (bool, error) {
+// hasFired tells whether the rule is firing or resolving after firing, when the hysteresis
+// of the resolveThreshold applies
+func hasFired(state pools.RuleState) bool {
+	return state.State == RuleFiringState ||
+		state.State == RulePendingResolvedState && !state.FiringTime.IsZero()
+}
 
-	// Parse threshold to float
-	floatThreshold, err := strconv.ParseFloat(threshold, 64)
-	if err != nil {
-		return false, fmt.Errorf("configured threshold is not a valid float: %v", threshold)
-	}
-
-	// Evaluate condition
-	switch operator {
-	case conditionGreaterThan:
-		return value > floatThreshold, nil
-	case conditionGreaterThanOrEqual:
-		return value >= floatThreshold, nil
-	case conditionLessThan:
-		return value < floatThreshold, nil
-	case conditionLessThanOrEqual:
-		return value <= floatThreshold, nil
-	case conditionEqual:
-		return value == floatThreshold, nil
-	default:
-		return false, fmt.Errorf("unknown configured operator: %q", operator)
+// countFiring returns how many of the buckets are firing
+func countFiring(states map[string]pools.BucketState) int {
+	count := 0
+	for _, state := range states {
+		if state.State == RuleFiringState {
+			count++
+		}
+	}
+	return count
+}
+
+// formatLabels renders the labels of a bucket sorted by name, as {service="api"}
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, labels[name]))
 	}
+	return "{" + strings.Join(pairs, ",") + "}"
 }
 
 // createKubeEvent creates a modern event in Kubernetes with data given by params
@@ -508,7 +626,7 @@ func createKubeEvent(ctx context.Context, rule v1alpha1.SearchRule, action, mess
 		ReportingController: "searchruler",
 		ReportingInstance:   "searchruler-controller",
 		Action:              action,
-		Reason:              "AlertFiring",
+		Reason:              action,
 
 		Regarding: corev1.ObjectReference{
 			APIVersion: rule.APIVersion,
@@ -0,0 +1,130 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+)
+
+// minutesPerDay is the end of a window lasting until midnight, written `24:00`
+const minutesPerDay = 24 * 60
+
+// weekdays are the days of the active windows
+var weekdays = map[v1alpha1.Weekday]time.Weekday{
+	"Mon": time.Monday,
+	"Tue": time.Tuesday,
+	"Wed": time.Wednesday,
+	"Thu": time.Thursday,
+	"Fri": time.Friday,
+	"Sat": time.Saturday,
+	"Sun": time.Sunday,
+}
+
+// activeWindow is an active window of a rule, with its times as minutes of the day
+type activeWindow struct {
+	days     map[time.Weekday]bool
+	start    int
+	end      int
+	location *time.Location
+}
+
+// compileActiveWindows checks the active windows of the rule
+func compileActiveWindows(resource *v1alpha1.SearchRule) ([]activeWindow, error) {
+
+	windows := make([]activeWindow, 0, len(resource.Spec.ActiveWindows))
+	for i, spec := range resource.Spec.ActiveWindows {
+
+		window := activeWindow{days: map[time.Weekday]bool{}}
+		for _, day := range spec.Days {
+			weekday, ok := weekdays[day]
+			if !ok {
+				return nil, fmt.Errorf("activeWindows[%d].days: unknown day %q", i, day)
+			}
+			window.days[weekday] = true
+		}
+
+		var err error
+		if window.start, err = minuteOfDay(spec.Start); err != nil || window.start == minutesPerDay {
+			return nil, fmt.Errorf("activeWindows[%d].start %q must be a time as HH:MM", i, spec.Start)
+		}
+		if window.end, err = minuteOfDay(spec.End); err != nil {
+			return nil, fmt.Errorf("activeWindows[%d].end %q must be a time as HH:MM", i, spec.End)
+		}
+		if window.location, err = time.LoadLocation(spec.Timezone); err != nil {
+			return nil, fmt.Errorf("activeWindows[%d].timezone %q: %v", i, spec.Timezone, err)
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// minuteOfDay returns the minutes since midnight of a time written as HH:MM, up to `24:00`
+func minuteOfDay(value string) (int, error) {
+
+	hourSpec, minuteSpec, found := strings.Cut(value, ":")
+	hour, hourErr := strconv.Atoi(hourSpec)
+	minute, minuteErr := strconv.Atoi(minuteSpec)
+	if !found || hourErr != nil || minuteErr != nil || len(hourSpec) != 2 || len(minuteSpec) != 2 ||
+		hour < 0 || minute < 0 || minute > 59 || hour*60+minute > minutesPerDay {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return hour*60 + minute, nil
+}
+
+// activeAt tells whether the time is in any of the windows. Rules without windows are always
+// active
+func activeAt(windows []activeWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for _, window := range windows {
+		if window.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains tells whether the time is in the window. A window ending before it starts goes on
+// until its end the day after
+func (w activeWindow) contains(t time.Time) bool {
+
+	local := t.In(w.location)
+	minute := local.Hour()*60 + local.Minute()
+	onDay := func(day time.Weekday) bool {
+		return len(w.days) == 0 || w.days[day]
+	}
+
+	if w.start < w.end {
+		return onDay(local.Weekday()) && minute >= w.start && minute < w.end
+	}
+	yesterday := (local.Weekday() + 6) % 7
+	return (onDay(local.Weekday()) && minute >= w.start) || (onDay(yesterday) && minute < w.end)
+}
+
+// ruleActive tells whether the rule is evaluated at the time, as it is in one of its active
+// windows. Rules with invalid windows are not
+func ruleActive(resource *v1alpha1.SearchRule, t time.Time) bool {
+	windows, err := compileActiveWindows(resource)
+	return err == nil && activeAt(windows, t)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchrule
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+)
+
+func TestActiveAt(t *testing.T) {
+	t.Parallel()
+	businessHours := searchrulerv1alpha1.ActiveWindow{
+		Days:  []searchrulerv1alpha1.Weekday{"Mon", "Tue", "Wed", "Thu", "Fri"},
+		Start: "09:00", End: "18:00", Timezone: "Europe/Madrid",
+	}
+	// Friday 2024-03-08
+	friday := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 8, hour, minute, 0, 0, time.UTC)
+	}
+
+	cases := []struct {
+		name    string
+		windows []searchrulerv1alpha1.ActiveWindow
+		at      time.Time
+		want    bool
+	}{
+		{name: "no windows", at: friday(3, 0), want: true},
+		{name: "in business hours", windows: []searchrulerv1alpha1.ActiveWindow{businessHours}, at: friday(8, 0), want: true},
+		{name: "before the start", windows: []searchrulerv1alpha1.ActiveWindow{businessHours}, at: friday(7, 59), want: false},
+		{name: "end excluded", windows: []searchrulerv1alpha1.ActiveWindow{businessHours}, at: friday(17, 0), want: false},
+		{name: "before the end", windows: []searchrulerv1alpha1.ActiveWindow{businessHours}, at: friday(16, 59), want: true},
+		{name: "weekend", windows: []searchrulerv1alpha1.ActiveWindow{businessHours}, at: friday(10, 0).AddDate(0, 0, 1), want: false},
+		{name: "until midnight", windows: []searchrulerv1alpha1.ActiveWindow{{Start: "20:00", End: "24:00"}},
+			at: friday(23, 59), want: true},
+		{name: "across midnight, first day", windows: []searchrulerv1alpha1.ActiveWindow{{Days: []searchrulerv1alpha1.Weekday{"Fri"}, Start: "22:00", End: "06:00"}},
+			at: friday(23, 0), want: true},
+		{name: "across midnight, day after", windows: []searchrulerv1alpha1.ActiveWindow{{Days: []searchrulerv1alpha1.Weekday{"Fri"}, Start: "22:00", End: "06:00"}},
+			at: friday(5, 0).AddDate(0, 0, 1), want: true},
+		{name: "across midnight, not started", windows: []searchrulerv1alpha1.ActiveWindow{{Days: []searchrulerv1alpha1.Weekday{"Fri"}, Start: "22:00", End: "06:00"}},
+			at: friday(5, 0), want: false},
+		{name: "any window", windows: []searchrulerv1alpha1.ActiveWindow{businessHours, {Days: []searchrulerv1alpha1.Weekday{"Sat"}, Start: "10:00", End: "12:00"}},
+			at: friday(10, 30).AddDate(0, 0, 1), want: true},
+	}
+	for _, tc := range cases {
+		resource := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+			r.Spec.ActiveWindows = tc.windows
+		})
+		windows, err := compileActiveWindows(resource)
+		if err != nil {
+			t.Fatalf("%s: compileActiveWindows: %v", tc.name, err)
+		}
+		if got := activeAt(windows, tc.at); got != tc.want {
+			t.Errorf("%s: activeAt = %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCompileActiveWindowsErrors(t *testing.T) {
+	t.Parallel()
+	for _, window := range []searchrulerv1alpha1.ActiveWindow{
+		{Start: "9:00", End: "18:00"},
+		{Start: "09:00", End: "24:01"},
+		{Start: "24:00", End: "06:00"},
+		{Start: "09:60", End: "18:00"},
+		{Start: "09:00", End: "18:00", Timezone: "Mars/Olympus"},
+		{Days: []searchrulerv1alpha1.Weekday{"Monday"}, Start: "09:00", End: "18:00"},
+	} {
+		resource := newSearchRule(func(r *searchrulerv1alpha1.SearchRule) {
+			r.Spec.ActiveWindows = []searchrulerv1alpha1.ActiveWindow{window}
+		})
+		if _, err := compileActiveWindows(resource); err == nil {
+			t.Errorf("%+v: expected an error", window)
+		}
+	}
+}
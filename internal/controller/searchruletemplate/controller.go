@@ -0,0 +1,112 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchruletemplate
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	runtimecontroller "sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	//
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/controller"
+)
+
+// SearchRuleTemplateReconciler reconciles a SearchRuleTemplate object
+type SearchRuleTemplateReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// MaxConcurrentReconciles is how many SearchRuleTemplates are reconciled at the same time
+	MaxConcurrentReconciles int
+}
+
+// +kubebuilder:rbac:groups=searchruler.freepik.com,resources=searchruletemplates,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=searchruler.freepik.com,resources=searchruletemplates/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=searchruler.freepik.com,resources=searchruletemplates/finalizers,verbs=update
+
+// +kubebuilder:rbac:groups=searchruler.freepik.com,resources=searchrules,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.19.0/pkg/reconcile
+func (r *SearchRuleTemplateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	logger := log.FromContext(ctx)
+
+	// 1. Get the content of the SearchRuleTemplate
+	templateResource := &searchrulerv1alpha1.SearchRuleTemplate{}
+	err = r.Get(ctx, req.NamespacedName, templateResource)
+
+	// 2. Check existence on the cluster
+	if err != nil {
+
+		// 2.1 It does NOT exist: its SearchRules are deleted with it, as it owns them
+		if err = client.IgnoreNotFound(err); err == nil {
+			logger.Info(fmt.Sprintf(controller.ResourceNotFoundError, controller.SearchRuleTemplateResourceType, req.NamespacedName))
+			return result, err
+		}
+
+		// 2.2 Failed to get the resource, requeue the request
+		logger.Info(fmt.Sprintf(controller.CanNotGetResourceError, controller.SearchRuleTemplateResourceType, req.NamespacedName, err.Error()))
+		return result, err
+	}
+
+	// 3. Nothing to do while it is being deleted
+	if !templateResource.DeletionTimestamp.IsZero() {
+		return result, nil
+	}
+
+	// 4. Update the status before the requeue, without hiding the error of the sync
+	defer func() {
+		if statusErr := r.Status().Update(ctx, templateResource); statusErr != nil {
+			logger.Info(fmt.Sprintf(controller.ResourceConditionUpdateError, controller.SearchRuleTemplateResourceType, req.NamespacedName, statusErr.Error()))
+			if err == nil {
+				err = statusErr
+			}
+		}
+	}()
+
+	// 5. Render the instances and apply their SearchRules
+	err = r.Sync(ctx, templateResource)
+	if err != nil {
+		r.UpdateConditionKubernetesApiCallFailure(templateResource)
+		logger.Info(fmt.Sprintf(controller.SyncTargetError, controller.SearchRuleTemplateResourceType, req.NamespacedName, err.Error()))
+		return result, err
+	}
+
+	return result, err
+}
+
+// SetupWithManager sets up the controller with the Manager. The SearchRules of a template are
+// watched too, so the ones edited or deleted by hand are rendered again
+func (r *SearchRuleTemplateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&searchrulerv1alpha1.SearchRuleTemplate{}).
+		Owns(&searchrulerv1alpha1.SearchRule{}).
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		Named("searchruletemplate").
+		WithOptions(runtimecontroller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(r)
+}
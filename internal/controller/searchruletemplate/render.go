@@ -0,0 +1,214 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchruletemplate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/controller"
+	"freepik.com/searchruler/internal/template"
+)
+
+const (
+
+	// Length of the revision of a template, in hex characters of the hash of its parameters and
+	// its skeleton
+	revisionLength = 10
+
+	// What text/template prints for a value missing in the data
+	missingValue = "<no value>"
+)
+
+// renderedRule is a SearchRule generated from a template, ready to be applied
+type renderedRule struct {
+	name        string
+	labels      map[string]string
+	annotations map[string]string
+	spec        v1alpha1.SearchRuleSpec
+}
+
+// revision returns the revision of the template, which changes with its parameters and its
+// skeleton but not with its instances
+func revision(resource *v1alpha1.SearchRuleTemplate) (string, error) {
+
+	content, err := json.Marshal(struct {
+		Parameters []v1alpha1.TemplateParameter `json:"parameters"`
+		Template   v1alpha1.SearchRuleSkeleton  `json:"template"`
+	}{resource.Spec.Parameters, resource.Spec.Template})
+	if err != nil {
+		return "", fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+	}
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])[:revisionLength], nil
+}
+
+// instanceValues returns the values of the parameters for the instance, with the defaults of
+// the ones it does not set. Values of parameters not declared are rejected, as they are
+// usually a typo
+func instanceValues(parameters []v1alpha1.TemplateParameter, instance v1alpha1.SearchRuleTemplateInstance) (map[string]string, error) {
+
+	declared := make(map[string]bool, len(parameters))
+	values := make(map[string]string, len(parameters))
+	for _, parameter := range parameters {
+		declared[parameter.Name] = true
+		value, set := instance.Values[parameter.Name]
+		switch {
+		case set:
+			values[parameter.Name] = value
+		case parameter.Default != "":
+			values[parameter.Name] = parameter.Default
+		case parameter.Required:
+			return nil, fmt.Errorf(controller.TemplateParameterMissingMessage, parameter.Name)
+		default:
+			values[parameter.Name] = ""
+		}
+	}
+
+	names := make([]string, 0, len(instance.Values))
+	for name := range instance.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !declared[name] {
+			return nil, fmt.Errorf(controller.TemplateParameterUnknownMessage, name)
+		}
+	}
+	return values, nil
+}
+
+// renderInstance renders the skeleton of the template with the values of the instance. The
+// rendered spec must be a valid SearchRule spec, so a typo in a field name fails here instead
+// of being dropped silently
+func renderInstance(resource *v1alpha1.SearchRuleTemplate, instance v1alpha1.SearchRuleTemplateInstance) (*renderedRule, error) {
+
+	values, err := instanceValues(resource.Spec.Parameters, instance)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]interface{}{
+		"values":    values,
+		"name":      instance.Name,
+		"namespace": resource.Namespace,
+		"template":  resource.Name,
+	}
+
+	rule := &renderedRule{name: instance.Name}
+	rule.labels, err = renderStrings("labels", resource.Spec.Template.Labels, data)
+	if err != nil {
+		return nil, err
+	}
+	rule.annotations, err = renderStrings("annotations", resource.Spec.Template.Annotations, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every string of the spec is rendered on its own, so the values never break its structure
+	var skeleton interface{}
+	if resource.Spec.Template.Spec != nil {
+		if err := json.Unmarshal(resource.Spec.Template.Spec.Raw, &skeleton); err != nil {
+			return nil, fmt.Errorf(controller.TemplateSpecErrorMessage, err)
+		}
+	}
+	spec, err := renderNode("spec", skeleton, data)
+	if err != nil {
+		return nil, err
+	}
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf(controller.JSONMarshalErrorMessage, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(specJSON))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rule.spec); err != nil {
+		return nil, fmt.Errorf(controller.TemplateSpecErrorMessage, err)
+	}
+	return rule, nil
+}
+
+// renderNode returns a copy of the node of the skeleton with its strings rendered. The path
+// of the node tells where a template failed
+func renderNode(path string, node interface{}, data map[string]interface{}) (interface{}, error) {
+
+	switch typed := node.(type) {
+	case string:
+		return renderString(path, typed, data)
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(typed))
+		for key, value := range typed {
+			renderedValue, err := renderNode(path+"."+key, value, data)
+			if err != nil {
+				return nil, err
+			}
+			rendered[key] = renderedValue
+		}
+		return rendered, nil
+	case []interface{}:
+		rendered := make([]interface{}, len(typed))
+		for i, value := range typed {
+			renderedValue, err := renderNode(fmt.Sprintf("%s[%d]", path, i), value, data)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = renderedValue
+		}
+		return rendered, nil
+	}
+	return node, nil
+}
+
+// renderStrings returns a copy of the map with its values rendered
+func renderStrings(path string, values map[string]string, data map[string]interface{}) (map[string]string, error) {
+
+	if values == nil {
+		return nil, nil
+	}
+	rendered := make(map[string]string, len(values))
+	for key, value := range values {
+		renderedValue, err := renderString(path+"."+key, value, data)
+		if err != nil {
+			return nil, err
+		}
+		rendered[key] = renderedValue
+	}
+	return rendered, nil
+}
+
+// renderString renders a string of the skeleton. Strings without templates are kept as they are,
+// and the ones reading a value that does not exist fail instead of holding `<no value>`
+func renderString(path, value string, data map[string]interface{}) (string, error) {
+
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+	rendered, err := template.EvaluateTemplate(value, data)
+	if err == nil && strings.Contains(rendered, missingValue) {
+		err = fmt.Errorf(controller.TemplateMissingValueMessage)
+	}
+	if err != nil {
+		return "", fmt.Errorf(controller.TemplateRenderErrorMessage, path, err)
+	}
+	return rendered, nil
+}
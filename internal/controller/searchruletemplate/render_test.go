@@ -0,0 +1,189 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchruletemplate
+
+import (
+	"strings"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+)
+
+// newTemplate returns a template counting the errors of a service, with a required service
+// and a threshold of 100 by default
+func newTemplate(modify func(*searchrulerv1alpha1.SearchRuleTemplate)) *searchrulerv1alpha1.SearchRuleTemplate {
+	template := &searchrulerv1alpha1.SearchRuleTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "errors", Namespace: "default", UID: "uid-errors"},
+		Spec: searchrulerv1alpha1.SearchRuleTemplateSpec{
+			Parameters: []searchrulerv1alpha1.TemplateParameter{
+				{Name: "service", Required: true},
+				{Name: "threshold", Default: "100"},
+			},
+			Template: searchrulerv1alpha1.SearchRuleSkeleton{
+				Labels: map[string]string{"service": "{{ .values.service }}"},
+				Spec: &apiextensionsv1.JSON{Raw: []byte(`{
+					"queryConnectorRef": {"name": "logs"},
+					"checkInterval": "1m",
+					"elasticsearch": {
+						"index": "logs-{{ .values.service }}-*",
+						"conditionField": "hits.total.value",
+						"query": {"query": {"range": {"@timestamp": {"gte": "{{` + "`{{ .from }}`" + `}}"}}}}
+					},
+					"condition": {"operator": "greaterThan", "threshold": "{{ .values.threshold }}", "for": "1m"}
+				}`)},
+			},
+		},
+	}
+	if modify != nil {
+		modify(template)
+	}
+	return template
+}
+
+func TestRevision(t *testing.T) {
+	t.Parallel()
+	template := newTemplate(nil)
+	base, err := revision(template)
+	if err != nil {
+		t.Fatalf("revision: %v", err)
+	}
+	if len(base) != revisionLength {
+		t.Errorf("revision = %q, want %d characters", base, revisionLength)
+	}
+
+	// Instances do not change the revision, the parameters and the skeleton do
+	template.Spec.Instances = []searchrulerv1alpha1.SearchRuleTemplateInstance{{Name: "checkout"}}
+	if got, _ := revision(template); got != base {
+		t.Errorf("revision changed with the instances")
+	}
+	template.Spec.Parameters[1].Default = "50"
+	if got, _ := revision(template); got == base {
+		t.Errorf("revision did not change with the default of a parameter")
+	}
+}
+
+func TestInstanceValues(t *testing.T) {
+	t.Parallel()
+	parameters := newTemplate(nil).Spec.Parameters
+	cases := []struct {
+		name    string
+		values  map[string]string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:   "defaults",
+			values: map[string]string{"service": "checkout"},
+			want:   map[string]string{"service": "checkout", "threshold": "100"},
+		},
+		{
+			name:   "overridden default",
+			values: map[string]string{"service": "checkout", "threshold": "20"},
+			want:   map[string]string{"service": "checkout", "threshold": "20"},
+		},
+		{
+			name:    "missing required",
+			values:  map[string]string{"threshold": "20"},
+			wantErr: "parameter service is required",
+		},
+		{
+			name:    "unknown parameter",
+			values:  map[string]string{"service": "checkout", "treshold": "20"},
+			wantErr: "unknown parameter treshold",
+		},
+	}
+	for _, tc := range cases {
+		got, err := instanceValues(parameters, searchrulerv1alpha1.SearchRuleTemplateInstance{Name: "rule", Values: tc.values})
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s: error = %v, want it to contain %q", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		for key, value := range tc.want {
+			if got[key] != value {
+				t.Errorf("%s: %s = %q, want %q", tc.name, key, got[key], value)
+			}
+		}
+	}
+}
+
+func TestRenderInstance(t *testing.T) {
+	t.Parallel()
+	template := newTemplate(nil)
+	rendered, err := renderInstance(template, searchrulerv1alpha1.SearchRuleTemplateInstance{
+		Name:   "checkout-errors",
+		Values: map[string]string{"service": "checkout"},
+	})
+	if err != nil {
+		t.Fatalf("renderInstance: %v", err)
+	}
+	if rendered.labels["service"] != "checkout" {
+		t.Errorf("labels = %v", rendered.labels)
+	}
+	if rendered.spec.Elasticsearch.Index != "logs-checkout-*" || rendered.spec.Condition.Threshold != "100" {
+		t.Errorf("spec = %+v", rendered.spec)
+	}
+
+	// Escaped templates reach the SearchRule, to be rendered on every evaluation
+	if query := string(rendered.spec.Elasticsearch.Query.Raw); !strings.Contains(query, `"gte":"{{ .from }}"`) {
+		t.Errorf("query = %s, want the query template of the SearchRule", query)
+	}
+}
+
+func TestRenderInstanceErrors(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name    string
+		spec    string
+		wantErr string
+	}{
+		{
+			name:    "unknown field",
+			spec:    `{"checkInterval": "1m", "chekInterval": "1m"}`,
+			wantErr: "not a valid SearchRule spec",
+		},
+		{
+			name:    "invalid template",
+			spec:    `{"description": "{{ .values.service "}`,
+			wantErr: "error rendering spec.description",
+		},
+		{
+			name:    "unescaped template of the SearchRule",
+			spec:    `{"actionRef": {"name": "slack", "data": "{{ .value }}"}}`,
+			wantErr: "error rendering spec.actionRef.data",
+		},
+	}
+	for _, tc := range cases {
+		template := newTemplate(func(t *searchrulerv1alpha1.SearchRuleTemplate) {
+			t.Spec.Template.Spec = &apiextensionsv1.JSON{Raw: []byte(tc.spec)}
+		})
+		_, err := renderInstance(template, searchrulerv1alpha1.SearchRuleTemplateInstance{
+			Name:   "checkout-errors",
+			Values: map[string]string{"service": "checkout"},
+		})
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: error = %v, want it to contain %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchruletemplate
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/globals"
+)
+
+// UpdateConditionSuccess updates the status of the SearchRuleTemplate resource with a success condition
+func (r *SearchRuleTemplateReconciler) UpdateConditionSuccess(SearchRuleTemplate *v1alpha1.SearchRuleTemplate) {
+
+	// Create the new condition with the success status
+	condition := globals.NewCondition(globals.ConditionTypeResourceSynced, metav1.ConditionTrue,
+		globals.ConditionReasonTargetSynced, globals.ConditionReasonTargetSyncedMessage)
+
+	// Update the status of the SearchRuleTemplate resource
+	globals.UpdateCondition(&SearchRuleTemplate.Status.Conditions, condition)
+}
+
+// UpdateConditionKubernetesApiCallFailure updates the status of the SearchRuleTemplate resource with a failure condition
+func (r *SearchRuleTemplateReconciler) UpdateConditionKubernetesApiCallFailure(SearchRuleTemplate *v1alpha1.SearchRuleTemplate) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeResourceSynced, metav1.ConditionFalse,
+		globals.ConditionReasonKubernetesApiCallErrorType, globals.ConditionReasonKubernetesApiCallErrorMessage)
+
+	// Update the status of the SearchRuleTemplate resource
+	globals.UpdateCondition(&SearchRuleTemplate.Status.Conditions, condition)
+}
+
+// UpdateConditionInstancesError updates the status of the SearchRuleTemplate resource with an InstancesError
+// condition, telling how many instances failed in the message. Every failure is in the status of its instance
+func (r *SearchRuleTemplateReconciler) UpdateConditionInstancesError(SearchRuleTemplate *v1alpha1.SearchRuleTemplate, message string) {
+
+	// Create the new condition with the failure status
+	condition := globals.NewCondition(globals.ConditionTypeResourceSynced, metav1.ConditionFalse,
+		globals.ConditionReasonInstancesErrorType, message)
+
+	// Update the status of the SearchRuleTemplate resource
+	globals.UpdateCondition(&SearchRuleTemplate.Status.Conditions, condition)
+}
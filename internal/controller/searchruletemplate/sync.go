@@ -0,0 +1,142 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchruletemplate
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	//
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/controller"
+)
+
+// Sync renders every instance of the template and applies it as a SearchRule owned by the
+// template, then deletes the SearchRules of the template that are no longer instances. An
+// instance failing to render keeps the SearchRule of its last revision, and is reported in
+// the status without stopping the others
+func (r *SearchRuleTemplateReconciler) Sync(ctx context.Context, resource *v1alpha1.SearchRuleTemplate) error {
+
+	logger := log.FromContext(ctx)
+
+	templateRevision, err := revision(resource)
+	if err != nil {
+		return err
+	}
+
+	// Revisions the instances were rendered from, kept for the ones failing now
+	previous := make(map[string]string, len(resource.Status.Instances))
+	for _, instance := range resource.Status.Instances {
+		previous[instance.Name] = instance.Revision
+	}
+
+	instances := make([]v1alpha1.SearchRuleTemplateInstanceStatus, 0, len(resource.Spec.Instances))
+	wanted := make(map[string]bool, len(resource.Spec.Instances))
+	failed := 0
+	for _, instance := range resource.Spec.Instances {
+		wanted[instance.Name] = true
+		status := v1alpha1.SearchRuleTemplateInstanceStatus{Name: instance.Name, Revision: templateRevision}
+
+		err := r.applyInstance(ctx, resource, instance, templateRevision)
+		if err != nil {
+			failed++
+			status.Revision = previous[instance.Name]
+			status.Error = err.Error()
+			logger.Info(fmt.Sprintf("SearchRule %s of template %s can not be applied: %v", instance.Name, resource.Name, err))
+		}
+		instances = append(instances, status)
+	}
+
+	// Delete the SearchRules generated from the template that are no longer instances
+	rules := &v1alpha1.SearchRuleList{}
+	err = r.List(ctx, rules, client.InNamespace(resource.Namespace),
+		client.MatchingLabels{controller.TemplateLabel: resource.Name})
+	if err != nil {
+		return err
+	}
+	for i := range rules.Items {
+		rule := &rules.Items[i]
+		if wanted[rule.Name] || !metav1.IsControlledBy(rule, resource) {
+			continue
+		}
+		err = r.Delete(ctx, rule)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		logger.Info(fmt.Sprintf("SearchRule %s of template %s deleted, it is no longer an instance", rule.Name, resource.Name))
+	}
+
+	resource.Status.Revision = templateRevision
+	resource.Status.Instances = instances
+	if failed > 0 {
+		r.UpdateConditionInstancesError(resource, fmt.Sprintf(controller.TemplateInstancesErrorMessage, failed, len(instances)))
+		return nil
+	}
+	r.UpdateConditionSuccess(resource)
+	return nil
+}
+
+// applyInstance renders the instance and creates or updates its SearchRule. SearchRules of the
+// same name not generated by the template are left untouched
+func (r *SearchRuleTemplateReconciler) applyInstance(ctx context.Context, resource *v1alpha1.SearchRuleTemplate,
+	instance v1alpha1.SearchRuleTemplateInstance, templateRevision string) error {
+
+	rendered, err := renderInstance(resource, instance)
+	if err != nil {
+		return err
+	}
+
+	rule := &v1alpha1.SearchRule{}
+	rule.Name = rendered.name
+	rule.Namespace = resource.Namespace
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, rule, func() error {
+
+		// The SearchRule exists when it has a resourceVersion
+		if rule.ResourceVersion != "" && !metav1.IsControlledBy(rule, resource) {
+			return fmt.Errorf(controller.TemplateInstanceConflictMessage, rule.Name)
+		}
+		if err := controllerutil.SetControllerReference(resource, rule, r.Scheme); err != nil {
+			return err
+		}
+
+		// Labels and annotations set by others are kept, the ones of the skeleton win
+		if rule.Labels == nil {
+			rule.Labels = map[string]string{}
+		}
+		for key, value := range rendered.labels {
+			rule.Labels[key] = value
+		}
+		rule.Labels[controller.TemplateLabel] = resource.Name
+		if rule.Annotations == nil {
+			rule.Annotations = map[string]string{}
+		}
+		for key, value := range rendered.annotations {
+			rule.Annotations[key] = value
+		}
+		rule.Annotations[controller.TemplateRevisionAnnotation] = templateRevision
+
+		rule.Spec = rendered.spec
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package searchruletemplate
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	searchrulerv1alpha1 "freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/controller"
+	"freepik.com/searchruler/internal/globals"
+)
+
+func newReconciler(t *testing.T, objects ...*searchrulerv1alpha1.SearchRule) *SearchRuleTemplateReconciler {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("clientgoscheme: %v", err)
+	}
+	if err := searchrulerv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("searchrulerv1alpha1: %v", err)
+	}
+	builder := fake.NewClientBuilder().WithScheme(scheme)
+	for _, object := range objects {
+		builder = builder.WithObjects(object)
+	}
+	return &SearchRuleTemplateReconciler{Client: builder.Build(), Scheme: scheme}
+}
+
+func getRule(t *testing.T, r *SearchRuleTemplateReconciler, name string) *searchrulerv1alpha1.SearchRule {
+	t.Helper()
+	rule := &searchrulerv1alpha1.SearchRule{}
+	err := r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, rule)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("get %s: %v", name, err)
+	}
+	return rule
+}
+
+func TestSyncInstances(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	r := newReconciler(t)
+	template := newTemplate(func(t *searchrulerv1alpha1.SearchRuleTemplate) {
+		t.Spec.Instances = []searchrulerv1alpha1.SearchRuleTemplateInstance{
+			{Name: "checkout-errors", Values: map[string]string{"service": "checkout"}},
+			{Name: "payments-errors", Values: map[string]string{"service": "payments", "threshold": "20"}},
+		}
+	})
+
+	if err := r.Sync(ctx, template); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	firstRevision := template.Status.Revision
+	payments := getRule(t, r, "payments-errors")
+	if payments == nil || payments.Spec.Condition.Threshold != "20" || payments.Spec.Elasticsearch.Index != "logs-payments-*" {
+		t.Fatalf("payments-errors = %+v", payments)
+	}
+	if payments.Labels[controller.TemplateLabel] != "errors" || payments.Annotations[controller.TemplateRevisionAnnotation] != firstRevision {
+		t.Errorf("labels = %v, annotations = %v", payments.Labels, payments.Annotations)
+	}
+	if !metav1.IsControlledBy(payments, template) {
+		t.Errorf("payments-errors is not owned by the template")
+	}
+	if len(template.Status.Instances) != 2 || template.Status.Instances[0].Revision != firstRevision {
+		t.Errorf("instances = %+v", template.Status.Instances)
+	}
+
+	// A change of the template renders every instance again, and removed instances are deleted
+	template.Spec.Parameters[1].Default = "50"
+	template.Spec.Instances = template.Spec.Instances[:1]
+	if err := r.Sync(ctx, template); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if template.Status.Revision == firstRevision {
+		t.Fatalf("revision did not change")
+	}
+	checkout := getRule(t, r, "checkout-errors")
+	if checkout.Spec.Condition.Threshold != "50" || checkout.Annotations[controller.TemplateRevisionAnnotation] != template.Status.Revision {
+		t.Errorf("checkout-errors was not rendered again: %+v", checkout)
+	}
+	if getRule(t, r, "payments-errors") != nil {
+		t.Errorf("payments-errors is no longer an instance and must be deleted")
+	}
+}
+
+func TestSyncInstanceErrors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	// A SearchRule created by hand with the name of an instance is never taken over
+	existing := &searchrulerv1alpha1.SearchRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "search-errors", Namespace: "default"},
+		Spec:       searchrulerv1alpha1.SearchRuleSpec{CheckInterval: "5m"},
+	}
+	r := newReconciler(t, existing)
+	template := newTemplate(func(t *searchrulerv1alpha1.SearchRuleTemplate) {
+		t.Spec.Instances = []searchrulerv1alpha1.SearchRuleTemplateInstance{
+			{Name: "checkout-errors", Values: map[string]string{"service": "checkout"}},
+			{Name: "search-errors", Values: map[string]string{"service": "search"}},
+			{Name: "missing-service"},
+		}
+	})
+
+	if err := r.Sync(ctx, template); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if getRule(t, r, "checkout-errors") == nil {
+		t.Errorf("the failing instances must not stop the others")
+	}
+	if rule := getRule(t, r, "search-errors"); rule.Spec.CheckInterval != "5m" || len(rule.OwnerReferences) != 0 {
+		t.Errorf("search-errors was taken over: %+v", rule)
+	}
+	for _, instance := range template.Status.Instances[1:] {
+		if instance.Error == "" || instance.Revision != "" {
+			t.Errorf("instance %s = %+v, want an error and no revision", instance.Name, instance)
+		}
+	}
+	condition := template.Status.Conditions[0]
+	if condition.Reason != globals.ConditionReasonInstancesErrorType || condition.Status != metav1.ConditionFalse {
+		t.Errorf("condition = %+v, want %s", condition, globals.ConditionReasonInstancesErrorType)
+	}
+}
@@ -0,0 +1,256 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cron parses the cron expressions of the SearchRules evaluated at fixed times, and
+// tells when they are due next
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearch bounds how far ahead the next time of a schedule is looked for, as expressions like
+// `0 0 30 2 *` never match
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// field is a field of an expression: its bounds and the names its values can be written with
+type field struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	dayField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}}
+	// Sunday is both 0 and 7
+	weekdayField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}}
+
+	// macros are the expressions with a name
+	macros = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// Schedule is a parsed cron expression with the five standard fields, minute, hour, day of
+// month, month and day of week, in a timezone
+type Schedule struct {
+	expression string
+	location   *time.Location
+
+	// Bits of the values matching each field
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+
+	// As in cron, when both days are restricted a day matches either of them
+	daysRestricted     bool
+	weekdaysRestricted bool
+}
+
+// Parse returns the schedule of the expression in the location. Fields accept `*`, values,
+// ranges as `1-5`, steps as `*/15` or `0-30/10`, lists of them separated by commas, and the
+// names of the months and of the days of the week. The macros from `@yearly` to `@hourly` are
+// accepted too
+func Parse(expression string, location *time.Location) (*Schedule, error) {
+
+	if location == nil {
+		location = time.UTC
+	}
+	s := &Schedule{expression: expression, location: location}
+
+	spec := strings.TrimSpace(expression)
+	if macro, ok := macros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, got %d", expression, len(fields))
+	}
+
+	var err error
+	if s.minutes, _, err = parseField(fields[0], minuteField); err != nil {
+		return nil, err
+	}
+	if s.hours, _, err = parseField(fields[1], hourField); err != nil {
+		return nil, err
+	}
+	if s.days, s.daysRestricted, err = parseField(fields[2], dayField); err != nil {
+		return nil, err
+	}
+	if s.months, _, err = parseField(fields[3], monthField); err != nil {
+		return nil, err
+	}
+	if s.weekdays, s.weekdaysRestricted, err = parseField(fields[4], weekdayField); err != nil {
+		return nil, err
+	}
+	if s.weekdays&(1<<7) != 0 {
+		s.weekdays |= 1
+	}
+	return s, nil
+}
+
+// parseField returns the bits of the values matching the field, and whether it restricts them
+func parseField(spec string, f field) (bits uint64, restricted bool, err error) {
+
+	for _, part := range strings.Split(spec, ",") {
+
+		rangeSpec, stepSpec, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			step, err = strconv.Atoi(stepSpec)
+			if err != nil || step < 1 {
+				return 0, false, fmt.Errorf("invalid step %q in the %s field", stepSpec, f.name)
+			}
+		}
+
+		var low, high int
+		switch {
+		case rangeSpec == "*" || rangeSpec == "?":
+			low, high = f.min, f.max
+			if f.max == 7 {
+				high = 6
+			}
+		case strings.Contains(rangeSpec, "-"):
+			lowSpec, highSpec, _ := strings.Cut(rangeSpec, "-")
+			if low, err = f.value(lowSpec); err != nil {
+				return 0, false, err
+			}
+			if high, err = f.value(highSpec); err != nil {
+				return 0, false, err
+			}
+			if low > high {
+				return 0, false, fmt.Errorf("invalid range %q in the %s field", rangeSpec, f.name)
+			}
+		default:
+			if low, err = f.value(rangeSpec); err != nil {
+				return 0, false, err
+			}
+			high = low
+			// `5/15` starts at 5 and goes on up to the maximum
+			if hasStep {
+				high = f.max
+			}
+		}
+
+		if rangeSpec != "*" && rangeSpec != "?" {
+			restricted = true
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, restricted, nil
+}
+
+// value returns the value of the field written as a number or as a name
+func (f field) value(spec string) (int, error) {
+	if value, ok := f.names[strings.ToUpper(spec)]; ok {
+		return value, nil
+	}
+	value, err := strconv.Atoi(spec)
+	if err != nil || value < f.min || value > f.max {
+		return 0, fmt.Errorf("invalid value %q in the %s field, must be between %d and %d", spec, f.name, f.min, f.max)
+	}
+	return value, nil
+}
+
+// Next returns the first time of the schedule after t, or the zero time when it has none in
+// the next years. Times missing in the timezone, as when the clocks go forward, are skipped,
+// and times happening twice, as when the clocks go back, are due on the first one only
+func (s *Schedule) Next(t time.Time) time.Time {
+
+	start := t
+	t = t.In(s.location).Truncate(time.Minute).Add(time.Minute)
+
+	// Hours and minutes go forward in absolute time, days and months on the calendar
+	for t.Sub(start) < maxSearch {
+		year, month, day := t.Date()
+		switch {
+		case s.months&(1<<uint(month)) == 0:
+			t = forward(t, time.Date(year, month+1, 1, 0, 0, 0, 0, s.location))
+		case !s.dayMatches(t):
+			t = forward(t, time.Date(year, month, day+1, 0, 0, 0, 0, s.location))
+		case s.hours&(1<<uint(t.Hour())) == 0:
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+		case s.minutes&(1<<uint(t.Minute())) == 0 || repeated(t):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// forward returns the candidate, or the next minute when the timezone moved the candidate back
+// to a time already checked
+func forward(current, candidate time.Time) time.Time {
+	if !candidate.After(current) {
+		return current.Add(time.Minute)
+	}
+	return candidate
+}
+
+// repeated tells whether the wall clock of the time already happened before, in the hour
+// repeated when the clocks go back
+func repeated(t time.Time) bool {
+	_, offset := t.Zone()
+	_, before := t.Add(-3 * time.Hour).Zone()
+	if before <= offset {
+		return false
+	}
+	earlier := t.Add(-time.Duration(before-offset) * time.Second)
+	return earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute() && earlier.Day() == t.Day()
+}
+
+// dayMatches tells whether the day of the time matches the day of month and the day of week
+func (s *Schedule) dayMatches(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	if s.daysRestricted && s.weekdaysRestricted {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+// Location returns the timezone of the schedule
+func (s *Schedule) Location() *time.Location {
+	return s.location
+}
+
+// String returns the expression and the timezone of the schedule
+func (s *Schedule) String() string {
+	return s.expression + " " + s.location.String()
+}
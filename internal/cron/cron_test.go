@@ -0,0 +1,99 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cron
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestNext(t *testing.T) {
+	t.Parallel()
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+	// Tuesday
+	base := time.Date(2024, 3, 5, 10, 17, 30, 0, time.UTC)
+
+	cases := []struct {
+		name       string
+		expression string
+		location   *time.Location
+		from       time.Time
+		want       time.Time
+	}{
+		{name: "every minute", expression: "* * * * *", from: base, want: time.Date(2024, 3, 5, 10, 18, 0, 0, time.UTC)},
+		{name: "on the minute", expression: "* * * * *", from: time.Date(2024, 3, 5, 10, 18, 0, 0, time.UTC),
+			want: time.Date(2024, 3, 5, 10, 19, 0, 0, time.UTC)},
+		{name: "daily", expression: "5 6 * * *", from: base, want: time.Date(2024, 3, 6, 6, 5, 0, 0, time.UTC)},
+		{name: "daily in a timezone", expression: "5 6 * * *", location: madrid, from: base,
+			want: time.Date(2024, 3, 6, 5, 5, 0, 0, time.UTC)},
+		{name: "steps", expression: "*/15 * * * *", from: base, want: time.Date(2024, 3, 5, 10, 30, 0, 0, time.UTC)},
+		{name: "range with step", expression: "0 9-17/4 * * *", from: base, want: time.Date(2024, 3, 5, 13, 0, 0, 0, time.UTC)},
+		{name: "business hours", expression: "*/30 9-17 * * MON-FRI", from: time.Date(2024, 3, 8, 17, 45, 0, 0, time.UTC),
+			want: time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)},
+		{name: "list", expression: "0 8,20 * * *", from: base, want: time.Date(2024, 3, 5, 20, 0, 0, 0, time.UTC)},
+		{name: "month names", expression: "0 0 1 jun,dec *", from: base, want: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "sunday as 7", expression: "0 0 * * 7", from: base, want: time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)},
+		{name: "day of month or of week", expression: "0 0 15 * FRI", from: base, want: time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC)},
+		{name: "leap day", expression: "0 0 29 2 *", from: base, want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "macro", expression: "@daily", from: base, want: time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC)},
+		{name: "never", expression: "0 0 30 2 *", from: base, want: time.Time{}},
+
+		// 02:30 does not exist in Madrid on the last Sunday of March, 02:30 is 00:30 UTC the day after
+		{name: "clocks going forward", expression: "30 2 * * *", location: madrid, from: time.Date(2024, 3, 30, 12, 0, 0, 0, time.UTC),
+			want: time.Date(2024, 4, 1, 0, 30, 0, 0, time.UTC)},
+		// 02:30 happens twice in Madrid on the last Sunday of October, the schedule runs on the first one
+		{name: "clocks going back", expression: "30 2 * * *", location: madrid, from: time.Date(2024, 10, 26, 12, 0, 0, 0, time.UTC),
+			want: time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC)},
+		{name: "repeated time", expression: "30 2 * * *", location: madrid, from: time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC),
+			want: time.Date(2024, 10, 28, 1, 30, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		schedule, err := Parse(tc.expression, tc.location)
+		if err != nil {
+			t.Fatalf("%s: Parse: %v", tc.name, err)
+		}
+		if got := schedule.Next(tc.from); !got.Equal(tc.want) {
+			t.Errorf("%s: Next = %s, want %s", tc.name, got.UTC(), tc.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+	for _, expression := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"* * * FOO *",
+		"@every 5m",
+	} {
+		if _, err := Parse(expression, nil); err == nil {
+			t.Errorf("%q: expected an error", expression)
+		}
+	}
+}
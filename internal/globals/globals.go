@@ -36,6 +36,9 @@ const (
 	ConditionReasonKubernetesApiCallErrorType    = "KubernetesApiCallError"
 	ConditionReasonKubernetesApiCallErrorMessage = "Call to Kubernetes API failed. More info in logs."
 
+	// Instances of a SearchRuleTemplate not rendered or applied, the message holds how many
+	ConditionReasonInstancesErrorType = "InstancesError"
+
 	// Constants for the state conditions
 	// Condition type for state
 	ConditionTypeState = "State"
@@ -78,10 +81,54 @@ const (
 	ConditionReasonQueryErrorMessage = "Error executing the query"
 	ConditionReasonQueryErrorType    = "QueryError"
 
+	// No data in the response of the query
+	ConditionReasonNoDataMessage = "The response of the query has no value to evaluate"
+	ConditionReasonNoDataType    = "NoData"
+
+	// Query template error, the message holds the reason
+	ConditionReasonQueryTemplateErrorType = "QueryTemplateError"
+
+	// Invalid condition, the message holds the reason
+	ConditionReasonInvalidConditionType = "InvalidCondition"
+
+	// Invalid schedule or active windows, the message holds the reason
+	ConditionReasonInvalidScheduleType = "InvalidSchedule"
+
+	// Rule outside of its active windows, not evaluated and with its alerts suspended
+	ConditionReasonSuspendedType    = "Suspended"
+	ConditionReasonSuspendedMessage = "Rule is outside of its active windows, its alerts are suspended"
+
 	// No certificates found
 	ConditionReasonNoCertsFoundType    = "NoCertsFound"
 	ConditionReasonNoCertsFoundMessage = "No certificates found in secret"
 
+	// Distribution detected on the QueryConnector cluster
+	ConditionTypeDistribution = "Distribution"
+
+	ConditionReasonDistributionDetectedType = "Detected"
+
+	ConditionReasonDistributionDetectionFailedType = "DetectionFailed"
+
+	ConditionReasonDistributionMismatchType = "DistributionMismatch"
+
+	// Connectivity of the QueryConnector cluster, checked on every sync
+	ConditionTypeReachable = "Reachable"
+
+	ConditionReasonReachableType = "Reachable"
+
+	ConditionReasonUnreachableType = "Unreachable"
+
+	ConditionReasonUnauthorizedType = "Unauthorized"
+
+	// Queries waiting or rejected by the limits of the QueryConnector
+	ConditionTypeThrottled = "Throttled"
+
+	ConditionReasonThrottledType    = "Throttled"
+	ConditionReasonThrottledMessage = "Query rejected by the limits of the QueryConnector"
+
+	ConditionReasonNotThrottledType    = "NotThrottled"
+	ConditionReasonNotThrottledMessage = "Queries are within the limits of the QueryConnector"
+
 	// PrometheusRule output condition
 	ConditionTypePrometheusRule = "PrometheusRule"
 
@@ -0,0 +1,121 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"freepik.com/searchruler/internal/sharding"
+)
+
+// metricsHandler serves the metrics of the registry. When the rules are sharded across replicas,
+// the metrics of every replica are served with `?aggregate=true`, so a single scrape through a
+// Service sees all the rules. Without it each replica serves its own rules, to scrape every pod
+func metricsHandler(registry *prometheus.Registry, peers sharding.Peers, bindAddress string) http.Handler {
+
+	local := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	if peers == nil {
+		return local
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("aggregate") != "true" {
+			local.ServeHTTP(w, r)
+			return
+		}
+
+		families, err := registry.Gather()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to gather metrics: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for _, body := range sharding.FetchPeers(r.Context(), peers, bindAddress, "/metrics") {
+			if body == nil {
+				continue
+			}
+			parser := expfmt.NewTextParser(model.UTF8Validation)
+			peerFamilies, err := parser.TextToMetricFamilies(bytes.NewReader(body))
+			if err != nil {
+				log.FromContext(r.Context()).Info(fmt.Sprintf("Failed to parse the metrics of a peer: %v", err))
+				continue
+			}
+			families = mergeFamilies(families, peerFamilies)
+		}
+
+		format := expfmt.NewFormat(expfmt.TypeTextPlain)
+		w.Header().Set("Content-Type", string(format))
+		encoder := expfmt.NewEncoder(w, format)
+		for _, family := range families {
+			if err := encoder.Encode(family); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// mergeFamilies adds the series of a peer to the families. A series already in the families is
+// kept as it is: each rule is exposed by the replica evaluating it only, and the health of the
+// QueryConnectors by the leader probing them only
+func mergeFamilies(families []*dto.MetricFamily, peerFamilies map[string]*dto.MetricFamily) []*dto.MetricFamily {
+
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+
+	for name, peerFamily := range peerFamilies {
+		family, exists := byName[name]
+		if !exists {
+			families = append(families, peerFamily)
+			byName[name] = peerFamily
+			continue
+		}
+		seen := make(map[string]bool, len(family.Metric))
+		for _, metric := range family.Metric {
+			seen[seriesSignature(metric)] = true
+		}
+		for _, metric := range peerFamily.Metric {
+			if !seen[seriesSignature(metric)] {
+				family.Metric = append(family.Metric, metric)
+			}
+		}
+	}
+
+	sort.Slice(families, func(i, j int) bool { return families[i].GetName() < families[j].GetName() })
+	return families
+}
+
+// seriesSignature identifies a series of a family by its labels
+func seriesSignature(metric *dto.Metric) string {
+	labels := make([]string, 0, len(metric.Label))
+	for _, label := range metric.Label {
+		labels = append(labels, fmt.Sprintf("%s=%q", label.GetName(), label.GetValue()))
+	}
+	sort.Strings(labels)
+	return strings.Join(labels, ",")
+}
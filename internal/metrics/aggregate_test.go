@@ -0,0 +1,93 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"freepik.com/searchruler/internal/sharding"
+)
+
+type testPeers []sharding.Member
+
+func (p testPeers) Peers() []sharding.Member {
+	return p
+}
+
+// newReplicaRegistry returns the registry of a replica exposing the value of its rules and the
+// health of a QueryConnector, as every replica does
+func newReplicaRegistry(t *testing.T, rules map[string]float64) *prometheus.Registry {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	values := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "searchrule_value", Help: "Value of the search rule"},
+		[]string{"searchrule_namespace", "rule"})
+	up := prometheus.NewGauge(prometheus.GaugeOpts{Name: "queryconnector_up", Help: "Whether the last probe succeeded"})
+	registry.MustRegister(values, up)
+	for rule, value := range rules {
+		values.WithLabelValues("default", rule).Set(value)
+	}
+	up.Set(1)
+	return registry
+}
+
+func TestMetricsHandlerAggregate(t *testing.T) {
+	t.Parallel()
+
+	// The peer serves its own rules on the same port as this replica
+	peer := httptest.NewServer(promhttp.HandlerFor(newReplicaRegistry(t, map[string]float64{"payments": 7}), promhttp.HandlerOpts{}))
+	defer peer.Close()
+	host, port, err := net.SplitHostPort(peer.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("peer address: %v", err)
+	}
+	handler := metricsHandler(newReplicaRegistry(t, map[string]float64{"checkout": 3}),
+		testPeers{{Identity: "replica-2", Address: host}}, ":"+port)
+
+	get := func(url string) string {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, url, nil))
+		body, _ := io.ReadAll(recorder.Result().Body)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", url, recorder.Code, body)
+		}
+		return string(body)
+	}
+
+	local := get("/metrics")
+	if !strings.Contains(local, `rule="checkout"`) || strings.Contains(local, `rule="payments"`) {
+		t.Errorf("local view = %s, want the rules of the replica only", local)
+	}
+
+	aggregated := get("/metrics?aggregate=true")
+	if !strings.Contains(aggregated, `rule="checkout"`) || !strings.Contains(aggregated, `rule="payments"`) {
+		t.Errorf("aggregated view = %s, want the rules of both replicas", aggregated)
+	}
+	if count := strings.Count(aggregated, "queryconnector_up 1"); count != 1 {
+		t.Errorf("queryconnector_up is exposed %d times, want once", count)
+	}
+	if count := strings.Count(aggregated, "# TYPE searchrule_value"); count != 1 {
+		t.Errorf("searchrule_value is declared %d times, want once", count)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"freepik.com/searchruler/internal/connector"
+	"freepik.com/searchruler/internal/pools"
+)
+
+var (
+	// Labels of every connector metric. As with SearchRules, the namespace label is prefixed so
+	// it does not collide with the target labels injected by Prometheus. It is empty for
+	// ClusterQueryConnectors
+	connectorLabels = []string{"queryconnector_namespace", "queryconnector"}
+
+	connectorUpDesc = prometheus.NewDesc("queryconnector_up",
+		"Whether the last probe of the QueryConnector succeeded",
+		connectorLabels, nil)
+	connectorLatencyDesc = prometheus.NewDesc("queryconnector_latency_seconds",
+		"Round trip of the last successful probe of the QueryConnector",
+		connectorLabels, nil)
+	connectorHealthDesc = prometheus.NewDesc("queryconnector_cluster_health",
+		"Health color reported by the cluster behind the QueryConnector, 1 for the current one",
+		append(connectorLabels, "status"), nil)
+	connectorInfoDesc = prometheus.NewDesc("queryconnector_info",
+		"Cluster behind the QueryConnector, as reported on the last successful probe",
+		append(connectorLabels, "cluster_name", "distribution", "version"), nil)
+
+	connectorInFlightDesc = prometheus.NewDesc("queryconnector_queries_in_flight",
+		"Queries of SearchRules running against the QueryConnector",
+		connectorLabels, nil)
+	connectorWaitingDesc = prometheus.NewDesc("queryconnector_queries_waiting",
+		"Queries of SearchRules waiting for the limits of the QueryConnector",
+		connectorLabels, nil)
+	connectorQueuedDesc = prometheus.NewDesc("queryconnector_queries_queued_total",
+		"Queries of SearchRules that had to wait for the limits of the QueryConnector",
+		connectorLabels, nil)
+	connectorRejectedDesc = prometheus.NewDesc("queryconnector_queries_rejected_total",
+		"Queries of SearchRules rejected after waiting maxQueueTime for the limits of the QueryConnector",
+		connectorLabels, nil)
+
+	// Colors reported by `_cluster/health`
+	healthColors = []string{connector.HealthGreen, connector.HealthYellow, connector.HealthRed}
+)
+
+// connectorsCollector exposes the last probe of every connector and the usage of their limits.
+// Samples are built on each scrape, so deleted connectors disappear without pruning anything
+type connectorsCollector struct {
+	connectorsPool *pools.ConnectorsStore
+
+	// limiters returns the stats of the connectors defining limits
+	limiters func() []connector.LimiterStats
+}
+
+func (c *connectorsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- connectorUpDesc
+	ch <- connectorLatencyDesc
+	ch <- connectorHealthDesc
+	ch <- connectorInfoDesc
+	ch <- connectorInFlightDesc
+	ch <- connectorWaitingDesc
+	ch <- connectorQueuedDesc
+	ch <- connectorRejectedDesc
+}
+
+func (c *connectorsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, stats := range c.limiters() {
+		ch <- prometheus.MustNewConstMetric(connectorInFlightDesc, prometheus.GaugeValue,
+			float64(stats.InFlight), stats.Namespace, stats.Name)
+		ch <- prometheus.MustNewConstMetric(connectorWaitingDesc, prometheus.GaugeValue,
+			float64(stats.Waiting), stats.Namespace, stats.Name)
+		ch <- prometheus.MustNewConstMetric(connectorQueuedDesc, prometheus.CounterValue,
+			float64(stats.QueuedTotal), stats.Namespace, stats.Name)
+		ch <- prometheus.MustNewConstMetric(connectorRejectedDesc, prometheus.CounterValue,
+			float64(stats.RejectedTotal), stats.Namespace, stats.Name)
+	}
+
+	for _, health := range c.connectorsPool.Snapshot() {
+		up := 0.0
+		if health.Reachable {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(connectorUpDesc, prometheus.GaugeValue, up, health.Namespace, health.Name)
+
+		if !health.Reachable {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(connectorLatencyDesc, prometheus.GaugeValue,
+			health.Latency.Seconds(), health.Namespace, health.Name)
+		ch <- prometheus.MustNewConstMetric(connectorInfoDesc, prometheus.GaugeValue, 1,
+			health.Namespace, health.Name, health.ClusterName, health.Distribution, health.Version)
+
+		// Engines without `_cluster/health` do not expose any color
+		if health.Status == "" {
+			continue
+		}
+		for _, color := range healthColors {
+			v := 0.0
+			if health.Status == color {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(connectorHealthDesc, prometheus.GaugeValue, v,
+				health.Namespace, health.Name, color)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+*/
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"freepik.com/searchruler/internal/connector"
+	"freepik.com/searchruler/internal/pools"
+)
+
+func TestConnectorsCollector(t *testing.T) {
+	t.Parallel()
+	connectorsPool := &pools.ConnectorsStore{Store: map[string]*pools.ConnectorHealth{}}
+	connectorsPool.Set("observability_logs", &pools.ConnectorHealth{
+		Namespace:    "observability",
+		Name:         "logs",
+		Reachable:    true,
+		ClusterName:  "logs",
+		Distribution: "elasticsearch",
+		Version:      "8.15.2",
+		Status:       "yellow",
+		Latency:      250 * time.Millisecond,
+	})
+	connectorsPool.Set("_audit", &pools.ConnectorHealth{Name: "audit"})
+
+	expected := `
+# HELP queryconnector_cluster_health Health color reported by the cluster behind the QueryConnector, 1 for the current one
+# TYPE queryconnector_cluster_health gauge
+queryconnector_cluster_health{queryconnector="logs",queryconnector_namespace="observability",status="green"} 0
+queryconnector_cluster_health{queryconnector="logs",queryconnector_namespace="observability",status="red"} 0
+queryconnector_cluster_health{queryconnector="logs",queryconnector_namespace="observability",status="yellow"} 1
+# HELP queryconnector_info Cluster behind the QueryConnector, as reported on the last successful probe
+# TYPE queryconnector_info gauge
+queryconnector_info{cluster_name="logs",distribution="elasticsearch",queryconnector="logs",queryconnector_namespace="observability",version="8.15.2"} 1
+# HELP queryconnector_latency_seconds Round trip of the last successful probe of the QueryConnector
+# TYPE queryconnector_latency_seconds gauge
+queryconnector_latency_seconds{queryconnector="logs",queryconnector_namespace="observability"} 0.25
+# HELP queryconnector_up Whether the last probe of the QueryConnector succeeded
+# TYPE queryconnector_up gauge
+queryconnector_up{queryconnector="audit",queryconnector_namespace=""} 0
+queryconnector_up{queryconnector="logs",queryconnector_namespace="observability"} 1
+`
+	collector := &connectorsCollector{
+		connectorsPool: connectorsPool,
+		limiters:       func() []connector.LimiterStats { return nil },
+	}
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleted connectors stop being exposed on the next scrape
+	connectorsPool.Delete("observability_logs")
+	if got := testutil.CollectAndCount(collector); got != 1 {
+		t.Errorf("got %d samples after deleting the connector, want 1", got)
+	}
+}
+
+func TestConnectorsCollector_Limits(t *testing.T) {
+	t.Parallel()
+	collector := &connectorsCollector{
+		connectorsPool: &pools.ConnectorsStore{Store: map[string]*pools.ConnectorHealth{}},
+		limiters: func() []connector.LimiterStats {
+			return []connector.LimiterStats{
+				{Namespace: "observability", Name: "logs", InFlight: 4, Waiting: 2, QueuedTotal: 10, RejectedTotal: 1},
+			}
+		},
+	}
+
+	expected := `
+# HELP queryconnector_queries_queued_total Queries of SearchRules that had to wait for the limits of the QueryConnector
+# TYPE queryconnector_queries_queued_total counter
+queryconnector_queries_queued_total{queryconnector="logs",queryconnector_namespace="observability"} 10
+# HELP queryconnector_queries_rejected_total Queries of SearchRules rejected after waiting maxQueueTime for the limits of the QueryConnector
+# TYPE queryconnector_queries_rejected_total counter
+queryconnector_queries_rejected_total{queryconnector="logs",queryconnector_namespace="observability"} 1
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"queryconnector_queries_queued_total", "queryconnector_queries_rejected_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.CollectAndCount(collector, "queryconnector_queries_in_flight", "queryconnector_queries_waiting"); got != 2 {
+		t.Errorf("got %d in flight and waiting samples, want 2", got)
+	}
+}
@@ -26,13 +26,14 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/tidwall/gjson"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/connector"
 	"freepik.com/searchruler/internal/controller/searchrule"
 	"freepik.com/searchruler/internal/pools"
+	"freepik.com/searchruler/internal/sharding"
 )
 
 type RuleMetricT struct {
@@ -71,7 +72,27 @@ var (
 		"searchrule_state": {
 			Name:   "searchrule_state",
 			Help:   "State of the search rule",
-			Labels: []string{"searchrule_namespace", "rule", "state"},
+			Labels: []string{"searchrule_namespace", "rule", "state", "severity"},
+		},
+		"searchrule_baseline_value": {
+			Name:   "searchrule_baseline_value",
+			Help:   "Value of the baseline window of the search rule, for rules compared with a baseline",
+			Labels: []string{"searchrule_namespace", "rule"},
+		},
+		"searchrule_change": {
+			Name:   "searchrule_change",
+			Help:   "Change from the baseline value to the current one of the search rule, for rules compared with a baseline",
+			Labels: []string{"searchrule_namespace", "rule"},
+		},
+		"searchrule_anomaly_lower_bound": {
+			Name:   "searchrule_anomaly_lower_bound",
+			Help:   "Lower bound learned from the history of the search rule, for rules detecting anomalies",
+			Labels: []string{"searchrule_namespace", "rule"},
+		},
+		"searchrule_anomaly_upper_bound": {
+			Name:   "searchrule_anomaly_upper_bound",
+			Help:   "Upper bound learned from the history of the search rule, for rules detecting anomalies",
+			Labels: []string{"searchrule_namespace", "rule"},
 		},
 	}
 
@@ -87,6 +108,7 @@ var (
 		searchrule.RuleFiringState,
 		searchrule.RulePendingFiringState,
 		searchrule.RulePendingResolvedState,
+		searchrule.RuleSuspendedState,
 	}
 
 	// customMetricsTruncated counts how many times a SearchRule emitted
@@ -104,9 +126,10 @@ var (
 	customMgr = newCustomMetricManager()
 )
 
-// Run starts the metrics server for the rules
+// Run starts the metrics server for the rules. When the rules are sharded across replicas, peers
+// lists the other replicas to aggregate their metrics on request
 func Run(ctx context.Context, rulesMetricsAddr string, rulesPool *pools.RulesStore,
-	rulesMetricsRefreshSec int) (err error) {
+	connectorsPool *pools.ConnectorsStore, rulesMetricsRefreshSec int, peers sharding.Peers) (err error) {
 
 	logger := log.FromContext(ctx)
 
@@ -120,9 +143,15 @@ func Run(ctx context.Context, rulesMetricsAddr string, rulesPool *pools.RulesSto
 	if err := prometheusRegistry.Register(customMetricsTruncated); err != nil {
 		return fmt.Errorf("failed to register custom-metrics counter: %w", err)
 	}
+	if err := prometheusRegistry.Register(&connectorsCollector{
+		connectorsPool: connectorsPool,
+		limiters:       connector.Limiters,
+	}); err != nil {
+		return fmt.Errorf("failed to register connectors collector: %w", err)
+	}
 
 	// Metrics http handler
-	http.Handle("/metrics", promhttp.HandlerFor(&prometheusRegistry, promhttp.HandlerOpts{}))
+	http.Handle("/metrics", metricsHandler(&prometheusRegistry, peers, rulesMetricsAddr))
 
 	// Start the metrics server
 	server := &http.Server{Addr: rulesMetricsAddr}
@@ -203,7 +232,7 @@ func updateMetrics(ctx context.Context, rulesPool *pools.RulesStore) error {
 		// --- legacy gauges -----------------------------------------------
 		if g, ok := defaultRuleMetrics["searchrule_value"]; ok {
 			g.WithLabelValues(ns, ruleName).Set(rule.Value)
-			seenBasic[basicSeriesKey{metric: "searchrule_value", labels: [3]string{ns, ruleName, ""}}] = struct{}{}
+			seenBasic[basicSeriesKey{metric: "searchrule_value", labels: [4]string{ns, ruleName}}] = struct{}{}
 		}
 		if g, ok := defaultRuleMetrics["searchrule_state"]; ok {
 			for _, state := range ruleStates {
@@ -211,8 +240,37 @@ func updateMetrics(ctx context.Context, rulesPool *pools.RulesStore) error {
 				if rule.State == state {
 					v = 1
 				}
-				g.WithLabelValues(ns, ruleName, state).Set(v)
-				seenBasic[basicSeriesKey{metric: "searchrule_state", labels: [3]string{ns, ruleName, state}}] = struct{}{}
+				g.WithLabelValues(ns, ruleName, state, rule.Severity).Set(v)
+				seenBasic[basicSeriesKey{metric: "searchrule_state", labels: [4]string{ns, ruleName, state, rule.Severity}}] = struct{}{}
+			}
+		}
+
+		// Rules compared with a baseline also expose it, and the change they evaluate
+		if rule.Comparison != nil {
+			comparisonValues := map[string]float64{
+				"searchrule_baseline_value": rule.Comparison.Baseline,
+				"searchrule_change":         rule.Comparison.Change,
+			}
+			for metric, value := range comparisonValues {
+				if g, ok := defaultRuleMetrics[metric]; ok {
+					g.WithLabelValues(ns, ruleName).Set(value)
+					seenBasic[basicSeriesKey{metric: metric, labels: [4]string{ns, ruleName}}] = struct{}{}
+				}
+			}
+		}
+
+		// Rules detecting anomalies expose their bounds once warmed up, to be graphed
+		// next to searchrule_value
+		if rule.Anomaly != nil && rule.Anomaly.Bounds != nil {
+			boundValues := map[string]float64{
+				"searchrule_anomaly_lower_bound": rule.Anomaly.Bounds.Lower,
+				"searchrule_anomaly_upper_bound": rule.Anomaly.Bounds.Upper,
+			}
+			for metric, value := range boundValues {
+				if g, ok := defaultRuleMetrics[metric]; ok {
+					g.WithLabelValues(ns, ruleName).Set(value)
+					seenBasic[basicSeriesKey{metric: metric, labels: [4]string{ns, ruleName}}] = struct{}{}
+				}
 			}
 		}
 
@@ -380,7 +438,7 @@ func extractLabelValues(bucket gjson.Result, labels []v1alpha1.MetricLabel) ([]s
 
 type basicSeriesKey struct {
 	metric string
-	labels [3]string // {ns, rule, state} (state empty for searchrule_value)
+	labels [4]string // {ns, rule, state, severity} (state and severity empty for searchrule_value)
 }
 
 type customSeriesKey struct {
@@ -469,10 +527,11 @@ func (m *customMetricManager) pruneBasic(metrics map[string]*prometheus.GaugeVec
 			continue
 		}
 		switch prev.metric {
-		case "searchrule_value":
+		case "searchrule_value", "searchrule_baseline_value", "searchrule_change",
+			"searchrule_anomaly_lower_bound", "searchrule_anomaly_upper_bound":
 			g.DeleteLabelValues(prev.labels[0], prev.labels[1])
 		case "searchrule_state":
-			g.DeleteLabelValues(prev.labels[0], prev.labels[1], prev.labels[2])
+			g.DeleteLabelValues(prev.labels[0], prev.labels[1], prev.labels[2], prev.labels[3])
 		}
 	}
 	m.previousBasic = seen
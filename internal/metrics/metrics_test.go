@@ -11,13 +11,18 @@ You may obtain a copy of the License at
 package metrics
 
 import (
+	"context"
 	"encoding/json"
 	"strings"
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/controller/searchrule"
+	"freepik.com/searchruler/internal/pools"
 )
 
 func TestValidateMetricName(t *testing.T) {
@@ -372,3 +377,29 @@ func TestCustomMetricManager_PruneCustom_GarbageCollectsWhenNoDeclarer(t *testin
 		t.Fatalf("gauge should have been GC'd the very first tick after the last declarer disappeared")
 	}
 }
+
+func TestUpdateMetrics_SuspendedState(t *testing.T) {
+	if err := initializeBasicMetrics(); err != nil {
+		t.Fatalf("initializeBasicMetrics: %v", err)
+	}
+	rulesPool := &pools.RulesStore{Store: map[string]*pools.Rule{}}
+	rulesPool.Set("default_demo", &pools.Rule{
+		SearchRule: v1alpha1.SearchRule{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "demo"}},
+		RuleState:  pools.RuleState{State: searchrule.RuleSuspendedState},
+	})
+	if err := updateMetrics(context.Background(), rulesPool); err != nil {
+		t.Fatalf("updateMetrics: %v", err)
+	}
+
+	// A suspended rule is only exported in its own state, so the PrometheusRule leaves it out
+	states := defaultRuleMetrics["searchrule_state"]
+	for _, state := range ruleStates {
+		want := 0.0
+		if state == searchrule.RuleSuspendedState {
+			want = 1
+		}
+		if got := testutil.ToFloat64(states.WithLabelValues("default", "demo", state, "")); got != want {
+			t.Errorf("searchrule_state{state=%q} = %v, want %v", state, got, want)
+		}
+	}
+}
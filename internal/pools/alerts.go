@@ -28,6 +28,39 @@ type Alert struct {
 	SearchRule      v1alpha1.SearchRule
 	Value           float64
 	Aggregations    interface{}
+
+	// Conditions are the leaves of the condition matched by the evaluation firing the alert
+	Conditions []ConditionMatch
+
+	// Severity is the level the alert fires at, for conditions with several severities.
+	// PreviousSeverity is the level it fired at before the last change, if any
+	Severity         string
+	PreviousSeverity string
+
+	// Labels are the labels of the bucket firing the alert, for rules evaluating their
+	// condition per bucket
+	Labels map[string]string
+
+	// Comparison holds the baseline value and the change firing the alert, for rules
+	// comparing their query with a baseline
+	Comparison *Comparison
+
+	// Error is why the evaluation of the rule failed, for the DatasourceNoData and
+	// DatasourceError alerts raised by the noDataState and execErrorState of the rule
+	Error string
+}
+
+// ConditionMatch is a leaf of the condition of a rule, with the value it compared. The
+// conditions defined by a CEL expression have a single match holding the expression
+type ConditionMatch struct {
+	Name           string
+	Field          string
+	Operator       string
+	Threshold      string
+	LowerThreshold string
+	UpperThreshold string
+	Expression     string
+	Value          float64
 }
 
 // AlertsStore
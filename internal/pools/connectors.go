@@ -0,0 +1,81 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"sync"
+	"time"
+)
+
+// ConnectorHealth is the result of the last connectivity probe of a QueryConnector
+// or ClusterQueryConnector. Namespace is empty for cluster scoped connectors
+type ConnectorHealth struct {
+	Namespace    string
+	Name         string
+	Reachable    bool
+	ClusterName  string
+	Distribution string
+	Version      string
+	Status       string
+	Latency      time.Duration
+}
+
+// ConnectorsStore
+type ConnectorsStore struct {
+	mu    sync.RWMutex
+	Store map[string]*ConnectorHealth
+}
+
+func (c *ConnectorsStore) Set(key string, health *ConnectorHealth) {
+	if health == nil {
+		return
+	}
+	cp := *health
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Store[key] = &cp
+}
+
+func (c *ConnectorsStore) Get(key string) (ConnectorHealth, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.Store[key]
+	if !ok || v == nil {
+		return ConnectorHealth{}, false
+	}
+	return *v, true
+}
+
+// Snapshot returns a copy of every entry, safe to iterate while the reconciler writes
+func (c *ConnectorsStore) Snapshot() map[string]ConnectorHealth {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make(map[string]ConnectorHealth, len(c.Store))
+	for k, v := range c.Store {
+		if v == nil {
+			continue
+		}
+		out[k] = *v
+	}
+	return out
+}
+
+func (c *ConnectorsStore) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.Store, key)
+}
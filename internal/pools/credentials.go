@@ -16,7 +16,11 @@ limitations under the License.
 
 package pools
 
-import "sync"
+import (
+	"sync"
+
+	"freepik.com/searchruler/api/v1alpha1"
+)
 
 // Credentials
 type Credentials struct {
@@ -25,6 +29,28 @@ type Credentials struct {
 	CA       string
 	Cert     string
 	Key      string
+
+	// CABundle holds the PEM certificates of the CAs trusted on top of the system ones
+	CABundle string
+
+	// AuthMode is how requests are authenticated: basic, apiKey, bearer or sigv4.
+	// Empty when the connector does not authenticate
+	AuthMode string
+
+	// APIKey and BearerToken are sent in the Authorization header
+	APIKey      string
+	BearerToken string
+
+	// AWS credentials, region and service name to sign the requests with SigV4
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+	Service         string
+
+	// Spec is the spec of the connector the credentials were read for. Its cached HTTP client
+	// is keyed by both, so it is forgotten with them once the spec changes
+	Spec *v1alpha1.QueryConnectorSpec
 }
 
 // CredentialsStore
@@ -0,0 +1,74 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"sync"
+	"time"
+)
+
+// QueryResult is the response to the query of a SearchRule that was sent in the batch
+// of another rule, waiting for the rule to be evaluated
+type QueryResult struct {
+	// Generation of the SearchRule whose query was sent
+	Generation int64
+	Body       []byte
+	Err        error
+	Time       time.Time
+}
+
+// QueryResultsStore
+type QueryResultsStore struct {
+	mu    sync.Mutex
+	Store map[string]*QueryResult
+}
+
+func (c *QueryResultsStore) Set(key string, result *QueryResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Store[key] = result
+}
+
+// Take removes the result stored under key and returns it when it was obtained for the given
+// generation of the rule no longer than maxAge ago
+func (c *QueryResultsStore) Take(key string, generation int64, maxAge time.Duration) (*QueryResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result, exists := c.Store[key]
+	if !exists {
+		return nil, false
+	}
+	delete(c.Store, key)
+	if result.Generation != generation || time.Since(result.Time) > maxAge {
+		return nil, false
+	}
+	return result, true
+}
+
+// Has tells whether a result is waiting for the rule
+func (c *QueryResultsStore) Has(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, exists := c.Store[key]
+	return exists
+}
+
+func (c *QueryResultsStore) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.Store, key)
+}
@@ -23,19 +23,91 @@ import (
 	"freepik.com/searchruler/api/v1alpha1"
 )
 
-// Rule
-type Rule struct {
-	SearchRule    v1alpha1.SearchRule
+// RuleState is the state machine of a rule, or of every bucket of a rule evaluating its
+// condition per bucket
+type RuleState struct {
 	FiringTime    time.Time
 	ResolvingTime time.Time
 	State         string
-	Value         float64
+
+	// Severity is the level the rule fires at, for conditions with several
+	// severities. It is kept while resolving and empty in any other state.
+	// SeveritySince holds when every level matching the last evaluation
+	// started to match.
+	Severity      string
+	SeveritySince map[string]time.Time
+}
+
+// Rule
+type Rule struct {
+	SearchRule v1alpha1.SearchRule
+	RuleState
+	Value float64
 
 	// Aggregations holds the last `aggregations` block parsed from the
 	// Elasticsearch response. The metrics goroutine reads it to fan out
 	// spec.customMetrics into per-bucket Prometheus samples; nil when the
 	// query did not return any aggregations.
 	Aggregations interface{}
+
+	// LastEvaluationTime is when the query of the rule was last evaluated.
+	// Rules due soon on the same connector are batched from it.
+	LastEvaluationTime time.Time
+
+	// Buckets holds the state of the buckets of a rule evaluating its
+	// condition per bucket, keyed by their labels. Buckets in normal state
+	// are not kept. The RuleState of the rule is the one of its most
+	// advanced bucket.
+	Buckets map[string]BucketState
+
+	// Comparison holds the baseline value and the change of the last
+	// evaluation, for rules comparing their query with a baseline. Value
+	// is the value of the current window then.
+	Comparison *Comparison
+
+	// Anomaly holds the history of the values of the rule and the bounds
+	// the last one was compared with, for conditions detecting anomalies.
+	Anomaly *AnomalyState
+}
+
+// AnomalyState is the history of the values of a rule detecting anomalies. The
+// samples are never mutated in place, a new history is built on every evaluation
+type AnomalyState struct {
+	// Method is the method the history was learned with, as changing it starts over
+	Method string
+
+	// Samples are the last values of the rule, oldest first, for the zscore method
+	Samples []float64
+
+	// Mean and Variance are the moving averages of the ewma method
+	Mean     float64
+	Variance float64
+
+	// Count is the number of values learned, to tell when the warm-up is over
+	Count int
+
+	// Bounds are the ones the last value was compared with, nil during the warm-up
+	Bounds *AnomalyBounds
+}
+
+// AnomalyBounds are the values a rule detecting anomalies expects, from its history
+type AnomalyBounds struct {
+	Mean  float64
+	Lower float64
+	Upper float64
+}
+
+// Comparison is the result of comparing the value of a rule with its baseline
+type Comparison struct {
+	Baseline float64
+	Change   float64
+}
+
+// BucketState is the state of a bucket of a rule evaluating its condition per bucket
+type BucketState struct {
+	RuleState
+	Labels map[string]string
+	Value  float64
 }
 
 // RulesStore
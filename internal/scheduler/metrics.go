@@ -0,0 +1,81 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// schedulerMetrics tracks whether the rules are evaluated on time
+type schedulerMetrics struct {
+	scheduled prometheus.Gauge
+	running   prometheus.Gauge
+	delay     prometheus.Histogram
+	late      *prometheus.CounterVec
+	missed    *prometheus.CounterVec
+}
+
+func newSchedulerMetrics() *schedulerMetrics {
+	return &schedulerMetrics{
+		scheduled: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "searchrule_scheduled_rules",
+			Help: "Rules the scheduler of the replica evaluates",
+		}),
+		running: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "searchrule_evaluations_running",
+			Help: "Evaluations holding a worker of the scheduler",
+		}),
+		delay: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "searchrule_evaluation_delay_seconds",
+			Help:    "Time between the slot of an evaluation and the start of the evaluation",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300},
+		}),
+		late: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "searchrule_evaluations_late_total",
+			Help: "Evaluations started later than a tenth of the interval of the rule after their slot",
+		}, []string{"searchrule_namespace", "rule"}),
+		missed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "searchrule_evaluations_missed_total",
+			Help: "Slots skipped because the previous evaluation of the rule had not finished yet",
+		}, []string{"searchrule_namespace", "rule"}),
+	}
+}
+
+// forget drops the series of a rule not scheduled anymore
+func (m *schedulerMetrics) forget(key types.NamespacedName) {
+	m.late.DeleteLabelValues(key.Namespace, key.Name)
+	m.missed.DeleteLabelValues(key.Namespace, key.Name)
+}
+
+// Describe implements prometheus.Collector
+func (s *Scheduler) Describe(ch chan<- *prometheus.Desc) {
+	s.metrics.scheduled.Describe(ch)
+	s.metrics.running.Describe(ch)
+	s.metrics.delay.Describe(ch)
+	s.metrics.late.Describe(ch)
+	s.metrics.missed.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (s *Scheduler) Collect(ch chan<- prometheus.Metric) {
+	s.metrics.scheduled.Collect(ch)
+	s.metrics.running.Collect(ch)
+	s.metrics.delay.Collect(ch)
+	s.metrics.late.Collect(ch)
+	s.metrics.missed.Collect(ch)
+}
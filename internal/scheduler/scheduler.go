@@ -0,0 +1,314 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"freepik.com/searchruler/internal/cron"
+)
+
+// lateFraction is the part of the time to its following slot an evaluation may start after its
+// slot before it is counted as late
+const lateFraction = 10
+
+// maxMissed bounds the slots of a cron schedule counted as missed at once
+const maxMissed = 1000
+
+// EvaluateFunc evaluates the rule of the key
+type EvaluateFunc func(ctx context.Context, key types.NamespacedName)
+
+// Options configures the scheduler
+type Options struct {
+	// Workers is how many evaluations run at the same time. Evaluations due while every worker
+	// is busy wait for one
+	Workers int
+
+	// MaxJitter caps the offset of a rule from the boundaries of its interval
+	MaxJitter time.Duration
+}
+
+// Spec is when a rule is evaluated: every Interval, or at the times of Cron when it is set
+type Spec struct {
+	Interval time.Duration
+	Cron     *cron.Schedule
+}
+
+// equal tells whether both specs evaluate at the same times
+func (spec Spec) equal(other Spec) bool {
+	if spec.Cron == nil || other.Cron == nil {
+		return spec.Cron == other.Cron && spec.Interval == other.Interval
+	}
+	return spec.Cron.String() == other.Cron.String()
+}
+
+// next returns the first slot of the spec after now, shifted by the offset of the rule when it
+// is evaluated every interval
+func (spec Spec) next(now time.Time, offset time.Duration) time.Time {
+	if spec.Cron != nil {
+		return spec.Cron.Next(now)
+	}
+	return nextSlot(now, spec.Interval, offset)
+}
+
+// gap returns the time from the slot to the following one
+func (spec Spec) gap(slot time.Time) time.Duration {
+	if spec.Cron == nil {
+		return spec.Interval
+	}
+	if next := spec.Cron.Next(slot); !next.IsZero() {
+		return next.Sub(slot)
+	}
+	return 0
+}
+
+// missed returns how many slots of the spec passed after the slot and up to now
+func (spec Spec) missed(slot, now time.Time) int {
+	if spec.Cron == nil {
+		return int(now.Sub(slot) / spec.Interval)
+	}
+	missed := 0
+	for next := spec.Cron.Next(slot); !next.IsZero() && !next.After(now) && missed < maxMissed; next = spec.Cron.Next(next) {
+		missed++
+	}
+	return missed
+}
+
+// Scheduler evaluates every rule on its own timer, independently of the reconciliations of the
+// rules. The evaluations of a rule happen on the boundaries of its interval, as every minute
+// at :00 for one of `1m`, shifted by an offset of the rule so the rules with the same interval
+// do not hit the backends at the same time. The offset comes from the key of the rule, so it
+// is the same across restarts and replicas. Rules with a cron schedule are evaluated at its
+// exact times instead
+type Scheduler struct {
+	evaluate EvaluateFunc
+	options  Options
+	metrics  *schedulerMetrics
+
+	// workers bounds the evaluations running at the same time
+	workers chan struct{}
+
+	// started is closed once the scheduler runs, evaluations due before wait for it
+	started chan struct{}
+	ctx     context.Context
+
+	mu      sync.Mutex
+	entries map[types.NamespacedName]*entry
+
+	// running has the rules with an evaluation waiting for a worker or running. It outlives the
+	// entries, so a rule rescheduled while evaluated is not evaluated twice at the same time
+	running map[types.NamespacedName]bool
+}
+
+// entry is a rule scheduled
+type entry struct {
+	key    types.NamespacedName
+	spec   Spec
+	offset time.Duration
+	timer  *time.Timer
+
+	// slot is when the next evaluation is due, zero for a schedule with no time left
+	slot time.Time
+}
+
+// New returns a scheduler running the evaluations with the function
+func New(evaluate EvaluateFunc, options Options) *Scheduler {
+	if options.Workers < 1 {
+		options.Workers = 1
+	}
+	return &Scheduler{
+		evaluate: evaluate,
+		options:  options,
+		metrics:  newSchedulerMetrics(),
+		workers:  make(chan struct{}, options.Workers),
+		started:  make(chan struct{}),
+		entries:  map[types.NamespacedName]*entry{},
+		running:  map[types.NamespacedName]bool{},
+	}
+}
+
+// Schedule evaluates the rule of the key as the spec says. Rules already scheduled with the same
+// spec keep their timer, so reconciling a rule does not move its evaluations. A rule evaluated
+// every interval and not evaluated since the slot before the next one, as one never evaluated,
+// is evaluated right away besides. Rules with a cron schedule wait for its next time
+func (s *Scheduler) Schedule(key types.NamespacedName, spec Spec, lastEvaluation time.Time) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.entries[key]
+	if exists && current.spec.equal(spec) {
+		return
+	}
+	if exists {
+		current.timer.Stop()
+	}
+
+	e := &entry{key: key, spec: spec}
+	if spec.Cron == nil {
+		e.offset = s.offset(key, spec.Interval)
+	}
+	e.slot = spec.next(time.Now(), e.offset)
+	e.timer = time.AfterFunc(time.Until(e.slot), func() { s.fire(e) })
+	if e.slot.IsZero() {
+		e.timer.Stop()
+	}
+	s.entries[key] = e
+	s.metrics.scheduled.Set(float64(len(s.entries)))
+
+	if spec.Cron == nil && lastEvaluation.Before(e.slot.Add(-spec.Interval)) && !s.running[key] {
+		s.running[key] = true
+		go s.run(e, time.Time{})
+	}
+}
+
+// Unschedule stops evaluating the rule of the key. An evaluation running finishes
+func (s *Scheduler) Unschedule(key types.NamespacedName) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, exists := s.entries[key]; exists {
+		e.timer.Stop()
+		delete(s.entries, key)
+		s.metrics.forget(key)
+	}
+	s.metrics.scheduled.Set(float64(len(s.entries)))
+}
+
+// Scheduled returns the spec the rule of the key is evaluated with, if it is scheduled
+func (s *Scheduler) Scheduled(key types.NamespacedName) (Spec, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, exists := s.entries[key]
+	if !exists {
+		return Spec{}, false
+	}
+	return e.spec, true
+}
+
+// NeedLeaderElection tells the manager every replica runs the scheduler. It is idle until a
+// controller schedules rules
+func (s *Scheduler) NeedLeaderElection() bool {
+	return false
+}
+
+// Start runs the evaluations until the context is done. The timers are stopped then, and the
+// evaluations running finish
+func (s *Scheduler) Start(ctx context.Context) error {
+
+	s.ctx = ctx
+	close(s.started)
+	<-ctx.Done()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, e := range s.entries {
+		e.timer.Stop()
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// fire runs the evaluation of the slot of the rule, and sets the timer of the next slot. The
+// slots passed while the previous evaluation was still waiting or running are missed
+func (s *Scheduler) fire(e *entry) {
+
+	s.mu.Lock()
+	if s.entries[e.key] != e {
+		s.mu.Unlock()
+		return
+	}
+	slot := e.slot
+	now := time.Now()
+	e.slot = e.spec.next(now, e.offset)
+	if !e.slot.IsZero() {
+		e.timer.Reset(time.Until(e.slot))
+	}
+	if s.running[e.key] {
+		s.metrics.missed.WithLabelValues(e.key.Namespace, e.key.Name).Inc()
+		s.mu.Unlock()
+		return
+	}
+	s.running[e.key] = true
+	s.mu.Unlock()
+
+	// Slots passed while the timer was late, as when the process was paused, are missed too
+	if skipped := e.spec.missed(slot, now); skipped > 0 {
+		s.metrics.missed.WithLabelValues(e.key.Namespace, e.key.Name).Add(float64(skipped))
+	}
+
+	go s.run(e, slot)
+}
+
+// run evaluates the rule once a worker is free. Evaluations out of the slots of the rule, as the
+// first one, have no slot and are not tracked as late
+func (s *Scheduler) run(e *entry, slot time.Time) {
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, e.key)
+		s.mu.Unlock()
+	}()
+
+	<-s.started
+	select {
+	case s.workers <- struct{}{}:
+	case <-s.ctx.Done():
+		return
+	}
+	defer func() { <-s.workers }()
+
+	if !slot.IsZero() {
+		delay := time.Since(slot)
+		s.metrics.delay.Observe(delay.Seconds())
+		if delay > e.spec.gap(slot)/lateFraction {
+			s.metrics.late.WithLabelValues(e.key.Namespace, e.key.Name).Inc()
+		}
+	}
+
+	s.metrics.running.Inc()
+	defer s.metrics.running.Dec()
+	s.evaluate(s.ctx, e.key)
+}
+
+// offset returns the offset of the rule from the boundaries of its interval, below MaxJitter
+// and below the interval
+func (s *Scheduler) offset(key types.NamespacedName, interval time.Duration) time.Duration {
+
+	limit := interval
+	if s.options.MaxJitter < limit {
+		limit = s.options.MaxJitter
+	}
+	if limit <= 0 {
+		return 0
+	}
+	sum := sha256.Sum256([]byte(key.String()))
+	return time.Duration(binary.BigEndian.Uint64(sum[:8]) % uint64(limit))
+}
+
+// nextSlot returns the first slot after now of a rule evaluated every interval with the offset
+func nextSlot(now time.Time, interval, offset time.Duration) time.Time {
+	boundary := now.Add(-offset).Truncate(interval)
+	return boundary.Add(interval + offset)
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/types"
+
+	"freepik.com/searchruler/internal/cron"
+)
+
+func TestNextSlot(t *testing.T) {
+	t.Parallel()
+	base := time.Date(2024, 11, 5, 10, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		now      time.Time
+		interval time.Duration
+		offset   time.Duration
+		want     time.Time
+	}{
+		{name: "next boundary", now: base.Add(20 * time.Second), interval: time.Minute, want: base.Add(time.Minute)},
+		{name: "on a boundary", now: base, interval: time.Minute, want: base.Add(time.Minute)},
+		{name: "offset ahead", now: base.Add(20 * time.Second), interval: time.Minute, offset: 30 * time.Second, want: base.Add(30 * time.Second)},
+		{name: "offset passed", now: base.Add(40 * time.Second), interval: time.Minute, offset: 30 * time.Second, want: base.Add(90 * time.Second)},
+		{name: "hourly", now: base.Add(90 * time.Minute), interval: time.Hour, offset: 5 * time.Second, want: base.Add(2*time.Hour + 5*time.Second)},
+	}
+	for _, tc := range cases {
+		if got := nextSlot(tc.now, tc.interval, tc.offset); !got.Equal(tc.want) {
+			t.Errorf("%s: nextSlot = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSchedulerOffset(t *testing.T) {
+	t.Parallel()
+	s := New(nil, Options{MaxJitter: 15 * time.Second})
+
+	spread := map[time.Duration]bool{}
+	for i := range 50 {
+		key := types.NamespacedName{Namespace: "default", Name: fmt.Sprintf("rule-%d", i)}
+		offset := s.offset(key, time.Minute)
+		if offset < 0 || offset >= 15*time.Second {
+			t.Fatalf("%s: offset %s out of the jitter", key, offset)
+		}
+		if again := s.offset(key, time.Minute); again != offset {
+			t.Fatalf("%s: offset %s then %s, want the same", key, offset, again)
+		}
+		if short := s.offset(key, 5*time.Second); short >= 5*time.Second {
+			t.Fatalf("%s: offset %s longer than the interval", key, short)
+		}
+		spread[offset] = true
+	}
+	if len(spread) < 40 {
+		t.Errorf("%d different offsets for 50 rules, want them spread", len(spread))
+	}
+
+	if offset := New(nil, Options{}).offset(types.NamespacedName{Name: "rule"}, time.Minute); offset != 0 {
+		t.Errorf("offset = %s without jitter, want none", offset)
+	}
+}
+
+// startScheduler runs a scheduler with the evaluation until the test ends
+func startScheduler(t *testing.T, evaluate EvaluateFunc, workers int) *Scheduler {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	s := New(evaluate, Options{Workers: workers})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return s
+}
+
+func TestSchedulerWorkers(t *testing.T) {
+	t.Parallel()
+
+	var running, maxRunning, evaluations atomic.Int32
+	s := startScheduler(t, func(ctx context.Context, key types.NamespacedName) {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			seen := maxRunning.Load()
+			if current <= seen || maxRunning.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		evaluations.Add(1)
+		time.Sleep(15 * time.Millisecond)
+	}, 2)
+
+	for i := range 6 {
+		s.Schedule(types.NamespacedName{Namespace: "default", Name: fmt.Sprintf("rule-%d", i)}, Spec{Interval: 20 * time.Millisecond}, time.Now())
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	if got := maxRunning.Load(); got > 2 {
+		t.Errorf("%d evaluations at the same time, want at most the 2 workers", got)
+	}
+	if evaluations.Load() < 6 {
+		t.Errorf("%d evaluations, want every rule evaluated", evaluations.Load())
+	}
+}
+
+func TestSchedulerMissedSlots(t *testing.T) {
+	t.Parallel()
+	key := types.NamespacedName{Namespace: "default", Name: "slow"}
+
+	var mu sync.Mutex
+	running := false
+	overlapped := false
+	s := startScheduler(t, func(ctx context.Context, key types.NamespacedName) {
+		mu.Lock()
+		overlapped = overlapped || running
+		running = true
+		mu.Unlock()
+		time.Sleep(70 * time.Millisecond)
+		mu.Lock()
+		running = false
+		mu.Unlock()
+	}, 4)
+
+	// The rule takes longer than its interval, so some of its slots pass while it is evaluated
+	s.Schedule(key, Spec{Interval: 20 * time.Millisecond}, time.Now())
+	time.Sleep(250 * time.Millisecond)
+	if missed := testutil.ToFloat64(s.metrics.missed.WithLabelValues("default", "slow")); missed == 0 {
+		t.Errorf("no missed slots, want the ones passed while the rule was evaluated")
+	}
+
+	// The series of the rule go away with it
+	s.Unschedule(key)
+	if count := testutil.CollectAndCount(s, "searchrule_evaluations_missed_total"); count != 0 {
+		t.Errorf("%d missed series after unscheduling the rule, want none", count)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if overlapped {
+		t.Errorf("the rule was evaluated twice at the same time")
+	}
+}
+
+func TestSchedulerSchedule(t *testing.T) {
+	t.Parallel()
+	key := types.NamespacedName{Namespace: "default", Name: "hourly"}
+
+	evaluated := make(chan types.NamespacedName, 10)
+	s := startScheduler(t, func(ctx context.Context, key types.NamespacedName) {
+		evaluated <- key
+	}, 1)
+
+	// A rule never evaluated is evaluated right away, not on the next boundary of its interval
+	s.Schedule(key, Spec{Interval: time.Hour}, time.Time{})
+	select {
+	case <-evaluated:
+	case <-time.After(time.Second):
+		t.Fatalf("the new rule was not evaluated right away")
+	}
+
+	// Scheduling it again with the same interval keeps its schedule, as on every reconciliation
+	s.Schedule(key, Spec{Interval: time.Hour}, time.Time{})
+	select {
+	case <-evaluated:
+		t.Errorf("the rule was evaluated again when scheduled with the same interval")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Rules evaluated recently wait for their slot
+	s.Schedule(key, Spec{Interval: 30 * time.Minute}, time.Now())
+	if spec, scheduled := s.Scheduled(key); !scheduled || spec.Interval != 30*time.Minute {
+		t.Errorf("interval = %s, want the new one", spec.Interval)
+	}
+	select {
+	case <-evaluated:
+		t.Errorf("the rule was evaluated out of its slot")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	s.Unschedule(key)
+	if _, scheduled := s.Scheduled(key); scheduled {
+		t.Errorf("the rule is still scheduled")
+	}
+}
+
+func TestSpecCron(t *testing.T) {
+	t.Parallel()
+	schedule, err := cron.Parse("5 6 * * *", time.UTC)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	spec := Spec{Cron: schedule}
+	slot := time.Date(2024, 11, 5, 6, 5, 0, 0, time.UTC)
+
+	// Cron slots are not shifted by the offset of the rule
+	if got := spec.next(slot.Add(-time.Hour), 15*time.Second); !got.Equal(slot) {
+		t.Errorf("next = %s, want %s", got, slot)
+	}
+	if got := spec.gap(slot); got != 24*time.Hour {
+		t.Errorf("gap = %s, want 24h", got)
+	}
+	if got := spec.missed(slot, slot.Add(50*time.Hour)); got != 2 {
+		t.Errorf("missed = %d, want the 2 slots passed", got)
+	}
+
+	other, _ := cron.Parse("5 6 * * *", time.UTC)
+	if !spec.equal(Spec{Cron: other}) {
+		t.Errorf("specs with the same expression are not equal")
+	}
+	if spec.equal(Spec{Interval: 24 * time.Hour}) {
+		t.Errorf("a cron spec is equal to an interval")
+	}
+}
+
+func TestSchedulerScheduleCron(t *testing.T) {
+	t.Parallel()
+	key := types.NamespacedName{Namespace: "default", Name: "daily"}
+
+	evaluated := make(chan types.NamespacedName, 10)
+	s := startScheduler(t, func(ctx context.Context, key types.NamespacedName) {
+		evaluated <- key
+	}, 1)
+
+	// Rules with a cron schedule are evaluated at its times only, even if never evaluated
+	schedule, err := cron.Parse("@yearly", time.UTC)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	s.Schedule(key, Spec{Cron: schedule}, time.Time{})
+	select {
+	case <-evaluated:
+		t.Errorf("the rule was evaluated out of its schedule")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if spec, scheduled := s.Scheduled(key); !scheduled || spec.Cron != schedule {
+		t.Errorf("the rule is not scheduled with its cron expression")
+	}
+}
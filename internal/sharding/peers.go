@@ -0,0 +1,87 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// peerTimeout is how long a peer has to answer, so a replica gone does not hang the
+// aggregated view
+const peerTimeout = 5 * time.Second
+
+// FetchPeers gets the path from the server every peer runs on the port of the bind address,
+// concurrently. The responses are in the order of the peers, and the ones of the peers failing
+// are nil: they are logged and left out, so the aggregated view is partial instead of failing
+func FetchPeers(ctx context.Context, peers Peers, bindAddress, path string) [][]byte {
+
+	logger := log.FromContext(ctx)
+	_, port, err := net.SplitHostPort(bindAddress)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Failed to get the port of %s to reach the peers: %v", bindAddress, err))
+		return nil
+	}
+
+	members := peers.Peers()
+	responses := make([][]byte, len(members))
+	client := &http.Client{Timeout: peerTimeout}
+	var wg sync.WaitGroup
+	for i, member := range members {
+		if member.Address == "" {
+			logger.Info(fmt.Sprintf("The peer %s does not advertise its address, it is left out", member.Identity))
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, err := fetchPeer(ctx, client, fmt.Sprintf("http://%s%s", net.JoinHostPort(member.Address, port), path))
+			if err != nil {
+				logger.Info(fmt.Sprintf("Failed to get %s from the peer %s: %v", path, member.Identity, err))
+				return
+			}
+			responses[i] = body
+		}()
+	}
+	wg.Wait()
+	return responses
+}
+
+// fetchPeer gets the body of the url
+func fetchPeer(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return io.ReadAll(response.Body)
+}
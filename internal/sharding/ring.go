@@ -0,0 +1,85 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharding
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// virtualNodes is the number of points of every member on the ring. The more points, the
+// more even the rules are spread across the members
+const virtualNodes = 128
+
+// Ring spreads keys across members by consistent hashing: a key belongs to the member of
+// the first point of the ring after its hash. A member joining or leaving only moves the
+// keys of its own points, so most keys keep their owner on a rebalance
+type Ring struct {
+	members []string
+	points  []uint64
+	owners  map[uint64]string
+}
+
+// NewRing returns the ring of the members
+func NewRing(members []string) *Ring {
+
+	ring := &Ring{
+		members: append([]string(nil), members...),
+		points:  make([]uint64, 0, len(members)*virtualNodes),
+		owners:  make(map[uint64]string, len(members)*virtualNodes),
+	}
+	sort.Strings(ring.members)
+	for _, member := range ring.members {
+		for i := 0; i < virtualNodes; i++ {
+			point := hash(fmt.Sprintf("%s#%d", member, i))
+			if _, taken := ring.owners[point]; taken {
+				continue
+			}
+			ring.owners[point] = member
+			ring.points = append(ring.points, point)
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i] < ring.points[j] })
+	return ring
+}
+
+// Owner returns the member owning the key, or an empty string when the ring has no members
+func (r *Ring) Owner(key string) string {
+
+	if len(r.points) == 0 {
+		return ""
+	}
+	keyHash := hash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= keyHash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// Members returns the members of the ring, sorted
+func (r *Ring) Members() []string {
+	return append([]string(nil), r.members...)
+}
+
+// hash returns the position of the value on the ring
+func hash(value string) uint64 {
+	sum := sha256.Sum256([]byte(value))
+	return binary.BigEndian.Uint64(sum[:8])
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharding
+
+import (
+	"fmt"
+	"testing"
+)
+
+func ruleKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("default_rule-%d", i)
+	}
+	return keys
+}
+
+func TestRingOwner(t *testing.T) {
+	t.Parallel()
+	if owner := NewRing(nil).Owner("default_rule"); owner != "" {
+		t.Errorf("owner = %q, want none without members", owner)
+	}
+
+	// Every replica builds the same ring, whatever the order it saw the members in
+	ring := NewRing([]string{"replica-a", "replica-b", "replica-c"})
+	other := NewRing([]string{"replica-c", "replica-a", "replica-b"})
+	counts := map[string]int{}
+	keys := ruleKeys(3000)
+	for _, key := range keys {
+		owner := ring.Owner(key)
+		if owner != other.Owner(key) {
+			t.Fatalf("%s: the owner depends on the order of the members", key)
+		}
+		counts[owner]++
+	}
+	for member, count := range counts {
+		if count < 600 || count > 1400 {
+			t.Errorf("%s owns %d of %d rules, want about a third", member, count, len(keys))
+		}
+	}
+}
+
+func TestRingRebalance(t *testing.T) {
+	t.Parallel()
+	before := NewRing([]string{"replica-a", "replica-b", "replica-c"})
+	after := NewRing([]string{"replica-a", "replica-b", "replica-c", "replica-d"})
+
+	// A member joining only takes rules, the others keep the rest of theirs
+	moved := 0
+	keys := ruleKeys(3000)
+	for _, key := range keys {
+		if before.Owner(key) == after.Owner(key) {
+			continue
+		}
+		moved++
+		if after.Owner(key) != "replica-d" {
+			t.Fatalf("%s moved from %s to %s", key, before.Owner(key), after.Owner(key))
+		}
+	}
+	if moved < 450 || moved > 1050 {
+		t.Errorf("%d of %d rules moved, want about a quarter", moved, len(keys))
+	}
+}
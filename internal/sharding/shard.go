@@ -0,0 +1,281 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+
+	// GroupLabel is set on the Leases of the replicas sharing the rules, with the name of
+	// their group
+	GroupLabel = "searchruler.freepik.com/shard-group"
+
+	// AddressAnnotation is set on the Lease of a replica with the address its webserver and
+	// metrics are reachable at by the other replicas
+	AddressAnnotation = "searchruler.freepik.com/shard-address"
+)
+
+// Member is a replica sharing the rules
+type Member struct {
+	Identity string
+	Address  string
+}
+
+// Peers lists the other replicas sharing the rules, to aggregate their views
+type Peers interface {
+	Peers() []Member
+}
+
+// Options configures the membership of a replica
+type Options struct {
+	// Client is the Kubernetes client the Leases are managed with
+	Client kubernetes.Interface
+
+	// Namespace is where the Leases of the group live
+	Namespace string
+
+	// Group is the name of the replicas sharing the rules, to tell them from other deployments
+	// of the operator in the same namespace
+	Group string
+
+	// Identity identifies the replica in its group, usually the name of its pod
+	Identity string
+
+	// Address is where the other replicas reach the webserver and metrics of this one
+	Address string
+
+	// LeaseDuration is how long a replica is a member without renewing its Lease. It is
+	// renewed three times in that time
+	LeaseDuration time.Duration
+}
+
+// Shard is the membership of a replica in the group sharing the rules. Every replica holds a
+// Lease renewed while it runs, and the replicas with a Lease not expired share the rules by
+// consistent hashing
+type Shard struct {
+	Options
+
+	mu       sync.RWMutex
+	ring     *Ring
+	peers    []Member
+	onChange []func()
+
+	// renewed is when the Lease of the replica was last renewed
+	renewed time.Time
+}
+
+// NewShard returns the membership of the replica. Until it is started and sees the members of
+// its group, the replica does not own any rule
+func NewShard(options Options) *Shard {
+	return &Shard{Options: options, ring: NewRing(nil)}
+}
+
+// Owns tells whether the replica evaluates the rule of the key. A replica failing to renew its
+// Lease owns nothing once it expired, as the other replicas took over its rules by then
+func (s *Shard) Owns(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if time.Since(s.renewed) > s.LeaseDuration {
+		return false
+	}
+	return s.ring.Owner(key) == s.Identity
+}
+
+// Owner returns the identity of the replica evaluating the rule of the key
+func (s *Shard) Owner(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ring.Owner(key)
+}
+
+// Members returns the identities of the replicas sharing the rules, sorted
+func (s *Shard) Members() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ring.Members()
+}
+
+// Peers returns the other replicas sharing the rules
+func (s *Shard) Peers() []Member {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Member(nil), s.peers...)
+}
+
+// OnChange registers a function called every time the members change, so the rules moving
+// from a replica to another are handed off
+func (s *Shard) OnChange(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = append(s.onChange, fn)
+}
+
+// NeedLeaderElection tells the manager every replica runs its membership, not only the leader
+func (s *Shard) NeedLeaderElection() bool {
+	return false
+}
+
+// Start renews the Lease of the replica and watches the members of its group until the context
+// is done. The Lease is deleted then, so the other replicas take over its rules right away
+func (s *Shard) Start(ctx context.Context) error {
+
+	logger := log.FromContext(ctx)
+	logger.Info(fmt.Sprintf("Joining the shard group %s as %s", s.Group, s.Identity))
+
+	ticker := time.NewTicker(s.LeaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		if err := s.sync(ctx); err != nil {
+			logger.Info(fmt.Sprintf("Failed to sync the members of the shard group %s: %v", s.Group, err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			err := s.Client.CoordinationV1().Leases(s.Namespace).Delete(context.Background(), s.leaseName(), metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				logger.Info(fmt.Sprintf("Failed to leave the shard group %s: %v", s.Group, err))
+			}
+			return nil
+		}
+	}
+}
+
+// sync renews the Lease of the replica and rebuilds the ring with the members of the group.
+// Leases expired are deleted, as the replicas holding them are gone
+func (s *Shard) sync(ctx context.Context) error {
+
+	now := time.Now()
+	if err := s.renew(ctx, now); err != nil {
+		return err
+	}
+
+	leases, err := s.Client.CoordinationV1().Leases(s.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", GroupLabel, s.Group),
+	})
+	if err != nil {
+		return err
+	}
+
+	members := []string{s.Identity}
+	peers := []Member{}
+	for i := range leases.Items {
+		lease := &leases.Items[i]
+		if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == s.Identity {
+			continue
+		}
+		if expired(lease, now) {
+			err := s.Client.CoordinationV1().Leases(s.Namespace).Delete(ctx, lease.Name, metav1.DeleteOptions{
+				Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+			})
+			if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+				return err
+			}
+			continue
+		}
+		members = append(members, *lease.Spec.HolderIdentity)
+		peers = append(peers, Member{Identity: *lease.Spec.HolderIdentity, Address: lease.Annotations[AddressAnnotation]})
+	}
+	sort.Strings(members)
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Identity < peers[j].Identity })
+
+	s.mu.Lock()
+	s.renewed = now
+	changed := !slices.Equal(members, s.ring.Members())
+	if changed {
+		s.ring = NewRing(members)
+	}
+	s.peers = peers
+	onChange := append([]func(){}, s.onChange...)
+	s.mu.Unlock()
+
+	if changed {
+		log.FromContext(ctx).Info(fmt.Sprintf("Members of the shard group %s changed: %v", s.Group, members))
+		for _, fn := range onChange {
+			fn()
+		}
+	}
+	return nil
+}
+
+// renew creates or renews the Lease of the replica
+func (s *Shard) renew(ctx context.Context, now time.Time) error {
+
+	leases := s.Client.CoordinationV1().Leases(s.Namespace)
+	renewTime := metav1.NewMicroTime(now)
+	leaseSeconds := int32(s.LeaseDuration.Seconds())
+
+	lease, err := leases.Get(ctx, s.leaseName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        s.leaseName(),
+				Namespace:   s.Namespace,
+				Labels:      map[string]string{GroupLabel: s.Group},
+				Annotations: map[string]string{AddressAnnotation: s.Address},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &s.Identity,
+				LeaseDurationSeconds: &leaseSeconds,
+				AcquireTime:          &renewTime,
+				RenewTime:            &renewTime,
+			},
+		}
+		_, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[AddressAnnotation] = s.Address
+	lease.Spec.HolderIdentity = &s.Identity
+	lease.Spec.LeaseDurationSeconds = &leaseSeconds
+	lease.Spec.RenewTime = &renewTime
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+// leaseName returns the name of the Lease of the replica
+func (s *Shard) leaseName() string {
+	return fmt.Sprintf("%s-%s", s.Group, s.Identity)
+}
+
+// expired tells whether the replica holding the Lease stopped renewing it
+func expired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	duration := time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	return lease.Spec.RenewTime.Add(duration).Before(now)
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sharding
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestShard(client kubernetes.Interface, identity string) *Shard {
+	return NewShard(Options{
+		Client:        client,
+		Namespace:     "searchruler",
+		Group:         "searchruler",
+		Identity:      identity,
+		Address:       "10.0.0." + identity[len(identity)-1:],
+		LeaseDuration: 15 * time.Second,
+	})
+}
+
+func TestShardMembership(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	client := fake.NewClientset()
+	first := newTestShard(client, "replica-1")
+	second := newTestShard(client, "replica-2")
+
+	if first.Owns("default_rule") {
+		t.Errorf("a replica owns rules before seeing its group")
+	}
+
+	changes := 0
+	first.OnChange(func() { changes++ })
+	for _, shard := range []*Shard{first, second, first} {
+		if err := shard.sync(ctx); err != nil {
+			t.Fatalf("sync %s: %v", shard.Identity, err)
+		}
+	}
+	if changes != 2 {
+		t.Errorf("changes = %d, want one when joining and one when the second replica joined", changes)
+	}
+	if members := first.Members(); !slices.Equal(members, []string{"replica-1", "replica-2"}) {
+		t.Errorf("members = %v", members)
+	}
+	if peers := first.Peers(); len(peers) != 1 || peers[0].Address != "10.0.0.2" {
+		t.Errorf("peers = %+v, want the second replica and its address", peers)
+	}
+
+	// Every rule is owned by exactly one of the replicas
+	for _, key := range ruleKeys(100) {
+		if first.Owns(key) == second.Owns(key) {
+			t.Fatalf("%s: owned by both replicas or by none", key)
+		}
+	}
+}
+
+func TestShardExpiredMembers(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	// A replica gone without leaving holds a Lease nobody renews anymore
+	holder := "replica-gone"
+	leaseSeconds := int32(15)
+	renewTime := metav1.NewMicroTime(time.Now().Add(-time.Minute))
+	client := fake.NewClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "searchruler-replica-gone",
+			Namespace: "searchruler",
+			Labels:    map[string]string{GroupLabel: "searchruler"},
+		},
+		Spec: coordinationv1.LeaseSpec{HolderIdentity: &holder, LeaseDurationSeconds: &leaseSeconds, RenewTime: &renewTime},
+	})
+	shard := newTestShard(client, "replica-1")
+	if err := shard.sync(ctx); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if members := shard.Members(); !slices.Equal(members, []string{"replica-1"}) {
+		t.Errorf("members = %v, want the replica alone", members)
+	}
+	if !shard.Owns("default_rule") {
+		t.Errorf("the only replica must own every rule")
+	}
+	leases, err := client.CoordinationV1().Leases("searchruler").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(leases.Items) != 1 || leases.Items[0].Name != "searchruler-replica-1" {
+		t.Errorf("leases = %+v, want the expired one deleted", leases.Items)
+	}
+
+	// A replica leaving deletes its Lease, so the others take over its rules right away
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := shard.Start(cancelled); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	leases, _ = client.CoordinationV1().Leases("searchruler").List(ctx, metav1.ListOptions{})
+	if len(leases.Items) != 0 {
+		t.Errorf("leases = %+v, want none after leaving", leases.Items)
+	}
+}
@@ -2,12 +2,14 @@ package webserver
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
 
 	"freepik.com/searchruler/internal/pools"
+	"freepik.com/searchruler/internal/sharding"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/yaml"
 
@@ -23,11 +25,13 @@ var (
 		"PendingResolving": "pending",
 		"Firing":           "firing",
 		"Normal":           "resolved",
+		"Suspended":        "suspended",
 	}
 )
 
-// RunWebserver starts a webserver that serves the rule pages
-func RunWebserver(ctx context.Context, webserverAddr string, rulesPool *pools.RulesStore) error {
+// RunWebserver starts a webserver that serves the rule pages. When the rules are sharded across
+// replicas, peers lists the other replicas to aggregate their rules on request
+func RunWebserver(ctx context.Context, webserverAddr string, rulesPool *pools.RulesStore, peers sharding.Peers) error {
 	logger := log.FromContext(ctx)
 
 	logger.Info(fmt.Sprintf("Starting webserver in %s", webserverAddr))
@@ -62,7 +66,7 @@ func RunWebserver(ctx context.Context, webserverAddr string, rulesPool *pools.Ru
 		return c.Redirect("/rules")
 	})
 	app.Get("/rules", getRules(rulesPool))
-	app.Get("/api/rules", getRulesJSON(rulesPool))
+	app.Get("/api/rules", getRulesJSON(rulesPool, peers, webserverAddr))
 	app.Get("/rules/:key", getRule(rulesPool))
 	app.Static("/static", publicPath)
 
@@ -114,32 +118,36 @@ func getRules(rulesPool *pools.RulesStore) func(c *fiber.Ctx) error {
 	}
 }
 
-// getRulesJSON returns a handler function that returns the rules in JSON format
-func getRulesJSON(rulesPool *pools.RulesStore) func(c *fiber.Ctx) error {
+// getRulesJSON returns a handler function that returns the rules in JSON format. The rules of
+// the other replicas are added with `?aggregate=true`, when the rules are sharded
+func getRulesJSON(rulesPool *pools.RulesStore, peers sharding.Peers, webserverAddr string) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 
 		alerts := []map[string]interface{}{}
 
 		for key, value := range rulesPool.Store {
-			alert := map[string]interface{}{
-				"labels": map[string]string{
-					"alertname": key,
-					"namespace": value.SearchRule.Namespace,
-				},
-				"annotations": map[string]string{
-					"description": value.SearchRule.Spec.Description,
-					"summary":     value.SearchRule.Spec.Description,
-				},
-				"state": states[value.State],
-				"activeAt": func() string {
-					if value.FiringTime.IsZero() {
-						return ""
-					}
-					return value.FiringTime.String()
-				}(),
+
+			// Rules evaluated per bucket have an alert for every bucket not in normal state
+			if len(value.Buckets) > 0 {
+				for _, bucket := range value.Buckets {
+					alerts = append(alerts, ruleAlert(key, value, bucket.RuleState, bucket.Labels))
+				}
+				continue
 			}
 
-			alerts = append(alerts, alert)
+			alerts = append(alerts, ruleAlert(key, value, value.RuleState, nil))
+		}
+
+		if peers != nil && c.Query("aggregate") == "true" {
+			for _, body := range sharding.FetchPeers(c.UserContext(), peers, webserverAddr, "/api/rules") {
+				peerAlerts := struct {
+					Alerts []map[string]interface{} `json:"alerts"`
+				}{}
+				if body == nil || json.Unmarshal(body, &peerAlerts) != nil {
+					continue
+				}
+				alerts = append(alerts, peerAlerts.Alerts...)
+			}
 		}
 
 		return c.JSON(map[string]interface{}{
@@ -147,3 +155,29 @@ func getRulesJSON(rulesPool *pools.RulesStore) func(c *fiber.Ctx) error {
 		})
 	}
 }
+
+// ruleAlert renders the alert of a rule, or of one of its buckets, for the rules API endpoint
+func ruleAlert(key string, rule *pools.Rule, state pools.RuleState, bucketLabels map[string]string) map[string]interface{} {
+
+	labels := map[string]string{}
+	for name, value := range bucketLabels {
+		labels[name] = value
+	}
+	labels["alertname"] = key
+	labels["namespace"] = rule.SearchRule.Namespace
+
+	return map[string]interface{}{
+		"labels": labels,
+		"annotations": map[string]string{
+			"description": rule.SearchRule.Spec.Description,
+			"summary":     rule.SearchRule.Spec.Description,
+		},
+		"state": states[state.State],
+		"activeAt": func() string {
+			if state.FiringTime.IsZero() {
+				return ""
+			}
+			return state.FiringTime.String()
+		}(),
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webserver
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"freepik.com/searchruler/api/v1alpha1"
+	"freepik.com/searchruler/internal/pools"
+)
+
+func TestGetRulesJSONStates(t *testing.T) {
+	t.Parallel()
+	cases := map[string]string{
+		"PendingFiring":    "pending",
+		"PendingResolving": "pending",
+		"Firing":           "firing",
+		"Normal":           "resolved",
+		"Suspended":        "suspended",
+	}
+	rulesPool := &pools.RulesStore{Store: map[string]*pools.Rule{}}
+	for state := range cases {
+		rulesPool.Set("default_"+state, &pools.Rule{
+			SearchRule: v1alpha1.SearchRule{ObjectMeta: metav1.ObjectMeta{Name: state, Namespace: "default"}},
+			RuleState:  pools.RuleState{State: state},
+		})
+	}
+
+	app := fiber.New()
+	app.Get("/api/rules", getRulesJSON(rulesPool, nil, ""))
+	response, err := app.Test(httptest.NewRequest("GET", "/api/rules", nil))
+	if err != nil {
+		t.Fatalf("GET /api/rules: %v", err)
+	}
+	defer response.Body.Close()
+
+	body := struct {
+		Alerts []struct {
+			Labels map[string]string `json:"labels"`
+			State  string            `json:"state"`
+		} `json:"alerts"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(body.Alerts) != len(cases) {
+		t.Fatalf("got %d alerts, want %d", len(body.Alerts), len(cases))
+	}
+	for _, alert := range body.Alerts {
+		state := alert.Labels["alertname"][len("default_"):]
+		if alert.State != cases[state] {
+			t.Errorf("rule in state %s is %q, want %q", state, alert.State, cases[state])
+		}
+	}
+}